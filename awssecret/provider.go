@@ -0,0 +1,92 @@
+// Package awssecret provide connection string of datahub.Hub from AWS Secrets Manager
+//
+//	cfg, _ := config.LoadDefaultConfig(ctx)
+//	p := awssecret.New(secretsmanager.NewFromConfig(cfg), awssecret.Options{
+//		SecretID:        "prod/app/db",
+//		Template:        "postgres://{username}:{password}@{host}:{port}/{dbname}?sslmode=require",
+//		RefreshInterval: time.Hour,
+//	})
+//	err := h.UseConnStringProvider(p, datahub.ConnProviderOptions{})
+//
+// Secrets Manager does not report when rotated secret expires, so the secret is read every RefreshInterval and the
+// pool is rebuilt when it is changed. RefreshInterval should be shorter than time old credential is kept valid by
+// the rotation
+package awssecret
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ariefdarmawan/datahub"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Client is part of secretsmanager.Client used by the provider
+type Client interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// Options of the provider
+type Options struct {
+	// SecretID is name or ARN of the secret
+	SecretID string
+	// VersionStage is stage of the secret to be read, default is AWSCURRENT
+	VersionStage string
+	// Template is connection string having {field} placeholders replaced by fields of JSON secret, ie: secret of RDS
+	// has username, password, host, port and dbname. When it is empty, the secret string is the connection string
+	Template string
+	// RefreshInterval is how often the secret is read again, 0 means it is read once
+	RefreshInterval time.Duration
+	// Timeout of reading the secret, default is 10 seconds
+	Timeout time.Duration
+}
+
+// Provider implements datahub.ConnStringProvider reading secret from Secrets Manager
+type Provider struct {
+	client Client
+	opts   Options
+}
+
+// New create provider
+func New(client Client, opts Options) *Provider {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Provider{client: client, opts: opts}
+}
+
+// ConnString read the secret and returns connection string, expiry is time of next refresh
+func (p *Provider) ConnString() (string, time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+	defer cancel()
+
+	in := &secretsmanager.GetSecretValueInput{SecretId: aws.String(p.opts.SecretID)}
+	if p.opts.VersionStage != "" {
+		in.VersionStage = aws.String(p.opts.VersionStage)
+	}
+	out, err := p.client.GetSecretValue(ctx, in)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to read %s. %w", p.opts.SecretID, err)
+	}
+	if out.SecretString == nil || *out.SecretString == "" {
+		return "", time.Time{}, fmt.Errorf("secret %s has no string value", p.opts.SecretID)
+	}
+
+	connString := *out.SecretString
+	if p.opts.Template != "" {
+		values := map[string]interface{}{}
+		if err = json.Unmarshal([]byte(connString), &values); err != nil {
+			return "", time.Time{}, fmt.Errorf("secret %s is not JSON. %w", p.opts.SecretID, err)
+		}
+		connString = datahub.ExpandConnString(p.opts.Template, values)
+	}
+
+	var expiry time.Time
+	if p.opts.RefreshInterval > 0 {
+		expiry = time.Now().Add(p.opts.RefreshInterval)
+	}
+	return connString, expiry, nil
+}
@@ -0,0 +1,274 @@
+// Package bench run standard workloads against datahub.Hub and report throughput and latency, so configurations of
+// driver and pool could be compared
+//
+//	res, err := bench.Run(h, bench.Options{Records: 5000, Concurrency: 16})
+//	bench.Report(os.Stdout, res)
+//
+// Workloads use their own table, which is emptied before and after the run
+package bench
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/ariefdarmawan/datahub"
+)
+
+// DefaultTableName is name of table used by workloads when Options.Table is empty
+const DefaultTableName = "DatahubBench"
+
+// Workload is a standard workload
+type Workload string
+
+// Standard workloads, each operation of Insert, Get, Update and Delete works on one record, Scan reads ScanTake records
+const (
+	Insert Workload = "insert"
+	Get    Workload = "get"
+	Update Workload = "update"
+	Scan   Workload = "scan"
+	Delete Workload = "delete"
+)
+
+// DefaultWorkloads is workloads run when Options.Workloads is empty, in order
+var DefaultWorkloads = []Workload{Insert, Get, Update, Scan, Delete}
+
+// Options of a run
+type Options struct {
+	// Table is name of table used by the run, default is DefaultTableName
+	Table string
+	// Records is number of records inserted, default is 1000
+	Records int
+	// Operations is number of operations of Get, Update and Scan workloads, default is Records
+	Operations int
+	// Concurrency is number of goroutines running operations of a workload, default is 4
+	Concurrency int
+	// ScanTake is number of records read by an operation of Scan, default is 100
+	ScanTake int
+	// Workloads is workloads to be run in order, default is DefaultWorkloads. Insert is always run first when
+	// other workloads need records
+	Workloads []Workload
+}
+
+// Result is result of a workload
+type Result struct {
+	Workload Workload
+	Ops      int
+	Errors   int
+	// LastError is the last error of the workload, if any
+	LastError  error
+	Elapsed    time.Duration
+	Throughput float64
+	Min        time.Duration
+	Mean       time.Duration
+	P50        time.Duration
+	P90        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+}
+
+// Results is result of a run, including pool and concurrency counters of the hub after the run
+type Results struct {
+	Options     Options
+	Workloads   []Result
+	Pool        datahub.PoolConfig
+	Concurrency datahub.ConcurrencyStats
+}
+
+// Record is record used by workloads
+type Record struct {
+	orm.DataModelBase `bson:"-" json:"-" ecname:"-"`
+
+	ID      string    `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	Name    string    `bson:"name" json:"name" sqlname:"name"`
+	Value   float64   `bson:"value" json:"value" sqlname:"value"`
+	Seq     int       `bson:"seq" json:"seq" sqlname:"seq"`
+	Created time.Time `bson:"created" json:"created" sqlname:"created"`
+}
+
+func (r *Record) TableName() string {
+	return DefaultTableName
+}
+
+func (r *Record) SetID(keys ...interface{}) {
+	r.ID = keys[0].(string)
+}
+
+func recordID(i int) string {
+	return fmt.Sprintf("bench-%08d", i)
+}
+
+// Run run the workloads against h
+func Run(h *datahub.Hub, opts Options) (*Results, error) {
+	if opts.Table == "" {
+		opts.Table = DefaultTableName
+	}
+	if opts.Records <= 0 {
+		opts.Records = 1000
+	}
+	if opts.Operations <= 0 {
+		opts.Operations = opts.Records
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.ScanTake <= 0 {
+		opts.ScanTake = 100
+	}
+	if len(opts.Workloads) == 0 {
+		opts.Workloads = DefaultWorkloads
+	}
+
+	th := h.IntoTable(opts.Table)
+	if err := h.EnsureTable(opts.Table, []string{"_id"}, new(Record)); err != nil {
+		return nil, fmt.Errorf("fail bench: unable to prepare %s. %w", opts.Table, err)
+	}
+	clean := func() error {
+		return th.DeleteQuery(new(Record), dbflex.Ne("_id", ""))
+	}
+	if err := clean(); err != nil {
+		return nil, fmt.Errorf("fail bench: unable to clean %s. %w", opts.Table, err)
+	}
+	defer clean()
+
+	res := &Results{Options: opts}
+	inserted := false
+	for _, w := range opts.Workloads {
+		if w != Insert && w != Delete && !inserted {
+			res.Workloads = append(res.Workloads, run(Insert, opts.Records, opts.Concurrency, insertOp(th)))
+			inserted = true
+		}
+		var r Result
+		switch w {
+		case Insert:
+			if inserted {
+				continue
+			}
+			r = run(w, opts.Records, opts.Concurrency, insertOp(th))
+			inserted = true
+		case Get:
+			r = run(w, opts.Operations, opts.Concurrency, func(int) error {
+				return th.Get(&Record{ID: recordID(rand.Intn(opts.Records))})
+			})
+		case Update:
+			r = run(w, opts.Operations, opts.Concurrency, func(i int) error {
+				rec := newRecord(rand.Intn(opts.Records))
+				rec.Value = rand.Float64()
+				return th.Update(rec)
+			})
+		case Scan:
+			r = run(w, opts.Operations, opts.Concurrency, func(int) error {
+				recs := []Record{}
+				from := recordID(rand.Intn(opts.Records))
+				parm := dbflex.NewQueryParam().SetWhere(dbflex.Gte("_id", from)).SetSort("_id").SetTake(opts.ScanTake)
+				return th.Gets(new(Record), parm, &recs)
+			})
+		case Delete:
+			r = run(w, opts.Records, opts.Concurrency, func(i int) error {
+				return th.Delete(&Record{ID: recordID(i)})
+			})
+			inserted = false
+		default:
+			return res, fmt.Errorf("fail bench: unknown workload %s", w)
+		}
+		res.Workloads = append(res.Workloads, r)
+	}
+
+	res.Pool = h.PoolConfig()
+	res.Concurrency = h.ConcurrencyStats()
+	return res, nil
+}
+
+func newRecord(i int) *Record {
+	return &Record{ID: recordID(i), Name: fmt.Sprintf("record %d", i), Value: float64(i), Seq: i, Created: time.Now()}
+}
+
+func insertOp(h *datahub.Hub) func(int) error {
+	return func(i int) error {
+		return h.Insert(newRecord(i))
+	}
+}
+
+// run call fn n times using given number of goroutines, fn receives index of the operation
+func run(w Workload, n, concurrency int, fn func(i int) error) Result {
+	latencies := make([]time.Duration, n)
+	var (
+		next    int64 = -1
+		errs    int64
+		lastMtx sync.Mutex
+		lastErr error
+		wg      sync.WaitGroup
+	)
+
+	started := time.Now()
+	for g := 0; g < concurrency; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= n {
+					return
+				}
+				opStarted := time.Now()
+				err := fn(i)
+				latencies[i] = time.Since(opStarted)
+				if err != nil {
+					atomic.AddInt64(&errs, 1)
+					lastMtx.Lock()
+					lastErr = err
+					lastMtx.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	r := Result{Workload: w, Ops: n, Errors: int(errs), LastError: lastErr, Elapsed: time.Since(started)}
+	if r.Elapsed > 0 {
+		r.Throughput = float64(n) / r.Elapsed.Seconds()
+	}
+	if n == 0 {
+		return r
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, d := range latencies {
+		total += d
+	}
+	r.Min, r.Max, r.Mean = latencies[0], latencies[n-1], total/time.Duration(n)
+	r.P50, r.P90, r.P99 = percentile(latencies, 50), percentile(latencies, 90), percentile(latencies, 99)
+	return r
+}
+
+// percentile returns p-th percentile of sorted durations using nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Report write results as table
+func Report(w io.Writer, res *Results) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "workload\tops\terrors\tops/s\tmin\tmean\tp50\tp90\tp99\tmax\t\n")
+	for _, r := range res.Workloads {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\t%s\t\n", r.Workload, r.Ops, r.Errors, r.Throughput,
+			r.Min, r.Mean, r.P50, r.P90, r.P99, r.Max)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "pool size %d, timeout %s, concurrency %d, waited %s, rejected %d\n", res.Pool.Size,
+		res.Pool.Timeout, res.Options.Concurrency, res.Concurrency.Waited, res.Concurrency.Rejected)
+	return err
+}
@@ -0,0 +1,124 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// compareValues compare 2 values, returns -1 if a < b, 0 if a == b and 1 if a > b.
+// Numbers are compared as float64, time as time and others as string. Nil is lower than any value
+func compareValues(a, b interface{}) int {
+	a, b = indirectValue(a), indirectValue(b)
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			}
+			return 0
+		}
+	}
+
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+func indirectValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return nil
+	}
+	return rv.Interface()
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// recordValue returns value of a field of a record, record could be a struct, pointer to struct or map
+func recordValue(item reflect.Value, field string) interface{} {
+	for item.Kind() == reflect.Ptr || item.Kind() == reflect.Interface {
+		if item.IsNil() {
+			return nil
+		}
+		item = item.Elem()
+	}
+	switch item.Kind() {
+	case reflect.Map:
+		v := item.MapIndex(reflect.ValueOf(field))
+		if !v.IsValid() {
+			return nil
+		}
+		return v.Interface()
+	case reflect.Struct:
+		v := fieldByDbName(item, field)
+		if !v.IsValid() {
+			return nil
+		}
+		return v.Interface()
+	}
+	return nil
+}
+
+// sortRecords sort slice of records by given fields, prefix field with - for descending sort
+func sortRecords(slice reflect.Value, fields []string) {
+	if len(fields) == 0 {
+		return
+	}
+	sort.SliceStable(slice.Interface(), func(i, j int) bool {
+		a, b := slice.Index(i), slice.Index(j)
+		for _, f := range fields {
+			desc := strings.HasPrefix(f, "-")
+			f = strings.TrimPrefix(f, "-")
+			c := compareValues(recordValue(a, f), recordValue(b, f))
+			if c == 0 {
+				continue
+			}
+			if desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
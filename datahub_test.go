@@ -1,12 +1,19 @@
 package datahub_test
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"git.kanosolution.net/kano/dbflex"
 	"git.kanosolution.net/kano/dbflex/orm"
 	"github.com/ariefdarmawan/datahub"
+	"github.com/ariefdarmawan/datahub/gql"
 
 	_ "github.com/ariefdarmawan/flexpg"
 	"github.com/eaciit/toolkit"
@@ -383,3 +390,685 @@ func (d *Dummy) TableName() string {
 func (d *Dummy) SetID(keys ...interface{}) {
 	d.ID = keys[0].(string)
 }
+
+func TestHubLock(t *testing.T) {
+	h := datahub.NewHub(getConn, true, 10)
+	defer h.Close()
+
+	cv.Convey("acquire lock", t, func() {
+		l1, err := h.AcquireLock("job-lock", 5*time.Second)
+		cv.So(err, cv.ShouldBeNil)
+
+		cv.Convey("lock held by other owner", func() {
+			_, err := h.AcquireLock("job-lock", 5*time.Second)
+			cv.So(err, cv.ShouldEqual, datahub.ErrLockHeld)
+
+			cv.Convey("release and reacquire with higher token", func() {
+				cv.So(l1.Release(), cv.ShouldBeNil)
+				l2, err := h.AcquireLock("job-lock", 5*time.Second)
+				cv.So(err, cv.ShouldBeNil)
+				cv.So(l2.Token, cv.ShouldBeGreaterThan, l1.Token)
+				l2.Release()
+			})
+		})
+	})
+}
+
+func TestHubSequence(t *testing.T) {
+	h := datahub.NewHub(getConn, true, 10)
+	defer h.Close()
+
+	cv.Convey("next value", t, func() {
+		h.RegisterSequence(datahub.Sequence{Name: "test-seq", BlockSize: 5, Format: "INV-{n:6}"})
+		v1, err := h.NextVal("test-seq")
+		cv.So(err, cv.ShouldBeNil)
+		v2, err := h.NextVal("test-seq")
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(v2, cv.ShouldEqual, v1+1)
+
+		cv.Convey("formatted number", func() {
+			n, err := h.NextNumber("test-seq")
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(n, cv.ShouldEqual, fmt.Sprintf("INV-%06d", v2+1))
+		})
+	})
+}
+
+func TestSplitStatements(t *testing.T) {
+	cv.Convey("split script", t, func() {
+		stmts := datahub.SplitStatements(`create table a(x text); -- note; here
+insert into a values ('x;''y');
+/* block; */ do $f$ begin; end $f$;
+-- trailing comment`)
+		cv.So(len(stmts), cv.ShouldEqual, 3)
+		cv.So(stmts[1], cv.ShouldEndWith, "insert into a values ('x;''y')")
+		cv.So(stmts[2], cv.ShouldEndWith, "do $f$ begin; end $f$")
+	})
+}
+
+func TestParseQuery(t *testing.T) {
+	cv.Convey("parse url query", t, func() {
+		q, _ := url.ParseQuery("status=open&amount[gte]=100&code[in]=a,b&sort=-created&page=2&pagesize=20")
+		parm, err := datahub.ParseQuery(q, []string{"status", "amount", "code", "created"})
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(parm.Skip, cv.ShouldEqual, 20)
+		cv.So(parm.Take, cv.ShouldEqual, 20)
+		cv.So(parm.Sort, cv.ShouldResemble, []string{"-created"})
+		cv.So(len(parm.Where.Items), cv.ShouldEqual, 3)
+
+		cv.Convey("reject field outside allowlist", func() {
+			q, _ := url.ParseQuery("password[startwith]=a")
+			_, err := datahub.ParseQuery(q, []string{"status"})
+			cv.So(err, cv.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseFilterExpr(t *testing.T) {
+	opts := datahub.FilterExprOptions{AllowedFields: []string{"status", "amount", "name", "created"}}
+
+	cv.Convey("parse filter expression", t, func() {
+		f, err := datahub.ParseFilterExpr("status eq 'open' and (amount gt 100 or contains(name, 'jo'))", opts)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(f.Op, cv.ShouldEqual, dbflex.OpAnd)
+		cv.So(len(f.Items), cv.ShouldEqual, 2)
+		cv.So(f.Items[0].Value, cv.ShouldEqual, "open")
+		cv.So(f.Items[1].Op, cv.ShouldEqual, dbflex.OpOr)
+
+		cv.Convey("parse values", func() {
+			created, _ := time.Parse(time.RFC3339, "2024-01-02T03:04:05Z")
+			cases := []struct {
+				expr  string
+				op    dbflex.FilterOp
+				value interface{}
+			}{
+				{"amount ge 1.5", dbflex.OpGte, 1.5},
+				{"AMOUNT LE -10", dbflex.OpLte, int64(-10)},
+				{"created lt 2024-01-02T03:04:05Z", dbflex.OpLt, created},
+				{"status ne null", dbflex.OpNe, nil},
+				{"status in ('a', 'b')", dbflex.OpIn, []interface{}{"a", "b"}},
+				{"startswith(name, 'jo')", dbflex.OpStartWith, nil},
+			}
+			for _, c := range cases {
+				f, err := datahub.ParseFilterExpr(c.expr, opts)
+				cv.So(err, cv.ShouldBeNil)
+				cv.So(f.Op, cv.ShouldEqual, c.op)
+				if c.op != dbflex.OpStartWith {
+					cv.So(f.Value, cv.ShouldResemble, c.value)
+				}
+			}
+		})
+
+		cv.Convey("keep injected text as a value", func() {
+			f, err := datahub.ParseFilterExpr("name eq 'O''Brien''; drop table users; --'", opts)
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(f.Op, cv.ShouldEqual, dbflex.OpEq)
+			cv.So(f.Field, cv.ShouldEqual, "name")
+			cv.So(f.Value, cv.ShouldEqual, "O'Brien'; drop table users; --")
+		})
+
+		cv.Convey("empty expression returns nil filter", func() {
+			f, err := datahub.ParseFilterExpr("   ", opts)
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(f, cv.ShouldBeNil)
+		})
+
+		cv.Convey("reject malformed and injected expressions", func() {
+			cases := []string{
+				"password eq 'x'",
+				"contains(password, 'x')",
+				"status eq 'open'; drop table users",
+				"status eq 'x' -- comment",
+				"status eq 1 = 1",
+				"status eq 'open",
+				"status eq",
+				"status eq 'open' or",
+				"(status eq 'open'",
+				"status eq 'open')",
+				"status like 'a%'",
+				"status eq open",
+				"status in ()",
+				"amount gt 12abc",
+				"contains(name, 1)",
+				"not not not not not not status eq 'open'",
+				strings.Repeat("a", 2001),
+			}
+			for _, expr := range cases {
+				_, err := datahub.ParseFilterExpr(expr, opts)
+				cv.So(err, cv.ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestFilterFromM(t *testing.T) {
+	cv.Convey("build filter from document", t, func() {
+		f, err := datahub.FilterFromM(toolkit.M{
+			"status": "open",
+			"age":    toolkit.M{"$gte": 17, "$lt": 60},
+			"$or":    []interface{}{toolkit.M{"city": "Jakarta"}, map[string]interface{}{"city": toolkit.M{"$in": []interface{}{"Bandung", "Bogor"}}}},
+		})
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(f.Op, cv.ShouldEqual, dbflex.OpAnd)
+		cv.So(len(f.Items), cv.ShouldEqual, 3)
+
+		cv.Convey("keep injected text as a value", func() {
+			f, err := datahub.FilterFromM(toolkit.M{"name": "x' or '1'='1"})
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(f.Op, cv.ShouldEqual, dbflex.OpEq)
+			cv.So(f.Field, cv.ShouldEqual, "name")
+			cv.So(f.Value, cv.ShouldEqual, "x' or '1'='1")
+		})
+
+		cv.Convey("empty document returns nil filter", func() {
+			f, err := datahub.FilterFromM(toolkit.M{})
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(f, cv.ShouldBeNil)
+		})
+
+		cv.Convey("reject malformed and injected documents", func() {
+			cases := []toolkit.M{
+				{"$where": "sleep(1000)"},
+				{"$or": toolkit.M{"city": "Jakarta"}},
+				{"$and": []interface{}{"city"}},
+				{"$not": "city"},
+				{"age": toolkit.M{"$regex": ".*"}},
+				{"age": toolkit.M{"$in": "a,b"}},
+				{"name = name; drop table users; --": "x"},
+				{"name) or (1": 1},
+				{"": "x"},
+				{"$or": []interface{}{toolkit.M{"a b": 1}}},
+			}
+			for _, c := range cases {
+				_, err := datahub.FilterFromM(c)
+				cv.So(err, cv.ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestQueryParamFromM(t *testing.T) {
+	cv.Convey("build query param from document", t, func() {
+		parm, err := datahub.QueryParamFromM(toolkit.M{
+			"where":      toolkit.M{"status": "open"},
+			"select":     []interface{}{"status", "amount"},
+			"sort":       "-amount,status",
+			"skip":       float64(10),
+			"take":       5,
+			"groupby":    []string{"status"},
+			"aggregates": []interface{}{toolkit.M{"op": "sum", "field": "amount", "alias": "total"}},
+		})
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(parm.Where.Field, cv.ShouldEqual, "status")
+		cv.So(parm.Select, cv.ShouldResemble, []string{"status", "amount"})
+		cv.So(parm.Sort, cv.ShouldResemble, []string{"-amount", "status"})
+		cv.So(parm.Skip, cv.ShouldEqual, 10)
+		cv.So(parm.Take, cv.ShouldEqual, 5)
+		cv.So(len(parm.Aggregates), cv.ShouldEqual, 1)
+		cv.So(parm.Aggregates[0].Op, cv.ShouldEqual, dbflex.AggrSum)
+
+		cv.Convey("reject malformed and injected documents", func() {
+			cases := []toolkit.M{
+				{"where": toolkit.M{"$bad": 1}},
+				{"select": "status, (select password from users)"},
+				{"sort": []interface{}{"amount; drop table users"}},
+				{"groupby": "status)--"},
+				{"aggregates": []interface{}{"sum"}},
+				{"aggregates": []interface{}{toolkit.M{"op": "median", "field": "amount"}}},
+				{"aggregates": []interface{}{toolkit.M{"op": "sum", "field": "amount) from users --"}}},
+				{"aggregates": []interface{}{toolkit.M{"op": "sum", "field": "amount", "alias": "x\"; drop"}}},
+			}
+			for _, c := range cases {
+				_, err := datahub.QueryParamFromM(c)
+				cv.So(err, cv.ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestMatchFilter(t *testing.T) {
+	cv.Convey("match filter against record", t, func() {
+		created := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+		rec := toolkit.M{"status": "open", "amount": 150, "name": "John", "created": created, "tags": nil}
+
+		cases := []struct {
+			name  string
+			f     *dbflex.Filter
+			match bool
+		}{
+			{"nil filter", nil, true},
+			{"eq", dbflex.Eq("status", "open"), true},
+			{"eq number of other type", dbflex.Eq("amount", 150.0), true},
+			{"ne", dbflex.Ne("status", "open"), false},
+			{"gt", dbflex.Gt("amount", 100), true},
+			{"lte time", dbflex.Lte("created", created), true},
+			{"range", &dbflex.Filter{Field: "amount", Op: dbflex.OpRange, Value: []interface{}{100, 200}}, true},
+			{"in", dbflex.In("status", "draft", "open"), true},
+			{"nin", dbflex.Nin("status", "draft", "open"), false},
+			{"contains is case insensitive", dbflex.Contains("name", "OH"), true},
+			{"startwith", dbflex.StartWith("name", "Jo"), true},
+			{"endwith", dbflex.EndWith("name", "hn"), true},
+			{"and", dbflex.And(dbflex.Eq("status", "open"), dbflex.Gt("amount", 200)), false},
+			{"or", dbflex.Or(dbflex.Eq("status", "closed"), dbflex.Gt("amount", 100)), true},
+			{"not", dbflex.Not(dbflex.Eq("status", "open")), false},
+			{"missing field", dbflex.Eq("owner", "John"), false},
+			{"nil value is lower than any value", dbflex.Gt("tags", 0), false},
+			{"injected text is compared as text", dbflex.Eq("status", "x' or '1'='1"), false},
+			{"not without item", &dbflex.Filter{Op: dbflex.OpNot}, false},
+			{"range with single bound", &dbflex.Filter{Field: "amount", Op: dbflex.OpRange, Value: []interface{}{100}}, false},
+			{"unknown operator", &dbflex.Filter{Field: "status", Op: "$regex", Value: ".*"}, false},
+		}
+		for _, c := range cases {
+			c := c
+			cv.Convey(c.name, func() {
+				cv.So(datahub.MatchFilter(c.f, rec), cv.ShouldEqual, c.match)
+			})
+		}
+	})
+}
+
+func TestGqlQueryParamFromArgs(t *testing.T) {
+	cv.Convey("translate graphql arguments", t, func() {
+		parm, err := gql.QueryParamFromArgs(map[string]interface{}{
+			"filter": map[string]interface{}{
+				"status": map[string]interface{}{"eq": "open"},
+				"or":     []interface{}{map[string]interface{}{"city": map[string]interface{}{"in": []interface{}{"Bogor"}}}},
+			},
+			"orderBy": []interface{}{map[string]interface{}{"field": "created", "direction": "DESC"}, "name"},
+			"first":   10,
+			"after":   gql.EncodeCursor(19),
+		})
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(parm.Where.Op, cv.ShouldEqual, dbflex.OpAnd)
+		cv.So(parm.Sort, cv.ShouldResemble, []string{"-created", "name"})
+		cv.So(parm.Take, cv.ShouldEqual, 10)
+		cv.So(parm.Skip, cv.ShouldEqual, 20)
+
+		cv.Convey("use default first", func() {
+			parm, err := gql.QueryParamFromArgs(map[string]interface{}{})
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(parm.Where, cv.ShouldBeNil)
+			cv.So(parm.Take, cv.ShouldEqual, gql.DefaultFirst)
+			cv.So(parm.Skip, cv.ShouldEqual, 0)
+		})
+
+		cv.Convey("reject malformed and injected arguments", func() {
+			cases := []map[string]interface{}{
+				{"first": -1},
+				{"first": "ten"},
+				{"after": "not a cursor"},
+				{"after": gql.EncodeCursor(-5)},
+				{"orderBy": []interface{}{1}},
+				{"orderBy": []interface{}{map[string]interface{}{"direction": "desc"}}},
+				{"orderBy": "name; drop table users"},
+				{"orderBy": []interface{}{map[string]interface{}{"field": "name desc, (select 1)"}}},
+				{"filter": map[string]interface{}{"status": map[string]interface{}{"regex": ".*"}}},
+				{"filter": map[string]interface{}{"name; drop table users": map[string]interface{}{"eq": 1}}},
+			}
+			for _, c := range cases {
+				_, err := gql.QueryParamFromArgs(c)
+				cv.So(err, cv.ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestGqlPaginate(t *testing.T) {
+	h := datahub.NewHub(getConn, true, 10)
+	defer h.Close()
+
+	cv.Convey("paginate records", t, func() {
+		h.DeleteQuery(NewDummy(1), nil)
+		for i := 1; i <= 5; i++ {
+			cv.So(h.Insert(NewDummy(i)), cv.ShouldBeNil)
+		}
+
+		args := map[string]interface{}{"orderBy": []interface{}{"Ref1"}, "first": 2}
+		page, err := gql.Paginate[*Dummy](h, NewDummy(1), args)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(len(page.Edges), cv.ShouldEqual, 2)
+		cv.So(page.Edges[0].Node.Ref1, cv.ShouldEqual, 1)
+		cv.So(page.PageInfo.HasNextPage, cv.ShouldBeTrue)
+		cv.So(page.PageInfo.HasPreviousPage, cv.ShouldBeFalse)
+
+		cv.Convey("continue from end cursor", func() {
+			args["after"] = page.PageInfo.EndCursor
+			next, err := gql.Paginate[*Dummy](h, NewDummy(1), args)
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(next.Edges[0].Node.Ref1, cv.ShouldEqual, 3)
+			cv.So(next.PageInfo.HasPreviousPage, cv.ShouldBeTrue)
+		})
+
+		cv.Convey("last page has no next page", func() {
+			args["after"] = gql.EncodeCursor(3)
+			last, err := gql.Paginate[*Dummy](h, NewDummy(1), args)
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(len(last.Edges), cv.ShouldEqual, 1)
+			cv.So(last.Edges[0].Node.Ref1, cv.ShouldEqual, 5)
+			cv.So(last.PageInfo.HasNextPage, cv.ShouldBeFalse)
+		})
+	})
+}
+
+func TestGqlLoader(t *testing.T) {
+	h := datahub.NewHub(getConn, true, 10)
+	defer h.Close()
+
+	cv.Convey("load records in batch", t, func() {
+		h.DeleteQuery(NewDummy(1), nil)
+		for i := 1; i <= 3; i++ {
+			cv.So(h.Insert(NewDummy(i)), cv.ShouldBeNil)
+		}
+
+		l := gql.NewLoader[Dummy](h, NewDummy(1).TableName(), "Ref1")
+		res := make([]*Dummy, 4)
+		errs := make([]error, 4)
+		wg := new(sync.WaitGroup)
+		for i := range res {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				res[i], errs[i] = l.Load(i + 1)
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 0; i < 3; i++ {
+			cv.So(errs[i], cv.ShouldBeNil)
+			cv.So(res[i].ID, cv.ShouldEqual, fmt.Sprintf("User-%d", i+1))
+		}
+		cv.So(errs[3], cv.ShouldBeNil)
+		cv.So(res[3], cv.ShouldBeNil)
+
+		cv.Convey("reject unknown field", func() {
+			l := gql.NewLoader[Dummy](h, NewDummy(1).TableName(), "Ref1; drop table users")
+			_, err := l.Load(1)
+			cv.So(err, cv.ShouldNotBeNil)
+		})
+	})
+}
+
+func TestUpsertMany(t *testing.T) {
+	h := datahub.NewHub(getConn, true, 10)
+	defer h.Close()
+
+	cv.Convey("upsert models", t, func() {
+		h.DeleteQuery(NewDummy(1), nil)
+		res, err := h.UpsertMany([]*Dummy{NewDummy(1), NewDummy(2)}, nil)
+		cv.So(err, cv.ShouldBeNil)
+		cv.So(res[0].Outcome, cv.ShouldEqual, datahub.UpsertInserted)
+		cv.So(res[1].Outcome, cv.ShouldEqual, datahub.UpsertInserted)
+
+		cases := []struct {
+			name     string
+			strategy datahub.ConflictStrategy
+			value    string
+			outcome  string
+			expected string
+		}{
+			{"merge", datahub.ConflictMerge, "Merged", datahub.UpsertUpdated, "Merged"},
+			{"replace", datahub.ConflictReplace, "Replaced", datahub.UpsertUpdated, "Replaced"},
+			{"skip", datahub.ConflictSkip, "Skipped", datahub.UpsertSkipped, "Employee 1"},
+			{"quote is written as text", datahub.ConflictMerge, "x'); drop table DatahubTestTable; --", datahub.UpsertUpdated,
+				"x'); drop table DatahubTestTable; --"},
+			{"backslash is written as text", datahub.ConflictMerge, `a\' or 1=1 --`, datahub.UpsertUpdated, `a\' or 1=1 --`},
+		}
+		for _, c := range cases {
+			c := c
+			cv.Convey(c.name, func() {
+				d := NewDummy(1)
+				d.Name = c.value
+				res, err := h.UpsertMany([]*Dummy{d}, nil, datahub.OnConflict(c.strategy))
+				cv.So(err, cv.ShouldBeNil)
+				cv.So(res[0].Outcome, cv.ShouldEqual, c.outcome)
+
+				got := NewDummy(1)
+				cv.So(h.Get(got), cv.ShouldBeNil)
+				cv.So(got.Name, cv.ShouldEqual, c.expected)
+			})
+		}
+
+		cv.Convey("last row of duplicate keys in a batch wins", func() {
+			d1, d2 := NewDummy(3), NewDummy(3)
+			d1.Name, d2.Name = "First", "Last"
+			res, err := h.UpsertMany([]*Dummy{d1, NewDummy(4), d2}, nil)
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(res[0].Outcome, cv.ShouldEqual, datahub.UpsertSkipped)
+			cv.So(res[1].Outcome, cv.ShouldEqual, datahub.UpsertInserted)
+			cv.So(res[2].Outcome, cv.ShouldEqual, datahub.UpsertInserted)
+
+			got := NewDummy(3)
+			cv.So(h.Get(got), cv.ShouldBeNil)
+			cv.So(got.Name, cv.ShouldEqual, "Last")
+		})
+
+		cv.Convey("write in batches", func() {
+			models := []*Dummy{}
+			for i := 1; i <= 5; i++ {
+				models = append(models, NewDummy(i))
+			}
+			res, err := h.UpsertMany(models, nil, datahub.UpsertBatchSize(2))
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(len(res), cv.ShouldEqual, 5)
+			cv.So(res[1].Outcome, cv.ShouldEqual, datahub.UpsertUpdated)
+			cv.So(res[4].Outcome, cv.ShouldEqual, datahub.UpsertInserted)
+		})
+
+		cv.Convey("reject malformed models", func() {
+			_, err := h.UpsertMany(NewDummy(1), nil)
+			cv.So(err, cv.ShouldNotBeNil)
+			_, err = h.UpsertMany([]string{"User-1"}, nil)
+			cv.So(err, cv.ShouldNotBeNil)
+			res, err := h.UpsertMany([]*Dummy{}, nil)
+			cv.So(err, cv.ShouldBeNil)
+			cv.So(len(res), cv.ShouldEqual, 0)
+		})
+	})
+}
+
+type ValidAddress struct {
+	City string `validate:"required"`
+}
+
+type validCustomer struct {
+	*ValidAddress
+	Name   string   `validate:"required,max=5"`
+	Email  string   `validate:"email"`
+	Status string   `validate:"oneof=open closed"`
+	Tags   []string `validate:"min=1"`
+	Age    int      `validate:"min=17,max=60"`
+	Code   string   `validate:"len=3"`
+	Note   string   `validate:"min=abc,unknown"`
+}
+
+type validOrder struct {
+	Total int `validate:"min=1"`
+}
+
+func (o *validOrder) Validate() error {
+	if o.Total > 100 {
+		return errors.New("total is over limit")
+	}
+	return nil
+}
+
+func TestValidateModel(t *testing.T) {
+	valid := func() *validCustomer {
+		return &validCustomer{Name: "John", Email: "john@mail.com", Status: "open", Tags: []string{"a"}, Age: 20, Code: "ABC"}
+	}
+
+	cv.Convey("validate model", t, func() {
+		cases := []struct {
+			name   string
+			data   interface{}
+			errors []string
+		}{
+			{"valid model", valid(), nil},
+			{"nil model", (*validCustomer)(nil), nil},
+			{"not a struct", "John", nil},
+			{"required", func() *validCustomer { c := valid(); c.Name = ""; return c }(), []string{"Name:required"}},
+			{"max counts characters", func() *validCustomer { c := valid(); c.Name = "Jöhnà"; return c }(), nil},
+			{"max", func() *validCustomer { c := valid(); c.Name = "Johnny"; return c }(), []string{"Name:max"}},
+			{"min of slice", func() *validCustomer { c := valid(); c.Tags = nil; return c }(), []string{"Tags:min"}},
+			{"min and max of number", func() *validCustomer { c := valid(); c.Age = 61; return c }(), []string{"Age:max"}},
+			{"len", func() *validCustomer { c := valid(); c.Code = "AB"; return c }(), []string{"Code:len"}},
+			{"email", func() *validCustomer { c := valid(); c.Email = "john@mail.com'; drop table users; --"; return c }(),
+				[]string{"Email:email"}},
+			{"oneof", func() *validCustomer { c := valid(); c.Status = "open' or '1'='1"; return c }(), []string{"Status:oneof"}},
+			{"all invalid fields are reported", func() *validCustomer { c := valid(); c.Name, c.Age = "", 1; return c }(),
+				[]string{"Name:required", "Age:min"}},
+			{"embedded pointer is validated when set", func() *validCustomer { c := valid(); c.ValidAddress = &ValidAddress{}; return c }(),
+				[]string{"City:required"}},
+			{"custom validation", &validOrder{Total: 101}, []string{":custom"}},
+			{"custom validation with field rule", &validOrder{Total: 0}, []string{"Total:min"}},
+		}
+
+		for _, c := range cases {
+			c := c
+			cv.Convey(c.name, func() {
+				err := datahub.ValidateModel(c.data)
+				if len(c.errors) == 0 {
+					cv.So(err, cv.ShouldBeNil)
+					return
+				}
+
+				verr, ok := err.(*datahub.ValidationError)
+				cv.So(ok, cv.ShouldBeTrue)
+				got := []string{}
+				for _, fe := range verr.Errors {
+					got = append(got, fe.Field+":"+fe.Rule)
+				}
+				cv.So(got, cv.ShouldResemble, c.errors)
+			})
+		}
+	})
+}
+
+func prepareBenchData(b *testing.B, h *datahub.Hub) {
+	h.DeleteQuery(NewDummy(1), nil)
+	for i := 1; i <= 1000; i++ {
+		if err := h.Insert(NewDummy(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGets(b *testing.B) {
+	h := datahub.NewHub(getConn, true, 10)
+	defer h.Close()
+	prepareBenchData(b, h)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		res := []*Dummy{}
+		if err := h.Gets(NewDummy(1), nil, &res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetsInto(b *testing.B) {
+	h := datahub.NewHub(getConn, true, 10)
+	defer h.Close()
+	prepareBenchData(b, h)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	res := []*Dummy{}
+	for i := 0; i < b.N; i++ {
+		if err := h.GetsInto(NewDummy(1), nil, &res); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPopulateInto(b *testing.B) {
+	h := datahub.NewHub(getConn, true, 10)
+	defer h.Close()
+	prepareBenchData(b, h)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	res := []toolkit.M{}
+	for i := 0; i < b.N; i++ {
+		if _, err := h.PopulateInto(dbflex.From(NewDummy(1).TableName()).Select(), &res); err != nil {
+			b.Fatal(err)
+		}
+	}
+	datahub.ReleaseMaps(res...)
+}
+
+func TestMaxTake(t *testing.T) {
+	h := datahub.NewHub(getConn, true, 10).SetMaxTake(2)
+	defer h.Close()
+
+	cv.Convey("max take", t, func() {
+		h.DeleteQuery(NewDummy(1), nil)
+		for i := 1; i <= 3; i++ {
+			cv.So(h.Insert(NewDummy(i)), cv.ShouldBeNil)
+		}
+
+		cv.Convey("query without take is capped", func() {
+			res := []*Dummy{}
+			cv.So(h.Gets(NewDummy(0), nil, &res), cv.ShouldBeNil)
+			cv.So(len(res), cv.ShouldEqual, 2)
+		})
+
+		cv.Convey("take over max take is rejected", func() {
+			res := []*Dummy{}
+			err := h.Gets(NewDummy(0), dbflex.NewQueryParam().SetTake(3), &res)
+			var gerr *datahub.GuardError
+			cv.So(errors.As(err, &gerr), cv.ShouldBeTrue)
+		})
+
+		cv.Convey("populate over max take is rejected", func() {
+			res := []toolkit.M{}
+			_, err := h.Populate(dbflex.From(NewDummy(0).TableName()).Select(), &res)
+			var gerr *datahub.GuardError
+			cv.So(errors.As(err, &gerr), cv.ShouldBeTrue)
+		})
+	})
+}
+
+type metaCacheModel struct {
+	ID   string `json:"_id" key:"1"`
+	Name string `json:"name"`
+}
+
+func TestMetaCache(t *testing.T) {
+	cv.Convey("metadata cache", t, func() {
+		cv.Convey("metadata is computed once for each type", func() {
+			m := datahub.MetaOf(new(metaCacheModel))
+			cv.So(m, cv.ShouldNotBeNil)
+			cv.So(datahub.MetaOf(metaCacheModel{}), cv.ShouldEqual, m)
+			cv.So(datahub.MetaOf(reflect.TypeOf(metaCacheModel{})), cv.ShouldEqual, m)
+			cv.So(m.Field("name"), cv.ShouldEqual, m.Field("Name"))
+			cv.So(datahub.MetaOf(new(Dummy)), cv.ShouldNotEqual, m)
+		})
+
+		cv.Convey("concurrent calls get the same metadata", func() {
+			type concurrentModel struct {
+				ID string `key:"1"`
+			}
+			metas := make([]*datahub.ModelMeta, 50)
+			wg := new(sync.WaitGroup)
+			for i := range metas {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					metas[i] = datahub.MetaOf(new(concurrentModel))
+				}(i)
+			}
+			wg.Wait()
+			for _, m := range metas {
+				cv.So(m, cv.ShouldEqual, metas[0])
+			}
+		})
+
+		cv.Convey("non struct has no metadata", func() {
+			cv.So(datahub.MetaOf("text"), cv.ShouldBeNil)
+			cv.So(datahub.MetaOf(nil), cv.ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,117 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+	"github.com/shopspring/decimal"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DecimalTag is struct tag defining scale of decimal.Decimal field, value is rounded to the scale before being written,
+// ie: Amount decimal.Decimal `decimal:"2"`
+//
+// Models having decimal.Decimal field are encoded and decoded by the hub. Decimal is stored as Decimal128 on mongo and
+// as text on SQL drivers, so it is kept exact on NUMERIC/DECIMAL column. On read, Decimal128, text and numbers are
+// accepted, so money value never go through float64 unless the column itself is float
+const DecimalTag = "decimal"
+
+var decimalType = reflect.TypeOf(decimal.Decimal{})
+
+// toDecimal convert value returned by the driver into decimal
+func toDecimal(v interface{}) (decimal.Decimal, error) {
+	switch o := indirectValue(v).(type) {
+	case nil:
+		return decimal.Zero, nil
+	case decimal.Decimal:
+		return o, nil
+	case primitive.Decimal128:
+		return decimal.NewFromString(o.String())
+	case string:
+		return decimal.NewFromString(strings.TrimSpace(o))
+	case []byte:
+		return decimal.NewFromString(strings.TrimSpace(string(o)))
+	case json.Number:
+		return decimal.NewFromString(o.String())
+	case int:
+		return decimal.NewFromInt(int64(o)), nil
+	case int32:
+		return decimal.NewFromInt32(o), nil
+	case int64:
+		return decimal.NewFromInt(o), nil
+	case float32:
+		return decimal.NewFromFloat32(o), nil
+	case float64:
+		return decimal.NewFromFloat(o), nil
+	}
+	return decimal.Zero, fmt.Errorf("can't convert %T into decimal", v)
+}
+
+// decimalValue returns decimal value to be written by the driver of conn
+func decimalValue(conn dbflex.IConnection, d decimal.Decimal) (interface{}, error) {
+	if conn != nil && isSQLDriver(conn) {
+		return d.String(), nil
+	}
+	return primitive.ParseDecimal128(d.String())
+}
+
+// roundDecimal round decimal value of a field to its scale defined by DecimalTag
+func roundDecimal(f *FieldMeta, v interface{}) interface{} {
+	if p, ok := v.(*decimal.Decimal); ok && p != nil {
+		v = *p
+	}
+	d, ok := v.(decimal.Decimal)
+	if !ok {
+		return v
+	}
+	scale, err := strconv.Atoi(f.Tag.Get(DecimalTag))
+	if err != nil {
+		return v
+	}
+	return d.Round(int32(scale))
+}
+
+// isDecimalField returns true if field is decimal.Decimal or pointer to it
+func isDecimalField(f *FieldMeta) bool {
+	return f.Type == decimalType || (f.Type.Kind() == reflect.Ptr && f.Type.Elem() == decimalType)
+}
+
+// SumDecimal returns sum of a decimal field of the model filtered by where. The sum is computed by the database and
+// returned as decimal, so it is exact when the field is stored as Decimal128 or NUMERIC
+func (h *Hub) SumDecimal(data orm.DataModel, field string, where *dbflex.Filter) (decimal.Decimal, error) {
+	data.SetThis(data)
+	const alias = "datahubsum"
+	parm := dbflex.NewQueryParam().SetAggr(dbflex.NewAggrItem(alias, dbflex.AggrSum, field))
+	if where != nil {
+		parm.SetWhere(where)
+	}
+
+	ms := []toolkit.M{}
+	if err := h.internal().PopulateByParm(data.TableName(), parm, &ms); err != nil {
+		return decimal.Zero, fmt.Errorf("fail SumDecimal: %w", err)
+	}
+	if len(ms) == 0 {
+		return decimal.Zero, nil
+	}
+	d, err := toDecimal(ms[0].Get(alias))
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("fail SumDecimal: %w", err)
+	}
+	return d, nil
+}
+
+// GetDecimal returns value of the field as decimal
+func (r Record) GetDecimal(path string) decimal.Decimal {
+	v, ok := r.Lookup(path)
+	if !ok {
+		return decimal.Zero
+	}
+	d, _ := toDecimal(v)
+	return d
+}
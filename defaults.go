@@ -0,0 +1,147 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTag is struct tag holding default value of a field, applied on Insert when the field has zero value.
+// Beside literal value following expressions are supported:
+//
+//	now()       current time, for time.Time field
+//	today()     current date without time, for time.Time field
+//	uuid()      new UUIDv7
+//	seq(name)   next value of sequence name, formatted using format of the sequence for string field
+const DefaultTag = "default"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// applyDefaults fill zero value fields having default tag
+func (h *Hub) applyDefaults(data interface{}) error {
+	rv := reflect.ValueOf(data)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	for _, f := range MetaOf(rv.Type()).Fields {
+		if !f.HasDefault {
+			continue
+		}
+		fv := f.Value(rv)
+		if !fv.CanSet() || !fv.IsZero() {
+			continue
+		}
+		if err := h.setDefault(fv, f.Default); err != nil {
+			return fmt.Errorf("default of field %s. %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (h *Hub) setDefault(fv reflect.Value, expr string) error {
+	target := fv
+	if fv.Kind() == reflect.Ptr {
+		target = reflect.New(fv.Type().Elem()).Elem()
+	}
+
+	var err error
+	switch {
+	case expr == "now()" || expr == "today()":
+		if target.Type() != timeType {
+			return fmt.Errorf("%s need time.Time field", expr)
+		}
+		now := time.Now()
+		if expr == "today()" {
+			now = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		}
+		target.Set(reflect.ValueOf(now))
+
+	case expr == "uuid()":
+		if target.Kind() != reflect.String {
+			return fmt.Errorf("%s need string field", expr)
+		}
+		target.SetString(NewUUIDv7().(string))
+
+	case strings.HasPrefix(expr, "seq(") && strings.HasSuffix(expr, ")"):
+		name := strings.TrimSpace(expr[4 : len(expr)-1])
+		if target.Kind() == reflect.String {
+			var s string
+			if s, err = h.NextNumber(name); err == nil {
+				target.SetString(s)
+			}
+		} else {
+			var n int64
+			if n, err = h.NextVal(name); err == nil {
+				err = setFromString(target, strconv.FormatInt(n, 10))
+			}
+		}
+
+	default:
+		err = setFromString(target, expr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if fv.Kind() == reflect.Ptr {
+		fv.Set(target.Addr())
+	}
+	return nil
+}
+
+// setFromString parse s based on kind of v and set it into v
+func setFromString(v reflect.Value, s string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	default:
+		if v.Type() == timeType {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return err
+			}
+			v.Set(reflect.ValueOf(t))
+			return nil
+		}
+		return fmt.Errorf("type %s is not supported", v.Type().String())
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// RegisterEnum register allowed values of a field of the model, field is struct field name or database name.
+// Value of the field is checked on Insert, Update and Save along with validate tag, zero value is allowed unless the
+// field is also required. Enums are shared with hubs created from this hub, register them before the hub is used
+func (h *Hub) RegisterEnum(model interface{}, field string, values ...string) *Hub {
+	meta := MetaOf(model)
+	if meta == nil {
+		return h
+	}
+	name := field
+	if f := meta.Field(field); f != nil {
+		name = f.Name
+	}
+	if h.enums == nil {
+		h.enums = map[reflect.Type]map[string][]string{}
+	}
+	if h.enums[meta.Type] == nil {
+		h.enums[meta.Type] = map[string][]string{}
+	}
+	h.enums[meta.Type][name] = append([]string{}, values...)
+	return h
+}
+
+// Enums returns registered enums of the model, keyed by struct field name
+func (h *Hub) Enums(model interface{}) map[string][]string {
+	meta := MetaOf(model)
+	res := map[string][]string{}
+	if meta == nil {
+		return res
+	}
+	for k, v := range h.enums[meta.Type] {
+		res[k] = append([]string{}, v...)
+	}
+	return res
+}
+
+// EnumValues returns allowed values of a field of the model, nil if field has no enum
+func (h *Hub) EnumValues(model interface{}, field string) []string {
+	meta := MetaOf(model)
+	if meta == nil {
+		return nil
+	}
+	f := meta.Field(field)
+	if f == nil {
+		return nil
+	}
+	return h.Enums(model)[f.Name]
+}
+
+// CheckEnum returns error if v is not allowed value of the field, field without enum accept any value
+func (h *Hub) CheckEnum(model interface{}, field string, v interface{}) error {
+	values := h.EnumValues(model, field)
+	if len(values) == 0 || enumHas(values, v) {
+		return nil
+	}
+	return fmt.Errorf("%s should be one of %s", field, strings.Join(values, ", "))
+}
+
+func enumHas(values []string, v interface{}) bool {
+	s := fmt.Sprintf("%v", indirectValue(v))
+	for _, opt := range values {
+		if s == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEnums append error of fields which value is not one of its enum
+func (h *Hub) validateEnums(data interface{}, verr *ValidationError) {
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	enums := h.enums[rv.Type()]
+	if len(enums) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(enums))
+	for name := range enums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	meta := MetaOf(rv.Type())
+	for _, name := range names {
+		f := meta.Field(name)
+		if f == nil {
+			continue
+		}
+		fv := reflect.Indirect(f.Value(rv))
+		if !fv.IsValid() || fv.IsZero() || enumHas(enums[name], fv.Interface()) {
+			continue
+		}
+		verr.Errors = append(verr.Errors, FieldError{Field: name, Rule: "enum",
+			Message: "should be one of " + strings.Join(enums[name], ", ")})
+	}
+}
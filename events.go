@@ -0,0 +1,276 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// Data event operations
+const (
+	EventInsert = "insert"
+	EventUpdate = "update"
+	EventSave   = "save"
+	EventDelete = "delete"
+)
+
+// DefaultOutboxTableName is default name of outbox table
+const DefaultOutboxTableName = "DatahubOutbox"
+
+// DataEvent is emitted by the hub after data is written
+type DataEvent struct {
+	ID     string        `json:"id"`
+	Table  string        `json:"table"`
+	Op     string        `json:"op"`
+	Keys   []interface{} `json:"keys,omitempty"`
+	Fields []string      `json:"fields,omitempty"`
+	Data   interface{}   `json:"data,omitempty"`
+	Meta   toolkit.M     `json:"meta,omitempty"`
+	Time   time.Time     `json:"time"`
+}
+
+// EventPublisher publish data events of the hub, ie: to a message broker
+type EventPublisher interface {
+	Publish(ev *DataEvent) error
+}
+
+// EventPublisherFunc is function that implements EventPublisher
+type EventPublisherFunc func(ev *DataEvent) error
+
+// Publish call the function
+func (fn EventPublisherFunc) Publish(ev *DataEvent) error {
+	return fn(ev)
+}
+
+// OutboxRecord is data event stored on outbox table
+type OutboxRecord struct {
+	ID        string    `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	Table     string    `bson:"table" json:"table" sqlname:"table"`
+	Event     string    `bson:"event" json:"event" sqlname:"event"`
+	Created   time.Time `bson:"created" json:"created" sqlname:"created"`
+	Published bool      `bson:"published" json:"published" sqlname:"published"`
+}
+
+// AddPublisher add publisher of data events written by Insert, Update, Save, UpdateField, Delete and DeleteQuery.
+// Without outbox, events are published right after the write (or on Commit for transactional hub) and publish
+// error is only logged. Use EnableOutbox for at least once delivery
+func (h *Hub) AddPublisher(p EventPublisher) *Hub {
+	h.publishers = append(h.publishers, p)
+	return h
+}
+
+// EnableOutbox store data events into outbox table using the connection of the write, so on transactional hub the event
+// is committed together with the data. On transactional hub write fails when its event could not be stored, without
+// transaction the data is already written so the error is only logged. Stored events are published to publishers of
+// the hub by RelayOutbox
+func (h *Hub) EnableOutbox(tableName string) *Hub {
+	if tableName == "" {
+		tableName = DefaultOutboxTableName
+	}
+	h.outboxTableName = tableName
+	return h
+}
+
+// emit invalidate cache of the table, and create data event of a write and publish it or store it into outbox. Error
+// storing the event into outbox is returned on transactional hub, so the transaction could be failed and the event is
+// not lost. Without transaction the write is already committed, returning error would make caller retry a successful
+// write, so it is only logged like publish error
+func (h *Hub) emit(conn dbflex.IConnection, op, tableName string, data interface{}, fields []string) error {
+	h.invalidateCache(tableName)
+	if len(h.publishers) == 0 && h.outboxTableName == "" {
+		return nil
+	}
+
+	ev := &DataEvent{
+		ID:     NewUUIDv7().(string),
+		Table:  tableName,
+		Op:     op,
+		Fields: fields,
+		Data:   data,
+		Meta:   h.meta,
+		Time:   time.Now(),
+	}
+	if dm, ok := data.(orm.DataModel); ok {
+		_, ev.Keys = dm.GetID(conn)
+	}
+
+	if h.outboxTableName != "" {
+		if err := h.storeOutbox(conn, ev); err != nil {
+			if h.IsTx() {
+				return fmt.Errorf("unable to store event to outbox. %w", err)
+			}
+			h.Logger().Error("unable to store event to outbox", "table", ev.Table, "op", ev.Op, "event", ev.ID,
+				"error", err.Error())
+		}
+		return nil
+	}
+
+	if h.IsTx() && h.txEvents != nil {
+		h.txEvents.add(ev)
+		return nil
+	}
+	h.publish(ev)
+	return nil
+}
+
+// txEventQueue is events of a transaction, published on Commit, and tables written by the transaction which cache is
+// invalidated again on Commit. It is shared by hubs scoped from the transactional hub so writes done by any of them
+// are covered
+type txEventQueue struct {
+	mtx    sync.Mutex
+	events []*DataEvent
+	tables map[string]bool
+}
+
+func (q *txEventQueue) add(ev *DataEvent) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.events = append(q.events, ev)
+}
+
+func (q *txEventQueue) touch(tableName string) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.tables == nil {
+		q.tables = map[string]bool{}
+	}
+	q.tables[tableName] = true
+}
+
+// take returns queued events and written tables, and clear the queue
+func (q *txEventQueue) take() ([]*DataEvent, []string) {
+	if q == nil {
+		return nil, nil
+	}
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	evs := q.events
+	tables := make([]string, 0, len(q.tables))
+	for t := range q.tables {
+		tables = append(tables, t)
+	}
+	q.events, q.tables = nil, nil
+	return evs, tables
+}
+
+func (h *Hub) publish(ev *DataEvent) error {
+	var lastErr error
+	for _, p := range h.publishers {
+		if err := p.Publish(ev); err != nil {
+			h.Logger().Error("unable to publish event", "table", ev.Table, "op", ev.Op, "event", ev.ID, "error", err.Error())
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (h *Hub) storeOutbox(conn dbflex.IConnection, ev *DataEvent) error {
+	tableName := h.table(h.outboxTableName)
+	if !conn.HasTable(tableName) {
+		if err := h.ensureOutbox(conn, tableName); err != nil {
+			return err
+		}
+	}
+	bs, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	rec := &OutboxRecord{ID: ev.ID, Table: ev.Table, Event: string(bs), Created: ev.Time}
+	_, err = conn.Execute(dbflex.From(tableName).Insert(), toolkit.M{}.Set("data", rec))
+	return err
+}
+
+// ensureOutbox create outbox table. Inside transaction it is created using separate connection, as DDL would commit
+// the transaction on some databases, ie: MySQL
+func (h *Hub) ensureOutbox(conn dbflex.IConnection, tableName string) error {
+	if !h.IsTx() {
+		return conn.EnsureTable(tableName, []string{"_id"}, new(OutboxRecord))
+	}
+	ddl, err := h.connect()
+	if err != nil {
+		return err
+	}
+	defer ddl.Close()
+	return ddl.EnsureTable(tableName, []string{"_id"}, new(OutboxRecord))
+}
+
+// RelayOutbox publish unpublished events of outbox table in the order they are created, and mark them as published.
+// It stops on first publish error so event order is kept, the event will be retried on next call. Returns number of
+// events being published
+func (h *Hub) RelayOutbox(batchSize int) (int, error) {
+	if h.outboxTableName == "" {
+		return 0, fmt.Errorf("fail RelayOutbox: outbox is not enabled")
+	}
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	recs := []*OutboxRecord{}
+	parm := dbflex.NewQueryParam().SetWhere(dbflex.Eq("published", false)).SetSort("created").SetTake(batchSize)
+	if err := h.internal().PopulateByParm(h.outboxTableName, parm, &recs); err != nil {
+		return 0, fmt.Errorf("fail RelayOutbox: %w", err)
+	}
+
+	for i, rec := range recs {
+		ev := new(DataEvent)
+		if err := json.Unmarshal([]byte(rec.Event), ev); err != nil {
+			return i, fmt.Errorf("fail RelayOutbox: event %s. %w", rec.ID, err)
+		}
+		for _, p := range h.publishers {
+			if err := p.Publish(ev); err != nil {
+				return i, fmt.Errorf("fail RelayOutbox: event %s. %w", rec.ID, err)
+			}
+		}
+		if err := h.markPublished(rec.ID); err != nil {
+			return i, fmt.Errorf("fail RelayOutbox: event %s. %w", rec.ID, err)
+		}
+	}
+	return len(recs), nil
+}
+
+// markPublished flag outbox record of given id as published
+func (h *Hub) markPublished(id string) error {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	cmd := dbflex.From(h.table(h.outboxTableName)).Update("published").Where(dbflex.Eq("_id", id))
+	_, err = conn.Execute(cmd, toolkit.M{}.Set("data", &OutboxRecord{ID: id, Published: true}))
+	return err
+}
+
+// StartOutboxRelay run RelayOutbox every interval until returned stop function is called, stop function is safe to
+// be called more than once
+func (h *Hub) StartOutboxRelay(every time.Duration, batchSize int) func() {
+	stop := make(chan bool)
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				for {
+					n, err := h.RelayOutbox(batchSize)
+					if err != nil {
+						h.Logger().Error("outbox relay fail", "error", err.Error())
+						break
+					}
+					if n < batchSize {
+						break
+					}
+				}
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(stop) }) }
+}
@@ -0,0 +1,124 @@
+package eventstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// DefaultSnapshotTableName is name of table used to store snapshots when Options.SnapshotTableName is empty
+const DefaultSnapshotTableName = "DatahubSnapshots"
+
+// Serializer encode and decode state of aggregate for snapshot
+type Serializer interface {
+	Marshal(state interface{}) ([]byte, error)
+	Unmarshal(data []byte, state interface{}) error
+}
+
+// JSONSerializer encode state as JSON
+type JSONSerializer struct{}
+
+// Marshal encode state
+func (JSONSerializer) Marshal(state interface{}) ([]byte, error) {
+	return json.Marshal(state)
+}
+
+// Unmarshal decode state
+func (JSONSerializer) Unmarshal(data []byte, state interface{}) error {
+	return json.Unmarshal(data, state)
+}
+
+// snapshotRecord is the latest snapshot of a stream, data is output of the serializer encoded as base64 so any
+// serializer could be used
+type snapshotRecord struct {
+	orm.DataModelBase `bson:"-" json:"-" ecname:"-"`
+
+	ID      string    `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	Version int64     `bson:"version" json:"version" sqlname:"version"`
+	Data    string    `bson:"data" json:"data" sqlname:"data"`
+	Created time.Time `bson:"created" json:"created" sqlname:"created"`
+}
+
+func (r *snapshotRecord) TableName() string {
+	return DefaultSnapshotTableName
+}
+
+func (r *snapshotRecord) SetID(keys ...interface{}) {
+	r.ID = keys[0].(string)
+}
+
+// SaveSnapshot save state of the stream at given version, it replaces previous snapshot of the stream. The state
+// should be the result of applying all events up to the version
+func (s *Store) SaveSnapshot(streamID string, version int64, state interface{}) error {
+	bs, err := s.opts.Serializer.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("fail SaveSnapshot: %s. unable to encode state. %w", streamID, err)
+	}
+	rec := &snapshotRecord{ID: streamID, Version: version, Data: base64.StdEncoding.EncodeToString(bs), Created: time.Now()}
+	if err = s.h.IntoTable(s.opts.SnapshotTableName).Save(rec); err != nil {
+		return fmt.Errorf("fail SaveSnapshot: %s. %w", streamID, err)
+	}
+	return nil
+}
+
+// LoadSnapshot decode latest snapshot of the stream into state and returns its version, 0 when the stream has no
+// snapshot and state is left untouched
+func (s *Store) LoadSnapshot(streamID string, state interface{}) (int64, error) {
+	recs := []*snapshotRecord{}
+	parm := dbflex.NewQueryParam().SetWhere(dbflex.Eq("_id", streamID)).SetTake(1)
+	if err := s.h.IntoTable(s.opts.SnapshotTableName).Gets(new(snapshotRecord), parm, &recs); err != nil {
+		return 0, fmt.Errorf("fail LoadSnapshot: %s. %w", streamID, err)
+	}
+	if len(recs) == 0 {
+		return 0, nil
+	}
+	bs, err := base64.StdEncoding.DecodeString(recs[0].Data)
+	if err == nil {
+		err = s.opts.Serializer.Unmarshal(bs, state)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("fail LoadSnapshot: %s. unable to decode state. %w", streamID, err)
+	}
+	return recs[0].Version, nil
+}
+
+// DeleteSnapshot delete snapshot of the stream, ie: when shape of the state is changed
+func (s *Store) DeleteSnapshot(streamID string) error {
+	if err := s.h.IntoTable(s.opts.SnapshotTableName).Delete(&snapshotRecord{ID: streamID}); err != nil {
+		return fmt.Errorf("fail DeleteSnapshot: %s. %w", streamID, err)
+	}
+	return nil
+}
+
+// Rehydrate rebuild state of the stream from its latest snapshot and events after it, apply is called for each event
+// in order of version. It returns version of the state. When Options.SnapshotEvery is set and at least that number of
+// events are applied, snapshot of the new state is saved, failing to save it is logged and does not fail Rehydrate
+func (s *Store) Rehydrate(streamID string, state interface{}, apply func(state interface{}, e *Event) error) (int64, error) {
+	version, err := s.LoadSnapshot(streamID, state)
+	if err != nil {
+		s.h.Logger().Warn("snapshot is ignored", "stream", streamID, "error", err.Error())
+		version = 0
+	}
+
+	events, err := s.Load(streamID, version+1)
+	if err != nil {
+		return 0, fmt.Errorf("fail Rehydrate: %w", err)
+	}
+	for _, e := range events {
+		if err = apply(state, e); err != nil {
+			return 0, fmt.Errorf("fail Rehydrate: %s version %d. %w", streamID, e.Version, err)
+		}
+		version = e.Version
+	}
+
+	if s.opts.SnapshotEvery > 0 && int64(len(events)) >= s.opts.SnapshotEvery {
+		if err = s.SaveSnapshot(streamID, version, state); err != nil {
+			s.h.Logger().Warn("unable to save snapshot", "stream", streamID, "version", version, "error", err.Error())
+		}
+	}
+	return version, nil
+}
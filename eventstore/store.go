@@ -0,0 +1,282 @@
+// Package eventstore implement append only event store on top of datahub.Hub
+//
+//	store := eventstore.New(h, eventstore.Options{})
+//	ver, err := store.Append("order-1", eventstore.NoStream, []eventstore.EventData{{Type: "OrderPlaced", Data: order}})
+//	events, err := store.Load("order-1", 0)
+//
+// Events of a stream are numbered by version starting from 1, appending with expected version that is not the current
+// version of the stream returns ErrConcurrency. Every event also has a global position taken from sequence of the hub.
+// On drivers supporting transaction events are appended in a transaction and the sequence is allocated in it, so
+// positions become visible in order. On other drivers positions are unique and increasing, but events appended
+// concurrently could become visible out of order.
+//
+// Aggregates with long histories could be rebuilt from snapshot using Rehydrate, snapshot is saved on demand by
+// SaveSnapshot or every Options.SnapshotEvery events applied by Rehydrate
+package eventstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/ariefdarmawan/datahub"
+)
+
+// DefaultTableName is name of table used to store events when Options.TableName is empty
+const DefaultTableName = "DatahubEvents"
+
+// Expected versions having special meaning
+const (
+	// AnyVersion append regardless of current version of the stream
+	AnyVersion int64 = -1
+	// NoStream append only when the stream has no event yet
+	NoStream int64 = 0
+)
+
+// ErrConcurrency is returned by Append when current version of the stream is not the expected version
+var ErrConcurrency = errors.New("stream version is changed")
+
+// EventData is event to be appended, Data is encoded as JSON
+type EventData struct {
+	Type string
+	Data interface{}
+	Meta map[string]interface{}
+}
+
+// Event is an event of a stream
+type Event struct {
+	StreamID string
+	Version  int64
+	Position int64
+	Type     string
+	Data     json.RawMessage
+	Meta     map[string]interface{}
+	Created  time.Time
+}
+
+// Decode decode data of the event into v
+func (e *Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Options of the store
+type Options struct {
+	// TableName is name of table storing events, default is DefaultTableName
+	TableName string
+	// SequenceName is name of hub sequence used for global position, default is the table name
+	SequenceName string
+	// SnapshotTableName is name of table storing snapshots, default is DefaultSnapshotTableName
+	SnapshotTableName string
+	// SnapshotEvery make Rehydrate save snapshot when it applies at least this number of events, 0 disable it
+	SnapshotEvery int64
+	// Serializer encode state of snapshots, default is JSONSerializer
+	Serializer Serializer
+}
+
+// record is an event persisted on the table, key is stream id and version so conflicting appends are rejected by
+// the database
+type record struct {
+	orm.DataModelBase `bson:"-" json:"-" ecname:"-"`
+
+	ID       string    `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	StreamID string    `bson:"streamid" json:"streamid" sqlname:"streamid"`
+	Version  int64     `bson:"version" json:"version" sqlname:"version"`
+	Position int64     `bson:"position" json:"position" sqlname:"position"`
+	Type     string    `bson:"type" json:"type" sqlname:"type"`
+	Data     string    `bson:"data" json:"data" sqlname:"data"`
+	Meta     string    `bson:"meta" json:"meta" sqlname:"meta"`
+	Created  time.Time `bson:"created" json:"created" sqlname:"created"`
+}
+
+func (r *record) TableName() string {
+	return DefaultTableName
+}
+
+func (r *record) SetID(keys ...interface{}) {
+	r.ID = keys[0].(string)
+}
+
+func (r *record) event() (*Event, error) {
+	e := &Event{StreamID: r.StreamID, Version: r.Version, Position: r.Position, Type: r.Type,
+		Data: json.RawMessage(r.Data), Created: r.Created}
+	if r.Meta != "" {
+		if err := json.Unmarshal([]byte(r.Meta), &e.Meta); err != nil {
+			return nil, fmt.Errorf("invalid meta of %s. %w", r.ID, err)
+		}
+	}
+	return e, nil
+}
+
+// Store is event store
+type Store struct {
+	h    *datahub.Hub
+	opts Options
+}
+
+// New create event store on the hub
+func New(h *datahub.Hub, opts Options) *Store {
+	if opts.TableName == "" {
+		opts.TableName = DefaultTableName
+	}
+	if opts.SequenceName == "" {
+		opts.SequenceName = opts.TableName
+	}
+	if opts.SnapshotTableName == "" {
+		opts.SnapshotTableName = DefaultSnapshotTableName
+	}
+	if opts.Serializer == nil {
+		opts.Serializer = JSONSerializer{}
+	}
+	return &Store{h: h, opts: opts}
+}
+
+// Hub returns hub of the store
+func (s *Store) Hub() *datahub.Hub {
+	return s.h
+}
+
+func recordID(streamID string, version int64) string {
+	return fmt.Sprintf("%s#%019d", streamID, version)
+}
+
+// Version returns current version of the stream, 0 when the stream has no event
+func (s *Store) Version(streamID string) (int64, error) {
+	return s.version(s.h, streamID)
+}
+
+func (s *Store) version(h *datahub.Hub, streamID string) (int64, error) {
+	recs := []*record{}
+	parm := dbflex.NewQueryParam().SetWhere(dbflex.Eq("streamid", streamID)).
+		SetSort("-version").SetTake(1).SetSelect("version")
+	if err := h.IntoTable(s.opts.TableName).Gets(new(record), parm, &recs); err != nil {
+		return 0, err
+	}
+	if len(recs) == 0 {
+		return 0, nil
+	}
+	return recs[0].Version, nil
+}
+
+// Append append events to the stream and returns new version of the stream. expectedVersion is the version of the
+// stream the events are based on, NoStream for new stream or AnyVersion to skip the check. ErrConcurrency is returned
+// when the stream is changed by other writer
+func (s *Store) Append(streamID string, expectedVersion int64, events []EventData) (int64, error) {
+	if streamID == "" {
+		return 0, errors.New("fail Append: stream id is mandatory")
+	}
+	if len(events) == 0 {
+		return s.Version(streamID)
+	}
+
+	h, commit := s.h, func(err error) error { return err }
+	if !h.IsTx() && h.Capability(datahub.CapTransaction) {
+		ht, err := h.BeginTx()
+		if err != nil {
+			return 0, fmt.Errorf("fail Append: %w", err)
+		}
+		h = ht
+		commit = func(err error) error {
+			if err != nil {
+				ht.Rollback()
+				return err
+			}
+			return ht.Commit()
+		}
+	}
+
+	version, err := s.append(h, streamID, expectedVersion, events)
+	if err = commit(err); err != nil {
+		if errors.Is(err, datahub.ErrDuplicateKey) {
+			err = ErrConcurrency
+		}
+		return 0, fmt.Errorf("fail Append: %s. %w", streamID, err)
+	}
+	return version, nil
+}
+
+func (s *Store) append(h *datahub.Hub, streamID string, expectedVersion int64, events []EventData) (int64, error) {
+	current, err := s.version(h, streamID)
+	if err != nil {
+		return 0, err
+	}
+	if expectedVersion != AnyVersion && current != expectedVersion {
+		return 0, fmt.Errorf("version is %d, expected %d. %w", current, expectedVersion, ErrConcurrency)
+	}
+
+	now := time.Now()
+	for i, ev := range events {
+		data, err := json.Marshal(ev.Data)
+		if err != nil {
+			return 0, fmt.Errorf("unable to encode event %d. %w", i, err)
+		}
+		meta := []byte{}
+		if len(ev.Meta) > 0 {
+			if meta, err = json.Marshal(ev.Meta); err != nil {
+				return 0, fmt.Errorf("unable to encode meta of event %d. %w", i, err)
+			}
+		}
+		pos, err := h.NextVal(s.opts.SequenceName)
+		if err != nil {
+			return 0, err
+		}
+
+		current++
+		rec := &record{ID: recordID(streamID, current), StreamID: streamID, Version: current, Position: pos,
+			Type: ev.Type, Data: string(data), Meta: string(meta), Created: now}
+		if err = h.IntoTable(s.opts.TableName).Insert(rec); err != nil {
+			return 0, err
+		}
+	}
+	return current, nil
+}
+
+// Load returns events of the stream from given version in order of their version, fromVersion 0 or 1 returns all events
+func (s *Store) Load(streamID string, fromVersion int64) ([]*Event, error) {
+	where := dbflex.Eq("streamid", streamID)
+	if fromVersion > 1 {
+		where = dbflex.And(where, dbflex.Gte("version", fromVersion))
+	}
+	events, err := s.load(dbflex.NewQueryParam().SetWhere(where).SetSort("version"))
+	if err != nil {
+		return nil, fmt.Errorf("fail Load: %s. %w", streamID, err)
+	}
+	return events, nil
+}
+
+// LoadAll returns events of all streams after given global position in order of their position, up to take events.
+// take 0 means no limit. It is used by projections and subscribers to follow the store
+func (s *Store) LoadAll(afterPosition int64, take int) ([]*Event, error) {
+	parm := dbflex.NewQueryParam().SetWhere(dbflex.Gt("position", afterPosition)).SetSort("position")
+	if take > 0 {
+		parm.SetTake(take)
+	}
+	events, err := s.load(parm)
+	if err != nil {
+		return nil, fmt.Errorf("fail LoadAll: %w", err)
+	}
+	return events, nil
+}
+
+func (s *Store) load(parm *dbflex.QueryParam) ([]*Event, error) {
+	recs := []*record{}
+	if err := s.h.IntoTable(s.opts.TableName).Gets(new(record), parm, &recs); err != nil {
+		return nil, err
+	}
+	events := make([]*Event, len(recs))
+	for i, r := range recs {
+		e, err := r.event()
+		if err != nil {
+			return nil, err
+		}
+		events[i] = e
+	}
+	return events, nil
+}
+
+// EnsureTable create table of the store when it is not exist yet
+func (s *Store) EnsureTable() error {
+	return s.h.EnsureTable(s.opts.TableName, []string{"_id"}, new(record))
+}
@@ -0,0 +1,395 @@
+package datahub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// FilterExprOptions control ParseFilterExpr
+type FilterExprOptions struct {
+	// AllowedFields are fields that can be used on the expression, other fields are rejected
+	AllowedFields []string
+
+	// MaxDepth is maximum nesting of parentheses and not, default is 5
+	MaxDepth int
+
+	// MaxLength is maximum length of the expression, default is 2000
+	MaxLength int
+}
+
+// ParseFilterExpr parse OData like filter expression into dbflex filter, so API consumers can send server side filter
+// as text, ie: status eq 'open' and (amount gt 100 or contains(name, 'jo')).
+//
+//	expr       := term { "or" term }
+//	term       := factor { "and" factor }
+//	factor     := "not" factor | "(" expr ")" | comparison | function
+//	comparison := field op value | field "in" "(" value { "," value } ")"
+//	function   := ( "contains" | "startswith" | "endswith" ) "(" field "," string ")"
+//	op         := eq | ne | gt | ge | gte | lt | le | lte
+//	value      := 'text' | number | true | false | null | datetime (RFC3339, unquoted)
+//
+// Keywords are case insensitive, single quote inside text is escaped by writing it twice
+func ParseFilterExpr(expr string, opts FilterExprOptions) (*dbflex.Filter, error) {
+	if opts.MaxDepth <= 0 {
+		opts.MaxDepth = 5
+	}
+	if opts.MaxLength <= 0 {
+		opts.MaxLength = 2000
+	}
+	if len(expr) > opts.MaxLength {
+		return nil, fmt.Errorf("filter expression is longer than %d characters", opts.MaxLength)
+	}
+
+	tokens, err := lexFilterExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := &exprParser{tokens: tokens, opts: opts, allowed: map[string]bool{}}
+	for _, f := range opts.AllowedFields {
+		p.allowed[strings.ToLower(f)] = true
+	}
+	f, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s at %d", p.tokens[p.pos].text, p.tokens[p.pos].at)
+	}
+	return f, nil
+}
+
+type exprTokenKind int
+
+const (
+	tokIdent exprTokenKind = iota
+	tokString
+	tokNumber
+	tokOpen
+	tokClose
+	tokComma
+)
+
+type exprToken struct {
+	kind exprTokenKind
+	text string
+	at   int
+}
+
+func lexFilterExpr(s string) ([]exprToken, error) {
+	tokens := []exprToken{}
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(' || r == ')' || r == ',':
+			kind := tokComma
+			if r == '(' {
+				kind = tokOpen
+			} else if r == ')' {
+				kind = tokClose
+			}
+			tokens = append(tokens, exprToken{kind, string(r), i})
+			i++
+
+		case r == '\'':
+			start := i
+			sb := strings.Builder{}
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						sb.WriteRune('\'')
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated text at %d", start)
+			}
+			tokens = append(tokens, exprToken{tokString, sb.String(), start})
+
+		case r == '-' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || strings.ContainsRune(".:-+TZe", runes[i])) {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokNumber, string(runes[start:i]), start})
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, exprToken{tokIdent, string(runes[start:i]), start})
+
+		default:
+			return nil, fmt.Errorf("unexpected character %c at %d", r, i)
+		}
+	}
+	return tokens, nil
+}
+
+type exprParser struct {
+	tokens  []exprToken
+	pos     int
+	opts    FilterExprOptions
+	allowed map[string]bool
+}
+
+func (p *exprParser) peek() *exprToken {
+	if p.pos >= len(p.tokens) {
+		return nil
+	}
+	return &p.tokens[p.pos]
+}
+
+func (p *exprParser) next() (*exprToken, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	p.pos++
+	return t, nil
+}
+
+func (p *exprParser) keyword(word string) bool {
+	if t := p.peek(); t != nil && t.kind == tokIdent && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(kind exprTokenKind, what string) (*exprToken, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind != kind {
+		return nil, fmt.Errorf("expecting %s at %d, got %s", what, t.at, t.text)
+	}
+	return t, nil
+}
+
+func (p *exprParser) parseOr(depth int) (*dbflex.Filter, error) {
+	items := []*dbflex.Filter{}
+	for {
+		f, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, f)
+		if !p.keyword("or") {
+			break
+		}
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return dbflex.Or(items...), nil
+}
+
+func (p *exprParser) parseAnd(depth int) (*dbflex.Filter, error) {
+	items := []*dbflex.Filter{}
+	for {
+		f, err := p.parseFactor(depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, f)
+		if !p.keyword("and") {
+			break
+		}
+	}
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return dbflex.And(items...), nil
+}
+
+func (p *exprParser) parseFactor(depth int) (*dbflex.Filter, error) {
+	if depth > p.opts.MaxDepth {
+		return nil, fmt.Errorf("filter expression is nested deeper than %d", p.opts.MaxDepth)
+	}
+
+	if p.keyword("not") {
+		f, err := p.parseFactor(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return dbflex.Not(f), nil
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == tokOpen {
+		f, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = p.expect(tokClose, ")"); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	if t.kind != tokIdent {
+		return nil, fmt.Errorf("expecting field at %d, got %s", t.at, t.text)
+	}
+
+	switch fn := strings.ToLower(t.text); fn {
+	case "contains", "startswith", "endswith":
+		if next := p.peek(); next != nil && next.kind == tokOpen {
+			return p.parseFunction(fn)
+		}
+	}
+
+	field := t.text
+	if err = p.checkField(field, t.at); err != nil {
+		return nil, err
+	}
+	opTok, err := p.expect(tokIdent, "operator")
+	if err != nil {
+		return nil, err
+	}
+
+	op := strings.ToLower(opTok.text)
+	if op == "in" {
+		if _, err = p.expect(tokOpen, "("); err != nil {
+			return nil, err
+		}
+		values := []interface{}{}
+		for {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			if t := p.peek(); t != nil && t.kind == tokComma {
+				p.pos++
+				continue
+			}
+			break
+		}
+		if _, err = p.expect(tokClose, ")"); err != nil {
+			return nil, err
+		}
+		return dbflex.In(field, values...), nil
+	}
+
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "eq":
+		return dbflex.Eq(field, v), nil
+	case "ne":
+		return dbflex.Ne(field, v), nil
+	case "gt":
+		return dbflex.Gt(field, v), nil
+	case "ge", "gte":
+		return dbflex.Gte(field, v), nil
+	case "lt":
+		return dbflex.Lt(field, v), nil
+	case "le", "lte":
+		return dbflex.Lte(field, v), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s at %d", opTok.text, opTok.at)
+}
+
+func (p *exprParser) parseFunction(fn string) (*dbflex.Filter, error) {
+	if _, err := p.expect(tokOpen, "("); err != nil {
+		return nil, err
+	}
+	ft, err := p.expect(tokIdent, "field")
+	if err != nil {
+		return nil, err
+	}
+	if err = p.checkField(ft.text, ft.at); err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(tokComma, ","); err != nil {
+		return nil, err
+	}
+	st, err := p.expect(tokString, "text")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = p.expect(tokClose, ")"); err != nil {
+		return nil, err
+	}
+
+	switch fn {
+	case "contains":
+		return dbflex.Contains(ft.text, st.text), nil
+	case "startswith":
+		return dbflex.StartWith(ft.text, st.text), nil
+	}
+	return dbflex.EndWith(ft.text, st.text), nil
+}
+
+func (p *exprParser) parseValue() (interface{}, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case tokString:
+		return t.text, nil
+
+	case tokNumber:
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return n, nil
+		}
+		if n, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return n, nil
+		}
+		if dt, err := time.Parse(time.RFC3339, t.text); err == nil {
+			return dt, nil
+		}
+		if dt, err := time.Parse("2006-01-02", t.text); err == nil {
+			return dt, nil
+		}
+		return nil, fmt.Errorf("invalid value %s at %d", t.text, t.at)
+
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("expecting value at %d, got %s", t.at, t.text)
+}
+
+func (p *exprParser) checkField(field string, at int) error {
+	if !p.allowed[strings.ToLower(field)] {
+		return fmt.Errorf("field %s at %d is not allowed", field, at)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// MatchFilter evaluate filter against a record in memory, nil filter match any record
+func MatchFilter(f *dbflex.Filter, rec toolkit.M) bool {
+	if f == nil {
+		return true
+	}
+
+	switch f.Op {
+	case dbflex.OpAnd:
+		for _, item := range f.Items {
+			if !MatchFilter(item, rec) {
+				return false
+			}
+		}
+		return true
+
+	case dbflex.OpOr:
+		for _, item := range f.Items {
+			if MatchFilter(item, rec) {
+				return true
+			}
+		}
+		return false
+
+	case dbflex.OpNot:
+		return len(f.Items) > 0 && !MatchFilter(f.Items[0], rec)
+	}
+
+	v := rec[f.Field]
+	switch f.Op {
+	case dbflex.OpEq:
+		return compareValues(v, f.Value) == 0
+	case dbflex.OpNe:
+		return compareValues(v, f.Value) != 0
+	case dbflex.OpGt:
+		return v != nil && compareValues(v, f.Value) > 0
+	case dbflex.OpGte:
+		return v != nil && compareValues(v, f.Value) >= 0
+	case dbflex.OpLt:
+		return v != nil && compareValues(v, f.Value) < 0
+	case dbflex.OpLte:
+		return v != nil && compareValues(v, f.Value) <= 0
+	case dbflex.OpRange:
+		bounds := toInterfaces(f.Value)
+		return v != nil && len(bounds) == 2 && compareValues(v, bounds[0]) >= 0 && compareValues(v, bounds[1]) <= 0
+	case dbflex.OpIn, dbflex.OpNin:
+		found := false
+		for _, item := range toInterfaces(f.Value) {
+			if compareValues(v, item) == 0 {
+				found = true
+				break
+			}
+		}
+		return found == (f.Op == dbflex.OpIn)
+	case dbflex.OpContains:
+		s := strings.ToLower(fmt.Sprintf("%v", indirectValue(v)))
+		for _, item := range toInterfaces(f.Value) {
+			if strings.Contains(s, strings.ToLower(fmt.Sprintf("%v", item))) {
+				return true
+			}
+		}
+		return false
+	case dbflex.OpStartWith:
+		return v != nil && strings.HasPrefix(fmt.Sprintf("%v", indirectValue(v)), fmt.Sprintf("%v", f.Value))
+	case dbflex.OpEndWith:
+		return v != nil && strings.HasSuffix(fmt.Sprintf("%v", indirectValue(v)), fmt.Sprintf("%v", f.Value))
+	}
+	return false
+}
+
+func toInterfaces(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{v}
+	}
+	res := make([]interface{}, rv.Len())
+	for i := range res {
+		res[i] = rv.Index(i).Interface()
+	}
+	return res
+}
@@ -0,0 +1,212 @@
+// Package gql provides building blocks for GraphQL resolvers backed by datahub.Hub. Arguments are received as
+// map[string]interface{}, as given by most GraphQL libraries:
+//
+//	filter:  {status: {eq: "open"}, total: {gte: 100}, or: [{city: {eq: "Jakarta"}}, {city: {in: ["Bogor"]}}]}
+//	orderBy: [{field: "created", direction: DESC}] or ["-created", "name"]
+//	first:   number of records
+//	after:   cursor returned on previous page
+package gql
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/ariefdarmawan/datahub"
+	"github.com/eaciit/toolkit"
+)
+
+// DefaultFirst is used when first argument is not given
+var DefaultFirst = 20
+
+// QueryParamFromArgs translate filter, orderBy, first and after arguments into QueryParam
+func QueryParamFromArgs(args map[string]interface{}) (*dbflex.QueryParam, error) {
+	parm := dbflex.NewQueryParam()
+
+	if fm, ok := args["filter"].(map[string]interface{}); ok {
+		f, err := datahub.FilterFromM(toolkit.M(normalizeFilter(fm).(map[string]interface{})))
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter. %w", err)
+		}
+		if f != nil {
+			parm = parm.SetWhere(f)
+		}
+	}
+
+	sort, err := orderBy(args["orderBy"])
+	if err != nil {
+		return nil, err
+	}
+	parm.Sort = sort
+
+	parm.Take = DefaultFirst
+	if v, ok := args["first"]; ok && v != nil {
+		n, err := toInt(v)
+		if err != nil || n < 0 {
+			return nil, errors.New("invalid first")
+		}
+		parm.Take = n
+	}
+	if v, ok := args["after"].(string); ok && v != "" {
+		offset, err := DecodeCursor(v)
+		if err != nil {
+			return nil, err
+		}
+		parm.Skip = offset + 1
+	}
+	return parm, nil
+}
+
+// CheckEnums validate input argument of a mutation against enums registered on the hub for the model, so invalid
+// value is rejected before the input is decoded into the model. Nested input of struct fields, or list of them, is
+// checked against enums of their types
+func CheckEnums(h *datahub.Hub, model interface{}, input map[string]interface{}) error {
+	if err := checkEnums(h, model, input, ""); err != nil {
+		return fmt.Errorf("invalid input. %w", err)
+	}
+	return nil
+}
+
+func checkEnums(h *datahub.Hub, model interface{}, input map[string]interface{}, prefix string) error {
+	meta := datahub.MetaOf(model)
+	for k, v := range input {
+		if v == nil {
+			continue
+		}
+		if err := h.CheckEnum(model, k, v); err != nil {
+			return fmt.Errorf("%s%w", prefix, err)
+		}
+		if meta == nil {
+			continue
+		}
+		if f := meta.Field(k); f != nil {
+			if err := checkNestedEnums(h, f.Type, v, prefix+k+"."); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkNestedEnums(h *datahub.Hub, t reflect.Type, v interface{}, prefix string) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	switch o := v.(type) {
+	case map[string]interface{}:
+		return checkEnums(h, t, o, prefix)
+	case []interface{}:
+		for _, item := range o {
+			if err := checkNestedEnums(h, t, item, prefix); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var filterOps = map[string]bool{
+	"eq": true, "ne": true, "gt": true, "gte": true, "lt": true, "lte": true, "in": true, "nin": true,
+	"contains": true, "startwith": true, "endwith": true, "and": true, "or": true, "not": true,
+}
+
+// normalizeFilter prefix GraphQL style operators with $ so it can be parsed by datahub.FilterFromM
+func normalizeFilter(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		res := map[string]interface{}{}
+		for k, item := range t {
+			if filterOps[strings.ToLower(k)] {
+				k = "$" + strings.ToLower(k)
+			}
+			res[k] = normalizeFilter(item)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(t))
+		for i, item := range t {
+			res[i] = normalizeFilter(item)
+		}
+		return res
+	}
+	return v
+}
+
+var fieldNameRx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+
+func orderBy(v interface{}) ([]string, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		if v == nil {
+			return nil, nil
+		}
+		items = []interface{}{v}
+	}
+	sort := []string{}
+	for _, item := range items {
+		switch t := item.(type) {
+		case string:
+			if !fieldNameRx.MatchString(strings.TrimPrefix(t, "-")) {
+				return nil, fmt.Errorf("invalid orderBy field %q", t)
+			}
+			sort = append(sort, t)
+		case map[string]interface{}:
+			field, _ := t["field"].(string)
+			if field == "" {
+				return nil, errors.New("invalid orderBy, field is mandatory")
+			}
+			if !fieldNameRx.MatchString(field) {
+				return nil, fmt.Errorf("invalid orderBy field %q", field)
+			}
+			if dir, _ := t["direction"].(string); strings.EqualFold(dir, "desc") {
+				field = "-" + field
+			}
+			sort = append(sort, field)
+		default:
+			return nil, errors.New("invalid orderBy")
+		}
+	}
+	return sort, nil
+}
+
+func toInt(v interface{}) (int, error) {
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int32:
+		return int(n), nil
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	case string:
+		return strconv.Atoi(n)
+	}
+	return 0, fmt.Errorf("invalid number %v", v)
+}
+
+// EncodeCursor returns opaque cursor of a record at given offset
+func EncodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+// DecodeCursor returns offset of a cursor
+func DecodeCursor(cursor string) (int, error) {
+	bs, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(bs), "offset:") {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(bs), "offset:"))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
@@ -0,0 +1,74 @@
+package gql
+
+import (
+	"fmt"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/ariefdarmawan/datahub"
+)
+
+// Edge is a record with its cursor
+type Edge[T any] struct {
+	Cursor string `json:"cursor"`
+	Node   T      `json:"node"`
+}
+
+// PageInfo is paging information of a connection
+type PageInfo struct {
+	HasNextPage     bool   `json:"hasNextPage"`
+	HasPreviousPage bool   `json:"hasPreviousPage"`
+	StartCursor     string `json:"startCursor"`
+	EndCursor       string `json:"endCursor"`
+}
+
+// Connection is relay style result of a list field
+type Connection[T any] struct {
+	Edges    []Edge[T] `json:"edges"`
+	PageInfo PageInfo  `json:"pageInfo"`
+}
+
+// Paginate run query of the model based on filter, orderBy, first and after arguments and returns relay style connection.
+// One extra record is read to know whether next page exists, when first is the max take of the hub the records are
+// counted instead. First more than max take of the hub is rejected
+func Paginate[T any](h *datahub.Hub, model orm.DataModel, args map[string]interface{}) (*Connection[T], error) {
+	parm, err := QueryParamFromArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	first, max := parm.Take, h.MaxTake()
+	if max > 0 && first > max {
+		return nil, fmt.Errorf("first %d exceeds max take %d", first, max)
+	}
+	probe := max == 0 || first < max
+	if probe {
+		parm.Take = first + 1
+	}
+
+	nodes := []T{}
+	if err = h.Gets(model, parm, &nodes); err != nil {
+		return nil, err
+	}
+
+	conn := &Connection[T]{Edges: []Edge[T]{}}
+	if len(nodes) > first {
+		nodes = nodes[:first]
+		conn.PageInfo.HasNextPage = true
+	}
+	if !probe && len(nodes) == first {
+		n, err := h.Count(model, dbflex.NewQueryParam().SetWhere(parm.Where))
+		if err != nil {
+			return nil, err
+		}
+		conn.PageInfo.HasNextPage = n > parm.Skip+first
+	}
+	conn.PageInfo.HasPreviousPage = parm.Skip > 0
+	for i, n := range nodes {
+		conn.Edges = append(conn.Edges, Edge[T]{Cursor: EncodeCursor(parm.Skip + i), Node: n})
+	}
+	if len(conn.Edges) > 0 {
+		conn.PageInfo.StartCursor = conn.Edges[0].Cursor
+		conn.PageInfo.EndCursor = conn.Edges[len(conn.Edges)-1].Cursor
+	}
+	return conn, nil
+}
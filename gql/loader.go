@@ -0,0 +1,132 @@
+package gql
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/ariefdarmawan/datahub"
+)
+
+// Loader batch loading of records by a field, so resolving a field of N parents run one query instead of N.
+// Keys requested within Wait duration are loaded together using in filter. Loader does not cache the result
+// and is meant to be created for each request
+type Loader[T any] struct {
+	// Wait is duration to collect keys before the batch is loaded, default is 2ms
+	Wait time.Duration
+	// MaxBatch is maximum number of keys of a batch, default is 500
+	MaxBatch int
+
+	h         *datahub.Hub
+	tableName string
+	field     string
+
+	mtx   sync.Mutex
+	batch *loaderBatch[T]
+}
+
+type loaderBatch[T any] struct {
+	keys    []interface{}
+	seen    map[string]bool
+	results map[string][]T
+	err     error
+	done    chan bool
+}
+
+// NewLoader create loader of records of T on tableName by field, T should be a struct
+func NewLoader[T any](h *datahub.Hub, tableName, field string) *Loader[T] {
+	return &Loader[T]{Wait: 2 * time.Millisecond, MaxBatch: 500, h: h, tableName: tableName, field: field}
+}
+
+// Load returns first record which field equal to key, nil if there is no such record
+func (l *Loader[T]) Load(key interface{}) (*T, error) {
+	items, err := l.LoadMany(key)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// LoadMany returns all records which field equal to key
+func (l *Loader[T]) LoadMany(key interface{}) ([]T, error) {
+	b := l.enqueue(key)
+	<-b.done
+	return b.results[fmt.Sprintf("%v", key)], b.err
+}
+
+func (l *Loader[T]) enqueue(key interface{}) *loaderBatch[T] {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	b := l.batch
+	if b == nil {
+		b = &loaderBatch[T]{seen: map[string]bool{}, done: make(chan bool)}
+		l.batch = b
+		time.AfterFunc(l.Wait, func() {
+			if l.detach(b) {
+				l.run(b)
+			}
+		})
+	}
+
+	k := fmt.Sprintf("%v", key)
+	if !b.seen[k] {
+		b.seen[k] = true
+		b.keys = append(b.keys, key)
+	}
+	if l.MaxBatch > 0 && len(b.keys) >= l.MaxBatch {
+		l.batch = nil
+		go l.run(b)
+	}
+	return b
+}
+
+// detach remove b as current batch, returns false if it has been detached
+func (l *Loader[T]) detach(b *loaderBatch[T]) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.batch != b {
+		return false
+	}
+	l.batch = nil
+	return true
+}
+
+func (l *Loader[T]) run(b *loaderBatch[T]) {
+	defer close(b.done)
+
+	meta := datahub.MetaOf(new(T))
+	if meta == nil {
+		b.err = errors.New("loader type should be a struct")
+		return
+	}
+	f := meta.Field(l.field)
+	if f == nil {
+		b.err = fmt.Errorf("field %s is not exist", l.field)
+		return
+	}
+
+	items := []T{}
+	parm := dbflex.NewQueryParam().SetWhere(dbflex.In(l.field, b.keys...))
+	max := l.h.MaxTake()
+	if max > 0 {
+		parm.SetTake(max)
+	}
+	if err := l.h.PopulateByParm(l.tableName, parm, &items); err != nil {
+		b.err = err
+		return
+	}
+	if max > 0 && len(items) >= max {
+		b.err = fmt.Errorf("records of the batch reach max take %d, result could be truncated", max)
+		return
+	}
+
+	b.results = map[string][]T{}
+	for _, item := range items {
+		k := fmt.Sprintf("%v", f.Value(reflect.ValueOf(item)).Interface())
+		b.results[k] = append(b.results[k], item)
+	}
+}
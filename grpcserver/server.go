@@ -0,0 +1,279 @@
+// Package grpcserver expose operations of a datahub.Hub over gRPC, so other services can use the hub as data gateway.
+// Service definition is in datahub.proto, requests and responses are google.protobuf.Struct
+//
+//	gs := grpc.NewServer()
+//	grpcserver.New(h, grpcserver.Options{Tables: []string{"orders", "customers"}}).Register(gs)
+package grpcserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/ariefdarmawan/datahub"
+	"github.com/eaciit/toolkit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ServiceName is full name of the gRPC service
+const ServiceName = "datahub.DataHub"
+
+// Options of the server
+type Options struct {
+	// Tables that can be accessed, empty means all tables
+	Tables []string
+	// KeyField is field used by id attribute of Get and Delete request, default is _id
+	KeyField string
+	// Authorize is called before each request, returning error reject the request with PermissionDenied
+	Authorize func(ctx context.Context, method, table string) error
+}
+
+// Server implements DataHub gRPC service
+type Server struct {
+	h      *datahub.Hub
+	opts   Options
+	tables map[string]bool
+}
+
+// New create server for given hub
+func New(h *datahub.Hub, opts Options) *Server {
+	s := &Server{h: h, opts: opts, tables: map[string]bool{}}
+	if s.opts.KeyField == "" {
+		s.opts.KeyField = "_id"
+	}
+	for _, t := range opts.Tables {
+		s.tables[strings.ToLower(t)] = true
+	}
+	return s
+}
+
+// hub returns hub bound to context of the call, so cancelled call stop its queries
+func (s *Server) hub(ctx context.Context) *datahub.Hub {
+	return s.h.WithContext(ctx)
+}
+
+// Register register the service to grpc server
+func (s *Server) Register(gs grpc.ServiceRegistrar) {
+	gs.RegisterService(&serviceDesc, s)
+}
+
+// Get returns single record
+func (s *Server) Get(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	table, m, err := s.prepare(ctx, "Get", req)
+	if err != nil {
+		return nil, err
+	}
+	where, err := s.keyFilter(m)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []toolkit.M{}
+	parm := dbflex.NewQueryParam().SetWhere(where).SetTake(1)
+	if err = s.hub(ctx).PopulateByParm(table, parm, &res); err != nil {
+		return nil, toStatus(err)
+	}
+	if len(res) == 0 {
+		return nil, status.Error(codes.NotFound, "record not found")
+	}
+	return toStruct(toolkit.M{"record": res[0]})
+}
+
+// Gets returns records matching the query
+func (s *Server) Gets(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	table, m, err := s.prepare(ctx, "Gets", req)
+	if err != nil {
+		return nil, err
+	}
+	parm, err := datahub.QueryParamFromM(m)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	parm.GroupBy, parm.Aggregates = nil, nil
+
+	res := []toolkit.M{}
+	if err = s.hub(ctx).PopulateByParm(table, parm, &res); err != nil {
+		return nil, toStatus(err)
+	}
+	return toStruct(toolkit.M{"records": res})
+}
+
+// Save insert or update a record
+func (s *Server) Save(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	table, m, err := s.prepare(ctx, "Save", req)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := m["record"].(map[string]interface{})
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "record is mandatory")
+	}
+	if err = s.hub(ctx).SaveAny(table, toolkit.M(record)); err != nil {
+		return nil, toStatus(err)
+	}
+	return toStruct(toolkit.M{"record": record})
+}
+
+// Delete delete records by id or filter, filter is mandatory
+func (s *Server) Delete(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	table, m, err := s.prepare(ctx, "Delete", req)
+	if err != nil {
+		return nil, err
+	}
+	where, err := s.keyFilter(m)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.hub(ctx).DeleteAny(table, where); err != nil {
+		return nil, toStatus(err)
+	}
+	return toStruct(toolkit.M{})
+}
+
+// Aggregate returns grouped and aggregated records
+func (s *Server) Aggregate(ctx context.Context, req *structpb.Struct) (*structpb.Struct, error) {
+	table, m, err := s.prepare(ctx, "Aggregate", req)
+	if err != nil {
+		return nil, err
+	}
+	parm, err := datahub.QueryParamFromM(m)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if len(parm.Aggregates) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "aggregates is mandatory")
+	}
+
+	res := []toolkit.M{}
+	if err = s.hub(ctx).PopulateByParm(table, parm, &res); err != nil {
+		return nil, toStatus(err)
+	}
+	return toStruct(toolkit.M{"records": res})
+}
+
+func (s *Server) prepare(ctx context.Context, method string, req *structpb.Struct) (string, toolkit.M, error) {
+	m := toolkit.M(req.AsMap())
+	table, _ := m["table"].(string)
+	if table == "" {
+		return "", nil, status.Error(codes.InvalidArgument, "table is mandatory")
+	}
+	if len(s.tables) > 0 && !s.tables[strings.ToLower(table)] {
+		return "", nil, status.Errorf(codes.PermissionDenied, "table %s is not accessible", table)
+	}
+	if s.opts.Authorize != nil {
+		if err := s.opts.Authorize(ctx, method, table); err != nil {
+			return "", nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+	return table, m, nil
+}
+
+func (s *Server) keyFilter(m toolkit.M) (*dbflex.Filter, error) {
+	if id, ok := m["id"]; ok && id != nil {
+		return dbflex.Eq(s.opts.KeyField, id), nil
+	}
+	if w, ok := m["where"].(map[string]interface{}); ok {
+		f, err := datahub.FilterFromM(w)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if f != nil {
+			return f, nil
+		}
+	}
+	return nil, status.Error(codes.InvalidArgument, "id or where is mandatory")
+}
+
+// toStruct convert document to Struct, values are normalized through JSON so time and custom types are accepted
+func toStruct(m toolkit.M) (*structpb.Struct, error) {
+	bs, err := json.Marshal(m)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	generic := map[string]interface{}{}
+	if err = json.Unmarshal(bs, &generic); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	res, err := structpb.NewStruct(generic)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return res, nil
+}
+
+func toStatus(err error) error {
+	var (
+		gerr *datahub.GuardError
+		verr *datahub.ValidationError
+		cerr *datahub.ConstraintError
+		nerr *datahub.ConnectionError
+	)
+	switch {
+	case errors.As(err, &gerr):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.As(err, &verr):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, datahub.ErrNotSupported):
+		return status.Error(codes.Unimplemented, err.Error())
+	case errors.Is(err, datahub.ErrReadOnly):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, datahub.ErrTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, datahub.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, datahub.ErrDuplicateKey), errors.As(err, &cerr):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.As(err, &nerr):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, datahub.ErrRateLimited), errors.Is(err, datahub.ErrShed):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+type dataHubServer interface {
+	Get(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	Gets(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	Save(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	Delete(context.Context, *structpb.Struct) (*structpb.Struct, error)
+	Aggregate(context.Context, *structpb.Struct) (*structpb.Struct, error)
+}
+
+func unaryHandler(name string, fn func(dataHubServer, context.Context, *structpb.Struct) (*structpb.Struct, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(structpb.Struct)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return fn(srv.(dataHubServer), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + name}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return fn(srv.(dataHubServer), ctx, req.(*structpb.Struct))
+			}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*dataHubServer)(nil),
+	Methods: []grpc.MethodDesc{
+		unaryHandler("Get", dataHubServer.Get),
+		unaryHandler("Gets", dataHubServer.Gets),
+		unaryHandler("Save", dataHubServer.Save),
+		unaryHandler("Delete", dataHubServer.Delete),
+		unaryHandler("Aggregate", dataHubServer.Aggregate),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "datahub.proto",
+}
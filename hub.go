@@ -1,7 +1,9 @@
 package datahub
 
 import (
+	"context"
 	"fmt"
+	"reflect"
 	"sync"
 	"time"
 
@@ -13,34 +15,167 @@ import (
 
 // Hub main datahub object. This object need to be initiated to work with datahub
 type Hub struct {
-	connFn   func() (dbflex.IConnection, error)
+	conns    *connFactory
 	usePool  bool
-	pool     *dbflex.DbPooling
+	pools    *hubPool
 	poolSize int
 
-	poolItems []*dbflex.PoolItem
+	poolTimeout     time.Duration
+	poolAutoClose   time.Duration
+	poolAutoRelease time.Duration
+	poolEager       int
+
+	poolItems map[int]*pooledItem
 	mtx       *sync.Mutex
 	_log      *toolkit.LogEngine
-
-	txconn dbflex.IConnection
-}
-
-// NewHub function to create new hub
-func NewHub(fn func() (dbflex.IConnection, error), usePool bool, poolsize int) *Hub {
+	logger    Logger
+
+	txconn   dbflex.IConnection
+	lockMode LockMode
+
+	lockTableName string
+
+	sequenceTableName string
+	sequenceMtx       *sync.Mutex
+	sequences         map[string]*sequenceState
+
+	idGenerator IDGenerator
+
+	projectionTableName string
+
+	ttlMtx     *sync.Mutex
+	ttlWorkers map[string]chan bool
+
+	skipValidation bool
+
+	opTimeout      time.Duration
+	defaultTimeout time.Duration
+
+	maxTake         int
+	protectedTables map[string]bool
+	unguarded       bool
+	modelDefaults   map[string]*modelDefaults
+	scopes          map[string]ScopeFunc
+	decodeOpts      *DecodeOptions
+	converters      map[converterKey]ConvertFunc
+	converterKeys   []converterKey
+	timeLocation    *time.Location
+	enums           map[reflect.Type]map[string][]string
+	models          []orm.DataModel
+	tablePrefix     string
+	tableSuffix     string
+	intoTable       string
+	stats           *hubStats
+	limits          *rateLimits
+	limiter         *opLimiter
+	priority        Priority
+	readOnly        bool
+	session         *hubSession
+	provider        *connProvider
+	config          *HubConfig
+	configHandlers  []func(ev ConfigChange)
+	profileLabels   bool
+	ctx             context.Context
+
+	idempotencyTableName string
+	idempotencyKey       string
+	sagaTableName        string
+	versionFields        map[string]*versionField
+
+	meta toolkit.M
+
+	partitions map[string]*partitioning
+
+	publishers      []EventPublisher
+	outboxTableName string
+	txEvents        *txEventQueue
+
+	cache        Cache
+	cacheTTL     time.Duration
+	cachedTables map[string]bool
+	cacheGens    *cacheGenerations
+}
+
+// NewHub function to create new hub, see PoolConfig for settings of the pool which could be changed by opts
+func NewHub(fn func() (dbflex.IConnection, error), usePool bool, poolsize int, opts ...Option) *Hub {
 	h := new(Hub)
-	h.connFn = fn
+	h.conns = &connFactory{fn: fn}
 	h.usePool = usePool
+	h.pools = new(hubPool)
 	h.poolSize = poolsize
+	h.mtx = new(sync.Mutex)
+	h.poolItems = map[int]*pooledItem{}
+	h.statsOf()
+	h.cacheGensOf()
+	h.rateLimitsOf()
+	h.limiterOf()
 
-	if h.usePool {
-		h.pool = dbflex.NewDbPooling(h.poolSize, h.connFn).SetLog(h.Log())
-		h.pool.Timeout = 7 * time.Second
-		h.pool.AutoClose = 5 * time.Second
-		//h.pool.AutoRelease = 3 * time.Second
+	for _, opt := range opts {
+		opt(h)
 	}
+	h.startPool()
 	return h
 }
 
+// scope returns copy of the hub to hold call specific options. The copy share pool, connection and states with the
+// original hub, hence shared states need to be initialized before the hub is copied
+func (h *Hub) scope() *Hub {
+	if h.mtx == nil {
+		h.mtx = new(sync.Mutex)
+	}
+	if h.poolItems == nil {
+		h.poolItems = map[int]*pooledItem{}
+	}
+	if h.conns == nil {
+		h.conns = new(connFactory)
+	}
+	if h.pools == nil {
+		h.pools = new(hubPool)
+	}
+	if h.usePool {
+		h.poolOf()
+	}
+	if h.sequences == nil {
+		h.sequences = map[string]*sequenceState{}
+	}
+	if h.ttlWorkers == nil {
+		h.ttlWorkers = map[string]chan bool{}
+	}
+	if h.protectedTables == nil {
+		h.protectedTables = map[string]bool{}
+	}
+	if h.modelDefaults == nil {
+		h.modelDefaults = map[string]*modelDefaults{}
+	}
+	if h.scopes == nil {
+		h.scopes = map[string]ScopeFunc{}
+	}
+	if h.converters == nil {
+		h.converters = map[converterKey]ConvertFunc{}
+	}
+	if h.enums == nil {
+		h.enums = map[reflect.Type]map[string][]string{}
+	}
+	if h.partitions == nil {
+		h.partitions = map[string]*partitioning{}
+	}
+	if h.cachedTables == nil {
+		h.cachedTables = map[string]bool{}
+	}
+	if h.versionFields == nil {
+		h.versionFields = map[string]*versionField{}
+	}
+	h.seqMtx()
+	h.ttlLock()
+	h.statsOf()
+	h.cacheGensOf()
+	h.rateLimitsOf()
+	h.limiterOf()
+
+	nh := *h
+	return &nh
+}
+
 // Log get logger object
 func (h *Hub) Log() *toolkit.LogEngine {
 	if h._log == nil {
@@ -52,8 +187,8 @@ func (h *Hub) Log() *toolkit.LogEngine {
 // SetLog set logger
 func (h *Hub) SetLog(l *toolkit.LogEngine) *Hub {
 	h._log = l
-	if h.pool != nil {
-		h.pool.SetLog(l)
+	if h.pools != nil && h.pools.pool != nil {
+		h.pools.pool.SetLog(l)
 	}
 	return h
 }
@@ -70,9 +205,11 @@ func (h *Hub) CloseConnection(idx int, conn dbflex.IConnection) {
 	h.closeConn(idx, conn)
 }
 
-// GetClassicConnection get connection without using pool. CleanUp operation need to be done manually
+// GetClassicConnection get connection without using pool. CleanUp operation need to be done manually.
+//
+// Deprecated: connection that is not closed is leaked, use Native or WithNative instead
 func (h *Hub) GetClassicConnection() (dbflex.IConnection, error) {
-	return h.connFn()
+	return h.connect()
 }
 
 func (h *Hub) getConnFromPool() (int, dbflex.IConnection, error) {
@@ -80,55 +217,47 @@ func (h *Hub) getConnFromPool() (int, dbflex.IConnection, error) {
 		return -1, h.txconn, nil
 	}
 
-	if h.poolSize == 0 {
-		h.poolSize = 100
-	}
-
 	if h.mtx == nil {
 		h.mtx = new(sync.Mutex)
 	}
 
-	if h.pool == nil {
-		h.pool = dbflex.NewDbPooling(h.poolSize, h.connFn).SetLog(h.Log())
-		h.pool.Timeout = 90 * time.Second
-		h.pool.AutoClose = 5 * time.Second
-		//h.pool.AutoRelease = 3 * time.Second
-	}
-
-	it, err := h.pool.Get()
+	pool := h.poolOf()
+	it, err := pool.Get()
 	if err != nil {
-		return -1, nil, fmt.Errorf("unable get connection from pool. %s", err.Error())
+		return -1, nil, fmt.Errorf("unable get connection from pool. %w", err)
 	}
 
 	conn := it.Connection()
-	idx := -1
 	h.mtx.Lock()
 	defer h.mtx.Unlock()
 
-	h.poolItems = append(h.poolItems, it)
-	idx = it.ID
+	if h.poolItems == nil {
+		h.poolItems = map[int]*pooledItem{}
+	}
+	// items are indexed by the hub as ids of items of different pools could collide after Reconnect
+	h.pools.lastIdx++
+	idx := h.pools.lastIdx
+	h.poolItems[idx] = &pooledItem{PoolItem: it, pool: pool}
 	return idx, conn, nil
 }
 
 // SetAutoCloseDuration set duration for a connection inside Hub Pool to be closed if it is not being used
 func (h *Hub) SetAutoCloseDuration(d time.Duration) *Hub {
+	h.poolAutoClose = d
 	if h.usePool {
-		if h.pool == nil {
-			h.pool = dbflex.NewDbPooling(h.poolSize, h.connFn)
-		}
-		h.pool.AutoClose = d
+		h.poolOf().AutoClose = d
 	}
 	return h
 }
 
 // SetAutoReleaseDuration set duration for a connection in pool to be released for a process
 func (h *Hub) SetAutoReleaseDuration(d time.Duration) *Hub {
+	h.poolAutoRelease = d
+	h.poolTimeout = d + time.Duration(5*time.Second)
 	if h.usePool {
-		if h.pool == nil {
-			h.pool = dbflex.NewDbPooling(h.poolSize, h.connFn)
-		}
-		h.pool.Timeout = d + time.Duration(5*time.Second)
-		h.pool.AutoRelease = d
+		p := h.poolOf()
+		p.Timeout = h.poolTimeout
+		p.AutoRelease = d
 	}
 	return h
 }
@@ -138,58 +267,93 @@ func (h *Hub) closeConn(idx int, conn dbflex.IConnection) {
 		return
 	}
 
+	if dc, ok := conn.(*deadlineConn); ok {
+		conn = dc.IConnection
+		if dc.isAbandoned() {
+			// connection is still used by timed out call, once the call returns it is closed rather than reused. Pooled
+			// connection is reopened before it is given back, so the pool does not hand out a closed connection
+			go func() {
+				dc.inflight.Wait()
+				conn.Close()
+				if h.usePool && idx >= 0 {
+					if err := conn.Connect(); err != nil {
+						h.Logger().Warn("unable to reopen abandoned connection", "error", err.Error())
+						h.dropItem(idx)
+						h.limiterOf().release()
+						return
+					}
+				}
+				h.releaseItem(idx)
+				h.limiterOf().release()
+			}()
+			return
+		}
+	}
+
 	if !h.usePool {
 		conn.Close()
 	}
+	h.releaseItem(idx)
+	h.limiterOf().release()
+}
 
+func (h *Hub) releaseItem(idx int) {
 	if h.mtx == nil {
 		h.mtx = new(sync.Mutex)
 	}
 	h.mtx.Lock()
 	defer h.mtx.Unlock()
 
-	for _, it := range h.poolItems {
-		if it.ID == idx {
-			it.Release()
-			break
+	if it, ok := h.poolItems[idx]; ok {
+		it.Release()
+		delete(h.poolItems, idx)
+		if it.pool != h.pools.pool {
+			h.closeRetiredPool(it.pool)
 		}
 	}
+}
 
-	/*
-		if idx < len(h.poolItems) && idx != -1 {
-			itemCount := len(h.poolItems)
-			h.poolItems[idx].Release()
-			if itemCount == 0 {
-				h.poolItems = []*dbflex.PoolItem{}
-			} else if idx == 0 {
-				h.poolItems = h.poolItems[1:]
-			} else if idx == len(h.poolItems)-1 {
-				h.poolItems = h.poolItems[:idx]
-			} else {
-				h.poolItems = append(h.poolItems[:idx], h.poolItems[idx+1:]...)
-			}
-		}
-	*/
+// dropItem forget pool item of connection which could not be reopened, the item is kept as in use by the pool so it
+// is never handed out again. The pool is reset by Reconnect
+func (h *Hub) dropItem(idx int) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	delete(h.poolItems, idx)
 }
 
 func (h *Hub) getConn() (int, dbflex.IConnection, error) {
+	if err := h.waitRate(""); err != nil {
+		return -1, nil, err
+	}
+	if h.session != nil && h.session.isClosed() {
+		return -1, nil, ErrSessionClosed
+	}
 	if h.txconn != nil {
 		return -1, h.txconn, nil
 	}
 
-	if h.connFn == nil {
+	if !h.hasConnFn() {
 		return -1, nil, fmt.Errorf("connection fn is not yet defined")
 	}
+	if err := h.limiterOf().acquire(h.priority == PriorityBatch); err != nil {
+		return -1, nil, err
+	}
 
 	if h.usePool {
-		return h.getConnFromPool()
+		idx, conn, err := h.getConnFromPool()
+		if err != nil {
+			h.limiterOf().release()
+			return idx, conn, err
+		}
+		return idx, h.withDeadline(h.withReadOnly(conn)), nil
 	}
 
-	conn, err := h.connFn()
+	conn, err := h.connect()
 	if err != nil {
-		return -1, nil, fmt.Errorf("unable to open connection. %s", err.Error())
+		h.limiterOf().release()
+		return -1, nil, fmt.Errorf("unable to open connection. %w", err)
 	}
-	return -1, conn, nil
+	return -1, h.withDeadline(h.withReadOnly(conn)), nil
 }
 
 // UsePool is a hub using pool
@@ -203,121 +367,233 @@ func (h *Hub) PoolSize() int {
 }
 
 // DeleteQuery delete object in database based on specific model and filter
-func (h *Hub) DeleteQuery(model orm.DataModel, where *dbflex.Filter) error {
+func (h *Hub) DeleteQuery(model orm.DataModel, where *dbflex.Filter) (err error) {
+	model.SetThis(model)
+	defer h.observeQuery("delete", model.TableName(), where, h.startOp("delete", model.TableName()), &err)
+	if err = h.waitRate(model.TableName()); err != nil {
+		return err
+	}
+	if err := h.guardWrite("delete", model.TableName(), where); err != nil {
+		return err
+	}
+	where = h.filterToUTC(where)
+
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	cmd := dbflex.From(model.TableName()).Delete()
+	cmd := dbflex.From(h.tableOf(model)).Delete()
 	if where != nil {
 		cmd.Where(where)
 	}
-	_, err = conn.Execute(cmd, nil)
-	return err
+	if _, err = conn.Execute(cmd, nil); err != nil {
+		return err
+	}
+	if err = h.emit(conn, EventDelete, model.TableName(), where, nil); err != nil {
+		return err
+	}
+	return nil
 }
 
 // Save will save data into database
-func (h *Hub) Save(data orm.DataModel) error {
+func (h *Hub) Save(data orm.DataModel) (err error) {
+	if h.idempotencyKey != "" {
+		return h.idempotent("save", data, (*Hub).Save)
+	}
 	data.SetThis(data)
+	defer h.observe("save", data.TableName(), h.startOp("save", data.TableName()), &err)
+	if err = h.waitRate(data.TableName()); err != nil {
+		return err
+	}
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	if err = orm.Save(conn, data); err != nil {
+	if err = h.applyIDGenerator(conn, data); err != nil {
+		return fmt.Errorf("unable to generate id. %w", err)
+	}
+
+	if err = h.validate(data); err != nil {
 		return err
 	}
 
+	defer h.timeToUTC(data)()
+	if err = ormSave(conn, h.mapped(conn, data)); err != nil {
+		return duplicateKey(err)
+	}
+
+	if err = h.emit(conn, EventSave, data.TableName(), data, nil); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Insert will create data into database
-func (h *Hub) Insert(data orm.DataModel) error {
+func (h *Hub) Insert(data orm.DataModel) (err error) {
+	if h.idempotencyKey != "" {
+		return h.idempotent("insert", data, (*Hub).Insert)
+	}
 	data.SetThis(data)
+	defer h.observe("insert", data.TableName(), h.startOp("insert", data.TableName()), &err)
+	if err = h.waitRate(data.TableName()); err != nil {
+		return err
+	}
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	if err = orm.Insert(conn, data); err != nil {
+	if err = h.applyIDGenerator(conn, data); err != nil {
+		return fmt.Errorf("unable to generate id. %w", err)
+	}
+
+	if err = h.applyDefaults(data); err != nil {
+		return fmt.Errorf("unable to apply default value. %w", err)
+	}
+
+	if err = h.validate(data); err != nil {
 		return err
 	}
 
+	defer h.timeToUTC(data)()
+	if err = ormInsert(conn, h.mapped(conn, data)); err != nil {
+		return duplicateKey(err)
+	}
+
+	if err = h.emit(conn, EventInsert, data.TableName(), data, nil); err != nil {
+		return err
+	}
 	return nil
 }
 
 // UpdateField update relevant fields in data based on specific filter
-func (h *Hub) UpdateField(data orm.DataModel, where *dbflex.Filter, fields ...string) error {
+func (h *Hub) UpdateField(data orm.DataModel, where *dbflex.Filter, fields ...string) (err error) {
 	data.SetThis(data)
+	defer h.observeQuery("update", data.TableName(), where, h.startOp("update", data.TableName()), &err)
+	if err = h.waitRate(data.TableName()); err != nil {
+		return err
+	}
+	if err := h.guardWrite("update", data.TableName(), where); err != nil {
+		return err
+	}
+	where = h.filterToUTC(where)
+
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
+	defer h.timeToUTC(data)()
 	updatedFields := fields
-	cmd := dbflex.From(data.TableName()).Update(updatedFields...).Where(where)
-	conn.Execute(cmd, toolkit.M{}.Set("data", data))
+	cmd := dbflex.From(h.tableOf(data)).Update(updatedFields...).Where(where)
+	if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", data)); err != nil {
+		return duplicateKey(err)
+	}
+	if err = h.emit(conn, EventUpdate, data.TableName(), data, fields); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Update will update single data in database based on specific model
-func (h *Hub) Update(data orm.DataModel) error {
+func (h *Hub) Update(data orm.DataModel) (err error) {
+	if h.idempotencyKey != "" {
+		return h.idempotent("update", data, (*Hub).Update)
+	}
 	data.SetThis(data)
+	defer h.observe("update", data.TableName(), h.startOp("update", data.TableName()), &err)
+	if err = h.waitRate(data.TableName()); err != nil {
+		return err
+	}
+	if err := h.validate(data); err != nil {
+		return err
+	}
+
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	if err = orm.Update(conn, data); err != nil {
-		return err
+	defer h.timeToUTC(data)()
+	if err = ormUpdate(conn, h.mapped(conn, data)); err != nil {
+		return duplicateKey(err)
 	}
 
+	if err = h.emit(conn, EventUpdate, data.TableName(), data, nil); err != nil {
+		return err
+	}
 	return nil
 }
 
 // Delete delete respective model record on database
-func (h *Hub) Delete(data orm.DataModel) error {
+func (h *Hub) Delete(data orm.DataModel) (err error) {
+	if h.idempotencyKey != "" {
+		return h.idempotent("delete", data, (*Hub).Delete)
+	}
 	data.SetThis(data)
+	defer h.observe("delete", data.TableName(), h.startOp("delete", data.TableName()), &err)
+	if err = h.waitRate(data.TableName()); err != nil {
+		return err
+	}
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	if err = orm.Delete(conn, data); err != nil {
+	if err = ormDelete(conn, h.mapped(conn, data)); err != nil {
 		return err
 	}
 
+	if err = h.emit(conn, EventDelete, data.TableName(), data, nil); err != nil {
+		return err
+	}
 	return nil
 }
 
-// GetByID returns single data based on its ID. Data need to be comply with orm.DataModel
+// GetByID returns single data based on its ID. Data need to be comply with orm.DataModel. For composite key, ids are
+// values of the key fields in order of their declaration or a single toolkit.M of key field name and its value
 func (h *Hub) GetByID(data orm.DataModel, ids ...interface{}) error {
 	data.SetThis(data)
-	data.SetID(ids...)
+	if err := setKeys(data, ids); err != nil {
+		return fmt.Errorf("fail GetByID: %w", err)
+	}
 	return h.Get(data)
 }
 
 // GetByParm return single data based on filter
-func (h *Hub) GetByParm(data orm.DataModel, parm *dbflex.QueryParam) error {
+func (h *Hub) GetByParm(data orm.DataModel, parm *dbflex.QueryParam) (err error) {
 	data.SetThis(data)
+	if h.lockMode != "" {
+		return h.getByParmWithLock(data, parm)
+	}
+	defer h.observe("get", data.TableName(), h.startOp("get", data.TableName()), &err)
+	if err = h.waitRate(data.TableName()); err != nil {
+		return err
+	}
 	if parm == nil {
 		parm = dbflex.NewQueryParam()
 	}
+	parm = h.applyModelDefaults(data.TableName(), parm)
 
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	cmd := dbflex.From(data.TableName())
+	if parm, err = nativeParm(conn, parm); err != nil {
+		return err
+	}
+
+	cmd := dbflex.From(h.tableOf(data))
 	if len(parm.Select) == 0 {
 		cmd.Select()
 	} else {
@@ -335,6 +611,13 @@ func (h *Hub) GetByParm(data orm.DataModel, parm *dbflex.QueryParam) error {
 	if take := parm.Take; take > 0 {
 		cmd.Take(take)
 	}
+	if h.decodeByHub(data) {
+		if err = h.fetchDecoded(conn, h.tableOf(data), parm, data); err != nil {
+			return err
+		}
+		return h.afterFetch(data)
+	}
+
 	cursor := conn.Cursor(cmd, nil)
 	if err := cursor.Error(); err != nil {
 		return err
@@ -343,87 +626,149 @@ func (h *Hub) GetByParm(data orm.DataModel, parm *dbflex.QueryParam) error {
 	if err = cursor.Fetch(data).Close(); err != nil {
 		return err
 	}
-	return nil
+	return h.afterFetch(data)
 }
 
 // Get return single data based on model. It will find record based on releant ID field
-func (h *Hub) Get(data orm.DataModel) error {
+func (h *Hub) Get(data orm.DataModel) (err error) {
 	data.SetThis(data)
+	if h.lockMode != "" {
+		return h.GetWithLock(data, h.lockMode)
+	}
+	defer h.observe("get", data.TableName(), h.startOp("get", data.TableName()), &err)
+	if err = h.waitRate(data.TableName()); err != nil {
+		return err
+	}
+	cacheKey := h.idCacheKey(data.TableName(), keyValues(data))
+	if h.cacheGet(data.TableName(), cacheKey, data) {
+		return h.afterFetch(data)
+	}
+	gen := h.cacheGen(data.TableName())
+
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	if err = orm.Get(conn, data); err != nil {
+	if h.decodeByHub(data) {
+		where, err := keyFilterOf(conn, data)
+		if err != nil {
+			return err
+		}
+		err = h.fetchDecoded(conn, h.tableOf(data), dbflex.NewQueryParam().SetWhere(where).SetTake(1), data)
+		if err != nil {
+			return err
+		}
+	} else if err = ormGet(conn, h.mapped(conn, data)); err != nil {
 		return err
 	}
 
-	return nil
+	h.cacheSet(data.TableName(), cacheKey, data, gen)
+	return h.afterFetch(data)
 }
 
 // Gets return all data based on model and filter
-func (h *Hub) Gets(data orm.DataModel, parm *dbflex.QueryParam, dest interface{}) error {
-	if parm == nil {
-		parm = dbflex.NewQueryParam()
+func (h *Hub) Gets(data orm.DataModel, parm *dbflex.QueryParam, dest interface{}) (err error) {
+	data.SetThis(data)
+	if h.lockMode != "" {
+		return h.GetsWithLock(data, parm, dest, h.lockMode)
+	}
+	defer h.observeQuery("gets", data.TableName(), whereOf(parm), h.startOp("gets", data.TableName()), &err)
+	if err = h.waitRate(data.TableName()); err != nil {
+		return err
+	}
+	parm, err = h.prepareQuery("gets", data.TableName(), parm)
+	if err != nil {
+		return err
 	}
 
+	cacheKey := h.queryCacheKey(data.TableName(), parm)
+	if h.cacheGet(data.TableName(), cacheKey, dest) {
+		return h.afterFetch(dest)
+	}
+	gen := h.cacheGen(data.TableName())
+
+	if err = h.getsNoCache(data, parm, dest); err != nil {
+		return err
+	}
+
+	h.cacheSet(data.TableName(), cacheKey, dest, gen)
+	return h.afterFetch(dest)
+}
+
+func (h *Hub) getsNoCache(data orm.DataModel, parm *dbflex.QueryParam, dest interface{}) error {
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	if err = orm.Gets(conn, data, dest, parm); err != nil {
+	if parm, err = nativeParm(conn, parm); err != nil {
 		return err
 	}
-
-	return nil
+	if h.decodeByHub(data) {
+		if parm == nil {
+			parm = dbflex.NewQueryParam()
+		}
+		return h.fetchDecoded(conn, h.tableOf(data), parm, dest)
+	}
+	return ormGets(conn, h.mapped(conn, data), dest, parm)
 }
 
 // Count returns number of data based on model and filter
-func (h *Hub) Count(data orm.DataModel, qp *dbflex.QueryParam) (int, error) {
+func (h *Hub) Count(data orm.DataModel, qp *dbflex.QueryParam) (n int, err error) {
+	data.SetThis(data)
+	defer h.observeQuery("count", data.TableName(), whereOf(qp), h.startOp("count", data.TableName()), &err)
+	if err = h.waitRate(data.TableName()); err != nil {
+		return 0, err
+	}
 	if qp == nil {
 		qp = dbflex.NewQueryParam()
 	}
 
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return 0, fmt.Errorf("connection error. %s", err.Error())
+		return 0, &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
+	if qp, err = nativeParm(conn, qp); err != nil {
+		return 0, err
+	}
 	var cmd dbflex.ICommand
 	if qp == nil || qp.Where == nil {
-		cmd = dbflex.From(data.TableName())
+		cmd = dbflex.From(h.tableOf(data))
 	} else {
-		cmd = dbflex.From(data.TableName()).Where(qp.Where)
+		cmd = dbflex.From(h.tableOf(data)).Where(qp.Where)
 	}
 	cur := conn.Cursor(cmd, nil)
 	if err = cur.Error(); err != nil {
-		return 0, fmt.Errorf("cursor error. %s", err.Error())
+		return 0, fmt.Errorf("cursor error. %w", err)
 	}
 	defer cur.Close()
 	return cur.Count(), nil
 }
 
-// Execute will execute command. Normally used with no-datamodel object
+// Execute will execute command. Normally used with no-datamodel object. Cache of all cached tables is invalidated
 func (h *Hub) Execute(cmd dbflex.ICommand, object interface{}) (interface{}, error) {
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return nil, fmt.Errorf("connection error. %s", err.Error())
+		return nil, &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
+	defer h.invalidateAllCache()
 
 	parm := toolkit.M{}
 	return conn.Execute(cmd, parm.Set("data", object))
 }
 
-// Populate will return all data based on command. Normally used with no-datamodel object
+// Populate will return all data based on command. Normally used with no-datamodel object. Command returning more
+// records than max take of the hub is rejected with GuardError
 func (h *Hub) Populate(cmd dbflex.ICommand, result interface{}, objects ...toolkit.M) (int, error) {
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return 0, fmt.Errorf("connection error. %s", err.Error())
+		return 0, &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
@@ -434,24 +779,44 @@ func (h *Hub) Populate(cmd dbflex.ICommand, result interface{}, objects ...toolk
 
 	c := conn.Cursor(cmd, object)
 	if err = c.Error(); err != nil {
-		return 0, fmt.Errorf("unable to prepare cursor. %s", err.Error())
+		return 0, fmt.Errorf("unable to prepare cursor. %w", err)
 	}
 	defer c.Close()
-	if err = c.Fetchs(result, 0).Error(); err != nil {
-		return 0, fmt.Errorf("unable to fetch data. %s", err.Error())
+	limit := 0
+	if h.maxTake > 0 && !h.unguarded {
+		// one more record is read to know whether the result exceeds max take
+		limit = h.maxTake + 1
+	}
+	if err = c.Fetchs(result, limit).Error(); err != nil {
+		return 0, fmt.Errorf("unable to fetch data. %w", err)
+	}
+	if rv := reflect.Indirect(reflect.ValueOf(result)); limit > 0 && rv.Kind() == reflect.Slice && rv.Len() > h.maxTake {
+		return 0, &GuardError{Op: "populate", Table: "command", Msg: fmt.Sprintf("result exceeds max take %d", h.maxTake)}
 	}
 	return c.Count(), nil
 }
 
 // PopulateByParm returns all data based on table name and QueryParm. Normally used with no-datamodel object
-func (h *Hub) PopulateByParm(tableName string, parm *dbflex.QueryParam, dest interface{}) error {
+func (h *Hub) PopulateByParm(tableName string, parm *dbflex.QueryParam, dest interface{}) (err error) {
+	defer h.observeQuery("populate", tableName, whereOf(parm), h.startOp("populate", tableName), &err)
+	if err = h.waitRate(tableName); err != nil {
+		return err
+	}
+	parm, err = h.prepareQuery("populate", tableName, parm)
+	if err != nil {
+		return err
+	}
+
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	qry := dbflex.From(tableName)
+	if parm, err = nativeParm(conn, parm); err != nil {
+		return err
+	}
+	qry := dbflex.From(h.table(tableName))
 	if w := parm.Select; w != nil {
 		qry.Select(w...)
 	}
@@ -476,7 +841,7 @@ func (h *Hub) PopulateByParm(tableName string, parm *dbflex.QueryParam, dest int
 
 	cur := conn.Cursor(qry, nil)
 	if err = cur.Error(); err != nil {
-		return fmt.Errorf("error when running cursor for PopulateByParm. %s", err.Error())
+		return fmt.Errorf("error when running cursor for PopulateByParm. %w", err)
 	}
 	defer cur.Close()
 
@@ -488,57 +853,124 @@ func (h *Hub) PopulateByParm(tableName string, parm *dbflex.QueryParam, dest int
 func (h *Hub) PopulateSQL(sql string, dest interface{}) error {
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
 	qry := dbflex.SQL(sql)
 	cur := conn.Cursor(qry, nil)
 	if err = cur.Error(); err != nil {
-		return fmt.Errorf("error when running cursor for PopulateSQL. %s", err.Error())
+		return fmt.Errorf("error when running cursor for PopulateSQL. %w", err)
 	}
 
 	err = cur.Fetchs(dest, 0).Close()
 	return err
 }
 
+// Close stop background workers of the hub and close the pool. Close of session hub only returns connection of the
+// session to the pool
 func (h *Hub) Close() {
+	if h.session != nil {
+		h.session.close()
+		return
+	}
+	h.stopConnProvider()
+	h.stopTTLWorkers()
+	h.closeSQLDB()
 	if h.usePool {
-		h.pool.Close()
+		h.mtx.Lock()
+		if h.pools.pool != nil {
+			h.pools.pool.Close()
+		}
+		h.mtx.Unlock()
 	}
 }
 
-// SaveAny save any object into database table. Normally used with no-datamodel object
-func (h *Hub) SaveAny(name string, object interface{}) error {
+// SaveAny save any object into database table. Normally used with no-datamodel object, see SetVersionField for
+// optimistic concurrency
+func (h *Hub) SaveAny(name string, object interface{}) (err error) {
+	defer h.observe("save", name, h.startOp("save", name), &err)
+	if err = h.waitRate(name); err != nil {
+		return err
+	}
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	cmd := dbflex.From(name).Save()
+	if vf := h.versionFieldOf(name); vf != nil {
+		if err = h.writeVersioned(conn, vf, name, object, nil); err != nil {
+			return fmt.Errorf("unable to save. %w", err)
+		}
+		h.invalidateCache(name)
+		return nil
+	}
+
+	cmd := dbflex.From(h.table(name)).Save()
 	if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", object)); err != nil {
-		return fmt.Errorf("unable to save. %s", err.Error())
+		return fmt.Errorf("unable to save. %w", duplicateKey(err))
 	}
+	h.invalidateCache(name)
 	return nil
 }
 
 // UpdateAny update specific fields on database table. Normally used with no-datamodel object
 // Will be deprecated
-func (h *Hub) UpdateAny(name string, object interface{}, fields ...string) error {
+func (h *Hub) UpdateAny(name string, object interface{}, fields ...string) (err error) {
+	defer h.observe("update", name, h.startOp("update", name), &err)
+	if err = h.waitRate(name); err != nil {
+		return err
+	}
 	idx, conn, err := h.getConn()
 	if err != nil {
-		return fmt.Errorf("connection error. %s", err.Error())
+		return &ConnectionError{Err: err}
 	}
 	defer h.closeConn(idx, conn)
 
-	cmd := dbflex.From(name).Update(fields...)
+	if vf := h.versionFieldOf(name); vf != nil {
+		if err = h.writeVersioned(conn, vf, name, object, fields); err != nil {
+			return fmt.Errorf("unable to save. %w", err)
+		}
+		h.invalidateCache(name)
+		return nil
+	}
+
+	cmd := dbflex.From(h.table(name)).Update(fields...)
 	if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", object)); err != nil {
-		return fmt.Errorf("unable to save. %s", err.Error())
+		return fmt.Errorf("unable to save. %w", duplicateKey(err))
 	}
+	h.invalidateCache(name)
 	return nil
 }
 
+// DeleteAny delete records of database table matching the filter. Normally used with no-datamodel object. Like
+// DeleteQuery it is rejected on protected table without filter and on read only hub
+func (h *Hub) DeleteAny(name string, where *dbflex.Filter) (err error) {
+	defer h.observeQuery("delete", name, where, h.startOp("delete", name), &err)
+	if err = h.waitRate(name); err != nil {
+		return err
+	}
+	if err := h.guardWrite("delete", name, where); err != nil {
+		return err
+	}
+	where = h.filterToUTC(where)
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	cmd := dbflex.From(h.table(name)).Delete()
+	if where != nil {
+		cmd.Where(where)
+	}
+	if _, err = conn.Execute(cmd, nil); err != nil {
+		return fmt.Errorf("unable to delete. %w", err)
+	}
+	return h.emit(conn, EventDelete, name, where, nil)
+}
+
 // EnsureTable will ensure existense of table according to given object
 func (h *Hub) EnsureTable(name string, keys []string, object interface{}) error {
 	idx, conn, e := h.GetConnection()
@@ -546,7 +978,7 @@ func (h *Hub) EnsureTable(name string, keys []string, object interface{}) error
 		return e
 	}
 	defer h.CloseConnection(idx, conn)
-	return conn.EnsureTable(name, keys, object)
+	return conn.EnsureTable(h.table(name), keys, object)
 }
 
 // Validate validate if a connection can be established
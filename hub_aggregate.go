@@ -0,0 +1,134 @@
+package datahub
+
+import (
+	"fmt"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// Lookup define a join with other collection using mongo $lookup stage.
+// As is the field on result holding joined documents, if Unwind is true the field will hold single document
+// instead of array. PreserveEmpty keep the document when Unwind is true and there is no joined document
+type Lookup struct {
+	From          string
+	LocalField    string
+	ForeignField  string
+	As            string
+	Unwind        bool
+	PreserveEmpty bool
+}
+
+// Stages returns pipeline stages of the lookup
+func (l Lookup) Stages() []toolkit.M {
+	as := l.As
+	if as == "" {
+		as = l.From
+	}
+	stages := []toolkit.M{
+		{"$lookup": toolkit.M{
+			"from":         l.From,
+			"localField":   l.LocalField,
+			"foreignField": l.ForeignField,
+			"as":           as,
+		}},
+	}
+	if l.Unwind {
+		stages = append(stages, toolkit.M{"$unwind": toolkit.M{
+			"path":                       "$" + as,
+			"preserveNullAndEmptyArrays": l.PreserveEmpty,
+		}})
+	}
+	return stages
+}
+
+// Aggregate run aggregation pipeline on given table and fetch the result into dest.
+// Pipeline is run using pipe command, hence it is only supported by mongo driver
+func (h *Hub) Aggregate(tableName string, pipeline []toolkit.M, dest interface{}) error {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	if isSQLDriver(conn) {
+		return fmt.Errorf("fail Aggregate: pipeline on %s. %w", driverName(conn), ErrNotSupported)
+	}
+
+	cmd := dbflex.From(h.table(tableName)).Command("pipe", pipeline)
+	cur := conn.Cursor(cmd, nil)
+	if err = cur.Error(); err != nil {
+		return fmt.Errorf("error when running cursor for Aggregate. %w", err)
+	}
+	defer cur.Close()
+
+	return cur.Fetchs(dest, 0).Error()
+}
+
+// AggregateLookup returns data of the model filtered by where, joined with other collections based on given lookups.
+// Dest should be a pointer to slice of struct that represents the joined shape, ie:
+//
+//	type OrderWithCustomer struct {
+//		Order    `bson:",inline"`
+//		Customer *Customer `bson:"customer"`
+//	}
+func (h *Hub) AggregateLookup(data orm.DataModel, where *dbflex.Filter, dest interface{}, lookups ...Lookup) error {
+	data.SetThis(data)
+	pipeline := []toolkit.M{}
+	if where != nil {
+		match, err := mongoFilter(where)
+		if err != nil {
+			return fmt.Errorf("fail AggregateLookup: %w", err)
+		}
+		pipeline = append(pipeline, toolkit.M{"$match": match})
+	}
+	for _, l := range lookups {
+		pipeline = append(pipeline, l.Stages()...)
+	}
+	return h.Aggregate(data.TableName(), pipeline, dest)
+}
+
+// PopulateByParmHaving returns aggregated data of a table based on QueryParam, filtered after aggregation by having.
+// Having filter could refer to group fields and aggregate alias. It is translated into HAVING clause on SQL drivers
+// and into $match stage after $group on mongo. Query is checked against guards of the hub like PopulateByParm
+func (h *Hub) PopulateByParmHaving(tableName string, parm *dbflex.QueryParam, having *dbflex.Filter, dest interface{}) error {
+	if parm == nil {
+		parm = dbflex.NewQueryParam()
+	}
+	if having == nil {
+		return h.PopulateByParm(tableName, parm, dest)
+	}
+	parm, err := h.prepareQuery("populate", tableName, parm)
+	if err != nil {
+		return err
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	sqlDriver, driver := isSQLDriver(conn), driverName(conn)
+	h.closeConn(idx, conn)
+
+	if !sqlDriver {
+		p := NewPipeline().Match(parm.Where).Group(parm.GroupBy, parm.Aggregates...).Match(having).Sort(parm.Sort...)
+		if parm.Skip > 0 {
+			p.Skip(parm.Skip)
+		}
+		if parm.Take > 0 {
+			p.Limit(parm.Take)
+		}
+		stages, err := p.Build()
+		if err != nil {
+			return fmt.Errorf("fail PopulateByParmHaving: %w", err)
+		}
+		return h.Aggregate(tableName, stages, dest)
+	}
+
+	sql, err := sqlAggregate(driver, h.table(tableName), parm, having)
+	if err != nil {
+		return fmt.Errorf("fail PopulateByParmHaving: %w", err)
+	}
+	return h.PopulateSQL(sql, dest)
+}
@@ -0,0 +1,168 @@
+package datahub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// AnonymizeBatchSize is number of records read and rewritten on each batch by Anonymize
+var AnonymizeBatchSize = 500
+
+// AnonymizerFunc returns replacement of a field value, row is the whole record being anonymized.
+// Returning an error value stops Anonymize with that error
+type AnonymizerFunc func(value interface{}, row toolkit.M) interface{}
+
+// AnonymizeNull replace value with nil
+func AnonymizeNull() AnonymizerFunc {
+	return func(interface{}, toolkit.M) interface{} {
+		return nil
+	}
+}
+
+// AnonymizeFixed replace value with given value
+func AnonymizeFixed(v interface{}) AnonymizerFunc {
+	return func(interface{}, toolkit.M) interface{} {
+		return v
+	}
+}
+
+// AnonymizeHash replace value with sha256 hash of salt and the value, same value produce same hash so it can still be joined
+func AnonymizeHash(salt string) AnonymizerFunc {
+	return func(v interface{}, _ toolkit.M) interface{} {
+		if v == nil {
+			return nil
+		}
+		sum := sha256.Sum256([]byte(salt + fmt.Sprintf("%v", v)))
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// AnonymizeMask replace all characters except last keep characters with *, keep should not be negative
+func AnonymizeMask(keep int) AnonymizerFunc {
+	if keep < 0 {
+		err := fmt.Errorf("invalid mask keep %d", keep)
+		return func(interface{}, toolkit.M) interface{} {
+			return err
+		}
+	}
+	return func(v interface{}, _ toolkit.M) interface{} {
+		if v == nil {
+			return nil
+		}
+		runes := []rune(fmt.Sprintf("%v", v))
+		for i := 0; i < len(runes)-keep; i++ {
+			runes[i] = '*'
+		}
+		return string(runes)
+	}
+}
+
+// AnonymizeFakeEmail replace value with fake but unique email derived from hash of the value
+func AnonymizeFakeEmail(domain string) AnonymizerFunc {
+	hash := AnonymizeHash(domain)
+	return func(v interface{}, row toolkit.M) interface{} {
+		if v == nil {
+			return nil
+		}
+		return "user-" + hash(v, row).(string)[:12] + "@" + domain
+	}
+}
+
+// Anonymize rewrite fields of the model records matched with where using given rules, records are processed in batch
+// ordered by its key. It returns number of rewritten records. Model should have single key field
+func (h *Hub) Anonymize(data orm.DataModel, rules map[string]AnonymizerFunc, where *dbflex.Filter) (int, error) {
+	if len(rules) == 0 {
+		return 0, errors.New("fail Anonymize: rules are mandatory")
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return 0, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	data.SetThis(data)
+	keyFields, _ := data.GetID(conn)
+	if len(keyFields) != 1 {
+		return 0, errors.New("fail Anonymize: model should have single key field")
+	}
+	keyField := keyFields[0]
+	tableName := h.tableOf(data)
+	defer h.invalidateCache(data.TableName())
+
+	fields := make([]string, 0, len(rules))
+	for f := range rules {
+		if f == keyField {
+			return 0, errors.New("fail Anonymize: key field can't be anonymized")
+		}
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	processed := 0
+	var lastKey interface{}
+	for {
+		filter := where
+		if lastKey != nil {
+			filter = combineFilter(where, dbflex.Gt(keyField, lastKey))
+		}
+		cmd := dbflex.From(tableName).Select(append([]string{keyField}, fields...)...).
+			OrderBy(keyField).Take(AnonymizeBatchSize)
+		if filter != nil {
+			cmd.Where(filter)
+		}
+		cur := conn.Cursor(cmd, nil)
+		if err = cur.Error(); err != nil {
+			return processed, fmt.Errorf("fail Anonymize: %w", err)
+		}
+		rows := []toolkit.M{}
+		if err = cur.Fetchs(&rows, 0).Close(); err != nil {
+			return processed, fmt.Errorf("fail Anonymize: %w", err)
+		}
+
+		for _, row := range rows {
+			update := toolkit.M{}
+			for _, f := range fields {
+				v := rules[f](row.Get(f), row)
+				if e, ok := v.(error); ok {
+					return processed, fmt.Errorf("fail Anonymize: field %s. %w", f, e)
+				}
+				update.Set(f, v)
+			}
+			cmd := dbflex.From(tableName).Update(fields...).Where(dbflex.Eq(keyField, row.Get(keyField)))
+			if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", update)); err != nil {
+				return processed, fmt.Errorf("fail Anonymize: key %v. %w", row.Get(keyField), err)
+			}
+			processed++
+			lastKey = row.Get(keyField)
+		}
+
+		if len(rows) < AnonymizeBatchSize {
+			return processed, nil
+		}
+	}
+}
+
+// combineFilter combine filters using And, nil filter is ignored
+func combineFilter(filters ...*dbflex.Filter) *dbflex.Filter {
+	items := []*dbflex.Filter{}
+	for _, f := range filters {
+		if f != nil {
+			items = append(items, f)
+		}
+	}
+	switch len(items) {
+	case 0:
+		return nil
+	case 1:
+		return items[0]
+	}
+	return dbflex.And(items...)
+}
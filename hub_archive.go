@@ -0,0 +1,137 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// ArchiveReport is result of Archive
+type ArchiveReport struct {
+	Batches  int
+	Moved    int
+	Duration time.Duration
+}
+
+// Archive move records of the model matched with where into archiveTable on the same hub, see ArchiveTo
+func (h *Hub) Archive(data orm.DataModel, where *dbflex.Filter, archiveTable string, batchSize int) (*ArchiveReport, error) {
+	return h.ArchiveTo(h, data, where, archiveTable, batchSize)
+}
+
+// ArchiveTo move records of the model matched with where into archiveTable on target hub in batches.
+// Each batch is written to archive table and then deleted from the source inside a transaction (when supported).
+// When target is other hub, batch is written to target before being deleted from source, so a failure could leave
+// the batch on both tables but never lose it. Archive table should have the same key with the model
+func (h *Hub) ArchiveTo(target *Hub, data orm.DataModel, where *dbflex.Filter, archiveTable string, batchSize int) (*ArchiveReport, error) {
+	if target == nil || archiveTable == "" {
+		return nil, errors.New("fail Archive: target hub and archive table are mandatory")
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	data.SetThis(data)
+	var keyFields []string
+	if err := h.Native(func(conn dbflex.IConnection) error {
+		keyFields, _ = data.GetID(conn)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("fail Archive: %w", err)
+	}
+	if len(keyFields) == 0 {
+		return nil, errors.New("fail Archive: model has no key field")
+	}
+
+	started := time.Now()
+	report := &ArchiveReport{}
+	tableName := data.TableName()
+	sameHub := target == h
+	moved := map[string]bool{}
+	for {
+		src := h
+		if h.Capability(CapTransaction) && !h.IsTx() {
+			ht, err := h.BeginTx()
+			if err != nil {
+				return report, fmt.Errorf("fail Archive: %w", err)
+			}
+			src = ht
+		}
+		dst := target
+		if sameHub {
+			dst = src
+		}
+
+		n, err := archiveBatch(src, dst, tableName, keyFields, where, archiveTable, batchSize, moved)
+		if src != h {
+			if err != nil {
+				src.Rollback()
+			} else if err = src.Commit(); err != nil {
+				err = fmt.Errorf("commit. %w", err)
+			}
+		}
+		if err != nil {
+			report.Duration = time.Since(started)
+			return report, fmt.Errorf("fail Archive: batch %d. %w", report.Batches+1, err)
+		}
+
+		if n > 0 {
+			report.Batches++
+			report.Moved += n
+		}
+		if n < batchSize {
+			break
+		}
+	}
+
+	report.Duration = time.Since(started)
+	return report, nil
+}
+
+// archiveBatch move a batch of records from src into archive table of dst. Moved hold keys of previous batch and
+// is replaced by keys of this batch, record of previous batch being read again means it is not deleted from source
+// and archiving would never end, hence it is returned as error
+func archiveBatch(src, dst *Hub, tableName string, keyFields []string, where *dbflex.Filter, archiveTable string,
+	batchSize int, moved map[string]bool) (int, error) {
+	parm := dbflex.NewQueryParam().SetTake(batchSize)
+	if where != nil {
+		parm.SetWhere(where)
+	}
+	rows := []toolkit.M{}
+	if err := src.internal().PopulateByParm(tableName, parm, &rows); err != nil {
+		return 0, fmt.Errorf("read. %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	for _, row := range rows {
+		if k := keyString(row, keyFields); moved[k] {
+			return 0, fmt.Errorf("record %s of previous batch is not deleted from source", k)
+		}
+	}
+	for k := range moved {
+		delete(moved, k)
+	}
+
+	keys := make([]*dbflex.Filter, len(rows))
+	for i, row := range rows {
+		moved[keyString(row, keyFields)] = true
+		if err := dst.SaveAny(archiveTable, row); err != nil {
+			return 0, fmt.Errorf("write. %w", err)
+		}
+		eqs := make([]*dbflex.Filter, len(keyFields))
+		for j, f := range keyFields {
+			eqs[j] = dbflex.Eq(f, row.Get(f))
+		}
+		keys[i] = dbflex.And(eqs...)
+	}
+
+	if _, err := src.Execute(dbflex.From(src.table(tableName)).Delete().Where(dbflex.Or(keys...)), nil); err != nil {
+		return 0, fmt.Errorf("delete. %w", err)
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,212 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// filter operators of array fields, they are translated into native filter before the query is run
+const (
+	opArrayHas  dbflex.FilterOp = "$arrayhas"
+	opArrayAll  dbflex.FilterOp = "$arrayall"
+	opArraySize dbflex.FilterOp = "$arraysize"
+)
+
+func init() {
+	hubOps[opArrayHas] = true
+	hubOps[opArrayAll] = true
+	hubOps[opArraySize] = true
+}
+
+// ArrayHas returns filter of array field having v as one of its elements.
+// Array field is stored as array on mongo and postgres, and as JSON array on mysql and sqlite
+func ArrayHas(field string, v interface{}) *dbflex.Filter {
+	return &dbflex.Filter{Field: field, Op: opArrayHas, Value: v}
+}
+
+// ArrayAll returns filter of array field having all of values as its elements
+func ArrayAll(field string, values ...interface{}) *dbflex.Filter {
+	return &dbflex.Filter{Field: field, Op: opArrayAll, Value: values}
+}
+
+// ArraySize returns filter of array field having n elements. On mongo it is checked by existence of element n-1 and n,
+// hence it assumes the array has no null element
+func ArraySize(field string, n int) *dbflex.Filter {
+	return &dbflex.Filter{Field: field, Op: opArraySize, Value: n}
+}
+
+// nativeArrayFilter translate array filter into filter of the driver of conn
+func nativeArrayFilter(conn dbflex.IConnection, f *dbflex.Filter) (*dbflex.Filter, error) {
+	values := mongoValues(f.Value)
+	if f.Op == opArrayHas {
+		values = []interface{}{f.Value}
+	}
+
+	if !isSQLDriver(conn) {
+		switch f.Op {
+		case opArrayHas, opArrayAll:
+			items := make([]*dbflex.Filter, len(values))
+			for i, v := range values {
+				items[i] = dbflex.Eq(f.Field, v)
+			}
+			return combineFilter(items...), nil
+		default:
+			n, _ := f.Value.(int)
+			if n <= 0 {
+				return dbflex.Eq(f.Field+".0", nil), nil
+			}
+			return dbflex.And(dbflex.Ne(f.Field+"."+strconv.Itoa(n-1), nil), dbflex.Eq(f.Field+"."+strconv.Itoa(n), nil)), nil
+		}
+	}
+
+	driver := driverName(conn)
+	pg := strings.Contains(driver, "pg") || strings.Contains(driver, "postgres")
+	mysql := strings.Contains(driver, "mysql")
+	sqlite := strings.Contains(driver, "sqlite")
+	if !pg && !mysql && !sqlite {
+		return nil, fmt.Errorf("array filter on %s. %w", driver, ErrNotSupported)
+	}
+
+	if f.Op == opArraySize {
+		length := "cardinality"
+		if mysql {
+			length = "JSON_LENGTH"
+		} else if sqlite {
+			length = "json_array_length"
+		}
+		return dbflex.Eq("COALESCE("+length+"("+f.Field+"), 0)", f.Value), nil
+	}
+
+	switch {
+	case pg:
+		return dbflex.Eq(f.Field+" @> ARRAY["+strings.Join(sqlLiterals(driver, values), ", ")+"]", true), nil
+
+	case mysql:
+		bs, err := json.Marshal(values)
+		if err != nil {
+			return nil, err
+		}
+		return dbflex.Eq("JSON_CONTAINS("+f.Field+", "+sqlLiteral(driver, string(bs))+")", 1), nil
+	}
+
+	items := make([]*dbflex.Filter, len(values))
+	for i, v := range values {
+		items[i] = dbflex.Eq("EXISTS(SELECT 1 FROM json_each("+f.Field+") WHERE value = "+sqlLiteral(driver, v)+")", 1)
+	}
+	return combineFilter(items...), nil
+}
+
+// ArrayPush append values into array field of records of the model matching where, in a single update statement
+func (h *Hub) ArrayPush(data orm.DataModel, where *dbflex.Filter, field string, values ...interface{}) error {
+	if err := h.arrayUpdate("push", data, where, field, values); err != nil {
+		return fmt.Errorf("fail ArrayPush: %w", err)
+	}
+	return nil
+}
+
+// ArrayPull remove all occurrences of values from array field of records of the model matching where, in a single
+// update statement. It is not supported on mysql
+func (h *Hub) ArrayPull(data orm.DataModel, where *dbflex.Filter, field string, values ...interface{}) error {
+	if err := h.arrayUpdate("pull", data, where, field, values); err != nil {
+		return fmt.Errorf("fail ArrayPull: %w", err)
+	}
+	return nil
+}
+
+func (h *Hub) arrayUpdate(op string, data orm.DataModel, where *dbflex.Filter, field string, values []interface{}) error {
+	data.SetThis(data)
+	if len(values) == 0 {
+		return nil
+	}
+	tableName := data.TableName()
+	if err := h.guardWrite("update", tableName, where); err != nil {
+		return err
+	}
+	where = h.filterToUTC(where)
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	if !isSQLDriver(conn) {
+		q, err := mongoFilter(where)
+		if err != nil {
+			return err
+		}
+		u := toolkit.M{"$push": toolkit.M{field: toolkit.M{"$each": values}}}
+		if op == "pull" {
+			u = toolkit.M{"$pullAll": toolkit.M{field: values}}
+		}
+		command := toolkit.M{}.Set("update", h.table(tableName)).
+			Set("updates", []toolkit.M{{"q": q, "u": u, "multi": true}})
+		if _, err = conn.Execute(dbflex.From(h.table(tableName)).Command("runcommand", command), nil); err != nil {
+			return err
+		}
+		if err = h.emit(conn, EventUpdate, tableName, data, []string{field}); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	set, err := sqlArraySet(driverName(conn), op, field, values)
+	if err != nil {
+		return err
+	}
+	sql := "UPDATE " + h.table(tableName) + " SET " + field + " = " + set
+	if where != nil {
+		cond, err := sqlWhere(driverName(conn), where)
+		if err != nil {
+			return err
+		}
+		sql += " WHERE " + cond
+	}
+	if _, err = conn.Execute(dbflex.SQL(sql), nil); err != nil {
+		return err
+	}
+	if err = h.emit(conn, EventUpdate, tableName, data, []string{field}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// sqlArraySet returns sql expression of new value of array field after values are pushed or pulled
+func sqlArraySet(driver, op, field string, values []interface{}) (string, error) {
+	lits := sqlLiterals(driver, values)
+	switch {
+	case strings.Contains(driver, "pg") || strings.Contains(driver, "postgres"):
+		if op == "push" {
+			return "array_cat(COALESCE(" + field + ", '{}'), ARRAY[" + strings.Join(lits, ", ") + "])", nil
+		}
+		return "ARRAY(SELECT x FROM unnest(" + field + ") AS x WHERE x NOT IN (" + strings.Join(lits, ", ") + "))", nil
+
+	case strings.Contains(driver, "mysql"):
+		if op == "pull" {
+			return "", fmt.Errorf("pull on %s. %w", driver, ErrNotSupported)
+		}
+		args := make([]string, len(lits))
+		for i, l := range lits {
+			args[i] = "'$', " + l
+		}
+		return "JSON_ARRAY_APPEND(COALESCE(" + field + ", JSON_ARRAY()), " + strings.Join(args, ", ") + ")", nil
+
+	case strings.Contains(driver, "sqlite"):
+		if op == "push" {
+			args := make([]string, len(lits))
+			for i, l := range lits {
+				args[i] = "'$[#]', " + l
+			}
+			return "json_insert(COALESCE(" + field + ", '[]'), " + strings.Join(args, ", ") + ")", nil
+		}
+		return "(SELECT json_group_array(value) FROM json_each(" + field + ") WHERE value NOT IN (" +
+			strings.Join(lits, ", ") + "))", nil
+	}
+	return "", fmt.Errorf("array update on %s. %w", driver, ErrNotSupported)
+}
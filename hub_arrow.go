@@ -0,0 +1,205 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/eaciit/toolkit"
+)
+
+// FetchArrow run the command and returns its result as arrow record, rows are appended directly into column builders
+// without decoding them into struct. Schema is inferred from first row with columns ordered by name, later value that
+// does not fit the inferred type, ie: fractional number on int64 column, returns error. Use FetchArrowSchema to define
+// columns and their types. Record need to be released by caller.
+// When allocator is nil memory.DefaultAllocator is used
+func (h *Hub) FetchArrow(cmd dbflex.ICommand, allocator memory.Allocator, objects ...toolkit.M) (arrow.Record, error) {
+	return h.FetchArrowSchema(cmd, nil, allocator, objects...)
+}
+
+// FetchArrowSchema works like FetchArrow with given schema. Supported column types are int64, float64, string,
+// binary, boolean and timestamp (microsecond), missing or nil value is appended as null
+func (h *Hub) FetchArrowSchema(cmd dbflex.ICommand, schema *arrow.Schema, allocator memory.Allocator, objects ...toolkit.M) (arrow.Record, error) {
+	if allocator == nil {
+		allocator = memory.DefaultAllocator
+	}
+	var object toolkit.M
+	if len(objects) > 0 {
+		object = objects[0]
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	cur := conn.Cursor(cmd, object)
+	if err = cur.Error(); err != nil {
+		return nil, fmt.Errorf("fail FetchArrow: unable to prepare cursor. %w", err)
+	}
+	defer cur.Close()
+
+	var (
+		builder *array.RecordBuilder
+		fields  []arrow.Field
+	)
+	defer func() {
+		if builder != nil {
+			builder.Release()
+		}
+	}()
+	if schema != nil {
+		builder = array.NewRecordBuilder(allocator, schema)
+		fields = schema.Fields()
+	}
+
+	row := toolkit.M{}
+	for {
+		for k := range row {
+			delete(row, k)
+		}
+		if err = cur.Fetch(&row).Error(); err != nil {
+			if isEOF(err) {
+				break
+			}
+			return nil, fmt.Errorf("fail FetchArrow: unable to fetch data. %w", err)
+		}
+
+		if builder == nil {
+			schema = arrowSchemaOf(row)
+			builder = array.NewRecordBuilder(allocator, schema)
+			fields = schema.Fields()
+		}
+		for i, f := range fields {
+			if err = arrowAppend(builder.Field(i), row[f.Name]); err != nil {
+				return nil, fmt.Errorf("fail FetchArrow: column %s. %w", f.Name, err)
+			}
+		}
+	}
+
+	if builder == nil {
+		// no row and no schema, returns empty record
+		builder = array.NewRecordBuilder(allocator, arrow.NewSchema([]arrow.Field{}, nil))
+	}
+	return builder.NewRecord(), nil
+}
+
+// arrowSchemaOf infer arrow schema from a row, nil value is assumed as string
+func arrowSchemaOf(row toolkit.M) *arrow.Schema {
+	names := make([]string, 0, len(row))
+	for k := range row {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	fields := make([]arrow.Field, len(names))
+	for i, name := range names {
+		fields[i] = arrow.Field{Name: name, Type: arrowTypeOf(row[name]), Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil)
+}
+
+func arrowTypeOf(v interface{}) arrow.DataType {
+	switch v.(type) {
+	case time.Time, *time.Time:
+		return arrow.FixedWidthTypes.Timestamp_us
+	case []byte:
+		return arrow.BinaryTypes.Binary
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Bool:
+		return arrow.FixedWidthTypes.Boolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return arrow.PrimitiveTypes.Int64
+	case reflect.Float32, reflect.Float64:
+		return arrow.PrimitiveTypes.Float64
+	}
+	return arrow.BinaryTypes.String
+}
+
+func arrowAppend(b array.Builder, v interface{}) error {
+	if t, ok := v.(*time.Time); ok {
+		if t == nil {
+			v = nil
+		} else {
+			v = *t
+		}
+	}
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+
+	switch ab := b.(type) {
+	case *array.Int64Builder:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			ab.Append(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if rv.Uint() > math.MaxInt64 {
+				return fmt.Errorf("%v overflows int64", v)
+			}
+			ab.Append(int64(rv.Uint()))
+		case reflect.Float32, reflect.Float64:
+			f := rv.Float()
+			if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+				return fmt.Errorf("%v can't be stored as int64 without loss, define the column as float64", v)
+			}
+			ab.Append(int64(f))
+		default:
+			return fmt.Errorf("%T is not a number", v)
+		}
+
+	case *array.Float64Builder:
+		f, ok := toFloat(v)
+		if !ok {
+			return fmt.Errorf("%T is not a number", v)
+		}
+		ab.Append(f)
+
+	case *array.BooleanBuilder:
+		bv, ok := v.(bool)
+		if !ok {
+			return fmt.Errorf("%T is not a bool", v)
+		}
+		ab.Append(bv)
+
+	case *array.TimestampBuilder:
+		t, ok := v.(time.Time)
+		if !ok {
+			return fmt.Errorf("%T is not a time", v)
+		}
+		ab.Append(arrow.Timestamp(t.UnixMicro()))
+
+	case *array.BinaryBuilder:
+		switch bv := v.(type) {
+		case []byte:
+			ab.Append(bv)
+		case string:
+			ab.Append([]byte(bv))
+		default:
+			return fmt.Errorf("%T is not bytes", v)
+		}
+
+	case *array.StringBuilder:
+		if s, ok := v.(string); ok {
+			ab.Append(s)
+		} else {
+			ab.Append(fmt.Sprintf("%v", v))
+		}
+
+	default:
+		return errors.New("column type is not supported")
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// ErrBatchWriterClosed is returned when writing to closed BatchWriter
+var ErrBatchWriterClosed = errors.New("batch writer is closed")
+
+// BatchWriter accumulate records of a model and write them in batches using UpsertMany, once number of pending
+// records reach flush size or flush interval is passed, whichever comes first. It is safe to be used concurrently
+type BatchWriter struct {
+	h         *Hub
+	modelType reflect.Type
+	flushSize int
+	onError   func(records []orm.DataModel, err error)
+
+	mtx      sync.Mutex
+	flushMtx sync.Mutex
+	pending  []orm.DataModel
+	closed   bool
+	stop     chan bool
+	done     chan bool
+}
+
+// NewBatchWriter create BatchWriter of the model. flushSize less than 1 means 100 records, flushInterval 0 means
+// records are only flushed by size, Flush and Close. Records are saved as upsert by key of the model, write errors are
+// passed to callback set by OnError or logged when there is no callback. Close the writer to flush remaining records
+func (h *Hub) NewBatchWriter(model orm.DataModel, flushSize int, flushInterval time.Duration) *BatchWriter {
+	if flushSize < 1 {
+		flushSize = 100
+	}
+	w := &BatchWriter{h: h, modelType: reflect.TypeOf(model), flushSize: flushSize,
+		stop: make(chan bool), done: make(chan bool)}
+	if flushInterval <= 0 {
+		close(w.done)
+		return w
+	}
+
+	go func() {
+		defer close(w.done)
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.Flush()
+			}
+		}
+	}()
+	return w
+}
+
+// OnError set callback receiving records which could not be written and their error. When a whole batch fails
+// records are all records of the batch, otherwise callback is called for each failed record
+func (w *BatchWriter) OnError(fn func(records []orm.DataModel, err error)) *BatchWriter {
+	w.onError = fn
+	return w
+}
+
+// Write add record to the writer, batch is flushed by caller which fills it
+func (w *BatchWriter) Write(data orm.DataModel) error {
+	if reflect.TypeOf(data) != w.modelType {
+		return fmt.Errorf("fail BatchWriter.Write: record should be %s", w.modelType.String())
+	}
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return ErrBatchWriterClosed
+	}
+	w.pending = append(w.pending, data)
+	full := len(w.pending) >= w.flushSize
+	w.mtx.Unlock()
+
+	if full {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Pending returns number of records waiting to be flushed
+func (w *BatchWriter) Pending() int {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return len(w.pending)
+}
+
+// Flush write pending records, error is returned when a batch could not be written at all.
+// Failed records are also reported to the error callback
+func (w *BatchWriter) Flush() error {
+	w.flushMtx.Lock()
+	defer w.flushMtx.Unlock()
+
+	var lastErr error
+	for {
+		w.mtx.Lock()
+		n := len(w.pending)
+		if n > w.flushSize {
+			n = w.flushSize
+		}
+		batch := w.pending[:n]
+		w.pending = w.pending[n:]
+		w.mtx.Unlock()
+		if len(batch) == 0 {
+			return lastErr
+		}
+		if err := w.write(batch); err != nil {
+			lastErr = err
+		}
+	}
+}
+
+func (w *BatchWriter) write(batch []orm.DataModel) error {
+	models := reflect.MakeSlice(reflect.SliceOf(w.modelType), 0, len(batch))
+	for _, data := range batch {
+		models = reflect.Append(models, reflect.ValueOf(data))
+	}
+
+	results, err := w.h.UpsertMany(models.Interface(), nil, UpsertBatchSize(len(batch)))
+	if err != nil {
+		w.report(batch, err)
+		return fmt.Errorf("fail BatchWriter.Flush: %w", err)
+	}
+	for _, res := range results {
+		if res.Outcome == UpsertFailed {
+			w.report([]orm.DataModel{batch[res.Index]}, res.Err)
+		}
+	}
+	return nil
+}
+
+func (w *BatchWriter) report(records []orm.DataModel, err error) {
+	if w.onError != nil {
+		w.onError(records, err)
+		return
+	}
+	w.h.Logger().Error("batch write fail", "table", records[0].TableName(), "records", len(records), "error", err.Error())
+}
+
+// Close stop background flush and flush remaining records, records written after Close are rejected
+func (w *BatchWriter) Close() error {
+	w.mtx.Lock()
+	if w.closed {
+		w.mtx.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mtx.Unlock()
+
+	select {
+	case <-w.done:
+	default:
+		close(w.stop)
+		<-w.done
+	}
+	return w.Flush()
+}
@@ -0,0 +1,355 @@
+package datahub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BlobChunkSize is size of each chunk of blob data, same with default chunk size of GridFS
+var BlobChunkSize = 255 * 1024
+
+// ErrBlobNotFound returned when blob is not exist on the bucket
+var ErrBlobNotFound = errors.New("blob is not found")
+
+// BlobFile is metadata of a blob. It is stored on <bucket>_files table, on mongo it is read from GridFS file
+type BlobFile struct {
+	ID string `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	// Version identify chunks of current content, it is changed on each PutBlob
+	Version  string    `bson:"version" json:"version" sqlname:"version"`
+	Length   int64     `bson:"length" json:"length" sqlname:"length"`
+	Chunks   int       `bson:"chunks" json:"chunks" sqlname:"chunks"`
+	Uploaded time.Time `bson:"uploaded" json:"uploaded" sqlname:"uploaded"`
+}
+
+// BlobChunk is part of blob data. It is stored on <bucket>_chunks table
+type BlobChunk struct {
+	ID     string `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	FileID string `bson:"fileid" json:"fileid" sqlname:"fileid"`
+	N      int    `bson:"n" json:"n" sqlname:"n"`
+	Data   []byte `bson:"data" json:"data" sqlname:"data"`
+}
+
+func (h *Hub) blobTables(bucket string) (string, string) {
+	return h.table(bucket + "_files"), h.table(bucket + "_chunks")
+}
+
+// blobChunkID returns id of nth chunk of given version of the blob
+func blobChunkID(id, version string, n int) string {
+	return fmt.Sprintf("%s#%s#%d", id, version, n)
+}
+
+// gridFSBucket returns GridFS bucket on mongo database of conn, nil is returned when the driver has no mongo database
+func gridFSBucket(conn dbflex.IConnection, bucket string) (*gridfs.Bucket, error) {
+	v := findNative(reflect.ValueOf(conn), "*mongo.Database", 0)
+	if !v.IsValid() {
+		return nil, nil
+	}
+	return gridfs.NewBucket(v.Interface().(*mongo.Database),
+		options.GridFSBucket().SetName(bucket).SetChunkSizeBytes(int32(BlobChunkSize)))
+}
+
+// PutBlob store content of r as blob with given id on the bucket, existing blob with same id will be replaced.
+// On mongo the blob is stored using GridFS with id as file name, so it can be read by other GridFS clients. Other
+// drivers split data into chunks the same way as GridFS, chunks are stored as binary (bytea on postgres).
+// Content is written as new version (a new GridFS revision on mongo) and the file is switched to it once all chunks
+// are written, so readers keep reading the previous content until then and failed write leaves it intact.
+// Previous version is deleted afterward
+func (h *Hub) PutBlob(bucket, id string, r io.Reader) (int64, error) {
+	if bucket == "" || id == "" {
+		return 0, errors.New("fail PutBlob: bucket and id are mandatory")
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return 0, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	gb, err := gridFSBucket(conn, h.table(bucket))
+	if err != nil {
+		return 0, fmt.Errorf("fail PutBlob: %w", err)
+	}
+	if gb != nil {
+		n, err := h.putGridFS(gb, id, r)
+		if err != nil {
+			return n, fmt.Errorf("fail PutBlob: %w", err)
+		}
+		return n, nil
+	}
+
+	filesTable, chunksTable := h.blobTables(bucket)
+	if err = ensureBlobTables(conn, filesTable, chunksTable); err != nil {
+		return 0, fmt.Errorf("fail PutBlob: %w", err)
+	}
+	prev, err := getBlobFile(conn, filesTable, id)
+	if err != nil {
+		return 0, fmt.Errorf("fail PutBlob: %w", err)
+	}
+
+	file := &BlobFile{ID: id, Version: NewUUIDv7().(string)}
+	buf := make([]byte, BlobChunkSize)
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			chunk := &BlobChunk{
+				ID:     blobChunkID(id, file.Version, file.Chunks),
+				FileID: id,
+				N:      file.Chunks,
+				Data:   append([]byte{}, buf[:n]...),
+			}
+			if _, err = conn.Execute(dbflex.From(chunksTable).Insert(), toolkit.M{}.Set("data", chunk)); err != nil {
+				deleteBlobChunks(conn, chunksTable, file)
+				return file.Length, fmt.Errorf("fail PutBlob: unable to write chunk %d. %w", file.Chunks, err)
+			}
+			file.Chunks++
+			file.Length += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			deleteBlobChunks(conn, chunksTable, file)
+			return file.Length, fmt.Errorf("fail PutBlob: unable to read. %w", readErr)
+		}
+	}
+
+	file.Uploaded = time.Now()
+	if _, err = conn.Execute(dbflex.From(filesTable).Save(), toolkit.M{}.Set("data", file)); err != nil {
+		deleteBlobChunks(conn, chunksTable, file)
+		return file.Length, fmt.Errorf("fail PutBlob: unable to write file. %w", err)
+	}
+	if prev != nil {
+		if err = deleteBlobChunks(conn, chunksTable, prev); err != nil {
+			h.Logger().Warn("unable to remove chunks of previous blob version", "bucket", bucket, "id", id,
+				"version", prev.Version, "error", err.Error())
+		}
+	}
+	return file.Length, nil
+}
+
+type blobCounter struct {
+	io.Reader
+	n int64
+}
+
+func (c *blobCounter) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// putGridFS upload r as new revision of file named id, then delete its previous revisions
+func (h *Hub) putGridFS(gb *gridfs.Bucket, id string, r io.Reader) (int64, error) {
+	counter := &blobCounter{Reader: r}
+	fileID, err := gb.UploadFromStream(id, counter)
+	if err != nil {
+		return counter.n, err
+	}
+
+	prevs, err := gridFSFiles(h.context(), gb, bson.M{"filename": id, "_id": bson.M{"$ne": fileID}}, nil)
+	if err == nil {
+		for _, f := range prevs {
+			if err = gb.Delete(f.ID); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		h.Logger().Warn("unable to remove previous revision of blob", "id", id, "error", err.Error())
+	}
+	return counter.n, nil
+}
+
+func gridFSFiles(ctx context.Context, gb *gridfs.Bucket, filter interface{}, opts *options.GridFSFindOptions) ([]gridfs.File, error) {
+	if opts == nil {
+		opts = options.GridFSFind()
+	}
+	cur, err := gb.Find(filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	files := []gridfs.File{}
+	if err = cur.All(ctx, &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// getGridFS write latest revision of file named id into w
+func (h *Hub) getGridFS(gb *gridfs.Bucket, id string, w io.Writer) (*BlobFile, error) {
+	files, err := gridFSFiles(h.context(), gb, bson.M{"filename": id},
+		options.GridFSFind().SetSort(bson.D{{Key: "uploadDate", Value: -1}}).SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, ErrBlobNotFound
+	}
+
+	f := files[0]
+	if _, err = gb.DownloadToStream(f.ID, w); err != nil {
+		return nil, err
+	}
+	file := &BlobFile{ID: id, Version: fmt.Sprintf("%v", f.ID), Length: f.Length, Uploaded: f.UploadDate}
+	if oid, ok := f.ID.(primitive.ObjectID); ok {
+		file.Version = oid.Hex()
+	}
+	if f.ChunkSize > 0 {
+		file.Chunks = int((f.Length + int64(f.ChunkSize) - 1) / int64(f.ChunkSize))
+	}
+	return file, nil
+}
+
+func getBlobFile(conn dbflex.IConnection, filesTable, id string) (*BlobFile, error) {
+	files := []*BlobFile{}
+	cur := conn.Cursor(dbflex.From(filesTable).Select().Where(dbflex.Eq("_id", id)), nil)
+	if err := cur.Error(); err != nil {
+		return nil, err
+	}
+	if err := cur.Fetchs(&files, 1).Close(); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	return files[0], nil
+}
+
+// deleteBlobChunks delete chunks of the version of the file
+func deleteBlobChunks(conn dbflex.IConnection, chunksTable string, file *BlobFile) error {
+	if file.Chunks == 0 {
+		return nil
+	}
+	ids := make([]interface{}, file.Chunks)
+	for n := range ids {
+		ids[n] = blobChunkID(file.ID, file.Version, n)
+	}
+	_, err := conn.Execute(dbflex.From(chunksTable).Delete().Where(dbflex.In("_id", ids...)), nil)
+	return err
+}
+
+// GetBlob write content of blob into w. It returns ErrBlobNotFound if blob is not exist
+func (h *Hub) GetBlob(bucket, id string, w io.Writer) (*BlobFile, error) {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	gb, err := gridFSBucket(conn, h.table(bucket))
+	if err != nil {
+		return nil, fmt.Errorf("fail GetBlob: %w", err)
+	}
+	if gb != nil {
+		file, err := h.getGridFS(gb, id, w)
+		if err != nil && !errors.Is(err, ErrBlobNotFound) {
+			return nil, fmt.Errorf("fail GetBlob: %w", err)
+		}
+		return file, err
+	}
+
+	filesTable, chunksTable := h.blobTables(bucket)
+	file, err := getBlobFile(conn, filesTable, id)
+	if err != nil {
+		return nil, fmt.Errorf("fail GetBlob: %w", err)
+	}
+	if file == nil {
+		return nil, ErrBlobNotFound
+	}
+
+	// read chunk one by one to avoid loading whole blob into memory
+	for n := 0; n < file.Chunks; n++ {
+		chunks := []*BlobChunk{}
+		cur := conn.Cursor(dbflex.From(chunksTable).Select().Where(dbflex.Eq("_id", blobChunkID(id, file.Version, n))), nil)
+		if err = cur.Error(); err != nil {
+			return nil, fmt.Errorf("fail GetBlob: %w", err)
+		}
+		if err = cur.Fetchs(&chunks, 1).Close(); err != nil {
+			return nil, fmt.Errorf("fail GetBlob: %w", err)
+		}
+		if len(chunks) == 0 {
+			return nil, fmt.Errorf("fail GetBlob: chunk %d is missing", n)
+		}
+		if _, err = w.Write(chunks[0].Data); err != nil {
+			return nil, fmt.Errorf("fail GetBlob: unable to write. %w", err)
+		}
+	}
+	return file, nil
+}
+
+// DeleteBlob delete blob and its chunks from the bucket. File and chunks are deleted in one transaction where
+// supported. On mongo every GridFS revision of the blob is deleted, each the GridFS way: file first then its chunks
+func (h *Hub) DeleteBlob(bucket, id string) error {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	gb, err := gridFSBucket(conn, h.table(bucket))
+	if err != nil || gb != nil {
+		defer h.closeConn(idx, conn)
+		if err == nil {
+			err = deleteGridFS(h.context(), gb, id)
+		}
+		if err != nil {
+			return fmt.Errorf("fail DeleteBlob: %w", err)
+		}
+		return nil
+	}
+	h.closeConn(idx, conn)
+
+	return h.inTx(func(ht *Hub) error {
+		idx, conn, err := ht.getConn()
+		if err != nil {
+			return &ConnectionError{Err: err}
+		}
+		defer ht.closeConn(idx, conn)
+
+		filesTable, chunksTable := ht.blobTables(bucket)
+		if _, err = conn.Execute(dbflex.From(filesTable).Delete().Where(dbflex.Eq("_id", id)), nil); err != nil {
+			return fmt.Errorf("fail DeleteBlob: %w", err)
+		}
+		if _, err = conn.Execute(dbflex.From(chunksTable).Delete().Where(dbflex.Eq("fileid", id)), nil); err != nil {
+			return fmt.Errorf("fail DeleteBlob: %w", err)
+		}
+		return nil
+	})
+}
+
+func deleteGridFS(ctx context.Context, gb *gridfs.Bucket, id string) error {
+	files, err := gridFSFiles(ctx, gb, bson.M{"filename": id}, nil)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err = gb.Delete(f.ID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureBlobTables(conn dbflex.IConnection, filesTable, chunksTable string) error {
+	if !conn.HasTable(filesTable) {
+		if err := conn.EnsureTable(filesTable, []string{"_id"}, new(BlobFile)); err != nil {
+			return fmt.Errorf("unable to prepare %s. %w", filesTable, err)
+		}
+	}
+	if !conn.HasTable(chunksTable) {
+		if err := conn.EnsureTable(chunksTable, []string{"_id"}, new(BlobChunk)); err != nil {
+			return fmt.Errorf("unable to prepare %s. %w", chunksTable, err)
+		}
+	}
+	return nil
+}
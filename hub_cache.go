@@ -0,0 +1,243 @@
+package datahub
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// Cache store query results of the hub. Values are JSON encoded records
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	DeleteByPrefix(prefix string)
+}
+
+// MemoryCache is in process Cache
+type MemoryCache struct {
+	mtx   sync.RWMutex
+	items map[string]memoryCacheItem
+}
+
+type memoryCacheItem struct {
+	value  []byte
+	expiry time.Time
+}
+
+// NewMemoryCache create in process cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{items: map[string]memoryCacheItem{}}
+}
+
+// Get returns cached value
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	item, ok := c.items[key]
+	if !ok || (!item.expiry.IsZero() && time.Now().After(item.expiry)) {
+		return nil, false
+	}
+	return item.value, true
+}
+
+// Set store value, ttl 0 means no expiry
+func (c *MemoryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	item := memoryCacheItem{value: value}
+	if ttl > 0 {
+		item.expiry = time.Now().Add(ttl)
+	}
+	c.items[key] = item
+}
+
+// DeleteByPrefix remove values which key started with prefix
+func (c *MemoryCache) DeleteByPrefix(prefix string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for k := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.items, k)
+		}
+	}
+}
+
+// SetCache set cache of the hub. Get, GetByID and Gets of cached models are served from the cache, except on
+// transactional hub. Cache of a table is invalidated by every write of the hub into the table, and again on Commit for
+// write done inside transaction. Execute invalidate all cached tables as its table is not known
+func (h *Hub) SetCache(c Cache, ttl time.Duration) *Hub {
+	h.cache = c
+	h.cacheTTL = ttl
+	return h
+}
+
+// EnableCache mark models to be cached
+func (h *Hub) EnableCache(models ...orm.DataModel) *Hub {
+	if h.cachedTables == nil {
+		h.cachedTables = map[string]bool{}
+	}
+	for _, m := range models {
+		h.cachedTables[strings.ToLower(m.TableName())] = true
+	}
+	return h
+}
+
+func (h *Hub) isCached(tableName string) bool {
+	return h.cache != nil && h.intoTable == "" && h.cachedTables[strings.ToLower(tableName)]
+}
+
+// cachePrefix returns prefix of cache keys of the table, it uses physical name of the table so hubs with different
+// table prefix sharing a cache do not read records of each other
+func (h *Hub) cachePrefix(tableName string) string {
+	return "datahub:" + strings.ToLower(h.table(tableName)) + ":"
+}
+
+func (h *Hub) idCacheKey(tableName string, ids []interface{}) string {
+	return h.cachePrefix(tableName) + "id:" + fmt.Sprintf("%v", ids)
+}
+
+func (h *Hub) queryCacheKey(tableName string, parm *dbflex.QueryParam) string {
+	bs, _ := json.Marshal(parm)
+	sum := sha1.Sum(bs)
+	return h.cachePrefix(tableName) + "q:" + hex.EncodeToString(sum[:])
+}
+
+// cacheGet decode cached value of key into dest, returns false when it is not cached
+func (h *Hub) cacheGet(tableName, key string, dest interface{}) bool {
+	if !h.isCached(tableName) || h.IsTx() {
+		return false
+	}
+	bs, ok := h.cache.Get(key)
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(bs, dest) == nil
+}
+
+// cacheGenerations count invalidations of each cached table, shared by the hub and hubs created from it. It let
+// value read before an invalidation be dropped instead of stored, as it could be older than the write
+type cacheGenerations struct {
+	mtx  sync.Mutex
+	gens map[string]uint64
+}
+
+func (h *Hub) cacheGensOf() *cacheGenerations {
+	if h.cacheGens == nil {
+		h.cacheGens = &cacheGenerations{gens: map[string]uint64{}}
+	}
+	return h.cacheGens
+}
+
+// cacheGen returns current generation of the table, it should be taken before the value to be cached is read
+func (h *Hub) cacheGen(tableName string) uint64 {
+	g := h.cacheGensOf()
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	return g.gens[h.cachePrefix(tableName)]
+}
+
+// cacheSet store value into the cache, value read by transactional hub is not stored as it could be rolled back.
+// Value is not stored either when the table has been invalidated since gen is taken
+func (h *Hub) cacheSet(tableName, key string, value interface{}, gen uint64) {
+	if !h.isCached(tableName) || h.IsTx() {
+		return
+	}
+	bs, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	g := h.cacheGensOf()
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	if g.gens[h.cachePrefix(tableName)] == gen {
+		h.cache.Set(key, bs, h.cacheTTL)
+	}
+}
+
+// invalidateCache remove cached records of the table, on transactional hub the table is invalidated again on Commit
+func (h *Hub) invalidateCache(tableName string) {
+	if !h.isCached(tableName) {
+		return
+	}
+	h.dropCache(tableName)
+	if h.IsTx() && h.txEvents != nil {
+		h.txEvents.touch(tableName)
+	}
+}
+
+// invalidateAllCache remove cached records of all cached tables, for command which table is not known
+func (h *Hub) invalidateAllCache() {
+	for tableName := range h.cachedTables {
+		h.invalidateCache(tableName)
+	}
+}
+
+func (h *Hub) dropCache(tableName string) {
+	if !h.isCached(tableName) {
+		return
+	}
+	prefix := h.cachePrefix(tableName)
+	g := h.cacheGensOf()
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+	g.gens[prefix]++
+	h.cache.DeleteByPrefix(prefix)
+}
+
+// WarmCache populate cache with result of the query, and each record of the result, so first request after start up
+// is served from the cache. Model need to be enabled using EnableCache
+func (h *Hub) WarmCache(model orm.DataModel, parm *dbflex.QueryParam) (int, error) {
+	model.SetThis(model)
+	tableName := model.TableName()
+	if !h.isCached(tableName) {
+		return 0, fmt.Errorf("fail WarmCache: cache of %s is not enabled", tableName)
+	}
+	parm, err := h.prepareQuery("gets", tableName, parm)
+	if err != nil {
+		return 0, fmt.Errorf("fail WarmCache: %w", err)
+	}
+
+	gen := h.cacheGen(tableName)
+	dest := reflect.New(reflect.SliceOf(reflect.TypeOf(model)))
+	if err = h.getsNoCache(model, parm, dest.Interface()); err != nil {
+		return 0, fmt.Errorf("fail WarmCache: %w", err)
+	}
+
+	h.cacheSet(tableName, h.queryCacheKey(tableName, parm), dest.Interface(), gen)
+	items := dest.Elem()
+	for i := 0; i < items.Len(); i++ {
+		item := items.Index(i).Interface()
+		h.cacheSet(tableName, h.idCacheKey(tableName, keyValues(item)), item, gen)
+	}
+	return items.Len(), nil
+}
+
+// ScheduleWarmCache run WarmCache every interval until returned stop function is called, stop function is safe to
+// be called more than once
+func (h *Hub) ScheduleWarmCache(model orm.DataModel, parm *dbflex.QueryParam, every time.Duration) func() {
+	stop := make(chan bool)
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := h.WarmCache(model, parm); err != nil {
+					h.Logger().Error("warm cache fail", "table", model.TableName(), "error", err.Error())
+				}
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(stop) }) }
+}
@@ -0,0 +1,129 @@
+package datahub
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// ErrReadOnly is returned by write operations of read only hub
+var ErrReadOnly = errors.New("hub is read only")
+
+// Option change setting of hub created by NewHub or Clone
+type Option func(h *Hub)
+
+// WithPoolSize set size of the pool, 0 means the hub does not use pool
+func WithPoolSize(n int) Option {
+	return func(h *Hub) {
+		h.usePool = n > 0
+		h.poolSize = n
+	}
+}
+
+// WithPoolTimeout set how long an operation waits for free connection of the pool
+func WithPoolTimeout(d time.Duration) Option {
+	return func(h *Hub) {
+		h.poolTimeout = d
+	}
+}
+
+// WithAutoClose set how long idle connection is kept on the pool, see SetAutoCloseDuration
+func WithAutoClose(d time.Duration) Option {
+	return func(h *Hub) {
+		h.poolAutoClose = d
+	}
+}
+
+// WithAutoRelease set how long a connection could be held by an operation before it is taken back by the pool
+func WithAutoRelease(d time.Duration) Option {
+	return func(h *Hub) {
+		h.poolAutoRelease = d
+	}
+}
+
+// WithDefaultTimeout set default timeout of operations of the clone, see SetDefaultTimeout
+func WithDefaultTimeout(d time.Duration) Option {
+	return func(h *Hub) {
+		h.defaultTimeout = d
+	}
+}
+
+// WithLogger set logger of the clone
+func WithLogger(l Logger) Option {
+	return func(h *Hub) {
+		h.logger = l
+	}
+}
+
+// WithReadOnly make the clone read only. Commands executed by read only hub, including DDL and procedures, returns
+// ErrReadOnly, and so is BeginTx. Raw SQL passed to Populate or Cursor is not inspected
+func WithReadOnly(readOnly bool) Option {
+	return func(h *Hub) {
+		h.readOnly = readOnly
+	}
+}
+
+// Clone create hub sharing connection function (including one set later by SetConnFn), settings, registered models and statistics of the hub, but having
+// its own pool, concurrency limit and background workers, ie: a small pool for background jobs. Settings of the
+// clone could be changed by opts. Clone of transactional hub is not transactional. Clone should be closed when it is
+// no longer used, it does not close the hub
+func (h *Hub) Clone(opts ...Option) *Hub {
+	nh := h.scope()
+	nh.txconn = nil
+	nh.txEvents = nil
+	nh.session = nil
+	nh.provider = nil
+	nh.mtx = new(sync.Mutex)
+	nh.poolItems = map[int]*pooledItem{}
+	nh.pools = new(hubPool)
+	nh.ttlMtx = new(sync.Mutex)
+	nh.ttlWorkers = map[string]chan bool{}
+
+	l := h.limiterOf()
+	l.mtx.Lock()
+	nh.limiter = &opLimiter{limit: l.limit, timeout: l.timeout, reserved: l.reserved, maxBatchQueue: l.maxBatchQueue}
+	l.mtx.Unlock()
+
+	for _, opt := range opts {
+		opt(nh)
+	}
+	nh.startPool()
+	return nh
+}
+
+// ReadOnly returns true when write operations of the hub are rejected
+func (h *Hub) ReadOnly() bool {
+	return h.readOnly
+}
+
+func (h *Hub) withReadOnly(conn dbflex.IConnection) dbflex.IConnection {
+	if !h.readOnly {
+		return conn
+	}
+	return &readOnlyConn{IConnection: conn}
+}
+
+// readOnlyConn reject commands changing data or schema
+type readOnlyConn struct {
+	dbflex.IConnection
+}
+
+// Unwrap returns the underlying connection
+func (c *readOnlyConn) Unwrap() dbflex.IConnection {
+	return c.IConnection
+}
+
+func (c *readOnlyConn) Execute(cmd dbflex.ICommand, m toolkit.M) (interface{}, error) {
+	return nil, ErrReadOnly
+}
+
+func (c *readOnlyConn) EnsureTable(name string, keys []string, obj interface{}) error {
+	return ErrReadOnly
+}
+
+func (c *readOnlyConn) BeginTx() error {
+	return ErrReadOnly
+}
@@ -0,0 +1,199 @@
+package datahub
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQueueTimeout is returned when an operation could not start within queue timeout of the concurrency limit
+var ErrQueueTimeout = errors.New("operation is not started within queue timeout")
+
+// ConcurrencyStats is state and metrics of concurrency limit of the hub
+type ConcurrencyStats struct {
+	Limit    int
+	InFlight int
+	Waiting  int
+	// WaitingBatch is number of waiting operations with PriorityBatch
+	WaitingBatch int
+	// Acquired is number of operations being started, Rejected is number of operations exceeding queue timeout
+	// and Shed is number of batch operations rejected as the queue is full
+	Acquired int64
+	Rejected int64
+	Shed     int64
+	// Waited is total time operations spent on the queue
+	Waited time.Duration
+}
+
+type opWaiter struct {
+	ready chan bool
+	batch bool
+}
+
+// opLimiter is semaphore limiting in flight operations, it is shared by hubs created from the same hub
+type opLimiter struct {
+	mtx      sync.Mutex
+	limit    int
+	timeout  time.Duration
+	inflight int
+	waiters  []*opWaiter
+	acquired int64
+	rejected int64
+	shed     int64
+	waited   time.Duration
+
+	// reserved is number of slots only used by interactive operations, maxBatchQueue is maximum number of
+	// waiting batch operations, see SetBatchLimits
+	reserved      int
+	maxBatchQueue int
+}
+
+func (h *Hub) limiterOf() *opLimiter {
+	if h.limiter == nil {
+		h.limiter = new(opLimiter)
+	}
+	return h.limiter
+}
+
+// SetMaxConcurrent limit number of operations holding a connection at the same time, regardless of pool size, so a
+// large pool could be used while heavy queries of background workers are capped. Operation exceeding the limit is
+// queued and returns ErrQueueTimeout when it is not started within queueTimeout, 0 means it waits as long as needed.
+// Some operations hold more than one connection, ie: Save of model using sequence, so n should be more than 1.
+// Operations of a transaction are not counted, the transaction holds its own connection. n 0 remove the limit
+func (h *Hub) SetMaxConcurrent(n int, queueTimeout time.Duration) *Hub {
+	l := h.limiterOf()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.limit = n
+	l.timeout = queueTimeout
+	l.grantWaiters()
+	return h
+}
+
+// ConcurrencyStats returns state and metrics of the concurrency limit
+func (h *Hub) ConcurrencyStats() ConcurrencyStats {
+	l := h.limiterOf()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return ConcurrencyStats{Limit: l.limit, InFlight: l.inflight, Waiting: len(l.waiters), WaitingBatch: l.waitingBatch(),
+		Acquired: l.acquired, Rejected: l.rejected, Shed: l.shed, Waited: l.waited}
+}
+
+// canStart returns true when an operation could start now, the caller should hold the lock
+func (l *opLimiter) canStart(batch bool) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	if batch {
+		return l.inflight < l.limit-l.reserved
+	}
+	return l.inflight < l.limit
+}
+
+func (l *opLimiter) waitingBatch() int {
+	n := 0
+	for _, w := range l.waiters {
+		if w.batch {
+			n++
+		}
+	}
+	return n
+}
+
+func (l *opLimiter) acquire(batch bool) error {
+	l.mtx.Lock()
+	if l.canStart(batch) {
+		l.inflight++
+		l.acquired++
+		l.mtx.Unlock()
+		return nil
+	}
+	if batch && l.maxBatchQueue > 0 && l.waitingBatch() >= l.maxBatchQueue {
+		l.shed++
+		l.mtx.Unlock()
+		return ErrShed
+	}
+	w := &opWaiter{ready: make(chan bool, 1), batch: batch}
+	l.waiters = append(l.waiters, w)
+	timeout := l.timeout
+	l.mtx.Unlock()
+
+	started := time.Now()
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case <-w.ready:
+		l.addWait(time.Since(started))
+		return nil
+	case <-expired:
+	}
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.waited += time.Since(started)
+	if !l.remove(w) {
+		// slot is granted while timer expired
+		return nil
+	}
+	l.rejected++
+	return ErrQueueTimeout
+}
+
+func (l *opLimiter) addWait(d time.Duration) {
+	l.mtx.Lock()
+	l.waited += d
+	l.mtx.Unlock()
+}
+
+func (l *opLimiter) remove(w *opWaiter) bool {
+	for i, o := range l.waiters {
+		if o == w {
+			l.waiters = append(l.waiters[:i], l.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// grantWaiters start waiting operations while there is free slot, interactive operations first then batch
+// operations, each in order they are queued. The caller should hold the lock
+func (l *opLimiter) grantWaiters() {
+	for {
+		var next *opWaiter
+		for _, batch := range []bool{false, true} {
+			if !l.canStart(batch) {
+				continue
+			}
+			for _, w := range l.waiters {
+				if w.batch == batch {
+					next = w
+					break
+				}
+			}
+			if next != nil {
+				break
+			}
+		}
+		if next == nil {
+			return
+		}
+		l.remove(next)
+		l.inflight++
+		l.acquired++
+		next.ready <- true
+	}
+}
+
+func (l *opLimiter) release() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.inflight > 0 {
+		l.inflight--
+	}
+	l.grantWaiters()
+}
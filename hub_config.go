@@ -0,0 +1,272 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is declarative configuration of named hubs, see FromConfig and FromFile
+//
+//	hubs:
+//	  main:
+//	    uri: postgres://localhost/app?sslmode=disable
+//	    poolSize: 50
+//	    timeout: 30s
+//	    fieldTag: json
+//	  report:
+//	    uri: postgres://replica/app?sslmode=disable
+//	    readOnly: true
+//	    cache:
+//	      ttl: 1m
+//	      tables: [Products, Categories]
+type Config struct {
+	Hubs map[string]HubConfig `json:"hubs" yaml:"hubs"`
+}
+
+// HubConfig is configuration of a hub
+type HubConfig struct {
+	// URI is connection string of the database, mandatory
+	URI string `json:"uri" yaml:"uri"`
+	// PoolSize is size of the pool, 0 means DefaultPoolSize. NoPool disable the pool
+	PoolSize int  `json:"poolSize" yaml:"poolSize"`
+	NoPool   bool `json:"noPool" yaml:"noPool"`
+	// PoolTimeout, AutoClose and AutoRelease are settings of the pool, see PoolConfig
+	PoolTimeout Duration `json:"poolTimeout" yaml:"poolTimeout"`
+	AutoClose   Duration `json:"autoClose" yaml:"autoClose"`
+	AutoRelease Duration `json:"autoRelease" yaml:"autoRelease"`
+	// Eager is number of connections opened when the hub is created
+	Eager int `json:"eager" yaml:"eager"`
+	// Timeout is default timeout of operations, see SetDefaultTimeout
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+	// SlowQuery is minimum duration of operations logged as slow, see SetSlowQueryThreshold
+	SlowQuery Duration `json:"slowQuery" yaml:"slowQuery"`
+	// KeyTag and FieldTag are key and field name tags of the connections
+	KeyTag   string `json:"keyTag" yaml:"keyTag"`
+	FieldTag string `json:"fieldTag" yaml:"fieldTag"`
+	ReadOnly bool   `json:"readOnly" yaml:"readOnly"`
+	// MaxTake cap number of records returned by a query, see SetMaxTake
+	MaxTake int `json:"maxTake" yaml:"maxTake"`
+	// Cache enable in memory cache of the tables
+	Cache *CacheConfig `json:"cache" yaml:"cache"`
+}
+
+// CacheConfig is cache configuration of a hub
+type CacheConfig struct {
+	TTL    Duration `json:"ttl" yaml:"ttl"`
+	Tables []string `json:"tables" yaml:"tables"`
+}
+
+// Duration is time.Duration written as string on config, ie: 30s or 1m
+type Duration time.Duration
+
+// UnmarshalText parse duration
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText returns duration as string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// ConfigError is returned when configuration is invalid, it lists all problems found
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// FromFile read configuration from YAML or JSON file, based on extension of the file, and create its hubs
+func FromFile(path string) (map[string]*Hub, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromConfig(cfg)
+}
+
+// LoadConfig read configuration from YAML or JSON file, based on extension of the file
+func LoadConfig(path string) (Config, error) {
+	cfg := Config{}
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("unable to read config. %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(bs, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bs, &cfg)
+	default:
+		return cfg, fmt.Errorf("unable to read config %s: extension should be .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("unable to parse config %s. %w", path, err)
+	}
+	return cfg, nil
+}
+
+// FromConfig create hubs of the configuration by their names. Configuration is validated before any hub is created,
+// ConfigError lists all problems found
+func FromConfig(cfg Config) (map[string]*Hub, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	hubs := make(map[string]*Hub, len(cfg.Hubs))
+	for name, hc := range cfg.Hubs {
+		hubs[name] = hc.NewHub()
+	}
+	return hubs, nil
+}
+
+// Validate check the configuration
+func (cfg Config) Validate() error {
+	if len(cfg.Hubs) == 0 {
+		return &ConfigError{Problems: []string{"hubs: no hub is configured"}}
+	}
+	names := make([]string, 0, len(cfg.Hubs))
+	for name := range cfg.Hubs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := []string{}
+	for _, name := range names {
+		problems = append(problems, cfg.Hubs[name].problems("hubs."+name)...)
+	}
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+// Validate check configuration of the hub
+func (c HubConfig) Validate() error {
+	if problems := c.problems("hub"); len(problems) > 0 {
+		return &ConfigError{Problems: problems}
+	}
+	return nil
+}
+
+func (c HubConfig) problems(path string) []string {
+	res := []string{}
+	add := func(field, msg string, args ...interface{}) {
+		res = append(res, path+"."+field+": "+fmt.Sprintf(msg, args...))
+	}
+
+	if c.URI == "" {
+		add("uri", "is mandatory")
+	} else if u, err := url.Parse(c.URI); err != nil {
+		add("uri", "is invalid. %s", err.Error())
+	} else if u.Scheme == "" {
+		add("uri", "has no scheme, ie: postgres://host/db or mongodb://host/db")
+	}
+	if c.PoolSize < 0 {
+		add("poolSize", "should not be negative, got %d", c.PoolSize)
+	}
+	if c.NoPool && c.PoolSize > 0 {
+		add("poolSize", "is set while noPool is true")
+	}
+	if c.Eager < 0 {
+		add("eager", "should not be negative, got %d", c.Eager)
+	} else if size := c.PoolSize; c.Eager > 0 && size > 0 && c.Eager > size {
+		add("eager", "should not be greater than poolSize %d, got %d", size, c.Eager)
+	}
+	durations := []struct {
+		field string
+		d     Duration
+	}{{"poolTimeout", c.PoolTimeout}, {"autoClose", c.AutoClose}, {"autoRelease", c.AutoRelease}, {"timeout", c.Timeout},
+		{"slowQuery", c.SlowQuery}}
+	for _, d := range durations {
+		if d.d < 0 {
+			add(d.field, "should not be negative, got %s", time.Duration(d.d))
+		}
+	}
+	if c.MaxTake < 0 {
+		add("maxTake", "should not be negative, got %d", c.MaxTake)
+	}
+	if c.Cache != nil {
+		if c.Cache.TTL < 0 {
+			add("cache.ttl", "should not be negative, got %s", time.Duration(c.Cache.TTL))
+		}
+		if len(c.Cache.Tables) == 0 {
+			add("cache.tables", "is empty, list tables to be cached")
+		}
+	}
+	return res
+}
+
+// Options returns options of NewHub for the configuration
+func (c HubConfig) Options() []Option {
+	opts := []Option{WithReadOnly(c.ReadOnly)}
+	if c.PoolTimeout > 0 {
+		opts = append(opts, WithPoolTimeout(time.Duration(c.PoolTimeout)))
+	}
+	if c.AutoClose > 0 {
+		opts = append(opts, WithAutoClose(time.Duration(c.AutoClose)))
+	}
+	if c.AutoRelease > 0 {
+		opts = append(opts, WithAutoRelease(time.Duration(c.AutoRelease)))
+	}
+	if c.Eager > 0 {
+		opts = append(opts, WithEagerPool(c.Eager))
+	}
+	if c.Timeout > 0 {
+		opts = append(opts, WithDefaultTimeout(time.Duration(c.Timeout)))
+	}
+	return opts
+}
+
+// ConnFn returns function opening connection of the configuration
+func (c HubConfig) ConnFn() func() (dbflex.IConnection, error) {
+	return func() (dbflex.IConnection, error) {
+		conn, err := dbflex.NewConnectionFromURI(c.URI, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err = conn.Connect(); err != nil {
+			return nil, err
+		}
+		if c.KeyTag != "" {
+			conn.SetKeyNameTag(c.KeyTag)
+		}
+		if c.FieldTag != "" {
+			conn.SetFieldNameTag(c.FieldTag)
+		}
+		return conn, nil
+	}
+}
+
+// NewHub create hub of the configuration, the configuration should be validated first
+func (c HubConfig) NewHub() *Hub {
+	h := NewHub(c.ConnFn(), !c.NoPool, c.PoolSize, c.Options()...)
+	h.SetMaxTake(c.MaxTake)
+	h.SetSlowQueryThreshold(time.Duration(c.SlowQuery))
+	h.config = &c
+	if c.Cache != nil {
+		h.SetCache(NewMemoryCache(), time.Duration(c.Cache.TTL))
+		if h.cachedTables == nil {
+			h.cachedTables = map[string]bool{}
+		}
+		for _, table := range c.Cache.Tables {
+			h.cachedTables[strings.ToLower(table)] = true
+		}
+	}
+	return h
+}
@@ -0,0 +1,207 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+	"github.com/shopspring/decimal"
+)
+
+// ConvertFunc convert a value into other type
+type ConvertFunc func(v interface{}) (interface{}, error)
+
+type converterKey struct {
+	from reflect.Type
+	to   reflect.Type
+}
+
+// RegisterConverter register function converting value of fromType into toType, types could be given as sample value
+// or reflect.Type. On read, value returned by the driver of fromType is converted when the field is of toType.
+// On write, field of a type registered as toType of other converter is converted using converter registered from that type,
+// so a custom type round-trip when both directions are registered. When more than one converter is registered from the
+// custom type, the first registered one is used on write:
+//
+//	h.RegisterConverter("", decimal.Decimal{}, func(v interface{}) (interface{}, error) { return decimal.NewFromString(v.(string)) })
+//	h.RegisterConverter(decimal.Decimal{}, "", func(v interface{}) (interface{}, error) { return v.(decimal.Decimal).String(), nil })
+//
+// Converters are applied by Get, GetByID, GetByParm, Gets, Save, Insert and Update. Converters are shared with hubs
+// created from this hub, register them before the hub is used
+func (h *Hub) RegisterConverter(fromType, toType interface{}, fn ConvertFunc) *Hub {
+	if h.converters == nil {
+		h.converters = map[converterKey]ConvertFunc{}
+	}
+	key := converterKey{typeOf(fromType), typeOf(toType)}
+	if _, ok := h.converters[key]; !ok {
+		h.converterKeys = append(h.converterKeys, key)
+	}
+	h.converters[key] = fn
+	return h
+}
+
+func typeOf(obj interface{}) reflect.Type {
+	if t, ok := obj.(reflect.Type); ok {
+		return t
+	}
+	return reflect.TypeOf(obj)
+}
+
+// converter returns converter from one type into another
+func (h *Hub) converter(from, to reflect.Type) ConvertFunc {
+	if len(h.converters) == 0 {
+		return nil
+	}
+	return h.converters[converterKey{from, to}]
+}
+
+// writeConverter returns converter used to write value of custom type t, converters are checked in registration
+// order so the first registered converter from t is used
+func (h *Hub) writeConverter(t reflect.Type) ConvertFunc {
+	var custom bool
+	var fn ConvertFunc
+	for _, k := range h.converterKeys {
+		if k.to == t {
+			custom = true
+		}
+		if k.from == t && fn == nil {
+			fn = h.converters[k]
+		}
+	}
+	if !custom {
+		return nil
+	}
+	return fn
+}
+
+// convertsModel returns true if a field of the model is converted by the hub, either by registered converter or
+// because it is Null, decimal or embedded
+func (h *Hub) convertsModel(data interface{}) bool {
+	meta := MetaOf(data)
+	if meta == nil {
+		return false
+	}
+	if hasNullField(meta) {
+		return true
+	}
+	for _, f := range meta.Fields {
+		if isDecimalField(f) || isEmbedField(f) {
+			return true
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		for k := range h.converters {
+			if k.to == ft || k.to == f.Type {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encodeValues convert values of document which type has write converter, and decimals into value of the driver
+func (h *Hub) encodeValues(conn dbflex.IConnection, doc toolkit.M) error {
+	for k, v := range doc {
+		if v == nil {
+			continue
+		}
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				doc[k] = nil
+				continue
+			}
+			if h.writeConverter(rv.Type()) == nil {
+				v = rv.Elem().Interface()
+			}
+		}
+
+		if fn := h.writeConverter(reflect.TypeOf(v)); fn != nil {
+			cv, err := fn(v)
+			if err != nil {
+				return fmt.Errorf("fail convert field %s: %w", k, err)
+			}
+			doc[k] = cv
+			continue
+		}
+		if d, ok := v.(decimal.Decimal); ok {
+			dv, err := decimalValue(conn, d)
+			if err != nil {
+				return fmt.Errorf("fail convert field %s: %w", k, err)
+			}
+			doc[k] = dv
+		}
+	}
+	return nil
+}
+
+// hubMapped is model mapped by the hub, so its fields are converted using registered converters and it is
+// written to and read from its physical table
+type hubMapped struct {
+	orm.DataModel
+	h     *Hub
+	conn  dbflex.IConnection
+	table string
+	doc   toolkit.M
+}
+
+func (m *hubMapped) TableName() string {
+	if m.table != "" {
+		return m.table
+	}
+	return m.DataModel.TableName()
+}
+
+func (m *hubMapped) GetID(conn dbflex.IConnection) ([]string, []interface{}) {
+	if conn == nil {
+		conn = m.conn
+	}
+	return m.DataModel.GetID(conn)
+}
+
+// PreSave call PreSave of the model then encode it, so conversion error fails the write
+func (m *hubMapped) PreSave(conn dbflex.IConnection) error {
+	if err := m.DataModel.PreSave(conn); err != nil {
+		return err
+	}
+	m.doc = nil
+	if tm, ok := m.DataModel.(tagMapped); ok {
+		m.doc = tm.encodeDoc()
+		return nil
+	}
+	doc := modelDoc(m.conn, m.DataModel)
+	if err := m.h.encodeValues(m.conn, doc); err != nil {
+		return err
+	}
+	m.doc = doc
+	return nil
+}
+
+func (m *hubMapped) encodeDoc() toolkit.M {
+	if m.doc != nil {
+		return m.doc
+	}
+	if tm, ok := m.DataModel.(tagMapped); ok {
+		return tm.encodeDoc()
+	}
+	m.doc = modelDoc(m.conn, m.DataModel)
+	m.h.encodeValues(m.conn, m.doc)
+	return m.doc
+}
+
+func (m *hubMapped) decodeDoc(doc toolkit.M, target interface{}) error {
+	if tm, ok := m.DataModel.(tagMapped); ok {
+		return tm.decodeDoc(doc, target)
+	}
+	return m.h.decodeDoc(doc, reflect.Indirect(reflect.ValueOf(target)), map[string]bool{}, map[string]bool{}, true)
+}
+
+func (m *hubMapped) record() interface{} {
+	if tm, ok := m.DataModel.(tagMapped); ok {
+		return tm.record()
+	}
+	return m.DataModel
+}
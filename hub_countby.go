@@ -0,0 +1,65 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// GroupCount is result of CountBy, Keys hold value of each group field
+type GroupCount struct {
+	Keys  toolkit.M
+	Count int
+}
+
+const countByAlias = "datahubcount"
+
+// CountBy returns number of data for each combination of group fields, filtered by where
+func (h *Hub) CountBy(data orm.DataModel, where *dbflex.Filter, groupFields ...string) ([]GroupCount, error) {
+	data.SetThis(data)
+	if len(groupFields) == 0 {
+		return nil, errors.New("fail CountBy: group field is mandatory")
+	}
+
+	parm := dbflex.NewQueryParam().
+		SetGroupBy(groupFields...).
+		SetAggr(dbflex.NewAggrItem(countByAlias, dbflex.AggrCount, groupFields[0]))
+	if where != nil {
+		parm.SetWhere(where)
+	}
+
+	ms := []toolkit.M{}
+	if err := h.internal().PopulateByParm(data.TableName(), parm, &ms); err != nil {
+		return nil, fmt.Errorf("fail CountBy: %w", err)
+	}
+
+	res := make([]GroupCount, len(ms))
+	for i, m := range ms {
+		res[i] = GroupCount{Keys: groupValues(m, groupFields), Count: m.GetInt(countByAlias)}
+	}
+	return res, nil
+}
+
+// groupValues returns values of group fields of an aggregate result row, some drivers, ie: mongo, return group
+// fields under _id
+func groupValues(m toolkit.M, groupFields []string) toolkit.M {
+	ids, _ := m.Get("_id").(toolkit.M)
+	if ids == nil {
+		if mid, ok := m.Get("_id").(map[string]interface{}); ok {
+			ids = toolkit.M(mid)
+		}
+	}
+
+	keys := toolkit.M{}
+	for _, f := range groupFields {
+		if m.Has(f) {
+			keys.Set(f, m.Get(f))
+		} else if ids != nil {
+			keys.Set(f, ids.Get(f))
+		}
+	}
+	return keys
+}
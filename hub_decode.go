@@ -0,0 +1,306 @@
+package datahub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DecodeOptions make the hub decode records of models by itself instead of leaving it to the driver, so fields that
+// could not be mapped are detected. It is applied by Get, GetByID, GetByParm and Gets
+type DecodeOptions struct {
+	// ErrorOnUnknown fail the read when record has field that is not exist on the model
+	ErrorOnUnknown bool
+
+	// ErrorOnMissing fail the read when field of the model is not returned by the record. It is not checked when
+	// query select specific fields
+	ErrorOnMissing bool
+
+	// OnSkipped is called once per read when fields are skipped and not rejected, when it is nil the report is
+	// logged as warning
+	OnSkipped func(r *DecodeReport)
+}
+
+// DecodeReport is fields skipped while decoding records of a table
+type DecodeReport struct {
+	Table   string
+	Unknown []string
+	Missing []string
+}
+
+// DecodeError is returned when record is rejected by DecodeOptions or could not be decoded into the model
+type DecodeError struct {
+	DecodeReport
+	// Err is the underlying error when record could not be decoded
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("fail decode %s: %s", e.Table, e.Err.Error())
+	}
+	msgs := []string{}
+	if len(e.Unknown) > 0 {
+		msgs = append(msgs, "unknown fields "+strings.Join(e.Unknown, ", "))
+	}
+	if len(e.Missing) > 0 {
+		msgs = append(msgs, "missing fields "+strings.Join(e.Missing, ", "))
+	}
+	return fmt.Sprintf("fail decode %s: %s", e.Table, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the underlying error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// SetDecodeOptions set decode options of the hub, nil means records are decoded by the driver
+func (h *Hub) SetDecodeOptions(opts *DecodeOptions) *Hub {
+	h.decodeOpts = opts
+	return h
+}
+
+// decodeByHub returns true if records of the model need to be decoded by the hub
+func (h *Hub) decodeByHub(data orm.DataModel) bool {
+	if _, ok := data.(tagMapped); ok {
+		return false
+	}
+	return h.decodeOpts != nil || h.convertsModel(data)
+}
+
+// queryCommand build select command of a table based on query parameter
+func queryCommand(tableName string, parm *dbflex.QueryParam) dbflex.ICommand {
+	cmd := dbflex.From(tableName)
+	if len(parm.Select) == 0 {
+		cmd.Select()
+	} else {
+		cmd.Select(parm.Select...)
+	}
+	if parm.Where != nil {
+		cmd.Where(parm.Where)
+	}
+	if len(parm.Sort) > 0 {
+		cmd.OrderBy(parm.Sort...)
+	}
+	if parm.Skip > 0 {
+		cmd.Skip(parm.Skip)
+	}
+	if parm.Take > 0 {
+		cmd.Take(parm.Take)
+	}
+	return cmd
+}
+
+// fetchDecoded run query and decode the records into dest, pointer to struct receive the first record
+func (h *Hub) fetchDecoded(conn dbflex.IConnection, tableName string, parm *dbflex.QueryParam, dest interface{}) error {
+	docs, err := fetchDocs(conn, queryCommand(tableName, parm))
+	if err != nil {
+		return err
+	}
+	return h.decodeDocs(tableName, docs, dest, len(parm.Select) > 0)
+}
+
+// decodeDocs decode documents into dest, which is pointer to slice or pointer to struct receiving the first document
+func (h *Hub) decodeDocs(tableName string, docs []toolkit.M, dest interface{}, selected bool) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("dest should be a pointer")
+	}
+
+	report := &DecodeReport{Table: tableName}
+	unknown, missing := map[string]bool{}, map[string]bool{}
+	if rv.Elem().Kind() != reflect.Slice {
+		if len(docs) == 0 {
+			return fmt.Errorf("fail decode %s: %w", tableName, ErrNotFound)
+		}
+		if err := h.decodeDoc(docs[0], rv.Elem(), unknown, missing, selected); err != nil {
+			return &DecodeError{DecodeReport: *report, Err: err}
+		}
+	} else {
+		sliceType := rv.Elem().Type()
+		elemType := sliceType.Elem()
+		res := reflect.MakeSlice(sliceType, 0, len(docs))
+		for _, doc := range docs {
+			item := reflect.New(elemType)
+			if elemType.Kind() == reflect.Ptr {
+				item.Elem().Set(reflect.New(elemType.Elem()))
+			}
+			if err := h.decodeDoc(doc, reflect.Indirect(item.Elem()), unknown, missing, selected); err != nil {
+				return &DecodeError{DecodeReport: *report, Err: err}
+			}
+			if dm, ok := item.Elem().Interface().(orm.DataModel); ok {
+				dm.SetThis(dm)
+			} else if item.Elem().CanAddr() {
+				if dm, ok := item.Elem().Addr().Interface().(orm.DataModel); ok {
+					dm.SetThis(dm)
+				}
+			}
+			res = reflect.Append(res, item.Elem())
+		}
+		rv.Elem().Set(res)
+	}
+
+	report.Unknown, report.Missing = sortedKeys(unknown), sortedKeys(missing)
+	opts := h.decodeOpts
+	if opts == nil || (len(report.Unknown) == 0 && len(report.Missing) == 0) {
+		return nil
+	}
+	if (opts.ErrorOnUnknown && len(report.Unknown) > 0) || (opts.ErrorOnMissing && len(report.Missing) > 0) {
+		return &DecodeError{DecodeReport: *report}
+	}
+	if opts.OnSkipped != nil {
+		opts.OnSkipped(report)
+	} else {
+		h.Logger().Warn("fields are skipped on decode", "table", tableName,
+			"unknown", strings.Join(report.Unknown, ","), "missing", strings.Join(report.Missing, ","))
+	}
+	return nil
+}
+
+// decodeDoc set fields of struct value rv from document
+func (h *Hub) decodeDoc(doc toolkit.M, rv reflect.Value, unknown, missing map[string]bool, selected bool) error {
+	if rv.Kind() == reflect.Map {
+		if rv.IsNil() {
+			rv.Set(reflect.MakeMap(rv.Type()))
+		}
+		for k, v := range doc {
+			rv.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(v))
+		}
+		return nil
+	}
+	meta := MetaOf(rv.Type())
+	if meta == nil {
+		return fmt.Errorf("can't decode into %s", rv.Type().String())
+	}
+
+	found := map[*FieldMeta]bool{}
+	for k, v := range doc {
+		f := meta.Field(k)
+		if f == nil {
+			unknown[k] = true
+			continue
+		}
+		found[f] = true
+		if err := h.assignValue(f.Value(rv), v); err != nil {
+			return fmt.Errorf("fail decode field %s: %w", f.Name, err)
+		}
+	}
+
+	if selected {
+		return nil
+	}
+	for _, f := range meta.Fields {
+		if found[f] || isIgnoredField(f) {
+			continue
+		}
+		missing[f.Name] = true
+	}
+	return nil
+}
+
+func isIgnoredField(f *FieldMeta) bool {
+	for _, tag := range []string{"bson", "json", "sqlname", "db"} {
+		if strings.Split(f.Tag.Get(tag), ",")[0] == "-" {
+			return true
+		}
+	}
+	return strings.TrimSpace(f.Tag.Get("gorm")) == "-"
+}
+
+// assignValue set fv from value returned by the driver, converting it into type of the field using registered
+// converter or by kind of the field
+func (h *Hub) assignValue(fv reflect.Value, v interface{}) error {
+	if v == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return nil
+	}
+
+	switch o := v.(type) {
+	case primitive.DateTime:
+		v = o.Time()
+	case primitive.Decimal128:
+		v = o.String()
+	}
+
+	vv := reflect.ValueOf(v)
+	if fn := h.converter(vv.Type(), fv.Type()); fn != nil {
+		cv, err := fn(v)
+		if err != nil {
+			return err
+		}
+		if cv == nil {
+			fv.Set(reflect.Zero(fv.Type()))
+			return nil
+		}
+		v, vv = cv, reflect.ValueOf(cv)
+	}
+	if fv.Type() == decimalType {
+		d, err := toDecimal(v)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(d))
+		return nil
+	}
+	if fv.Kind() == reflect.Struct && fv.Type().Implements(nullableType) {
+		if err := h.assignValue(fv.FieldByName("V"), v); err != nil {
+			return err
+		}
+		fv.FieldByName("Valid").SetBool(true)
+		return nil
+	}
+	if fv.Kind() == reflect.Ptr && vv.Kind() != reflect.Ptr {
+		nv := reflect.New(fv.Type().Elem())
+		if err := h.assignValue(nv.Elem(), v); err != nil {
+			return err
+		}
+		fv.Set(nv)
+		return nil
+	}
+
+	switch {
+	case vv.Type().AssignableTo(fv.Type()):
+		fv.Set(vv)
+	case (vv.Kind() == reflect.String || vv.Type() == reflect.TypeOf([]byte{})) && isJSONTarget(fv.Type()):
+		var bs []byte
+		if vv.Kind() == reflect.String {
+			bs = []byte(vv.String())
+		} else {
+			bs = vv.Bytes()
+		}
+		return json.Unmarshal(bs, fv.Addr().Interface())
+	case vv.Kind() == reflect.String && fv.Kind() != reflect.String && fv.Type() != timeType:
+		return setFromString(fv, vv.String())
+	case vv.Type().ConvertibleTo(fv.Type()) && (vv.Kind() == reflect.String) == (fv.Kind() == reflect.String):
+		fv.Set(vv.Convert(fv.Type()))
+	case fv.Kind() == reflect.String && vv.Kind() != reflect.Map && vv.Kind() != reflect.Slice:
+		fv.SetString(fmt.Sprintf("%v", v))
+	case fv.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(fmt.Sprintf("%v", v))
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	default:
+		return toolkit.Serde(v, fv.Addr().Interface(), "")
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
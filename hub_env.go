@@ -0,0 +1,121 @@
+package datahub
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultEnvPrefix is prefix of environment variables read by FromEnv when prefix is empty
+const DefaultEnvPrefix = "DATAHUB"
+
+// FromEnv create hub configured by environment variables, prefix is DefaultEnvPrefix when it is empty.
+// Variables and their defaults, durations are written as 30s, 1m and so on:
+//
+//	DATAHUB_URI           connection string, mandatory
+//	DATAHUB_POOLSIZE      size of the pool, default DefaultPoolSize
+//	DATAHUB_NOPOOL        true to disable the pool, default false
+//	DATAHUB_POOLTIMEOUT   wait for free connection, default DefaultPoolTimeout
+//	DATAHUB_AUTOCLOSE     idle connection lifetime, default DefaultPoolAutoClose
+//	DATAHUB_AUTORELEASE   connection held by an operation is taken back after, default never
+//	DATAHUB_EAGER         connections opened on start, default 0
+//	DATAHUB_TIMEOUT       default timeout of operations, default none
+//	DATAHUB_SLOWQUERY     operations taking longer are logged as slow, default disabled
+//	DATAHUB_KEYTAG        key name tag of connections, default driver default
+//	DATAHUB_FIELDTAG      field name tag of connections, default driver default
+//	DATAHUB_READONLY      true to reject writes, default false
+//	DATAHUB_MAXTAKE       maximum records returned by a query, default no limit
+//	DATAHUB_CACHETABLES   comma separated tables cached in memory, default none
+//	DATAHUB_CACHETTL      ttl of cached values, default no expiry
+func FromEnv(prefix string) (*Hub, error) {
+	c, err := HubConfigFromEnv(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return c.NewHub(), nil
+}
+
+// HubConfigFromEnv read and validate hub configuration from environment variables, see FromEnv
+func HubConfigFromEnv(prefix string) (HubConfig, error) {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	prefix = strings.TrimSuffix(strings.ToUpper(prefix), "_") + "_"
+
+	c := HubConfig{}
+	problems := []string{}
+	get := func(name string) (string, bool) {
+		v, ok := os.LookupEnv(prefix + name)
+		return strings.TrimSpace(v), ok && strings.TrimSpace(v) != ""
+	}
+	fail := func(name, msg string) {
+		problems = append(problems, prefix+name+": "+msg)
+	}
+	getInt := func(name string, dest *int) {
+		if v, ok := get(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				fail(name, "should be a number, got "+strconv.Quote(v))
+				return
+			}
+			*dest = n
+		}
+	}
+	getBool := func(name string, dest *bool) {
+		if v, ok := get(name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				fail(name, "should be true or false, got "+strconv.Quote(v))
+				return
+			}
+			*dest = b
+		}
+	}
+	getDuration := func(name string, dest *Duration) {
+		if v, ok := get(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				fail(name, "should be a duration such as 30s or 1m, got "+strconv.Quote(v))
+				return
+			}
+			*dest = Duration(d)
+		}
+	}
+
+	c.URI, _ = get("URI")
+	c.KeyTag, _ = get("KEYTAG")
+	c.FieldTag, _ = get("FIELDTAG")
+	getInt("POOLSIZE", &c.PoolSize)
+	getBool("NOPOOL", &c.NoPool)
+	getDuration("POOLTIMEOUT", &c.PoolTimeout)
+	getDuration("AUTOCLOSE", &c.AutoClose)
+	getDuration("AUTORELEASE", &c.AutoRelease)
+	getInt("EAGER", &c.Eager)
+	getDuration("TIMEOUT", &c.Timeout)
+	getDuration("SLOWQUERY", &c.SlowQuery)
+	getBool("READONLY", &c.ReadOnly)
+	getInt("MAXTAKE", &c.MaxTake)
+	if v, ok := get("CACHETABLES"); ok {
+		c.Cache = &CacheConfig{}
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				c.Cache.Tables = append(c.Cache.Tables, t)
+			}
+		}
+		getDuration("CACHETTL", &c.Cache.TTL)
+	}
+	if len(problems) > 0 {
+		return c, &ConfigError{Problems: problems}
+	}
+
+	// name problems by variable, ie: cfg.cache.tables to DATAHUB_CACHETABLES
+	for _, p := range c.problems("cfg") {
+		field, msg, _ := strings.Cut(strings.TrimPrefix(p, "cfg."), ": ")
+		fail(strings.ToUpper(strings.ReplaceAll(field, ".", "")), msg)
+	}
+	if len(problems) > 0 {
+		return c, &ConfigError{Problems: problems}
+	}
+	return c, nil
+}
@@ -0,0 +1,171 @@
+package datahub
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Errors returned by the hub are wrapped into one of the categories below, so they can be handled using errors.As
+// while errors.Is and errors.As still reach the driver error:
+//
+//	ConnectionError  connection could not be acquired
+//	QueryError       the driver fail to run a command or query
+//	DecodeError      record could not be decoded into the model
+//	ConstraintError  write is rejected by key or unique constraint, see also ErrDuplicateKey
+//	TimeoutError     operation is not completed within its timeout, see also ErrTimeout
+
+// ConnectionError is returned when connection to the database could not be acquired
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return "connection error. " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ConnectionError) Unwrap() error {
+	return e.Err
+}
+
+// QueryError is returned when the driver fail to run an operation of the hub
+type QueryError struct {
+	Op    string
+	Table string
+	Err   error
+}
+
+func (e *QueryError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the driver error
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
+// ConstraintError is returned when a write is rejected by key or unique constraint of the table
+type ConstraintError struct {
+	Op    string
+	Table string
+	Err   error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error, which is *DuplicateKeyError for duplicate key
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// TimeoutError is returned when an operation is not completed within its timeout, errors.Is(err, ErrTimeout) is true
+type TimeoutError struct {
+	Op    string
+	Table string
+	Err   error
+}
+
+func (e *TimeoutError) Error() string {
+	return e.Err.Error()
+}
+
+// Is returns true for ErrTimeout
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
+
+// Unwrap returns the underlying error
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// classifyError wrap error returned by an operation into its category. Errors already categorized, and errors
+// raised by the hub itself such as validation and guard errors, are returned as is
+func classifyError(op, table string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var (
+		connErr    *ConnectionError
+		queryErr   *QueryError
+		decodeErr  *DecodeError
+		consErr    *ConstraintError
+		timeoutErr *TimeoutError
+		verr       *ValidationError
+		gerr       *GuardError
+	)
+	switch {
+	case errors.As(err, &connErr), errors.As(err, &queryErr), errors.As(err, &decodeErr), errors.As(err, &consErr),
+		errors.As(err, &timeoutErr), errors.As(err, &verr), errors.As(err, &gerr),
+		errors.Is(err, ErrNotFound), errors.Is(err, ErrNotSupported), errors.Is(err, ErrRateLimited),
+		errors.Is(err, ErrReadOnly):
+		return err
+	case errors.Is(err, ErrTimeout):
+		return &TimeoutError{Op: op, Table: table, Err: err}
+	case errors.Is(err, ErrDuplicateKey), errors.Is(err, ErrVersionConflict):
+		return &ConstraintError{Op: op, Table: table, Err: err}
+	}
+	return &QueryError{Op: op, Table: table, Err: err}
+}
+
+// ErrDuplicateKey is returned when a write violates primary key or unique index, use errors.Is to check it and
+// errors.As with *DuplicateKeyError to get the key name
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// DuplicateKeyError is unique constraint violation reported by the driver
+type DuplicateKeyError struct {
+	// Key is name of the index or constraint being violated, empty when driver does not report it
+	Key string
+	// Err is the driver error
+	Err error
+}
+
+func (e *DuplicateKeyError) Error() string {
+	if e.Key == "" {
+		return "duplicate key. " + e.Err.Error()
+	}
+	return "duplicate key " + e.Key + ". " + e.Err.Error()
+}
+
+// Is returns true for ErrDuplicateKey
+func (e *DuplicateKeyError) Is(target error) bool {
+	return target == ErrDuplicateKey
+}
+
+// Unwrap returns the driver error
+func (e *DuplicateKeyError) Unwrap() error {
+	return e.Err
+}
+
+var duplicateKeyPatterns = []*regexp.Regexp{
+	// mongo: E11000 duplicate key error collection: db.orders index: code_1 dup key: { code: "A" }
+	regexp.MustCompile(`E11000 duplicate key error.*?index: (\S+)`),
+	// postgres: duplicate key value violates unique constraint "orders_code_key"
+	regexp.MustCompile(`duplicate key value violates unique constraint "([^"]+)"`),
+	// mysql: Error 1062: Duplicate entry 'A' for key 'orders.code'
+	regexp.MustCompile(`Duplicate entry .* for key '([^']+)'`),
+	// sqlite: UNIQUE constraint failed: orders.code
+	regexp.MustCompile(`UNIQUE constraint failed: (.+)$`),
+}
+
+// duplicateKey returns *DuplicateKeyError when err is unique constraint violation of any supported driver,
+// otherwise err is returned as is. It is wrapped into ConstraintError once returned by the operation
+func duplicateKey(err error) error {
+	if err == nil || errors.Is(err, ErrDuplicateKey) {
+		return err
+	}
+	msg := err.Error()
+	for _, re := range duplicateKeyPatterns {
+		if m := re.FindStringSubmatch(msg); m != nil {
+			return &DuplicateKeyError{Key: strings.TrimSpace(m[1]), Err: err}
+		}
+	}
+	lower := strings.ToLower(msg)
+	if strings.Contains(lower, "duplicate key") || strings.Contains(lower, "e11000") || strings.Contains(lower, "error 1062") {
+		return &DuplicateKeyError{Err: err}
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+var mapPool = sync.Pool{
+	New: func() interface{} {
+		return toolkit.M{}
+	},
+}
+
+// AcquireMap get empty toolkit.M from pool
+func AcquireMap() toolkit.M {
+	return mapPool.Get().(toolkit.M)
+}
+
+// ReleaseMaps clear the maps and put them back to pool, maps should not be used anymore after being released
+func ReleaseMaps(ms ...toolkit.M) {
+	for _, m := range ms {
+		if m == nil {
+			continue
+		}
+		for k := range m {
+			delete(m, k)
+		}
+		mapPool.Put(m)
+	}
+}
+
+// GetsInto works like Gets but reuse elements of buf. Buf is pointer to slice, it is truncated and filled
+// with the result. Existing elements (up to capacity of the slice) are reset and decoded in place,
+// so calling it repeatedly with the same buffer produce much less garbage than Gets
+func (h *Hub) GetsInto(data orm.DataModel, parm *dbflex.QueryParam, buf interface{}) error {
+	data.SetThis(data)
+	parm, err := h.prepareQuery("gets", data.TableName(), parm)
+	if err != nil {
+		return err
+	}
+
+	cmd := dbflex.From(h.tableOf(data))
+	if len(parm.Select) == 0 {
+		cmd.Select()
+	} else {
+		cmd.Select(parm.Select...)
+	}
+	if parm.Where != nil {
+		cmd.Where(parm.Where)
+	}
+	if len(parm.Sort) > 0 {
+		cmd.OrderBy(parm.Sort...)
+	}
+	if parm.Skip > 0 {
+		cmd.Skip(parm.Skip)
+	}
+	if parm.Take > 0 {
+		cmd.Take(parm.Take)
+	}
+
+	if err := h.fetchInto(cmd, nil, buf); err != nil {
+		return fmt.Errorf("fail GetsInto: %w", err)
+	}
+	return h.afterFetch(buf)
+}
+
+// PopulateInto works like Populate but reuse elements of buf, see GetsInto. When buf is pointer to []toolkit.M
+// new maps are taken from pool, they can be returned to the pool using ReleaseMaps once they are not needed
+func (h *Hub) PopulateInto(cmd dbflex.ICommand, buf interface{}, objects ...toolkit.M) (int, error) {
+	var object toolkit.M
+	if len(objects) > 0 {
+		object = objects[0]
+	}
+	if err := h.fetchInto(cmd, object, buf); err != nil {
+		return 0, fmt.Errorf("fail PopulateInto: %w", err)
+	}
+	return reflect.ValueOf(buf).Elem().Len(), nil
+}
+
+func (h *Hub) fetchInto(cmd dbflex.ICommand, object toolkit.M, buf interface{}) error {
+	rv := reflect.ValueOf(buf)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("buffer should be pointer to slice")
+	}
+	slice := rv.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	isMap := elemType == reflect.TypeOf(toolkit.M{})
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	cur := conn.Cursor(cmd, object)
+	if err = cur.Error(); err != nil {
+		return err
+	}
+	defer cur.Close()
+
+	full := slice.Slice(0, slice.Cap())
+	n := 0
+	for {
+		var item reflect.Value
+		if n < full.Len() {
+			item = full.Index(n)
+		} else {
+			full = reflect.Append(full, reflect.Zero(elemType))
+			full = full.Slice(0, full.Cap())
+			item = full.Index(n)
+		}
+
+		// reset the element, keep pointer and map allocation so it can be reused
+		var target interface{}
+		switch {
+		case isMap:
+			m, _ := item.Interface().(toolkit.M)
+			if m == nil {
+				m = AcquireMap()
+				item.Set(reflect.ValueOf(m))
+			}
+			for k := range m {
+				delete(m, k)
+			}
+			target = item.Addr().Interface()
+		case isPtr:
+			if item.IsNil() {
+				item.Set(reflect.New(elemType.Elem()))
+			} else {
+				item.Elem().Set(reflect.Zero(elemType.Elem()))
+			}
+			target = item.Interface()
+		default:
+			item.Set(reflect.Zero(elemType))
+			target = item.Addr().Interface()
+		}
+
+		if err = cur.Fetch(target).Error(); err != nil {
+			if isEOF(err) {
+				break
+			}
+			return err
+		}
+		n++
+	}
+
+	slice.Set(full.Slice(0, n))
+	return nil
+}
+
+func isEOF(err error) bool {
+	return errors.Is(err, io.EOF) || strings.Contains(strings.ToLower(err.Error()), "eof")
+}
@@ -0,0 +1,38 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// AfterFetcher is implemented by model that need to populate derived fields after being loaded from database.
+// AfterFetch is called by Get, GetByID, GetByParm, Gets and other model based read operations on each record
+type AfterFetcher interface {
+	AfterFetch(h *Hub) error
+}
+
+// afterFetch normalize time values of dest and call its AfterFetch, dest could be a pointer to struct or a pointer to slice
+func (h *Hub) afterFetch(dest interface{}) error {
+	h.timeToLocal(dest)
+	if af, ok := dest.(AfterFetcher); ok {
+		return af.AfterFetch(h)
+	}
+
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Slice {
+		return nil
+	}
+	rv = rv.Elem()
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		if item.Kind() != reflect.Ptr && item.CanAddr() {
+			item = item.Addr()
+		}
+		if af, ok := item.Interface().(AfterFetcher); ok {
+			if err := af.AfterFetch(h); err != nil {
+				return fmt.Errorf("record %d. %w", i, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package datahub
+
+import (
+	"fmt"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// GuardError is returned when an operation is rejected by safety guard of the hub
+type GuardError struct {
+	Op    string
+	Table string
+	Msg   string
+}
+
+func (e *GuardError) Error() string {
+	return fmt.Sprintf("fail %s on %s: %s", e.Op, e.Table, e.Msg)
+}
+
+// SetMaxTake set maximum number of records returned by Gets, GetsInto, PopulateByParm and Populate. Query with take
+// more than n is rejected with GuardError, query without take is capped to n. Populate is rejected when its command
+// returns more than n records. 0 means no limit
+func (h *Hub) SetMaxTake(n int) *Hub {
+	h.maxTake = n
+	return h
+}
+
+// MaxTake returns maximum number of records returned by a query
+func (h *Hub) MaxTake() int {
+	return h.maxTake
+}
+
+// ProtectTables mark tables as large tables. Gets, PopulateByParm, DeleteQuery and UpdateField without filter
+// on these tables will be rejected with GuardError
+func (h *Hub) ProtectTables(names ...string) *Hub {
+	if h.protectedTables == nil {
+		h.protectedTables = map[string]bool{}
+	}
+	for _, name := range names {
+		h.protectedTables[strings.ToLower(name)] = true
+	}
+	return h
+}
+
+// UnprotectTables remove tables from protected tables
+func (h *Hub) UnprotectTables(names ...string) *Hub {
+	for _, name := range names {
+		delete(h.protectedTables, strings.ToLower(name))
+	}
+	return h
+}
+
+func (h *Hub) isProtected(tableName string) bool {
+	return h.protectedTables[strings.ToLower(tableName)]
+}
+
+// prepareQuery apply model defaults and check query against guards of the hub.
+// It returns copy of parm with defaults being applied and take being capped
+func (h *Hub) prepareQuery(op, tableName string, parm *dbflex.QueryParam) (*dbflex.QueryParam, error) {
+	if parm == nil {
+		parm = dbflex.NewQueryParam()
+	}
+	parm = h.applyModelDefaults(tableName, parm)
+	if parm.Where != nil && h.timeLocation != nil {
+		cp := *parm
+		cp.Where = h.filterToUTC(parm.Where)
+		parm = &cp
+	}
+	if h.unguarded {
+		return parm, nil
+	}
+	return h.guardQuery(op, tableName, parm)
+}
+
+// guardQuery reject query without filter on protected table or with take exceeding max take, and returns copy of
+// parm with take being capped when it has no take
+func (h *Hub) guardQuery(op, tableName string, parm *dbflex.QueryParam) (*dbflex.QueryParam, error) {
+	if parm == nil {
+		parm = dbflex.NewQueryParam()
+	}
+	if parm.Where == nil && h.isProtected(tableName) {
+		return nil, &GuardError{Op: op, Table: tableName, Msg: "query without filter is not allowed"}
+	}
+	if h.maxTake > 0 && parm.Take > h.maxTake {
+		return nil, &GuardError{Op: op, Table: tableName,
+			Msg: fmt.Sprintf("take %d exceeds max take %d", parm.Take, h.maxTake)}
+	}
+	if h.maxTake > 0 && parm.Take == 0 {
+		capped := *parm
+		capped.Take = h.maxTake
+		parm = &capped
+	}
+	return parm, nil
+}
+
+// internal returns copy of the hub which queries are not checked against query guards and max take. It is used by
+// operations of the hub which need all matching records, ie: Snapshot and Archive, or apply the guards themselves
+func (h *Hub) internal() *Hub {
+	nh := h.scope()
+	nh.unguarded = true
+	return nh
+}
+
+// guardWrite check delete or update filter against guards of the hub
+func (h *Hub) guardWrite(op, tableName string, where *dbflex.Filter) error {
+	if where == nil && h.isProtected(tableName) {
+		return &GuardError{Op: op, Table: tableName, Msg: op + " without filter is not allowed"}
+	}
+	return nil
+}
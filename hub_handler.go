@@ -0,0 +1,69 @@
+package datahub
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HubStats is payload of /stats of Handler
+type HubStats struct {
+	Pool        PoolStats
+	Concurrency ConcurrencyStats
+	Tables      []OpStats
+}
+
+// Handler returns http.Handler exposing state of the hub as JSON, to be mounted on debug mux of the service
+//
+//	mux.Handle("/debug/datahub/", http.StripPrefix("/debug/datahub", h.Handler()))
+//
+// Routes, relative to the mount point:
+//
+//	GET /healthz  take a connection of the hub, 200 when it is healthy and 503 otherwise
+//	GET /stats    pool and concurrency state, and statistics of each table and operation, see Stats
+//	GET /slow     latest slow queries, newest first, query param n limit number of queries, see SlowQueries
+//	GET /top      signatures taking most time, query param n limit number of signatures, see TopQueries
+func (h *Hub) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		idx, conn, err := h.getConn()
+		if err != nil {
+			writeHandlerJSON(w, http.StatusServiceUnavailable, map[string]interface{}{"status": "unavailable",
+				"error": (&ConnectionError{Err: err}).Error()})
+			return
+		}
+		h.closeConn(idx, conn)
+		writeHandlerJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "duration": time.Since(started).String()})
+	})
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeHandlerJSON(w, http.StatusOK, HubStats{Pool: h.PoolStats(), Concurrency: h.ConcurrencyStats(), Tables: h.Stats()})
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		writeHandlerJSON(w, http.StatusOK, h.SlowQueries(limitOf(r)))
+	})
+	mux.HandleFunc("/top", func(w http.ResponseWriter, r *http.Request) {
+		writeHandlerJSON(w, http.StatusOK, h.TopQueries(limitOf(r)))
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeHandlerJSON(w, http.StatusMethodNotAllowed, map[string]interface{}{"error": "method is not allowed"})
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// limitOf returns query param n of the request, 0 means no limit
+func limitOf(r *http.Request) int {
+	n, _ := strconv.Atoi(r.URL.Query().Get("n"))
+	return n
+}
+
+func writeHandlerJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
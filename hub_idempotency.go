@@ -0,0 +1,211 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// DefaultIdempotencyTableName is name of table used to keep processed idempotency keys when no name is set via
+// SetIdempotencyTableName
+const DefaultIdempotencyTableName = "DatahubIdempotency"
+
+// IdempotencyRecord is the record persisted on idempotency table for each processed key
+type IdempotencyRecord struct {
+	ID      string    `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	Table   string    `bson:"table" json:"table" sqlname:"table"`
+	Op      string    `bson:"op" json:"op" sqlname:"op"`
+	Created time.Time `bson:"created" json:"created" sqlname:"created"`
+}
+
+// SetIdempotencyTableName set name of table used to store processed idempotency keys
+func (h *Hub) SetIdempotencyTableName(name string) *Hub {
+	h.idempotencyTableName = name
+	return h
+}
+
+// IdempotencyTableName returns name of table used to store processed idempotency keys
+func (h *Hub) IdempotencyTableName() string {
+	if h.idempotencyTableName == "" {
+		return DefaultIdempotencyTableName
+	}
+	return h.idempotencyTableName
+}
+
+// WithIdempotencyKey returns hub which Insert, Save, Update and Delete are done once for the key, ie: message id of
+// at least once consumer. The key is recorded on idempotency table in the same transaction as the write when driver
+// support transaction, otherwise before the write and removed when the write fails, so failed write could be retried.
+// Replay of a processed key returns nil without writing. Use a hub per key
+func (h *Hub) WithIdempotencyKey(key string) *Hub {
+	nh := h.scope()
+	nh.idempotencyKey = key
+	return nh
+}
+
+// IdempotencyKeyUsed returns true when write with the key is already processed
+func (h *Hub) IdempotencyKeyUsed(key string) (bool, error) {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return false, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	tableName := h.table(h.IdempotencyTableName())
+	if !conn.HasTable(tableName) {
+		return false, nil
+	}
+	docs, err := fetchDocs(conn, dbflex.From(tableName).Select().Where(dbflex.Eq("_id", key)).Take(1))
+	if err != nil {
+		return false, fmt.Errorf("fail IdempotencyKeyUsed: %w", err)
+	}
+	return len(docs) > 0, nil
+}
+
+// PurgeIdempotencyKeys delete keys processed before given time, keys should be kept longer than messages could be
+// redelivered. It returns number of deleted keys
+func (h *Hub) PurgeIdempotencyKeys(before time.Time) (int, error) {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return 0, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	tableName := h.table(h.IdempotencyTableName())
+	if !conn.HasTable(tableName) {
+		return 0, nil
+	}
+	where := dbflex.Lt("created", before)
+	cur := conn.Cursor(dbflex.From(tableName).Where(where), nil)
+	if err = cur.Error(); err != nil {
+		return 0, fmt.Errorf("fail PurgeIdempotencyKeys: %w", err)
+	}
+	n := cur.Count()
+	cur.Close()
+	if _, err = conn.Execute(dbflex.From(tableName).Delete().Where(where), nil); err != nil {
+		return 0, fmt.Errorf("fail PurgeIdempotencyKeys: %w", err)
+	}
+	return n, nil
+}
+
+// errReplayed rollback transaction of idempotent write which key is already processed
+var errReplayed = errors.New("idempotency key is already processed")
+
+// idempotent run write fn once for idempotency key of the hub, fn is called with copy of the hub without the key.
+// When driver support transaction the key is claimed and fn is run in the same transaction, so the key is only
+// recorded together with the write and a concurrent replay waits for the first attempt. Without transaction the key
+// is claimed before fn and released when fn fails, a crash between the claim and the write leaves the key claimed
+// without the write, hence the message is treated as processed
+func (h *Hub) idempotent(op string, data orm.DataModel, fn func(*Hub, orm.DataModel) error) error {
+	data.SetThis(data)
+	key := h.idempotencyKey
+	if key == "" {
+		return fmt.Errorf("fail %s: idempotency key is mandatory", op)
+	}
+	if err := h.ensureIdempotencyTable(); err != nil {
+		return fmt.Errorf("fail %s: idempotency key %s. %w", op, key, err)
+	}
+	transactional := h.IsTx() || h.Capability(CapTransaction)
+
+	err := h.inTx(func(ht *Hub) error {
+		nh := ht.scope()
+		nh.idempotencyKey = ""
+
+		claimed, err := nh.claimIdempotencyKey(key, op, data.TableName())
+		if err != nil {
+			return fmt.Errorf("fail %s: idempotency key %s. %w", op, key, err)
+		}
+		if !claimed {
+			return errReplayed
+		}
+
+		if err = fn(nh, data); err != nil {
+			if !transactional {
+				if rerr := nh.releaseIdempotencyKey(key); rerr != nil {
+					h.Logger().Warn("unable to release idempotency key", "key", key, "error", rerr.Error())
+				}
+			}
+			return err
+		}
+		return nil
+	})
+	if errors.Is(err, errReplayed) {
+		h.Logger().Debug("idempotent write is replayed", "key", key, "table", data.TableName(), "op", op)
+		return nil
+	}
+	return err
+}
+
+// ensureIdempotencyTable create idempotency table, using separate connection when the hub is in transaction as DDL
+// would commit the transaction on some databases
+func (h *Hub) ensureIdempotencyTable() error {
+	tableName := h.table(h.IdempotencyTableName())
+	var (
+		conn dbflex.IConnection
+		err  error
+	)
+	if h.IsTx() {
+		if conn, err = h.connect(); err != nil {
+			return &ConnectionError{Err: err}
+		}
+		defer conn.Close()
+	} else {
+		idx, c, err := h.getConn()
+		if err != nil {
+			return &ConnectionError{Err: err}
+		}
+		defer h.closeConn(idx, c)
+		conn = c
+	}
+	if conn.HasTable(tableName) {
+		return nil
+	}
+	if err = conn.EnsureTable(tableName, []string{"_id"}, new(IdempotencyRecord)); err != nil {
+		return fmt.Errorf("unable to prepare %s. %w", tableName, err)
+	}
+	return nil
+}
+
+// claimIdempotencyKey record the key, returns false when the key is already recorded. The key is read first, so
+// transaction is not aborted by duplicate key of a processed key
+func (h *Hub) claimIdempotencyKey(key, op, table string) (bool, error) {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return false, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	tableName := h.table(h.IdempotencyTableName())
+	docs, err := fetchDocs(conn, dbflex.From(tableName).Select().Where(dbflex.Eq("_id", key)).Take(1))
+	if err != nil {
+		return false, err
+	}
+	if len(docs) > 0 {
+		return false, nil
+	}
+
+	rec := &IdempotencyRecord{ID: key, Table: table, Op: op, Created: time.Now()}
+	_, err = conn.Execute(dbflex.From(tableName).Insert(), toolkit.M{}.Set("data", rec))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(duplicateKey(err), ErrDuplicateKey) {
+		// claimed by concurrent attempt which is committed
+		return false, nil
+	}
+	return false, err
+}
+
+func (h *Hub) releaseIdempotencyKey(key string) error {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	_, err = conn.Execute(dbflex.From(h.table(h.IdempotencyTableName())).Delete().Where(dbflex.Eq("_id", key)), nil)
+	return err
+}
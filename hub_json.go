@@ -0,0 +1,162 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// EmbedTag is struct tag marking nested struct, map or slice field to be stored as a whole, ie:
+//
+//	Meta ProductMeta `embed:"json"`
+//
+// On mongo the field is stored as subdocument, on SQL drivers it is marshaled into JSON text so it could be stored on
+// JSON/JSONB column. Models having embedded field are encoded and decoded by the hub. Use JSONPathEq to filter by
+// value inside the field
+const EmbedTag = "embed"
+
+// opJSONPathEq is filter operator of JSONPathEq, it is translated into native filter before the query is run
+const opJSONPathEq dbflex.FilterOp = "$jsonpatheq"
+
+// JSONPathEq returns filter of value inside embedded field equals to v. Path is field name followed by path inside it
+// separated by dot, ie: JSONPathEq("meta.color", "red"). It is translated into dotted field on mongo, JSON_EXTRACT on
+// mysql and sqlite, and #>> on postgres where value is compared as text
+func JSONPathEq(path string, v interface{}) *dbflex.Filter {
+	return &dbflex.Filter{Field: path, Op: opJSONPathEq, Value: v}
+}
+
+// isEmbedField returns true if field is marked by EmbedTag
+func isEmbedField(f *FieldMeta) bool {
+	return f.Tag.Get(EmbedTag) != ""
+}
+
+// embedValue returns value of embedded field to be written by the driver of conn
+func embedValue(conn dbflex.IConnection, f *FieldMeta, v interface{}) (interface{}, error) {
+	if !isEmbedField(f) || !isSQLDriver(conn) || v == nil {
+		return v, nil
+	}
+	rv := reflect.ValueOf(v)
+	if (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Map || rv.Kind() == reflect.Slice) && rv.IsNil() {
+		return nil, nil
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("fail marshal field %s: %w", f.Name, err)
+	}
+	return string(bs), nil
+}
+
+// isJSONTarget returns true if field of type t could be unmarshaled from JSON text
+func isJSONTarget(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Struct:
+		return t != timeType && t != decimalType
+	case reflect.Map:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// nativeParm returns copy of parm which filter having operators of the hub is translated into filter the driver of
+// conn understands, parm is returned as is when there is nothing to translate
+func nativeParm(conn dbflex.IConnection, parm *dbflex.QueryParam) (*dbflex.QueryParam, error) {
+	if parm == nil || parm.Where == nil || !hasHubOp(parm.Where) {
+		return parm, nil
+	}
+	where, err := nativeFilter(conn, parm.Where)
+	if err != nil {
+		return nil, err
+	}
+	p := *parm
+	p.Where = where
+	return &p, nil
+}
+
+func hasHubOp(f *dbflex.Filter) bool {
+	if f == nil {
+		return false
+	}
+	if hubOps[f.Op] {
+		return true
+	}
+	for _, item := range f.Items {
+		if hasHubOp(item) {
+			return true
+		}
+	}
+	return false
+}
+
+var hubOps = map[dbflex.FilterOp]bool{
+	opJSONPathEq: true,
+}
+
+// nativeFilter translate operators of the hub into filter of the driver
+func nativeFilter(conn dbflex.IConnection, f *dbflex.Filter) (*dbflex.Filter, error) {
+	if f == nil {
+		return nil, nil
+	}
+	if len(f.Items) > 0 {
+		items := make([]*dbflex.Filter, 0, len(f.Items))
+		for _, item := range f.Items {
+			nf, err := nativeFilter(conn, item)
+			if err != nil {
+				return nil, err
+			}
+			if nf != nil {
+				items = append(items, nf)
+			}
+		}
+		nf := *f
+		nf.Items = items
+		return &nf, nil
+	}
+
+	switch f.Op {
+	case opJSONPathEq:
+		if !isSQLDriver(conn) {
+			return dbflex.Eq(f.Field, f.Value), nil
+		}
+		expr, v, err := sqlJSONPath(driverName(conn), f.Field, f.Value)
+		if err != nil {
+			return nil, err
+		}
+		return dbflex.Eq(expr, v), nil
+
+	case opArrayHas, opArrayAll, opArraySize:
+		return nativeArrayFilter(conn, f)
+	}
+	return f, nil
+}
+
+// sqlJSONPath returns sql expression extracting value of dotted path from JSON column, and value to be compared with it
+func sqlJSONPath(driver, path string, v interface{}) (string, interface{}, error) {
+	parts := strings.Split(path, ".")
+	if len(parts) < 2 {
+		return "", nil, fmt.Errorf("json path %s need field and path inside it", path)
+	}
+	for _, p := range parts {
+		if p == "" || strings.ContainsAny(p, "'\"{},$ ") {
+			return "", nil, fmt.Errorf("invalid json path %s", path)
+		}
+	}
+
+	col, inner := parts[0], parts[1:]
+	switch {
+	case strings.Contains(driver, "pg") || strings.Contains(driver, "postgres"):
+		if v != nil {
+			v = fmt.Sprintf("%v", indirectValue(v))
+		}
+		return col + " #>> '{" + strings.Join(inner, ",") + "}'", v, nil
+	case strings.Contains(driver, "mysql"):
+		return "JSON_UNQUOTE(JSON_EXTRACT(" + col + ", '$." + strings.Join(inner, ".") + "'))", v, nil
+	case strings.Contains(driver, "sqlite"):
+		return "json_extract(" + col + ", '$." + strings.Join(inner, ".") + "')", v, nil
+	}
+	return "", nil, fmt.Errorf("json path on %s. %w", driver, ErrNotSupported)
+}
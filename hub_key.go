@@ -0,0 +1,136 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// KeyFilter returns filter matching the record of the model by its key fields, composite key is combined using and
+func (h *Hub) KeyFilter(model orm.DataModel) (*dbflex.Filter, error) {
+	model.SetThis(model)
+	var where *dbflex.Filter
+	err := h.Native(func(conn dbflex.IConnection) error {
+		var e error
+		where, e = keyFilterOf(conn, model)
+		return e
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fail KeyFilter: %w", err)
+	}
+	return where, nil
+}
+
+// DeleteByID delete record of the model based on its ID, ids are the same with GetByID
+func (h *Hub) DeleteByID(data orm.DataModel, ids ...interface{}) error {
+	data.SetThis(data)
+	if err := setKeys(data, ids); err != nil {
+		return fmt.Errorf("fail DeleteByID: %w", err)
+	}
+	return h.Delete(data)
+}
+
+// keyFilterOf build filter of key fields of data
+func keyFilterOf(conn dbflex.IConnection, data orm.DataModel) (*dbflex.Filter, error) {
+	names, values := data.GetID(conn)
+	if len(names) == 0 {
+		return nil, errors.New("model has no key field")
+	}
+	doc := toolkit.M{}
+	for i, n := range names {
+		doc[n] = values[i]
+	}
+	return keyFilter(doc, names), nil
+}
+
+// setKeys set key fields of data. ids are values of key fields in order of the key tags, or a single map of key field
+// name (struct field name or database name) and its value, ie: toolkit.M{"OrderID": 1, "LineNo": 2}
+func setKeys(data orm.DataModel, ids []interface{}) error {
+	if len(ids) == 0 {
+		return errors.New("key value is mandatory")
+	}
+
+	_, mapped := data.(tagMapped)
+	meta := MetaOf(data)
+	var keys []*FieldMeta
+	if meta != nil && !mapped {
+		keys = meta.KeyFields("key")
+	}
+
+	named, isNamed := namedKeys(ids)
+	if !isNamed {
+		if len(keys) <= 1 {
+			data.SetID(ids...)
+			return nil
+		}
+		if len(ids) != len(keys) {
+			return fmt.Errorf("model has %d key fields, got %d values", len(keys), len(ids))
+		}
+		rv := reflect.Indirect(reflect.ValueOf(data))
+		for i, f := range keys {
+			if err := assignKey(f.Value(rv), ids[i]); err != nil {
+				return fmt.Errorf("key %s. %w", f.Name, err)
+			}
+		}
+		return nil
+	}
+
+	if len(keys) == 0 {
+		names, values := data.GetID(nil)
+		for i, n := range names {
+			if v, ok := named[n]; ok {
+				values[i] = v
+			}
+		}
+		data.SetID(values...)
+		return nil
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	for name, v := range named {
+		f := meta.Field(name)
+		if f == nil || !f.IsKey("key") {
+			return fmt.Errorf("%s is not a key field", name)
+		}
+		if err := assignKey(f.Value(rv), v); err != nil {
+			return fmt.Errorf("key %s. %w", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func namedKeys(ids []interface{}) (map[string]interface{}, bool) {
+	if len(ids) != 1 {
+		return nil, false
+	}
+	switch m := ids[0].(type) {
+	case toolkit.M:
+		return m, true
+	case map[string]interface{}:
+		return m, true
+	}
+	return nil, false
+}
+
+func assignKey(fv reflect.Value, v interface{}) error {
+	vv := reflect.ValueOf(v)
+	switch {
+	case !vv.IsValid():
+		fv.Set(reflect.Zero(fv.Type()))
+	case vv.Type().AssignableTo(fv.Type()):
+		fv.Set(vv)
+	case vv.Kind() == reflect.String && fv.Kind() != reflect.String:
+		return setFromString(fv, vv.String())
+	case vv.Type().ConvertibleTo(fv.Type()) && fv.Kind() != reflect.String:
+		fv.Set(vv.Convert(fv.Type()))
+	case fv.Kind() == reflect.String:
+		fv.SetString(fmt.Sprintf("%v", v))
+	default:
+		return fmt.Errorf("%s can't be assigned to %s", vv.Type().String(), fv.Type().String())
+	}
+	return nil
+}
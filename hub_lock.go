@@ -0,0 +1,188 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// DefaultLockTableName is name of table used to keep distributed lock records when no name is set via SetLockTableName
+const DefaultLockTableName = "DatahubLocks"
+
+// ErrLockHeld returned when a lock is currently owned by other process and has not expired yet
+var ErrLockHeld = errors.New("lock is held by other owner")
+
+// LockRecord is the record persisted on lock table for each named lock
+type LockRecord struct {
+	ID     string    `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	Token  int64     `bson:"token" json:"token" sqlname:"token"`
+	Owner  string    `bson:"owner" json:"owner" sqlname:"owner"`
+	Expiry time.Time `bson:"expiry" json:"expiry" sqlname:"expiry"`
+}
+
+// Lock is an acquired distributed lock. Token is a fencing token which is guaranteed to be higher than
+// any token previously issued for the same lock name, it can be passed to other resources to reject stale writers
+type Lock struct {
+	Name   string
+	Token  int64
+	Owner  string
+	Expiry time.Time
+
+	h *Hub
+}
+
+// SetLockTableName set name of table used to store distributed locks
+func (h *Hub) SetLockTableName(name string) *Hub {
+	h.lockTableName = name
+	return h
+}
+
+// LockTableName returns name of table used to store distributed locks
+func (h *Hub) LockTableName() string {
+	if h.lockTableName == "" {
+		return DefaultLockTableName
+	}
+	return h.lockTableName
+}
+
+// Lock acquire a named lock which will be valid for given ttl. It returns Unlock function that need to be called
+// to release the lock. ErrLockHeld will be returned if lock is currently owned by other process
+func (h *Hub) Lock(name string, ttl time.Duration) (func(), error) {
+	l, e := h.AcquireLock(name, ttl)
+	if e != nil {
+		return nil, e
+	}
+	return func() {
+		if e := l.Release(); e != nil {
+			h.Logger().Warn("unable to release lock", "lock", name, "error", e.Error())
+		}
+	}, nil
+}
+
+// AcquireLock acquire a named lock and return the lock with its fencing token
+func (h *Hub) AcquireLock(name string, ttl time.Duration) (*Lock, error) {
+	if name == "" {
+		return nil, errors.New("fail Lock: name is mandatory")
+	}
+	if ttl <= 0 {
+		return nil, errors.New("fail Lock: ttl should be greater than 0")
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	tableName := h.table(h.LockTableName())
+	if !conn.HasTable(tableName) {
+		if err = conn.EnsureTable(tableName, []string{"_id"}, new(LockRecord)); err != nil {
+			return nil, fmt.Errorf("fail Lock: unable to prepare lock table. %w", err)
+		}
+	}
+
+	owner := toolkit.RandomString(32)
+	now := time.Now()
+	rec := &LockRecord{ID: name, Token: 1, Owner: owner, Expiry: now.Add(ttl)}
+
+	current, err := getLockRecord(conn, tableName, name)
+	if err != nil {
+		return nil, fmt.Errorf("fail Lock: %w", err)
+	}
+
+	if current == nil {
+		// insert will fail if other process is creating the same lock at the same time, as name is the key
+		if _, err = conn.Execute(dbflex.From(tableName).Insert(), toolkit.M{}.Set("data", rec)); err != nil {
+			if errors.Is(duplicateKey(err), ErrDuplicateKey) {
+				return nil, ErrLockHeld
+			}
+			return nil, fmt.Errorf("fail Lock: %w", err)
+		}
+	} else {
+		if current.Expiry.After(now) {
+			return nil, ErrLockHeld
+		}
+
+		// only update when token is still the same as the one we read, so only one process can take over expired lock
+		rec.Token = current.Token + 1
+		cmd := dbflex.From(tableName).Update("token", "owner", "expiry").
+			Where(dbflex.And(dbflex.Eq("_id", name), dbflex.Eq("token", current.Token)))
+		if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", rec)); err != nil {
+			return nil, fmt.Errorf("fail Lock: %w", err)
+		}
+	}
+
+	saved, err := getLockRecord(conn, tableName, name)
+	if err != nil {
+		return nil, fmt.Errorf("fail Lock: %w", err)
+	}
+	if saved == nil || saved.Owner != owner || saved.Token != rec.Token {
+		return nil, ErrLockHeld
+	}
+
+	return &Lock{Name: name, Token: rec.Token, Owner: owner, Expiry: rec.Expiry, h: h}, nil
+}
+
+// Release release the lock. The record is kept with expired time so the fencing token keeps increasing
+func (l *Lock) Release() error {
+	idx, conn, err := l.h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer l.h.closeConn(idx, conn)
+
+	rec := &LockRecord{ID: l.Name, Token: l.Token, Owner: "", Expiry: time.Time{}}
+	cmd := dbflex.From(l.h.table(l.h.LockTableName())).Update("owner", "expiry").
+		Where(dbflex.And(dbflex.Eq("_id", l.Name), dbflex.Eq("token", l.Token), dbflex.Eq("owner", l.Owner)))
+	if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", rec)); err != nil {
+		return fmt.Errorf("fail Unlock: %w", err)
+	}
+	return nil
+}
+
+// Extend extend expiry of the lock for given ttl, it will fail if lock has been taken over by other owner
+func (l *Lock) Extend(ttl time.Duration) error {
+	idx, conn, err := l.h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer l.h.closeConn(idx, conn)
+
+	tableName := l.h.table(l.h.LockTableName())
+	rec := &LockRecord{ID: l.Name, Token: l.Token, Owner: l.Owner, Expiry: time.Now().Add(ttl)}
+	cmd := dbflex.From(tableName).Update("expiry").
+		Where(dbflex.And(dbflex.Eq("_id", l.Name), dbflex.Eq("token", l.Token), dbflex.Eq("owner", l.Owner)))
+	if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", rec)); err != nil {
+		return fmt.Errorf("fail Extend: %w", err)
+	}
+
+	saved, err := getLockRecord(conn, tableName, l.Name)
+	if err != nil {
+		return fmt.Errorf("fail Extend: %w", err)
+	}
+	if saved == nil || saved.Owner != l.Owner || saved.Token != l.Token {
+		return ErrLockHeld
+	}
+	l.Expiry = rec.Expiry
+	return nil
+}
+
+func getLockRecord(conn dbflex.IConnection, tableName, name string) (*LockRecord, error) {
+	cur := conn.Cursor(dbflex.From(tableName).Select().Where(dbflex.Eq("_id", name)), nil)
+	if err := cur.Error(); err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+
+	recs := []*LockRecord{}
+	if err := cur.Fetchs(&recs, 1).Error(); err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, nil
+	}
+	return recs[0], nil
+}
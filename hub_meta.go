@@ -0,0 +1,66 @@
+package datahub
+
+import (
+	"sort"
+
+	"github.com/eaciit/toolkit"
+)
+
+// WithMeta returns hub carrying metadata, ie: hub.WithMeta(toolkit.M{"req_id": id}). Metadata is merged with metadata
+// of current hub, written as fields of every log of the hub and attached to records and events emitted by the hub,
+// so database activity can be traced back to a request
+func (h *Hub) WithMeta(meta toolkit.M) *Hub {
+	nh := h.scope()
+	nh.meta = toolkit.M{}
+	for k, v := range h.meta {
+		nh.meta[k] = v
+	}
+	for k, v := range meta {
+		nh.meta[k] = v
+	}
+	return nh
+}
+
+// Meta returns metadata of the hub, it should be treated as read only
+func (h *Hub) Meta() toolkit.M {
+	return h.meta
+}
+
+// metaFields returns metadata as list of key and value pairs sorted by key
+func (h *Hub) metaFields() []interface{} {
+	if len(h.meta) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(h.meta))
+	for k := range h.meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kv := make([]interface{}, 0, len(keys)*2)
+	for _, k := range keys {
+		kv = append(kv, k, h.meta[k])
+	}
+	return kv
+}
+
+// metaLogger add metadata of the hub to every log
+type metaLogger struct {
+	Logger
+	fields []interface{}
+}
+
+func (l *metaLogger) Debug(msg string, kv ...interface{}) {
+	l.Logger.Debug(msg, append(kv, l.fields...)...)
+}
+
+func (l *metaLogger) Info(msg string, kv ...interface{}) {
+	l.Logger.Info(msg, append(kv, l.fields...)...)
+}
+
+func (l *metaLogger) Warn(msg string, kv ...interface{}) {
+	l.Logger.Warn(msg, append(kv, l.fields...)...)
+}
+
+func (l *metaLogger) Error(msg string, kv ...interface{}) {
+	l.Logger.Error(msg, append(kv, l.fields...)...)
+}
@@ -0,0 +1,67 @@
+package datahub
+
+import (
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+type modelDefaults struct {
+	sort   []string
+	fields []string
+}
+
+// ModelDefault is option of SetModelDefaults
+type ModelDefault func(md *modelDefaults)
+
+// DefaultSort set sort applied when QueryParam has no sort, prefix field with - for descending sort
+func DefaultSort(fields ...string) ModelDefault {
+	return func(md *modelDefaults) {
+		md.sort = fields
+	}
+}
+
+// DefaultSelect set fields to be selected when QueryParam has no select
+func DefaultSelect(fields ...string) ModelDefault {
+	return func(md *modelDefaults) {
+		md.fields = fields
+	}
+}
+
+// SetModelDefaults register default sort and select of a model, they are applied by Gets, GetsInto, GetByParm and
+// PopulateByParm of the model table when QueryParam omit them. Calling it without options remove the defaults
+func (h *Hub) SetModelDefaults(model orm.DataModel, opts ...ModelDefault) *Hub {
+	name := strings.ToLower(model.TableName())
+	if len(opts) == 0 {
+		delete(h.modelDefaults, name)
+		return h
+	}
+
+	md := new(modelDefaults)
+	for _, opt := range opts {
+		opt(md)
+	}
+	if h.modelDefaults == nil {
+		h.modelDefaults = map[string]*modelDefaults{}
+	}
+	h.modelDefaults[name] = md
+	return h
+}
+
+// applyModelDefaults returns copy of parm with defaults of the table being applied
+func (h *Hub) applyModelDefaults(tableName string, parm *dbflex.QueryParam) *dbflex.QueryParam {
+	md, ok := h.modelDefaults[strings.ToLower(tableName)]
+	if !ok {
+		return parm
+	}
+
+	p := *parm
+	if len(p.Sort) == 0 && len(md.sort) > 0 {
+		p.Sort = md.sort
+	}
+	if len(p.Select) == 0 && len(md.fields) > 0 && len(p.Aggregates) == 0 {
+		p.Select = md.fields
+	}
+	return &p
+}
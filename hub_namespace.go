@@ -0,0 +1,80 @@
+package datahub
+
+import (
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// WithTablePrefix returns hub which prefix every table name it builds command for, including tables used internally
+// by the hub (locks, sequences, outbox and others), ie: hub.WithTablePrefix("dev_") read and write orders as dev_orders.
+// So multiple environments can share one database without touching model code. Raw commands and SQL given by the
+// caller are not rewritten
+func (h *Hub) WithTablePrefix(prefix string) *Hub {
+	nh := h.scope()
+	nh.tablePrefix = prefix
+	return nh
+}
+
+// WithTableSuffix returns hub which append suffix to every table name it builds command for, see WithTablePrefix
+func (h *Hub) WithTableSuffix(suffix string) *Hub {
+	nh := h.scope()
+	nh.tableSuffix = suffix
+	return nh
+}
+
+// IntoTable returns hub which direct model operations to given table in place of table of the model, ie:
+// hub.IntoTable("orders_2023").Save(order) for archive or per tenant tables. Fields of the model are mapped the same
+// way, prefix and suffix of the hub are still applied. Cache is bypassed and events keep table name of the model
+func (h *Hub) IntoTable(name string) *Hub {
+	nh := h.scope()
+	nh.intoTable = name
+	return nh
+}
+
+// PhysicalTableName returns name of the table used on database for given table name, after prefix and suffix of the
+// hub is applied
+func (h *Hub) PhysicalTableName(name string) string {
+	return h.table(name)
+}
+
+func (h *Hub) table(name string) string {
+	if name == "" {
+		return name
+	}
+	return h.tablePrefix + name + h.tableSuffix
+}
+
+// tableRef returns table reference used in FROM and JOIN of SQL, physical table is aliased with its name so
+// conditions and selected fields referring the table name keep working. Reference with alias, ie: "customers c",
+// only has its table name replaced
+func (h *Hub) tableRef(name string) string {
+	if parts := strings.SplitN(name, " ", 2); len(parts) == 2 {
+		return h.table(parts[0]) + " " + parts[1]
+	}
+	if table := h.table(name); table != name {
+		return table + " " + name
+	}
+	return name
+}
+
+// tableOf returns physical table name of the model
+func (h *Hub) tableOf(data orm.DataModel) string {
+	if h.intoTable != "" {
+		return h.table(h.intoTable)
+	}
+	return h.table(data.TableName())
+}
+
+// mapped returns model which document is encoded and decoded by the hub when its fields need to be converted or
+// its physical table name is not its table name, otherwise data is returned as is
+func (h *Hub) mapped(conn dbflex.IConnection, data orm.DataModel) orm.DataModel {
+	table := h.tableOf(data)
+	if _, ok := data.(tagMapped); ok || !h.convertsModel(data) {
+		if table == data.TableName() {
+			return data
+		}
+	}
+	return &hubMapped{DataModel: data, h: h, conn: conn, table: table}
+}
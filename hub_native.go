@@ -0,0 +1,111 @@
+package datahub
+
+import (
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// Capability is feature that might or might not be supported by driver of the hub
+type Capability string
+
+const (
+	// CapTransaction driver support BeginTx, Commit and Rollback
+	CapTransaction Capability = "transaction"
+	// CapSQL driver is backed by SQL database and accept SQL command
+	CapSQL Capability = "sql"
+	// CapJoin driver support join on TableQuery
+	CapJoin Capability = "join"
+	// CapRowLock driver support select for update
+	CapRowLock Capability = "rowlock"
+	// CapPipeline driver support aggregation pipeline
+	CapPipeline Capability = "pipeline"
+	// CapReturning driver support RETURNING clause on insert, update and delete
+	CapReturning Capability = "returning"
+)
+
+// Capability check if driver of the hub support given capability. It returns false if connection can't be established
+func (h *Hub) Capability(c Capability) bool {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return false
+	}
+	defer h.closeConn(idx, conn)
+	return connCapability(conn, c)
+}
+
+// Native run fn with a connection of the hub, so driver specific feature can be used. Connection is returned to the pool
+// (or closed when hub is not using pool) after fn is completed, hence fn should not retain the connection
+func (h *Hub) Native(fn func(conn dbflex.IConnection) error) error {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+	if dc, ok := conn.(*deadlineConn); ok {
+		return fn(dc.IConnection)
+	}
+	return fn(conn)
+}
+
+func connCapability(conn dbflex.IConnection, c Capability) bool {
+	sqlDriver := isSQLDriver(conn)
+	switch c {
+	case CapTransaction:
+		return conn.SupportTx()
+
+	case CapSQL, CapJoin, CapRowLock:
+		return sqlDriver
+
+	case CapPipeline:
+		return !sqlDriver
+
+	case CapReturning:
+		name := driverName(conn)
+		return strings.Contains(name, "pg") || strings.Contains(name, "postgres") || strings.Contains(name, "sqlite")
+	}
+	return false
+}
+
+// NativeClientTypes are types of driver client looked up by WithNative, in order of preference
+var NativeClientTypes = []string{"*mongo.Client", "*sql.DB", "*mongo.Database"}
+
+// WithNative run fn with underlying driver client of a pooled connection, ie: *mongo.Client or *sql.DB.
+// Connection is guaranteed to be returned to the pool after fn is completed, so fn should not retain the client.
+// When no known client is found, fn receives the dbflex connection itself
+func (h *Hub) WithNative(fn func(native interface{}) error) error {
+	return h.Native(func(conn dbflex.IConnection) error {
+		for _, name := range NativeClientTypes {
+			if v := findNative(reflect.ValueOf(conn), name, 0); v.IsValid() {
+				return fn(v.Interface())
+			}
+		}
+		return fn(conn)
+	})
+}
+
+// findNative look for value of given type held by a field (including unexported and embedded) of v
+func findNative(v reflect.Value, typeName string, depth int) reflect.Value {
+	if !v.IsValid() || depth > 4 {
+		return reflect.Value{}
+	}
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		if v.Type().String() == typeName {
+			return reflect.NewAt(v.Type().Elem(), v.UnsafePointer())
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if found := findNative(v.Field(i), typeName, depth+1); found.IsValid() {
+			return found
+		}
+	}
+	return reflect.Value{}
+}
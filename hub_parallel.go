@@ -0,0 +1,72 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// GetsParallel run Gets for each parm concurrently, each on its own connection, and merge the results into dest.
+// Results are merged following order of parms, unless sortFields is given, then merged result is re-sorted
+// (prefix field with - for descending sort). On transactional or session hub the queries are run sequentially
+func (h *Hub) GetsParallel(data orm.DataModel, parms []*dbflex.QueryParam, dest interface{}, sortFields ...string) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("fail GetsParallel: dest should be pointer to slice")
+	}
+	sliceType := rv.Elem().Type()
+
+	results := make([]reflect.Value, len(parms))
+	errs := make([]error, len(parms))
+	run := func(i int) {
+		res := reflect.New(sliceType)
+		errs[i] = h.Gets(copyModel(data), parms[i], res.Interface())
+		results[i] = res.Elem()
+	}
+
+	if h.IsTx() || h.IsSession() {
+		for i := range parms {
+			run(i)
+		}
+	} else {
+		wg := new(sync.WaitGroup)
+		for i := range parms {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	merged := reflect.MakeSlice(sliceType, 0, 0)
+	for i, res := range results {
+		if errs[i] != nil {
+			return fmt.Errorf("fail GetsParallel: query %d. %w", i, errs[i])
+		}
+		merged = reflect.AppendSlice(merged, res)
+	}
+	sortRecords(merged, sortFields)
+	rv.Elem().Set(merged)
+	return nil
+}
+
+// copyModel returns copy of the model, so concurrent queries do not share it as Gets set the model as its own this
+func copyModel(data orm.DataModel) orm.DataModel {
+	rv := reflect.ValueOf(data)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return data
+	}
+	cp := reflect.New(rv.Elem().Type())
+	cp.Elem().Set(rv.Elem())
+	m, ok := cp.Interface().(orm.DataModel)
+	if !ok {
+		return data
+	}
+	return m
+}
@@ -0,0 +1,245 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// PartitionInterval is time span of each partition of a partitioned table
+type PartitionInterval string
+
+// Partition intervals, partition table name is table name of the model followed by the period, ie: events_2024_06
+const (
+	PartitionDaily   PartitionInterval = "daily"
+	PartitionMonthly PartitionInterval = "monthly"
+	PartitionYearly  PartitionInterval = "yearly"
+)
+
+type partitioning struct {
+	timeField string
+	interval  PartitionInterval
+}
+
+// SetPartitioning split records of a model into tables per period based on value of timeField, so a single logical
+// model can be backed by tables like events_2024_05, events_2024_06. Records are written using SavePartitioned and
+// InsertPartitioned, and read using GetsRange. Partition table is created on first write
+func (h *Hub) SetPartitioning(model orm.DataModel, timeField string, interval PartitionInterval) *Hub {
+	if h.partitions == nil {
+		h.partitions = map[string]*partitioning{}
+	}
+	h.partitions[strings.ToLower(model.TableName())] = &partitioning{timeField: timeField, interval: interval}
+	return h
+}
+
+// PartitionName returns name of partition table of base table for given time
+func PartitionName(base string, t time.Time, interval PartitionInterval) string {
+	switch interval {
+	case PartitionDaily:
+		return base + "_" + t.Format("2006_01_02")
+	case PartitionYearly:
+		return base + "_" + t.Format("2006")
+	}
+	return base + "_" + t.Format("2006_01")
+}
+
+// PartitionNames returns names of partition tables of base table covering time range from - to
+func PartitionNames(base string, from, to time.Time, interval PartitionInterval) []string {
+	names := []string{}
+	t := partitionStart(from, interval)
+	for !t.After(to) {
+		names = append(names, PartitionName(base, t, interval))
+		switch interval {
+		case PartitionDaily:
+			t = t.AddDate(0, 0, 1)
+		case PartitionYearly:
+			t = t.AddDate(1, 0, 0)
+		default:
+			t = t.AddDate(0, 1, 0)
+		}
+	}
+	return names
+}
+
+func partitionStart(t time.Time, interval PartitionInterval) time.Time {
+	switch interval {
+	case PartitionDaily:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case PartitionYearly:
+		return time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func (h *Hub) partitioningOf(data orm.DataModel) (*partitioning, error) {
+	p, ok := h.partitions[strings.ToLower(data.TableName())]
+	if !ok {
+		return nil, fmt.Errorf("table %s is not partitioned", data.TableName())
+	}
+	return p, nil
+}
+
+// PartitionOf returns name of partition table of the data based on its time field
+func (h *Hub) PartitionOf(data orm.DataModel) (string, error) {
+	p, err := h.partitioningOf(data)
+	if err != nil {
+		return "", err
+	}
+	var t time.Time
+	switch v := indirectValue(recordValue(reflect.ValueOf(data), p.timeField)).(type) {
+	case time.Time:
+		t = v
+	default:
+		return "", fmt.Errorf("field %s should be a time", p.timeField)
+	}
+	if t.IsZero() {
+		return "", fmt.Errorf("field %s is empty", p.timeField)
+	}
+	return PartitionName(data.TableName(), t, p.interval), nil
+}
+
+// SavePartitioned save data into its partition table
+func (h *Hub) SavePartitioned(data orm.DataModel) error {
+	return h.writePartition(data, false)
+}
+
+// InsertPartitioned insert data into its partition table
+func (h *Hub) InsertPartitioned(data orm.DataModel) error {
+	return h.writePartition(data, true)
+}
+
+func (h *Hub) writePartition(data orm.DataModel, insert bool) error {
+	data.SetThis(data)
+	tableName, err := h.PartitionOf(data)
+	if err != nil {
+		return fmt.Errorf("fail write partition: %w", err)
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	if err = h.applyIDGenerator(conn, data); err != nil {
+		return fmt.Errorf("unable to generate id. %w", err)
+	}
+	if insert {
+		if err = h.applyDefaults(data); err != nil {
+			return fmt.Errorf("unable to apply default value. %w", err)
+		}
+	}
+	if err = h.validate(data); err != nil {
+		return err
+	}
+
+	if err = h.ensurePartition(conn, h.table(tableName), data); err != nil {
+		return fmt.Errorf("fail write partition: unable to create partition %s. %w", tableName, err)
+	}
+
+	cmd := dbflex.From(h.table(tableName)).Save()
+	if insert {
+		cmd = dbflex.From(h.table(tableName)).Insert()
+	}
+	if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", data)); err != nil {
+		return fmt.Errorf("fail write partition: %w", duplicateKey(err))
+	}
+	return nil
+}
+
+func (h *Hub) ensurePartition(conn dbflex.IConnection, tableName string, data orm.DataModel) error {
+	if conn.HasTable(tableName) {
+		return nil
+	}
+	keyTag := conn.KeyNameTag()
+	if keyTag == "" {
+		keyTag = "key"
+	}
+	nameTag := conn.FieldNameTag()
+	keys := []string{}
+	for _, f := range MetaOf(data).KeyFields(keyTag) {
+		keys = append(keys, f.DbName(nameTag))
+	}
+	return conn.EnsureTable(tableName, keys, data)
+}
+
+// GetsRange returns records of partitioned model which time field is within from (inclusive) and to (exclusive).
+// Partitions covering the range are queried concurrently and results are merged and sorted by sort of the parm,
+// partitions that are not yet created are skipped
+func (h *Hub) GetsRange(data orm.DataModel, from, to time.Time, parm *dbflex.QueryParam, dest interface{}) error {
+	data.SetThis(data)
+	p, err := h.partitioningOf(data)
+	if err != nil {
+		return fmt.Errorf("fail GetsRange: %w", err)
+	}
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("fail GetsRange: dest should be pointer to slice")
+	}
+	sliceType := rv.Elem().Type()
+	if parm, err = h.guardQuery("gets", data.TableName(), parm); err != nil {
+		return fmt.Errorf("fail GetsRange: %w", err)
+	}
+
+	q := *parm
+	q.Where = combineFilter(dbflex.Gte(p.timeField, from), dbflex.Lt(p.timeField, to), parm.Where)
+	q.Skip = 0
+	if parm.Take > 0 {
+		q.Take = parm.Skip + parm.Take
+	}
+
+	tables := []string{}
+	err = h.Native(func(conn dbflex.IConnection) error {
+		for _, name := range PartitionNames(data.TableName(), from, to, p.interval) {
+			if conn.HasTable(h.table(name)) {
+				tables = append(tables, name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fail GetsRange: %w", err)
+	}
+
+	// guards are applied to the whole range above
+	ih := h.internal()
+	results := make([]reflect.Value, len(tables))
+	errs := make([]error, len(tables))
+	wg := new(sync.WaitGroup)
+	for i, name := range tables {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			res := reflect.New(sliceType)
+			errs[i] = ih.PopulateByParm(name, &q, res.Interface())
+			results[i] = res.Elem()
+		}(i, name)
+	}
+	wg.Wait()
+
+	merged := reflect.MakeSlice(sliceType, 0, 0)
+	for i, res := range results {
+		if errs[i] != nil {
+			return fmt.Errorf("fail GetsRange: partition %s. %w", tables[i], errs[i])
+		}
+		merged = reflect.AppendSlice(merged, res)
+	}
+	sortRecords(merged, parm.Sort)
+
+	start, end := parm.Skip, merged.Len()
+	if start > end {
+		start = end
+	}
+	if parm.Take > 0 && start+parm.Take < end {
+		end = start + parm.Take
+	}
+	rv.Elem().Set(merged.Slice(start, end))
+	return h.afterFetch(dest)
+}
@@ -0,0 +1,176 @@
+package datahub
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// Default settings of the pool
+const (
+	DefaultPoolSize      = 100
+	DefaultPoolTimeout   = 7 * time.Second
+	DefaultPoolAutoClose = 5 * time.Second
+)
+
+// PoolConfig is effective configuration of the pool of a hub
+type PoolConfig struct {
+	UsePool bool
+	Size    int
+	// Timeout is how long an operation waits for free connection
+	Timeout time.Duration
+	// AutoClose is how long idle connection is kept, AutoRelease is how long a connection could be held by an
+	// operation before it is taken back, 0 means never
+	AutoClose   time.Duration
+	AutoRelease time.Duration
+	// Eager is number of connections opened when the hub is created, 0 means connections are opened on demand
+	Eager int
+}
+
+// WithEagerPool make NewHub and Clone open n connections of the pool, see Warm. Failure is logged and does not fail
+// the creation, call Warm when the application should not start without database. By default connections are
+// opened on demand. Eager connections are closed like other connections once they are idle longer than auto close
+// duration, which is DefaultPoolAutoClose unless set, so use it together with WithAutoClose to keep them open, ie:
+//
+//	datahub.NewHub(fn, true, 20, datahub.WithEagerPool(5), datahub.WithAutoClose(30*time.Minute))
+func WithEagerPool(n int) Option {
+	return func(h *Hub) {
+		h.poolEager = n
+	}
+}
+
+// PoolConfig returns effective configuration of the pool
+func (h *Hub) PoolConfig() PoolConfig {
+	cfg := PoolConfig{UsePool: h.usePool, Size: h.poolSize, Timeout: h.poolTimeout, AutoClose: h.poolAutoClose,
+		AutoRelease: h.poolAutoRelease, Eager: h.poolEager}
+	if cfg.Size == 0 {
+		cfg.Size = DefaultPoolSize
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = DefaultPoolTimeout
+	}
+	if cfg.AutoClose == 0 {
+		cfg.AutoClose = DefaultPoolAutoClose
+	}
+	return cfg
+}
+
+// PoolStats is state of the pool of a hub
+type PoolStats struct {
+	PoolConfig
+	// InUse is number of connections of the pool held by operations of the hub
+	InUse int
+}
+
+// PoolStats returns state of the pool, connections held by hubs created using Clone are not counted
+func (h *Hub) PoolStats() PoolStats {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	return PoolStats{PoolConfig: h.PoolConfig(), InUse: len(h.poolItems)}
+}
+
+// hubPool is pool shared by hubs created from the same hub, so it could be replaced by Reconnect.
+// SQLConn is connection held for SQLDB when hub is not using pool
+type hubPool struct {
+	pool    *dbflex.DbPooling
+	lastIdx int
+
+	sqlConn dbflex.IConnection
+	sqlDB   *sql.DB
+}
+
+// pooledItem is connection taken from a pool, pool is kept so pool replaced by Reconnect is closed once all of its
+// connections are released
+type pooledItem struct {
+	*dbflex.PoolItem
+	pool *dbflex.DbPooling
+}
+
+// poolOf returns pool of the hub, the pool is created using PoolConfig when it is not created yet
+func (h *Hub) poolOf() *dbflex.DbPooling {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.pools.pool == nil {
+		h.pools.pool = h.newPool()
+	}
+	return h.pools.pool
+}
+
+func (h *Hub) newPool() *dbflex.DbPooling {
+	cfg := h.PoolConfig()
+	h.poolSize = cfg.Size
+	pool := dbflex.NewDbPooling(cfg.Size, h.connect).SetLog(h.Log())
+	pool.Timeout = cfg.Timeout
+	pool.AutoClose = cfg.AutoClose
+	pool.AutoRelease = cfg.AutoRelease
+	return pool
+}
+
+// closeRetiredPool close pool replaced by Reconnect when none of its connections is in use, the caller should hold
+// the lock
+func (h *Hub) closeRetiredPool(pool *dbflex.DbPooling) {
+	for _, it := range h.poolItems {
+		if it.pool == pool {
+			return
+		}
+	}
+	pool.Close()
+}
+
+// startPool create the pool and open eager connections, it is called once settings of new hub are applied
+func (h *Hub) startPool() {
+	if !h.usePool {
+		return
+	}
+	h.poolOf()
+	if h.poolEager > 0 {
+		if err := h.Warm(h.poolEager); err != nil {
+			h.Logger().Warn("unable to open eager connections", "error", err.Error())
+		}
+	}
+}
+
+// Warm open n connections of the pool, so the first operations after startup do not wait for connections to be
+// established. It fails on the first connection that could not be opened, so it could be used to check the
+// configuration on startup. n is capped to pool size, hub without pool opens and closes one connection.
+// Warmed connections are not exempted from auto close: they are closed by the pool when they are idle longer than
+// its auto close duration, DefaultPoolAutoClose (5 seconds) when it is not set by WithAutoClose or
+// SetAutoCloseDuration. Set auto close duration longer than the expected idle time for warming to have effect
+func (h *Hub) Warm(n int) error {
+	if !h.hasConnFn() {
+		return fmt.Errorf("fail Warm: connection fn is not yet defined")
+	}
+
+	if !h.usePool {
+		conn, err := h.connect()
+		if err != nil {
+			return fmt.Errorf("fail Warm: %w", &ConnectionError{Err: err})
+		}
+		conn.Close()
+		return nil
+	}
+
+	pool := h.poolOf()
+	if n > h.poolSize {
+		n = h.poolSize
+	}
+
+	// items are held until all are opened, so the pool could not hand out the same connection twice
+	items := make([]*dbflex.PoolItem, 0, n)
+	defer func() {
+		for _, it := range items {
+			it.Release()
+		}
+	}()
+	for i := 0; i < n; i++ {
+		it, err := pool.Get()
+		if err != nil {
+			return fmt.Errorf("fail Warm: connection %d. %w", i+1, &ConnectionError{Err: err})
+		}
+		items = append(items, it)
+	}
+	h.Logger().Debug("pool is warmed", "connections", len(items))
+	return nil
+}
@@ -0,0 +1,51 @@
+package datahub
+
+import (
+	"context"
+	"runtime/pprof"
+	"time"
+)
+
+// Labels set on goroutine running a hub operation when profiling labels are enabled
+const (
+	ProfileLabelTable = "datahub.table"
+	ProfileLabelOp    = "datahub.op"
+)
+
+// SetProfileLabels enable pprof labels of table and operation, ie: datahub.table=Orders and datahub.op=gets, on
+// goroutine running Save, Insert, Update, Delete, Get, Gets, Count and other core operations, so CPU and goroutine
+// profiles could be grouped by data operation. Goroutines started by the driver inherit the labels. After the
+// operation, labels of the goroutine are set back to labels of the context given by WithContext, labels set by caller
+// using pprof.Do are lost when the context is not given
+func (h *Hub) SetProfileLabels(enable bool) *Hub {
+	h.profileLabels = enable
+	return h
+}
+
+// WithContext returns hub keeping ctx of the caller, pprof labels of ctx are kept on operations of the hub
+func (h *Hub) WithContext(ctx context.Context) *Hub {
+	nh := h.scope()
+	nh.ctx = ctx
+	return nh
+}
+
+func (h *Hub) context() context.Context {
+	if h.ctx == nil {
+		return context.Background()
+	}
+	return h.ctx
+}
+
+// startOp set profiling labels of the operation and returns its start time, labels are restored by observe
+func (h *Hub) startOp(op, table string) time.Time {
+	if h.profileLabels {
+		pprof.SetGoroutineLabels(pprof.WithLabels(h.context(), pprof.Labels(ProfileLabelTable, table, ProfileLabelOp, op)))
+	}
+	return time.Now()
+}
+
+func (h *Hub) endOp() {
+	if h.profileLabels {
+		pprof.SetGoroutineLabels(h.context())
+	}
+}
@@ -0,0 +1,192 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// RelTag is struct tag used to define relation of a field, format is kind,table,foreignfield[,localfield].
+//
+//	hasmany,orders,customer_id      => orders.customer_id equal to _id of the parent, field type is slice
+//	hasone,profiles,user_id         => profiles.user_id equal to _id of the parent
+//	belongsto,customers,customer_id => customers._id equal to customer_id of the parent
+//
+// The 4th item override field of the parent (hasmany/hasone) or of the related table (belongsto), default is _id
+const RelTag = "rel"
+
+// Relation kinds
+const (
+	RelHasMany   = "hasmany"
+	RelHasOne    = "hasone"
+	RelBelongsTo = "belongsto"
+)
+
+type relation struct {
+	Kind         string
+	Table        string
+	ForeignField string
+	LocalField   string
+}
+
+func parseRelation(tag string) (*relation, error) {
+	parts := strings.Split(tag, ",")
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("invalid relation %s", tag)
+	}
+	rel := &relation{
+		Kind:         strings.ToLower(strings.TrimSpace(parts[0])),
+		Table:        strings.TrimSpace(parts[1]),
+		ForeignField: strings.TrimSpace(parts[2]),
+		LocalField:   "_id",
+	}
+	if len(parts) > 3 && strings.TrimSpace(parts[3]) != "" {
+		rel.LocalField = strings.TrimSpace(parts[3])
+	}
+	switch rel.Kind {
+	case RelHasMany, RelHasOne, RelBelongsTo:
+	default:
+		return nil, fmt.Errorf("invalid relation kind %s", rel.Kind)
+	}
+	return rel, nil
+}
+
+// GetsPreload return all data based on model and filter, and load related records of given relation fields.
+// Relation fields need to be tagged with rel tag. Each relation is loaded using single query for all parents
+func (h *Hub) GetsPreload(data orm.DataModel, parm *dbflex.QueryParam, dest interface{}, relations ...string) error {
+	if err := h.Gets(data, parm, dest); err != nil {
+		return err
+	}
+	return h.Preload(dest, relations...)
+}
+
+// Preload load related records of given relation fields into dest. Dest could be a pointer to struct or a pointer to slice
+func (h *Hub) Preload(dest interface{}, relations ...string) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr {
+		return errors.New("fail Preload: dest should be a pointer")
+	}
+	rv = rv.Elem()
+
+	parents := []reflect.Value{}
+	if rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			if p := reflect.Indirect(rv.Index(i)); p.IsValid() {
+				parents = append(parents, p)
+			}
+		}
+	} else {
+		parents = append(parents, rv)
+	}
+	if len(parents) == 0 {
+		return nil
+	}
+
+	parentType := parents[0].Type()
+	if parentType.Kind() != reflect.Struct {
+		return errors.New("fail Preload: dest should be a struct or slice of struct")
+	}
+
+	for _, relName := range relations {
+		sf, ok := parentType.FieldByName(relName)
+		if !ok {
+			return fmt.Errorf("fail Preload: field %s is not exist", relName)
+		}
+		rel, err := parseRelation(sf.Tag.Get(RelTag))
+		if err != nil {
+			return fmt.Errorf("fail Preload: field %s. %w", relName, err)
+		}
+		if err = h.preloadRelation(parents, sf, rel); err != nil {
+			return fmt.Errorf("fail Preload: field %s. %w", relName, err)
+		}
+	}
+	return nil
+}
+
+func (h *Hub) preloadRelation(parents []reflect.Value, sf reflect.StructField, rel *relation) error {
+	// parentField is field on parent holding the value, targetField is field on related record being matched
+	parentField, targetField := rel.LocalField, rel.ForeignField
+	if rel.Kind == RelBelongsTo {
+		parentField, targetField = rel.ForeignField, rel.LocalField
+	}
+
+	keys := []interface{}{}
+	seen := map[string]bool{}
+	for _, p := range parents {
+		fv := fieldByDbName(p, parentField)
+		if !fv.IsValid() {
+			return fmt.Errorf("field %s is not exist on %s", parentField, p.Type().Name())
+		}
+		if fv.IsZero() {
+			continue
+		}
+		k := fmt.Sprintf("%v", fv.Interface())
+		if !seen[k] {
+			seen[k] = true
+			keys = append(keys, fv.Interface())
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	elemType := sf.Type
+	if rel.Kind == RelHasMany {
+		if elemType.Kind() != reflect.Slice {
+			return errors.New("hasmany relation field should be a slice")
+		}
+		elemType = elemType.Elem()
+	}
+
+	related := reflect.New(reflect.SliceOf(elemType))
+	parm := dbflex.NewQueryParam().SetWhere(dbflex.In(targetField, keys...))
+	if err := h.internal().PopulateByParm(rel.Table, parm, related.Interface()); err != nil {
+		return err
+	}
+
+	groups := map[string][]reflect.Value{}
+	related = related.Elem()
+	for i := 0; i < related.Len(); i++ {
+		item := related.Index(i)
+		fv := fieldByDbName(reflect.Indirect(item), targetField)
+		if !fv.IsValid() {
+			return fmt.Errorf("field %s is not exist on %s", targetField, rel.Table)
+		}
+		k := fmt.Sprintf("%v", fv.Interface())
+		groups[k] = append(groups[k], item)
+	}
+
+	for _, p := range parents {
+		k := fmt.Sprintf("%v", fieldByDbName(p, parentField).Interface())
+		items := groups[k]
+		target := p.FieldByIndex(sf.Index)
+		if rel.Kind == RelHasMany {
+			slice := reflect.MakeSlice(sf.Type, 0, len(items))
+			slice = reflect.Append(slice, items...)
+			target.Set(slice)
+		} else if len(items) > 0 {
+			target.Set(items[0])
+		}
+	}
+	return nil
+}
+
+// fieldByDbName find struct field by its database name, checking sqlname, json and bson tag and field name
+func fieldByDbName(v reflect.Value, name string) reflect.Value {
+	if !v.IsValid() {
+		return reflect.Value{}
+	}
+	meta := MetaOf(v.Type())
+	if meta == nil {
+		return reflect.Value{}
+	}
+	f := meta.Field(name)
+	if f == nil {
+		return reflect.Value{}
+	}
+	return f.Value(v)
+}
@@ -0,0 +1,44 @@
+package datahub
+
+import "errors"
+
+// ErrShed is returned when batch operation is rejected as too many batch operations are waiting, see SetBatchLimits
+var ErrShed = errors.New("batch operation is shed")
+
+// Priority is priority class of operations of a hub
+type Priority int
+
+const (
+	// PriorityInteractive is priority of user facing operations, it is the default
+	PriorityInteractive Priority = iota
+	// PriorityBatch is priority of background jobs, they get connection after waiting interactive operations
+	PriorityBatch
+)
+
+// WithPriority returns hub which operations have given priority, ie: nightly jobs use hub.WithPriority(PriorityBatch).
+// Priority is applied by the concurrency limit set by SetMaxConcurrent: when the limit is reached waiting interactive
+// operations are started before waiting batch operations. Set the limit no more than pool size so operations wait on
+// the limit rather than on the pool
+func (h *Hub) WithPriority(p Priority) *Hub {
+	nh := h.scope()
+	nh.priority = p
+	return nh
+}
+
+// Priority returns priority of operations of the hub
+func (h *Hub) Priority() Priority {
+	return h.priority
+}
+
+// SetBatchLimits keep reserved slots of the concurrency limit for interactive operations, so batch operations could
+// only use the rest of them, and shed batch operation with ErrShed when maxQueued batch operations are already
+// waiting. maxQueued 0 means batch operations are always queued
+func (h *Hub) SetBatchLimits(reserved, maxQueued int) *Hub {
+	l := h.limiterOf()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.reserved = reserved
+	l.maxBatchQueue = maxQueued
+	l.grantWaiters()
+	return h
+}
@@ -0,0 +1,108 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// OutParam mark an argument of CallProc as output parameter
+type OutParam struct {
+	Name string
+}
+
+// Out create output parameter for CallProc. Output values are fetched into dest of CallProc using name as field
+func Out(name string) OutParam {
+	return OutParam{Name: name}
+}
+
+// CallProc call stored procedure / server side function and fetch its result into dest. Dest should be pointer
+// to slice on SQL drivers, or nil when result is not needed.
+// On SQL drivers it is translated into CALL (EXEC on sqlserver). On mongo it runs database command where name is
+// the command and args is value of the command followed by pair of option name and value.
+// Output parameter is supported on postgres (INOUT returned as row) and mysql (session variables)
+func (h *Hub) CallProc(name string, args []interface{}, dest interface{}) error {
+	if name == "" {
+		return errors.New("fail CallProc: name is mandatory")
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	if !isSQLDriver(conn) {
+		command := toolkit.M{}
+		if len(args) > 0 {
+			command.Set(name, args[0])
+			for i := 1; i+1 < len(args); i += 2 {
+				command.Set(fmt.Sprintf("%v", args[i]), args[i+1])
+			}
+		} else {
+			command.Set(name, 1)
+		}
+		res, err := conn.Execute(dbflex.From(name).Command("runcommand", command), nil)
+		if err != nil {
+			return fmt.Errorf("fail CallProc: %w", err)
+		}
+		if dest != nil && res != nil {
+			if err = toolkit.Serde(res, dest, ""); err != nil {
+				return fmt.Errorf("fail CallProc: unable to decode result. %w", err)
+			}
+		}
+		return nil
+	}
+
+	driver := driverName(conn)
+	literals := make([]string, len(args))
+	outs := []string{}
+	for i, arg := range args {
+		out, isOut := arg.(OutParam)
+		switch {
+		case !isOut:
+			literals[i] = sqlLiteral(driver, arg)
+		case strings.Contains(driver, "mysql"):
+			literals[i] = "@" + out.Name
+			outs = append(outs, "@"+out.Name+" AS "+out.Name)
+		case strings.Contains(driver, "pg") || strings.Contains(driver, "postgres"):
+			literals[i] = "NULL"
+		default:
+			return fmt.Errorf("fail CallProc: output parameter on %s. %w", driver, ErrNotSupported)
+		}
+	}
+
+	var sql string
+	if strings.Contains(driver, "mssql") || strings.Contains(driver, "sqlserver") {
+		sql = "EXEC " + name + " " + strings.Join(literals, ", ")
+	} else {
+		sql = "CALL " + name + "(" + strings.Join(literals, ", ") + ")"
+	}
+
+	if len(outs) > 0 {
+		if _, err = conn.Execute(dbflex.SQL(sql), nil); err != nil {
+			return fmt.Errorf("fail CallProc: %w", err)
+		}
+		sql = "SELECT " + strings.Join(outs, ", ")
+	}
+
+	if dest == nil {
+		if _, err = conn.Execute(dbflex.SQL(sql), nil); err != nil {
+			return fmt.Errorf("fail CallProc: %w", err)
+		}
+		return nil
+	}
+
+	cur := conn.Cursor(dbflex.SQL(sql), nil)
+	if err = cur.Error(); err != nil {
+		return fmt.Errorf("fail CallProc: %w", err)
+	}
+	defer cur.Close()
+	if err = cur.Fetchs(dest, 0).Error(); err != nil {
+		return fmt.Errorf("fail CallProc: unable to fetch result. %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// DefaultProjectionTableName is name of table used to keep state of projections
+const DefaultProjectionTableName = "DatahubProjections"
+
+// ProjectionMode define how a projection is refreshed
+type ProjectionMode struct {
+	// Incremental only load source records having watermark field greater than last refresh, and save them
+	// into target. Otherwise target table is emptied and fully reloaded
+	Incremental bool
+
+	// WatermarkField is field of source result used as watermark on incremental mode
+	WatermarkField string
+
+	// Where is base filter of source command. On incremental mode it is combined with watermark filter,
+	// hence source command should not have its own where
+	Where *dbflex.Filter
+}
+
+// FullRefresh returns mode to fully reload the projection
+func FullRefresh() ProjectionMode {
+	return ProjectionMode{}
+}
+
+// IncrementalRefresh returns mode to incrementally load the projection based on watermark field
+func IncrementalRefresh(watermarkField string) ProjectionMode {
+	return ProjectionMode{Incremental: true, WatermarkField: watermarkField}
+}
+
+// ProjectionState is the record persisted on projection table for each projection
+type ProjectionState struct {
+	ID        string      `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	Target    string      `bson:"target" json:"target" sqlname:"target"`
+	Watermark interface{} `bson:"watermark" json:"watermark" sqlname:"watermark"`
+	LastRun   time.Time   `bson:"lastrun" json:"lastrun" sqlname:"lastrun"`
+	Rows      int         `bson:"rows" json:"rows" sqlname:"rows"`
+}
+
+// ProjectionResult is result of a projection refresh
+type ProjectionResult struct {
+	Name      string
+	Rows      int
+	Watermark interface{}
+	Duration  time.Duration
+}
+
+// projectionLocks hold mutex of each projection, so refreshes of the same projection, ie: scheduled and manual one,
+// do not read and write its state and target concurrently
+var projectionLocks sync.Map
+
+func (h *Hub) projectionLock(name string) *sync.Mutex {
+	mtx, _ := projectionLocks.LoadOrStore(h.table(h.ProjectionTableName())+"/"+name, new(sync.Mutex))
+	return mtx.(*sync.Mutex)
+}
+
+// SetProjectionTableName set name of table used to store state of projections
+func (h *Hub) SetProjectionTableName(name string) *Hub {
+	h.projectionTableName = name
+	return h
+}
+
+// ProjectionTableName returns name of table used to store state of projections
+func (h *Hub) ProjectionTableName() string {
+	if h.projectionTableName == "" {
+		return DefaultProjectionTableName
+	}
+	return h.projectionTableName
+}
+
+// RefreshProjection materialize result of source command into target table.
+// Target rows are written using Save, so result of source command should include key of target table.
+// Target and state of the projection are written in one transaction where supported, so failed full refresh does
+// not leave the target empty. Source command is not changed, filter of the mode is applied to its copy.
+// Refreshes of the same projection are run one at a time
+func (h *Hub) RefreshProjection(name string, sourceCmd dbflex.ICommand, targetTable string, mode ProjectionMode) (*ProjectionResult, error) {
+	if name == "" || sourceCmd == nil || targetTable == "" {
+		return nil, errors.New("fail RefreshProjection: name, source command and target table are mandatory")
+	}
+	if mode.Incremental && mode.WatermarkField == "" {
+		return nil, errors.New("fail RefreshProjection: watermark field is mandatory on incremental mode")
+	}
+
+	mtx := h.projectionLock(name)
+	mtx.Lock()
+	defer mtx.Unlock()
+
+	started := time.Now()
+	state, err := h.getProjectionState(name)
+	if err != nil {
+		return nil, fmt.Errorf("fail RefreshProjection: %w", err)
+	}
+	state.Target = targetTable
+
+	where := mode.Where
+	if mode.Incremental && state.Watermark != nil {
+		wf := dbflex.Gt(mode.WatermarkField, state.Watermark)
+		if where == nil {
+			where = wf
+		} else {
+			where = dbflex.And(where, wf)
+		}
+	}
+	if where != nil {
+		sourceCmd = copyCommand(sourceCmd)
+		sourceCmd.Where(where)
+	}
+
+	rows := []toolkit.M{}
+	if _, err = h.internal().Populate(sourceCmd, &rows); err != nil {
+		return nil, fmt.Errorf("fail RefreshProjection: source. %w", err)
+	}
+
+	err = h.inTx(func(ht *Hub) error {
+		if !mode.Incremental {
+			if _, err := ht.Execute(dbflex.From(ht.table(targetTable)).Delete(), nil); err != nil {
+				return fmt.Errorf("clear target. %w", err)
+			}
+		}
+
+		for _, row := range rows {
+			if err := ht.SaveAny(targetTable, row); err != nil {
+				return fmt.Errorf("write target. %w", err)
+			}
+			if mode.Incremental {
+				if wm := row.Get(mode.WatermarkField); compareValues(wm, state.Watermark) > 0 {
+					state.Watermark = wm
+				}
+			}
+		}
+
+		state.LastRun = time.Now()
+		state.Rows = len(rows)
+		if err := ht.SaveAny(ht.ProjectionTableName(), state); err != nil {
+			return fmt.Errorf("save state. %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fail RefreshProjection: %w", err)
+	}
+
+	return &ProjectionResult{Name: name, Rows: len(rows), Watermark: state.Watermark, Duration: time.Since(started)}, nil
+}
+
+// copyCommand returns shallow copy of cmd, so filter could be added without changing command of the caller
+func copyCommand(cmd dbflex.ICommand) dbflex.ICommand {
+	rv := reflect.ValueOf(cmd)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return cmd
+	}
+	cp := reflect.New(rv.Elem().Type())
+	cp.Elem().Set(rv.Elem())
+	if c, ok := cp.Interface().(dbflex.ICommand); ok {
+		return c
+	}
+	return cmd
+}
+
+// ScheduleProjection refresh projection periodically. onDone, if not nil, is called after each refresh.
+// It returns function to stop the schedule, calling it more than once is safe
+func (h *Hub) ScheduleProjection(every time.Duration, name string, sourceFn func() dbflex.ICommand, targetTable string,
+	mode ProjectionMode, onDone func(*ProjectionResult, error)) func() {
+	done := make(chan bool)
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+				res, err := h.RefreshProjection(name, sourceFn(), targetTable, mode)
+				if err != nil {
+					h.Logger().Error("projection refresh fail", "projection", name, "error", err.Error())
+				}
+				if onDone != nil {
+					onDone(res, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
+func (h *Hub) getProjectionState(name string) (*ProjectionState, error) {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	tableName := h.table(h.ProjectionTableName())
+	if !conn.HasTable(tableName) {
+		if err = conn.EnsureTable(tableName, []string{"_id"}, new(ProjectionState)); err != nil {
+			return nil, fmt.Errorf("unable to prepare projection table. %w", err)
+		}
+	}
+
+	cur := conn.Cursor(dbflex.From(tableName).Select().Where(dbflex.Eq("_id", name)), nil)
+	if err = cur.Error(); err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+
+	states := []*ProjectionState{}
+	if err = cur.Fetchs(&states, 1).Error(); err != nil {
+		return nil, err
+	}
+	if len(states) == 0 {
+		return &ProjectionState{ID: name}, nil
+	}
+	return states[0], nil
+}
@@ -0,0 +1,309 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ProtoRecord let protobuf generated message to be used as orm.DataModel, so request / response types of gRPC services
+// can be persisted without parallel model struct. Column is the proto field name (or its JSON name when JSONNames is called),
+// nested message is stored as document, enum as its number and google.protobuf.Timestamp as time.
+// Only the field being set of a oneof is stored, other members of the oneof are stored as null
+//
+//	h.Save(datahub.ProtoModel(user, "users"))
+//	h.Gets(datahub.ProtoModel(new(pb.User), "users"), parm, &[]*pb.User{})
+type ProtoRecord struct {
+	orm.DataModelBase `json:"-" bson:"-"`
+
+	msg       proto.Message
+	table     string
+	keys      []string
+	jsonNames bool
+}
+
+// ProtoModel wraps protobuf message into DataModel. keyFields are proto field names of the primary key, default is id
+func ProtoModel(msg proto.Message, tableName string, keyFields ...string) *ProtoRecord {
+	if len(keyFields) == 0 {
+		keyFields = []string{"id"}
+	}
+	p := &ProtoRecord{msg: msg, table: tableName, keys: keyFields}
+	p.SetThis(p)
+	return p
+}
+
+// JSONNames use JSON name (lowerCamelCase) of proto fields as column name
+func (p *ProtoRecord) JSONNames() *ProtoRecord {
+	p.jsonNames = true
+	return p
+}
+
+// Message returns the wrapped message
+func (p *ProtoRecord) Message() proto.Message {
+	return p.msg
+}
+
+// TableName returns table name of the record
+func (p *ProtoRecord) TableName() string {
+	return p.table
+}
+
+// GetID returns column names and values of key fields
+func (p *ProtoRecord) GetID(conn dbflex.IConnection) ([]string, []interface{}) {
+	m := p.msg.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	names, values := []string{}, []interface{}{}
+	for _, k := range p.keys {
+		fd := fields.ByName(protoreflect.Name(k))
+		if fd == nil {
+			continue
+		}
+		names = append(names, p.column(fd))
+		values = append(values, protoToDoc(fd, m.Get(fd)))
+	}
+	return names, values
+}
+
+// SetID set value of key fields
+func (p *ProtoRecord) SetID(keys ...interface{}) {
+	m := p.msg.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	for i, k := range p.keys {
+		if i >= len(keys) {
+			return
+		}
+		if fd := fields.ByName(protoreflect.Name(k)); fd != nil {
+			if v, err := protoFromDoc(fd, keys[i], nil); err == nil {
+				m.Set(fd, v)
+			}
+		}
+	}
+}
+
+func (p *ProtoRecord) column(fd protoreflect.FieldDescriptor) string {
+	if p.jsonNames {
+		return fd.JSONName()
+	}
+	return string(fd.Name())
+}
+
+func (p *ProtoRecord) encodeDoc() toolkit.M {
+	return protoToM(p.msg.ProtoReflect(), p.column)
+}
+
+func (p *ProtoRecord) decodeDoc(doc toolkit.M, target interface{}) error {
+	msg, ok := target.(proto.Message)
+	if !ok {
+		return fmt.Errorf("%T is not a protobuf message", target)
+	}
+	return protoFromM(doc, msg.ProtoReflect(), p.column)
+}
+
+func (p *ProtoRecord) record() interface{} {
+	return p.msg
+}
+
+func protoToM(m protoreflect.Message, column func(protoreflect.FieldDescriptor) string) toolkit.M {
+	res := toolkit.M{}
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		name := column(fd)
+		isMsg := fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind
+		if (fd.ContainingOneof() != nil || (isMsg && !fd.IsList() && !fd.IsMap())) && !m.Has(fd) {
+			res[name] = nil
+			continue
+		}
+		res[name] = protoToDoc(fd, m.Get(fd))
+	}
+	return res
+}
+
+func protoToDoc(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch {
+	case fd.IsList():
+		l := v.List()
+		arr := make([]interface{}, l.Len())
+		for i := 0; i < l.Len(); i++ {
+			arr[i] = protoScalarToDoc(fd, l.Get(i))
+		}
+		return arr
+
+	case fd.IsMap():
+		res := toolkit.M{}
+		v.Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+			res[k.String()] = protoScalarToDoc(fd.MapValue(), mv)
+			return true
+		})
+		return res
+	}
+	return protoScalarToDoc(fd, v)
+}
+
+func protoScalarToDoc(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return int32(v.Enum())
+
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if ts, ok := v.Message().Interface().(*timestamppb.Timestamp); ok {
+			return ts.AsTime()
+		}
+		return protoToM(v.Message(), func(fd protoreflect.FieldDescriptor) string { return string(fd.Name()) })
+	}
+	return v.Interface()
+}
+
+func protoFromM(doc toolkit.M, m protoreflect.Message, column func(protoreflect.FieldDescriptor) string) error {
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		raw, ok := doc[column(fd)]
+		if !ok {
+			// document read from driver may keep the other naming
+			if raw, ok = doc[string(fd.Name())]; !ok {
+				raw, ok = doc[fd.JSONName()]
+			}
+		}
+		if !ok || raw == nil {
+			m.Clear(fd)
+			continue
+		}
+
+		switch {
+		case fd.IsList():
+			l := m.Mutable(fd).List()
+			for _, item := range toInterfaces(raw) {
+				v, err := protoFromDoc(fd, item, l.NewElement)
+				if err != nil {
+					return fmt.Errorf("field %s: %w", fd.Name(), err)
+				}
+				l.Append(v)
+			}
+
+		case fd.IsMap():
+			items, ok := toM(raw)
+			if !ok {
+				return fmt.Errorf("field %s: %T is not a map", fd.Name(), raw)
+			}
+			mp := m.Mutable(fd).Map()
+			for k, item := range items {
+				key, err := protoFromDoc(fd.MapKey(), k, nil)
+				if err != nil {
+					return fmt.Errorf("field %s: %w", fd.Name(), err)
+				}
+				v, err := protoFromDoc(fd.MapValue(), item, mp.NewValue)
+				if err != nil {
+					return fmt.Errorf("field %s: %w", fd.Name(), err)
+				}
+				mp.Set(key.MapKey(), v)
+			}
+
+		default:
+			v, err := protoFromDoc(fd, raw, func() protoreflect.Value { return m.NewField(fd) })
+			if err != nil {
+				return fmt.Errorf("field %s: %w", fd.Name(), err)
+			}
+			// setting a member of oneof clears the others
+			m.Set(fd, v)
+		}
+	}
+	return nil
+}
+
+var protoKindTypes = map[protoreflect.Kind]reflect.Type{
+	protoreflect.BoolKind:     reflect.TypeOf(false),
+	protoreflect.EnumKind:     reflect.TypeOf(int32(0)),
+	protoreflect.Int32Kind:    reflect.TypeOf(int32(0)),
+	protoreflect.Sint32Kind:   reflect.TypeOf(int32(0)),
+	protoreflect.Sfixed32Kind: reflect.TypeOf(int32(0)),
+	protoreflect.Int64Kind:    reflect.TypeOf(int64(0)),
+	protoreflect.Sint64Kind:   reflect.TypeOf(int64(0)),
+	protoreflect.Sfixed64Kind: reflect.TypeOf(int64(0)),
+	protoreflect.Uint32Kind:   reflect.TypeOf(uint32(0)),
+	protoreflect.Fixed32Kind:  reflect.TypeOf(uint32(0)),
+	protoreflect.Uint64Kind:   reflect.TypeOf(uint64(0)),
+	protoreflect.Fixed64Kind:  reflect.TypeOf(uint64(0)),
+	protoreflect.FloatKind:    reflect.TypeOf(float32(0)),
+	protoreflect.DoubleKind:   reflect.TypeOf(float64(0)),
+	protoreflect.StringKind:   reflect.TypeOf(""),
+}
+
+// protoFromDoc convert value read from document into proto value of the field, newMsg is used to create nested message
+func protoFromDoc(fd protoreflect.FieldDescriptor, raw interface{}, newMsg func() protoreflect.Value) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if newMsg == nil {
+			return protoreflect.Value{}, errors.New("message is not supported as key")
+		}
+		nv := newMsg()
+		if fd.Message().FullName() == "google.protobuf.Timestamp" {
+			t, ok := raw.(time.Time)
+			if !ok {
+				return protoreflect.Value{}, fmt.Errorf("%T is not a time", raw)
+			}
+			return protoreflect.ValueOfMessage(timestamppb.New(t).ProtoReflect()), nil
+		}
+		doc, ok := toM(raw)
+		if !ok {
+			return protoreflect.Value{}, fmt.Errorf("%T is not a document", raw)
+		}
+		err := protoFromM(doc, nv.Message(), func(fd protoreflect.FieldDescriptor) string { return string(fd.Name()) })
+		return nv, err
+
+	case protoreflect.BytesKind:
+		switch b := raw.(type) {
+		case []byte:
+			return protoreflect.ValueOfBytes(b), nil
+		case string:
+			return protoreflect.ValueOfBytes([]byte(b)), nil
+		}
+		return protoreflect.Value{}, fmt.Errorf("%T is not bytes", raw)
+	}
+
+	t := protoKindTypes[fd.Kind()]
+	if t == nil {
+		return protoreflect.Value{}, fmt.Errorf("kind %v is not supported", fd.Kind())
+	}
+	rv := reflect.New(t).Elem()
+	if s, ok := raw.(string); ok && t.Kind() != reflect.String {
+		if err := setFromString(rv, s); err != nil {
+			return protoreflect.Value{}, err
+		}
+	} else {
+		src := reflect.ValueOf(raw)
+		if !src.Type().ConvertibleTo(t) || (src.Kind() == reflect.String) != (t.Kind() == reflect.String) {
+			return protoreflect.Value{}, fmt.Errorf("%T can not be converted into %s", raw, t.String())
+		}
+		rv.Set(src.Convert(t))
+	}
+
+	switch v := rv.Interface().(type) {
+	case bool:
+		return protoreflect.ValueOfBool(v), nil
+	case int32:
+		if fd.Kind() == protoreflect.EnumKind {
+			return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), nil
+		}
+		return protoreflect.ValueOfInt32(v), nil
+	case int64:
+		return protoreflect.ValueOfInt64(v), nil
+	case uint32:
+		return protoreflect.ValueOfUint32(v), nil
+	case uint64:
+		return protoreflect.ValueOfUint64(v), nil
+	case float32:
+		return protoreflect.ValueOfFloat32(v), nil
+	case float64:
+		return protoreflect.ValueOfFloat64(v), nil
+	}
+	return protoreflect.ValueOfString(rv.String()), nil
+}
@@ -0,0 +1,130 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is returned when an operation exceeds rate limit of the hub and could not wait for its turn
+var ErrRateLimited = errors.New("rate limit is exceeded")
+
+// tokenBucket allow rate operations per second with bursts of up to burst operations
+type tokenBucket struct {
+	mtx    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve take a token and returns how long caller should wait before using it. Token is not taken when the wait
+// would exceed maxWait, maxWait 0 means no limit and negative means caller does not wait at all
+func (b *tokenBucket) reserve(maxWait time.Duration) (time.Duration, bool) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	var wait time.Duration
+	if b.tokens < 1 {
+		wait = time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	}
+	if wait > 0 && (maxWait < 0 || (maxWait > 0 && wait > maxWait)) {
+		return 0, false
+	}
+	b.tokens--
+	return wait, true
+}
+
+// rateLimits is shared by hubs created from the same hub
+type rateLimits struct {
+	mtx     sync.RWMutex
+	global  *tokenBucket
+	tables  map[string]*tokenBucket
+	maxWait time.Duration
+}
+
+func (h *Hub) rateLimitsOf() *rateLimits {
+	if h.limits == nil {
+		h.limits = &rateLimits{tables: map[string]*tokenBucket{}}
+	}
+	return h.limits
+}
+
+// SetRateLimit limit number of operations of the hub, and hubs created from it, to opsPerSecond with bursts of up
+// to burst operations. Every operation acquiring a connection is counted, including raw commands. Operation exceeding
+// the limit waits for its turn, see SetRateLimitWait. opsPerSecond 0 remove the limit
+func (h *Hub) SetRateLimit(opsPerSecond float64, burst int) *Hub {
+	l := h.rateLimitsOf()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.global = nil
+	if opsPerSecond > 0 {
+		l.global = newTokenBucket(opsPerSecond, burst)
+	}
+	return h
+}
+
+// SetTableRateLimit limit number of operations on a table, on top of the hub limit. Only operations on models and
+// tables, such as Save, Gets and PopulateByParm, are counted. opsPerSecond 0 remove the limit
+func (h *Hub) SetTableRateLimit(table string, opsPerSecond float64, burst int) *Hub {
+	l := h.rateLimitsOf()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	delete(l.tables, strings.ToLower(table))
+	if opsPerSecond > 0 {
+		l.tables[strings.ToLower(table)] = newTokenBucket(opsPerSecond, burst)
+	}
+	return h
+}
+
+// SetRateLimitWait set maximum time an operation waits for its turn when rate limit is exceeded, ErrRateLimited is
+// returned when it needs to wait longer. 0, the default, means waiting as long as needed, negative means fail fast
+func (h *Hub) SetRateLimitWait(d time.Duration) *Hub {
+	l := h.rateLimitsOf()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.maxWait = d
+	return h
+}
+
+// waitRate wait for turn of the hub limit, or the table limit when table is given
+func (h *Hub) waitRate(table string) error {
+	l := h.rateLimitsOf()
+	l.mtx.RLock()
+	b, maxWait := l.global, l.maxWait
+	if table != "" {
+		b = l.tables[strings.ToLower(table)]
+	}
+	l.mtx.RUnlock()
+	if b == nil {
+		return nil
+	}
+
+	wait, ok := b.reserve(maxWait)
+	if !ok {
+		if table == "" {
+			return ErrRateLimited
+		}
+		return fmt.Errorf("%s. %w", table, ErrRateLimited)
+	}
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// connFactory is connection function shared by hubs created from the same hub, including clones
+type connFactory struct {
+	mtx sync.RWMutex
+	fn  func() (dbflex.IConnection, error)
+}
+
+func (h *Hub) hasConnFn() bool {
+	h.conns.mtx.RLock()
+	defer h.conns.mtx.RUnlock()
+	return h.conns.fn != nil
+}
+
+// connect open new connection using connection function of the hub
+func (h *Hub) connect() (dbflex.IConnection, error) {
+	h.conns.mtx.RLock()
+	fn := h.conns.fn
+	h.conns.mtx.RUnlock()
+	if fn == nil {
+		return nil, errors.New("connection fn is not yet defined")
+	}
+	return fn()
+}
+
+// SetConnFn replace connection function of the hub, ie: to apply rotated database credential, then rebuild the
+// pool using Reconnect. When connection could not be opened using fn, previous function is kept and error is
+// returned. Clones of the hub use fn for their new connections, but their pools are not rebuilt
+func (h *Hub) SetConnFn(fn func() (dbflex.IConnection, error)) error {
+	if fn == nil {
+		return errors.New("fail SetConnFn: connection fn is mandatory")
+	}
+	h.conns.mtx.Lock()
+	old := h.conns.fn
+	h.conns.fn = fn
+	h.conns.mtx.Unlock()
+
+	if err := h.Reconnect(); err != nil {
+		h.conns.mtx.Lock()
+		h.conns.fn = old
+		h.conns.mtx.Unlock()
+		return fmt.Errorf("fail SetConnFn: %w", err)
+	}
+	return nil
+}
+
+// Reconnect replace pool of the hub with a new pool, so following operations use new connections. Connections of
+// the old pool are closed once operations using them, including transactions and sessions, are completed.
+// A connection is opened first to check the connection function, on failure the pool is kept
+func (h *Hub) Reconnect() error {
+	conn, err := h.connect()
+	if err != nil {
+		return fmt.Errorf("fail Reconnect: %w", &ConnectionError{Err: err})
+	}
+	conn.Close()
+	if !h.usePool {
+		return nil
+	}
+
+	h.mtx.Lock()
+	old := h.pools.pool
+	h.pools.pool = h.newPool()
+	if old != nil {
+		h.closeRetiredPool(old)
+	}
+	h.mtx.Unlock()
+
+	if h.poolEager > 0 {
+		if err = h.Warm(h.poolEager); err != nil {
+			h.Logger().Warn("unable to open eager connections", "error", err.Error())
+		}
+	}
+	h.Logger().Info("hub is reconnected")
+	return nil
+}
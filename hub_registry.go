@@ -0,0 +1,291 @@
+package datahub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// ModelDrift is a difference found between a model and its table
+type ModelDrift struct {
+	Table string
+	// Kind is one of table, key, column and index
+	Kind    string
+	Message string
+}
+
+// ModelDriftError is returned by RegisterModels when a registered model does not match the database
+type ModelDriftError struct {
+	Drifts []ModelDrift
+}
+
+func (e *ModelDriftError) Error() string {
+	msgs := make([]string, len(e.Drifts))
+	for i, d := range e.Drifts {
+		msgs[i] = d.Table + ": " + d.Message
+	}
+	return "model drift. " + strings.Join(msgs, "; ")
+}
+
+// RegisterModels register models used by the application and verify them against the database: table (or collection)
+// should exist, model should have key field, every field should have its column on SQL drivers and every index defined
+// by index tag should exist with the same uniqueness. Call it on startup so the application fails fast instead of
+// at the first query. Drifts are logged as warning and returned as *ModelDriftError
+func (h *Hub) RegisterModels(models ...orm.DataModel) error {
+	for _, m := range models {
+		m.SetThis(m)
+		h.models = append(h.models, m)
+	}
+	drifts, err := h.verifyModels(models)
+	if err != nil {
+		return fmt.Errorf("fail RegisterModels: %w", err)
+	}
+	if len(drifts) > 0 {
+		return &ModelDriftError{Drifts: drifts}
+	}
+	return nil
+}
+
+// Models returns registered models
+func (h *Hub) Models() []orm.DataModel {
+	return append([]orm.DataModel{}, h.models...)
+}
+
+// VerifyModels verify registered models against the database and returns drifts found, ie: to be reported periodically
+func (h *Hub) VerifyModels() ([]ModelDrift, error) {
+	drifts, err := h.verifyModels(h.models)
+	if err != nil {
+		return nil, fmt.Errorf("fail VerifyModels: %w", err)
+	}
+	return drifts, nil
+}
+
+func (h *Hub) verifyModels(models []orm.DataModel) ([]ModelDrift, error) {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	drifts := []ModelDrift{}
+	for _, m := range models {
+		ds, err := h.verifyModel(conn, m)
+		if err != nil {
+			return nil, fmt.Errorf("%s. %w", m.TableName(), err)
+		}
+		for _, d := range ds {
+			h.Logger().Warn("model drift", "table", d.Table, "kind", d.Kind, "message", d.Message)
+		}
+		drifts = append(drifts, ds...)
+	}
+	return drifts, nil
+}
+
+// tableIndex is index found on the database
+type tableIndex struct {
+	Fields []string
+	Unique bool
+}
+
+func (h *Hub) verifyModel(conn dbflex.IConnection, data orm.DataModel) ([]ModelDrift, error) {
+	tableName := h.tableOf(data)
+	drifts := []ModelDrift{}
+	drift := func(kind, msg string, args ...interface{}) {
+		drifts = append(drifts, ModelDrift{Table: tableName, Kind: kind, Message: fmt.Sprintf(msg, args...)})
+	}
+
+	if keys, _ := data.GetID(conn); len(keys) == 0 {
+		drift("key", "model has no key field")
+	}
+
+	var (
+		exists  bool
+		columns map[string]bool
+		indexes map[string]tableIndex
+		err     error
+	)
+	if isSQLDriver(conn) {
+		exists, columns, indexes, err = sqlTableInfo(conn, tableName)
+	} else {
+		exists, indexes, err = mongoCollectionInfo(conn, tableName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		drift("table", "table is not exist")
+		return drifts, nil
+	}
+
+	doc := modelDoc(conn, data)
+	if columns != nil {
+		names := make([]string, 0, len(doc))
+		for k := range doc {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			if !columns[strings.ToLower(k)] {
+				drift("column", "column %s is not exist", k)
+			}
+		}
+	}
+
+	meta := MetaOf(data)
+	if meta == nil {
+		return drifts, nil
+	}
+	tag := conn.FieldNameTag()
+	for _, im := range meta.Indexes {
+		ti, ok := indexes[strings.ToLower(im.Name)]
+		if !ok {
+			drift("index", "index %s is not exist", im.Name)
+			continue
+		}
+		if ti.Unique != im.Unique {
+			drift("index", "index %s unique is %v, expected %v", im.Name, ti.Unique, im.Unique)
+		}
+		if len(ti.Fields) == 0 {
+			continue
+		}
+		fields := make([]string, len(im.Fields))
+		for i, name := range im.Fields {
+			fields[i] = name
+			if f := meta.Field(name); f != nil {
+				fields[i] = f.DbName(tag)
+			}
+		}
+		if !strings.EqualFold(strings.Join(fields, ","), strings.Join(ti.Fields, ",")) {
+			drift("index", "index %s is on %s, expected %s", im.Name, strings.Join(ti.Fields, ","), strings.Join(fields, ","))
+		}
+	}
+	return drifts, nil
+}
+
+func mongoCollectionInfo(conn dbflex.IConnection, tableName string) (bool, map[string]tableIndex, error) {
+	reply := struct {
+		Cursor struct {
+			FirstBatch []toolkit.M `json:"firstBatch" bson:"firstBatch"`
+		} `json:"cursor" bson:"cursor"`
+	}{}
+	run := func(command toolkit.M) error {
+		res, err := conn.Execute(dbflex.From(tableName).Command("runcommand", command), nil)
+		if err != nil {
+			return err
+		}
+		reply.Cursor.FirstBatch = nil
+		if res == nil {
+			return nil
+		}
+		return toolkit.Serde(res, &reply, "")
+	}
+
+	if err := run(toolkit.M{}.Set("listCollections", 1).Set("filter", toolkit.M{"name": tableName}).Set("nameOnly", true)); err != nil {
+		return false, nil, err
+	}
+	if len(reply.Cursor.FirstBatch) == 0 {
+		return false, nil, nil
+	}
+
+	if err := run(toolkit.M{}.Set("listIndexes", tableName)); err != nil {
+		return true, nil, err
+	}
+	indexes := map[string]tableIndex{}
+	for _, m := range reply.Cursor.FirstBatch {
+		// key document is decoded into map, which loses field order, hence only uniqueness is compared
+		ti := tableIndex{Unique: isTrue(m.Get("unique", false))}
+		indexes[strings.ToLower(m.GetString("name"))] = ti
+	}
+	return true, indexes, nil
+}
+
+func sqlTableInfo(conn dbflex.IConnection, tableName string) (bool, map[string]bool, map[string]tableIndex, error) {
+	driver := driverName(conn)
+	name := sqlLiteral(driver, tableName)
+
+	var colSQL, idxSQL string
+	switch {
+	case strings.Contains(driver, "pg") || strings.Contains(driver, "postgres"):
+		colSQL = "SELECT column_name FROM information_schema.columns WHERE table_name = " + name
+		idxSQL = "SELECT i.relname AS index_name, a.attname AS column_name, ix.indisunique AS is_unique, " +
+			"array_position(ix.indkey::int2[], a.attnum) AS seq FROM pg_class t JOIN pg_index ix ON t.oid = ix.indrelid " +
+			"JOIN pg_class i ON i.oid = ix.indexrelid JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(ix.indkey) " +
+			"WHERE t.relname = " + name + " ORDER BY index_name, seq"
+	case strings.Contains(driver, "mysql"):
+		colSQL = "SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = " + name
+		idxSQL = "SELECT index_name, column_name, non_unique = 0 AS is_unique FROM information_schema.statistics " +
+			"WHERE table_schema = DATABASE() AND table_name = " + name + " ORDER BY index_name, seq_in_index"
+	case strings.Contains(driver, "sqlite"):
+		colSQL = "SELECT name AS column_name FROM pragma_table_info(" + name + ")"
+		idxSQL = "SELECT il.name AS index_name, ii.name AS column_name, il.\"unique\" AS is_unique " +
+			"FROM pragma_index_list(" + name + ") il JOIN pragma_index_info(il.name) ii ORDER BY il.name, ii.seqno"
+	default:
+		return false, nil, nil, fmt.Errorf("verify table on %s. %w", driver, ErrNotSupported)
+	}
+
+	docs, err := fetchDocs(conn, dbflex.SQL(colSQL))
+	if err != nil {
+		return false, nil, nil, err
+	}
+	if len(docs) == 0 {
+		return false, nil, nil, nil
+	}
+	columns := map[string]bool{}
+	for _, d := range docs {
+		columns[strings.ToLower(docString(d, "column_name"))] = true
+	}
+
+	if docs, err = fetchDocs(conn, dbflex.SQL(idxSQL)); err != nil {
+		return true, columns, nil, err
+	}
+	indexes := map[string]tableIndex{}
+	for _, d := range docs {
+		n := strings.ToLower(docString(d, "index_name"))
+		ti := indexes[n]
+		ti.Fields = append(ti.Fields, docString(d, "column_name"))
+		ti.Unique = ti.Unique || isTrue(docValueOf(d, "is_unique"))
+		indexes[n] = ti
+	}
+	return true, columns, indexes, nil
+}
+
+// docValueOf returns value of a key of document returned by SQL driver, which could be in upper case
+func docValueOf(d toolkit.M, key string) interface{} {
+	if v, ok := d[key]; ok {
+		return v
+	}
+	for k, v := range d {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return nil
+}
+
+func docString(d toolkit.M, key string) string {
+	switch v := docValueOf(d, key).(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func isTrue(v interface{}) bool {
+	switch o := indirectValue(v).(type) {
+	case bool:
+		return o
+	case string:
+		return o == "1" || strings.EqualFold(o, "true") || strings.EqualFold(o, "t")
+	case []byte:
+		return isTrue(string(o))
+	}
+	f, _ := toFloat(indirectValue(v))
+	return f != 0
+}
@@ -0,0 +1,173 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// SettingChange is a setting changed by ApplyConfig
+type SettingChange struct {
+	Setting string
+	Old     string
+	New     string
+}
+
+// ConfigChange is event of settings changed by ApplyConfig
+type ConfigChange struct {
+	Time    time.Time
+	Changes []SettingChange
+	// Ignored is settings changed on the configuration which could not be applied at runtime, ie: uri.
+	// The hub should be recreated to apply them
+	Ignored []string
+}
+
+// ConfigSource returns latest configuration of a hub, see WatchConfig
+type ConfigSource func() (HubConfig, error)
+
+// FileConfigSource returns configuration of hub with given name on YAML or JSON file
+func FileConfigSource(path, name string) ConfigSource {
+	return func() (HubConfig, error) {
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			return HubConfig{}, err
+		}
+		c, ok := cfg.Hubs[name]
+		if !ok {
+			return HubConfig{}, fmt.Errorf("hub %s is not found on %s", name, path)
+		}
+		return c, nil
+	}
+}
+
+// EnvConfigSource returns configuration of hub from environment variables, see FromEnv
+func EnvConfigSource(prefix string) ConfigSource {
+	return func() (HubConfig, error) {
+		return HubConfigFromEnv(prefix)
+	}
+}
+
+// OnConfigChange register fn to be called when ApplyConfig changes settings of the hub
+func (h *Hub) OnConfigChange(fn func(ev ConfigChange)) *Hub {
+	h.configHandlers = append(h.configHandlers, fn)
+	return h
+}
+
+// WatchConfig read src every interval and apply its changes using ApplyConfig until returned stop function is
+// called, stop function is safe to be called more than once. Configuration which could not be read or is invalid is
+// logged and the current settings are kept
+func (h *Hub) WatchConfig(src ConfigSource, every time.Duration) func() {
+	stop := make(chan bool)
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				c, err := src()
+				if err != nil {
+					h.Logger().Warn("unable to read hub config", "error", err.Error())
+					continue
+				}
+				if _, err = h.ApplyConfig(c); err != nil {
+					h.Logger().Warn("unable to apply hub config", "error", err.Error())
+				}
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(stop) }) }
+}
+
+// ApplyConfig apply settings of c which could be changed at runtime: pool size, pool timeouts, default timeout,
+// slow query threshold, read only flag and max take. Operations in flight are not interrupted, when pool size is
+// changed new operations use a new pool and the old pool is closed once its connections are released.
+// Other changed settings are reported as ignored. Change event is sent to handlers registered by OnConfigChange
+func (h *Hub) ApplyConfig(c HubConfig) (ConfigChange, error) {
+	ev := ConfigChange{Time: time.Now()}
+	if err := c.Validate(); err != nil {
+		return ev, fmt.Errorf("fail ApplyConfig: %w", err)
+	}
+
+	changed := func(setting string, from, to interface{}) bool {
+		if reflect.DeepEqual(from, to) {
+			return false
+		}
+		ev.Changes = append(ev.Changes, SettingChange{Setting: setting, Old: fmt.Sprintf("%v", from), New: fmt.Sprintf("%v", to)})
+		return true
+	}
+
+	// effective pool configuration of c, zero values are defaults
+	cur := h.PoolConfig()
+	next := HubConfig{PoolSize: c.PoolSize, PoolTimeout: c.PoolTimeout, AutoClose: c.AutoClose, AutoRelease: c.AutoRelease}
+	if next.PoolSize == 0 {
+		next.PoolSize = DefaultPoolSize
+	}
+	if next.PoolTimeout == 0 {
+		next.PoolTimeout = Duration(DefaultPoolTimeout)
+	}
+	if next.AutoClose == 0 {
+		next.AutoClose = Duration(DefaultPoolAutoClose)
+	}
+
+	h.mtx.Lock()
+	resize := h.usePool && changed("poolSize", cur.Size, next.PoolSize)
+	if changed("poolTimeout", cur.Timeout, time.Duration(next.PoolTimeout)) {
+		h.poolTimeout = time.Duration(next.PoolTimeout)
+	}
+	if changed("autoClose", cur.AutoClose, time.Duration(next.AutoClose)) {
+		h.poolAutoClose = time.Duration(next.AutoClose)
+	}
+	if changed("autoRelease", cur.AutoRelease, time.Duration(next.AutoRelease)) {
+		h.poolAutoRelease = time.Duration(next.AutoRelease)
+	}
+	if resize {
+		h.poolSize = next.PoolSize
+		if old := h.pools.pool; old != nil {
+			h.pools.pool = h.newPool()
+			h.closeRetiredPool(old)
+		}
+	} else if p := h.pools.pool; p != nil {
+		p.Timeout, p.AutoClose, p.AutoRelease = h.poolTimeout, h.poolAutoClose, h.poolAutoRelease
+	}
+	h.mtx.Unlock()
+
+	if changed("timeout", h.defaultTimeout, time.Duration(c.Timeout)) {
+		h.SetDefaultTimeout(time.Duration(c.Timeout))
+	}
+	if changed("slowQuery", h.SlowQueryThreshold(), time.Duration(c.SlowQuery)) {
+		h.SetSlowQueryThreshold(time.Duration(c.SlowQuery))
+	}
+	if changed("readOnly", h.readOnly, c.ReadOnly) {
+		h.readOnly = c.ReadOnly
+	}
+	if changed("maxTake", h.maxTake, c.MaxTake) {
+		h.SetMaxTake(c.MaxTake)
+	}
+
+	if last := h.config; last != nil {
+		ignored := []struct {
+			setting  string
+			from, to interface{}
+		}{{"uri", last.URI, c.URI}, {"noPool", last.NoPool, c.NoPool}, {"keyTag", last.KeyTag, c.KeyTag},
+			{"fieldTag", last.FieldTag, c.FieldTag}, {"eager", last.Eager, c.Eager}, {"cache", last.Cache, c.Cache}}
+		for _, s := range ignored {
+			if !reflect.DeepEqual(s.from, s.to) {
+				ev.Ignored = append(ev.Ignored, s.setting)
+			}
+		}
+	}
+	h.config = &c
+
+	if len(ev.Changes) == 0 && len(ev.Ignored) == 0 {
+		return ev, nil
+	}
+	h.Logger().Info("hub config is applied", "changes", len(ev.Changes), "ignored", len(ev.Ignored))
+	for _, fn := range h.configHandlers {
+		fn(ev)
+	}
+	return ev, nil
+}
@@ -0,0 +1,438 @@
+package datahub
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeleteReturning delete records of the model matched with where and fetch the deleted records into dest, which should
+// be pointer to slice. On drivers supporting RETURNING (see CapReturning) the records are deleted and returned by a single
+// statement. Other drivers read the records first and delete them by their keys inside a transaction when supported,
+// so records written after the read are never deleted without being returned
+func (h *Hub) DeleteReturning(model orm.DataModel, where *dbflex.Filter, dest interface{}) error {
+	model.SetThis(model)
+	tableName := model.TableName()
+	if err := h.guardWrite("delete", tableName, where); err != nil {
+		return err
+	}
+	where = h.filterToUTC(where)
+
+	if !h.Capability(CapReturning) {
+		err := h.inTx(func(ht *Hub) error {
+			return ht.deletePreRead(model, where, dest)
+		})
+		if err != nil {
+			return fmt.Errorf("fail DeleteReturning: %w", err)
+		}
+		return h.afterFetch(dest)
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	sql := "DELETE FROM " + h.table(tableName)
+	cond, err := sqlWhere(driverName(conn), where)
+	if err != nil {
+		return fmt.Errorf("fail DeleteReturning: %w", err)
+	}
+	if cond != "" {
+		sql += " WHERE " + cond
+	}
+	if err = fetchReturning(conn, sql+" RETURNING *", model, dest); err != nil {
+		return fmt.Errorf("fail DeleteReturning: %w", err)
+	}
+	if err = h.emit(conn, EventDelete, tableName, where, nil); err != nil {
+		return err
+	}
+	return h.afterFetch(dest)
+}
+
+func (h *Hub) deletePreRead(model orm.DataModel, where *dbflex.Filter, dest interface{}) error {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	keyFields, _ := model.GetID(conn)
+	if len(keyFields) == 0 {
+		return errors.New("model has no key field")
+	}
+
+	cmd := dbflex.From(h.tableOf(model)).Select()
+	if where != nil {
+		cmd.Where(where)
+	}
+	docs, err := fetchDocs(conn, cmd)
+	if err != nil {
+		return fmt.Errorf("read. %w", err)
+	}
+
+	if len(docs) > 0 {
+		keys := make([]*dbflex.Filter, len(docs))
+		for i, doc := range docs {
+			keys[i] = keyFilter(doc, keyFields)
+		}
+		if _, err = conn.Execute(dbflex.From(h.tableOf(model)).Delete().Where(dbflex.Or(keys...)), nil); err != nil {
+			return fmt.Errorf("delete. %w", err)
+		}
+		if err = h.emit(conn, EventDelete, model.TableName(), where, nil); err != nil {
+			return err
+		}
+	}
+	return decodeReturning(model, docs, dest)
+}
+
+func fetchDocs(conn dbflex.IConnection, cmd dbflex.ICommand) ([]toolkit.M, error) {
+	cur := conn.Cursor(cmd, nil)
+	if err := cur.Error(); err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+	docs := []toolkit.M{}
+	if err := cur.Fetchs(&docs, 0).Error(); err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
+
+// fetchReturning run sql having RETURNING clause and fetch the returned rows into dest
+func fetchReturning(conn dbflex.IConnection, sql string, model orm.DataModel, dest interface{}) error {
+	if _, ok := model.(tagMapped); !ok {
+		cur := conn.Cursor(dbflex.SQL(sql), nil)
+		if err := cur.Error(); err != nil {
+			return err
+		}
+		defer cur.Close()
+		return cur.Fetchs(dest, 0).Error()
+	}
+
+	docs, err := fetchDocs(conn, dbflex.SQL(sql))
+	if err != nil {
+		return err
+	}
+	return decodeReturning(model, docs, dest)
+}
+
+// decodeReturning fill dest, pointer to slice, with documents read from table of the model
+func decodeReturning(model orm.DataModel, docs []toolkit.M, dest interface{}) error {
+	if tm, ok := model.(tagMapped); ok {
+		return decodeDocs(tm, docs, dest)
+	}
+	return toolkit.Serde(docs, dest, "")
+}
+
+// UpdateReturning update fields of records matched with where using values of data, same with UpdateField, and fetch
+// the records after being updated into dest, which should be pointer to slice. All non key fields are updated when
+// fields is empty. Drivers supporting RETURNING update and return the records in one statement, on mongo each matched
+// document is updated by findAndModify returning its new state. Other drivers update the records by their keys and
+// read them back inside a transaction when supported
+func (h *Hub) UpdateReturning(data orm.DataModel, where *dbflex.Filter, fields []string, dest interface{}) error {
+	data.SetThis(data)
+	tableName := data.TableName()
+	if err := h.guardWrite("update", tableName, where); err != nil {
+		return err
+	}
+	where = h.filterToUTC(where)
+	if err := h.validate(data); err != nil {
+		return err
+	}
+
+	if !h.Capability(CapReturning) {
+		err := h.inTx(func(ht *Hub) error {
+			return ht.updatePreRead(data, where, fields, dest)
+		})
+		if err != nil {
+			return fmt.Errorf("fail UpdateReturning: %w", err)
+		}
+		return h.afterFetch(dest)
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	set := updateSet(conn, data, fields)
+	if len(set) == 0 {
+		return errors.New("fail UpdateReturning: no field to update")
+	}
+	sets := make([]string, 0, len(set))
+	for k, v := range set {
+		sets = append(sets, k+" = "+sqlLiteral(driverName(conn), v))
+	}
+	sql := "UPDATE " + h.table(tableName) + " SET " + strings.Join(sets, ", ")
+	cond, err := sqlWhere(driverName(conn), where)
+	if err != nil {
+		return fmt.Errorf("fail UpdateReturning: %w", err)
+	}
+	if cond != "" {
+		sql += " WHERE " + cond
+	}
+	if err = fetchReturning(conn, sql+" RETURNING *", data, dest); err != nil {
+		return fmt.Errorf("fail UpdateReturning: %w", err)
+	}
+	if err = h.emit(conn, EventUpdate, tableName, data, fields); err != nil {
+		return err
+	}
+	return h.afterFetch(dest)
+}
+
+// updateSet returns fields and values of data to be updated, all non key fields when fields is empty
+func updateSet(conn dbflex.IConnection, data orm.DataModel, fields []string) toolkit.M {
+	doc := modelDoc(conn, data)
+	set := toolkit.M{}
+	if len(fields) > 0 {
+		for _, f := range fields {
+			if v, ok := doc[f]; ok {
+				set[f] = v
+			}
+		}
+		return set
+	}
+
+	keyFields, _ := data.GetID(conn)
+	isKey := map[string]bool{}
+	for _, k := range keyFields {
+		isKey[k] = true
+	}
+	for k, v := range doc {
+		if !isKey[k] {
+			set[k] = v
+		}
+	}
+	return set
+}
+
+// updatePreRead read keys of records matched with where and update them by their keys. where is kept on the update
+// predicate, so record changed after the read to not match it anymore is not updated
+func (h *Hub) updatePreRead(data orm.DataModel, where *dbflex.Filter, fields []string, dest interface{}) error {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	tableName := data.TableName()
+	table := h.table(tableName)
+	keyFields, _ := data.GetID(conn)
+	if len(keyFields) == 0 {
+		return errors.New("model has no key field")
+	}
+	set := updateSet(conn, data, fields)
+	if len(set) == 0 {
+		return errors.New("no field to update")
+	}
+
+	cmd := dbflex.From(table).Select(keyFields...)
+	if where != nil {
+		cmd.Where(where)
+	}
+	matched, err := fetchDocs(conn, cmd)
+	if err != nil {
+		return fmt.Errorf("read. %w", err)
+	}
+	if len(matched) == 0 {
+		return decodeReturning(data, matched, dest)
+	}
+
+	docs := make([]toolkit.M, 0, len(matched))
+	if !isSQLDriver(conn) {
+		for _, key := range matched {
+			q, err := mongoFilter(combineFilter(keyFilter(key, keyFields), where))
+			if err != nil {
+				return err
+			}
+			command := toolkit.M{}.Set("findAndModify", table).Set("query", q).
+				Set("update", toolkit.M{"$set": set}).Set("new", true)
+			res, err := conn.Execute(dbflex.From(table).Command("runcommand", command), nil)
+			if err != nil {
+				return fmt.Errorf("update. %w", err)
+			}
+			reply := struct {
+				Value toolkit.M `json:"value" bson:"value"`
+			}{}
+			if res != nil {
+				if err = toolkit.Serde(res, &reply, ""); err != nil {
+					return fmt.Errorf("unable to decode result. %w", err)
+				}
+			}
+			if reply.Value == nil {
+				return fmt.Errorf("update. record %v does not match the filter anymore", key)
+			}
+			docs = append(docs, reply.Value)
+		}
+	} else {
+		keys := make([]*dbflex.Filter, len(matched))
+		for i, key := range matched {
+			keys[i] = keyFilter(key, keyFields)
+		}
+		setFields := make([]string, 0, len(set))
+		for k := range set {
+			setFields = append(setFields, k)
+		}
+		upd := dbflex.From(table).Update(setFields...).Where(combineFilter(dbflex.Or(keys...), where))
+		if _, err = conn.Execute(upd, toolkit.M{}.Set("data", set)); err != nil {
+			return fmt.Errorf("update. %w", err)
+		}
+		if docs, err = fetchDocs(conn, dbflex.From(table).Select().Where(dbflex.Or(keys...))); err != nil {
+			return fmt.Errorf("read. %w", err)
+		}
+	}
+
+	if err = h.emit(conn, EventUpdate, tableName, data, fields); err != nil {
+		return err
+	}
+	return decodeReturning(data, docs, dest)
+}
+
+// lastInsertID run insert statement using *sql.Tx of the transaction, or *sql.DB of the connection, and returns
+// LastInsertId of its result. Reading the id from result of the statement guarantees it is taken from the same
+// connection running the insert, which SELECT LAST_INSERT_ID() on a pooled *sql.DB does not
+func (h *Hub) lastInsertID(conn dbflex.IConnection, query string) (int64, error) {
+	typeName := "*sql.DB"
+	if h.IsTx() {
+		typeName = "*sql.Tx"
+	}
+	v := findNative(reflect.ValueOf(conn), typeName, 0)
+	if !v.IsValid() {
+		return 0, fmt.Errorf("%s of driver %s is not found. %w", typeName, driverName(conn), ErrNotSupported)
+	}
+	res, err := v.Interface().(interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	}).Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// InsertReturning insert data, same with Insert, and populate keys generated by database back into data, ie: auto
+// increment or serial ID. Key fields having zero value are left to the database: on drivers supporting RETURNING they
+// are returned by the insert statement, mysql read them from LastInsertId of the insert (single key only) and on mongo
+// ObjectID is generated before the insert the same way mongo driver does. Data need to implement SetID to receive
+// the keys
+func (h *Hub) InsertReturning(data orm.DataModel) error {
+	data.SetThis(data)
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	if err = h.applyIDGenerator(conn, data); err != nil {
+		return fmt.Errorf("unable to generate id. %w", err)
+	}
+	if err = h.applyDefaults(data); err != nil {
+		return fmt.Errorf("unable to apply default value. %w", err)
+	}
+	if err = h.validate(data); err != nil {
+		return err
+	}
+
+	keyFields, keyValues := data.GetID(conn)
+	generated := map[string]bool{}
+	for i, k := range keyFields {
+		if v := reflect.ValueOf(keyValues[i]); !v.IsValid() || v.IsZero() {
+			generated[k] = true
+		}
+	}
+	if len(generated) == 0 {
+		if err = ormInsert(conn, h.mapped(conn, data)); err != nil {
+			return err
+		}
+		if err = h.emit(conn, EventInsert, data.TableName(), data, nil); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	if !isSQLDriver(conn) {
+		for i, k := range keyFields {
+			if !generated[k] {
+				continue
+			}
+			switch keyValues[i].(type) {
+			case primitive.ObjectID:
+				keyValues[i] = primitive.NewObjectID()
+			case string:
+				keyValues[i] = primitive.NewObjectID().Hex()
+			default:
+				return fmt.Errorf("fail InsertReturning: generate %s of type %T. %w", k, keyValues[i], ErrNotSupported)
+			}
+		}
+		data.SetID(keyValues...)
+		if err = ormInsert(conn, h.mapped(conn, data)); err != nil {
+			return err
+		}
+		if err = h.emit(conn, EventInsert, data.TableName(), data, nil); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	driver := driverName(conn)
+	returning := connCapability(conn, CapReturning)
+	if !returning && !strings.Contains(driver, "mysql") {
+		return fmt.Errorf("fail InsertReturning: generated key on %s. %w", driver, ErrNotSupported)
+	}
+	if !returning && len(keyFields) > 1 {
+		return fmt.Errorf("fail InsertReturning: generated composite key on %s. %w", driver, ErrNotSupported)
+	}
+
+	if err = data.PreSave(conn); err != nil {
+		return err
+	}
+	doc := modelDoc(conn, data)
+	cols, literals := []string{}, []string{}
+	for k, v := range doc {
+		if generated[k] {
+			continue
+		}
+		cols = append(cols, k)
+		literals = append(literals, sqlLiteral(driver, v))
+	}
+	sql := "INSERT INTO " + h.tableOf(data) + " (" + strings.Join(cols, ", ") + ") VALUES (" + strings.Join(literals, ", ") + ")"
+
+	var docs []toolkit.M
+	if returning {
+		docs, err = fetchDocs(conn, dbflex.SQL(sql+" RETURNING "+strings.Join(keyFields, ", ")))
+	} else {
+		var id int64
+		if id, err = h.lastInsertID(conn, sql); err == nil {
+			docs = []toolkit.M{toolkit.M{}.Set(keyFields[0], id)}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("fail InsertReturning: %w", duplicateKey(err))
+	}
+	if len(docs) == 0 {
+		return errors.New("fail InsertReturning: generated key is not returned")
+	}
+
+	for i, k := range keyFields {
+		if generated[k] {
+			keyValues[i] = docs[0].Get(k)
+		}
+	}
+	data.SetID(keyValues...)
+	if err = data.PostSave(conn); err != nil {
+		return err
+	}
+	if err = h.emit(conn, EventInsert, data.TableName(), data, nil); err != nil {
+		return err
+	}
+	return nil
+}
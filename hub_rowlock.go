@@ -0,0 +1,134 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// LockMode row locking mode applied on select
+type LockMode string
+
+const (
+	// LockForUpdate lock selected rows exclusively until transaction ends
+	LockForUpdate LockMode = "FOR UPDATE"
+	// LockForShare lock selected rows against modification by other transaction until transaction ends
+	LockForShare LockMode = "FOR SHARE"
+)
+
+// WithLock returns copy of the hub which Get, GetByID, GetByParm and Gets lock records being read with given mode until
+// transaction ends, ie: tx.WithLock(datahub.LockForUpdate).GetByParm(data, parm). Hub need to be in transaction
+func (h *Hub) WithLock(mode LockMode) *Hub {
+	nh := h.scope()
+	nh.lockMode = mode
+	return nh
+}
+
+// GetForUpdate return single data based on its model ID and lock the record until transaction ends.
+// Hub need to be in transaction, see BeginTx
+func (h *Hub) GetForUpdate(data orm.DataModel) error {
+	return h.GetWithLock(data, LockForUpdate)
+}
+
+// GetWithLock return single data based on its model ID and lock the record with given mode
+func (h *Hub) GetWithLock(data orm.DataModel, mode LockMode) error {
+	data.SetThis(data)
+	if !h.IsTx() {
+		return errors.New("fail GetWithLock: hub is not in transaction")
+	}
+
+	where, err := keyFilterOf(h.txconn, data)
+	if err != nil {
+		return fmt.Errorf("fail GetWithLock: %w", err)
+	}
+
+	parm := dbflex.NewQueryParam().SetWhere(where).SetTake(1)
+	if err := h.fetchWithLock(data.TableName(), parm, mode, func(cur dbflex.ICursor) error {
+		return cur.Fetch(data).Error()
+	}); err != nil {
+		return fmt.Errorf("fail GetWithLock: %w", err)
+	}
+	return h.afterFetch(data)
+}
+
+func (h *Hub) getByParmWithLock(data orm.DataModel, parm *dbflex.QueryParam) error {
+	if !h.IsTx() {
+		return errors.New("fail GetByParm: hub is not in transaction")
+	}
+	p := dbflex.NewQueryParam()
+	if parm != nil {
+		cp := *parm
+		p = &cp
+	}
+	p.Take = 1
+	if err := h.fetchWithLock(data.TableName(), p, h.lockMode, func(cur dbflex.ICursor) error {
+		return cur.Fetch(data).Error()
+	}); err != nil {
+		return fmt.Errorf("fail GetByParm: %w", err)
+	}
+	return h.afterFetch(data)
+}
+
+// GetsWithLock return all data based on model and filter and lock them with given mode until transaction ends
+func (h *Hub) GetsWithLock(data orm.DataModel, parm *dbflex.QueryParam, dest interface{}, mode LockMode) error {
+	data.SetThis(data)
+	if !h.IsTx() {
+		return errors.New("fail GetsWithLock: hub is not in transaction")
+	}
+	if parm == nil {
+		parm = dbflex.NewQueryParam()
+	}
+
+	if err := h.fetchWithLock(data.TableName(), parm, mode, func(cur dbflex.ICursor) error {
+		return cur.Fetchs(dest, 0).Error()
+	}); err != nil {
+		return fmt.Errorf("fail GetsWithLock: %w", err)
+	}
+	return h.afterFetch(dest)
+}
+
+// fetchWithLock run select with row lock clause on SQL drivers. For other drivers (ie: mongo) it is a normal
+// read inside transaction, write conflict on the same documents will be detected by the database on commit
+func (h *Hub) fetchWithLock(tableName string, parm *dbflex.QueryParam, mode LockMode, fn func(dbflex.ICursor) error) error {
+	conn := h.txconn
+
+	var cmd dbflex.ICommand
+	if isSQLDriver(conn) {
+		sql, err := sqlSelect(driverName(conn), h.table(tableName), parm)
+		if err != nil {
+			return err
+		}
+		if mode != "" {
+			sql += " " + string(mode)
+		}
+		cmd = dbflex.SQL(sql)
+	} else {
+		cmd = dbflex.From(h.table(tableName))
+		if len(parm.Select) == 0 {
+			cmd.Select()
+		} else {
+			cmd.Select(parm.Select...)
+		}
+		if parm.Where != nil {
+			cmd.Where(parm.Where)
+		}
+		if len(parm.Sort) > 0 {
+			cmd.OrderBy(parm.Sort...)
+		}
+		if parm.Skip > 0 {
+			cmd.Skip(parm.Skip)
+		}
+		if parm.Take > 0 {
+			cmd.Take(parm.Take)
+		}
+	}
+
+	cur := conn.Cursor(cmd, nil)
+	if err := cur.Error(); err != nil {
+		return err
+	}
+	defer cur.Close()
+	return fn(cur)
+}
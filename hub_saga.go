@@ -0,0 +1,232 @@
+package datahub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// DefaultSagaTableName is name of table used to keep saga states when no name is set via SetSagaTableName
+const DefaultSagaTableName = "DatahubSagas"
+
+// Status of a saga
+const (
+	SagaRunning      = "running"
+	SagaCompleted    = "completed"
+	SagaCompensating = "compensating"
+	SagaCompensated  = "compensated"
+)
+
+// SagaRecord is state of a saga persisted on saga table. Step is number of completed steps while the saga is running,
+// and number of steps still to be compensated while it is compensating
+type SagaRecord struct {
+	ID      string    `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	Name    string    `bson:"name" json:"name" sqlname:"name"`
+	Status  string    `bson:"status" json:"status" sqlname:"status"`
+	Step    int       `bson:"step" json:"step" sqlname:"step"`
+	Data    string    `bson:"data" json:"data" sqlname:"data"`
+	Error   string    `bson:"error" json:"error" sqlname:"error"`
+	Created time.Time `bson:"created" json:"created" sqlname:"created"`
+	Updated time.Time `bson:"updated" json:"updated" sqlname:"updated"`
+}
+
+// SagaContext is passed to steps of a saga. Hub is transactional when driver support transaction, write using it so
+// the write, its outbox events and progress of the saga are committed together. Data is persisted along with the
+// saga, so values set by a step are available to next steps and compensations, also after the saga is resumed
+type SagaContext struct {
+	Hub  *Hub
+	ID   string
+	Data toolkit.M
+}
+
+// SagaFunc is action or compensation of a saga step
+type SagaFunc func(ctx *SagaContext) error
+
+type sagaStep struct {
+	do, compensate SagaFunc
+}
+
+// Saga is definition of a workflow made of steps, each step has an action and its compensation. When an action fails
+// compensations of completed steps are run in reverse order. State of each run is persisted, so runs interrupted by
+// crash are continued by Resume
+type Saga struct {
+	h     *Hub
+	name  string
+	steps []sagaStep
+}
+
+// SetSagaTableName set name of table used to store saga states
+func (h *Hub) SetSagaTableName(name string) *Hub {
+	h.sagaTableName = name
+	return h
+}
+
+// SagaTableName returns name of table used to store saga states
+func (h *Hub) SagaTableName() string {
+	if h.sagaTableName == "" {
+		return DefaultSagaTableName
+	}
+	return h.sagaTableName
+}
+
+// NewSaga create saga definition, name identifies the saga on saga table so it should be unique
+func (h *Hub) NewSaga(name string) *Saga {
+	return &Saga{h: h, name: name}
+}
+
+// Step add a step to the saga, compensate could be nil for step that does not need to be undone
+func (s *Saga) Step(do, compensate SagaFunc) *Saga {
+	s.steps = append(s.steps, sagaStep{do: do, compensate: compensate})
+	return s
+}
+
+// Run run the saga with given id, id should be unique for each run, ie: order id. Running id which is already
+// completed or compensated does nothing, id which is still in progress is continued. When a step fails the saga is
+// compensated and the step error is returned
+func (s *Saga) Run(id string, data toolkit.M) error {
+	if id == "" {
+		return errors.New("fail Saga.Run: id is mandatory")
+	}
+	rec, err := s.load(id)
+	if err != nil {
+		return fmt.Errorf("fail Saga.Run: %w", err)
+	}
+	if rec == nil {
+		if data == nil {
+			data = toolkit.M{}
+		}
+		bs, _ := json.Marshal(data)
+		now := time.Now()
+		rec = &SagaRecord{ID: id, Name: s.name, Status: SagaRunning, Data: string(bs), Created: now, Updated: now}
+		if err = s.h.SaveAny(s.h.SagaTableName(), rec); err != nil {
+			return fmt.Errorf("fail Saga.Run: %w", err)
+		}
+	}
+	return s.run(rec)
+}
+
+// Resume continue runs of the saga which are still running or compensating, ie: on startup after crash.
+// It returns number of resumed runs and the last error
+func (s *Saga) Resume() (int, error) {
+	recs := []SagaRecord{}
+	where := dbflex.And(dbflex.Eq("name", s.name), dbflex.In("status", SagaRunning, SagaCompensating))
+	if err := s.h.internal().PopulateByParm(s.h.SagaTableName(), dbflex.NewQueryParam().SetWhere(where), &recs); err != nil {
+		return 0, fmt.Errorf("fail Saga.Resume: %w", err)
+	}
+	var lastErr error
+	for i := range recs {
+		if err := s.run(&recs[i]); err != nil {
+			lastErr = err
+		}
+	}
+	return len(recs), lastErr
+}
+
+func (s *Saga) load(id string) (*SagaRecord, error) {
+	err := s.h.Native(func(conn dbflex.IConnection) error {
+		tableName := s.h.table(s.h.SagaTableName())
+		if conn.HasTable(tableName) {
+			return nil
+		}
+		return conn.EnsureTable(tableName, []string{"_id"}, new(SagaRecord))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recs := []SagaRecord{}
+	parm := dbflex.NewQueryParam().SetWhere(dbflex.Eq("_id", id)).SetTake(1)
+	if err = s.h.internal().PopulateByParm(s.h.SagaTableName(), parm, &recs); err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, nil
+	}
+	return &recs[0], nil
+}
+
+func (s *Saga) run(rec *SagaRecord) error {
+	data := toolkit.M{}
+	if rec.Data != "" {
+		if err := json.Unmarshal([]byte(rec.Data), &data); err != nil {
+			return fmt.Errorf("fail saga %s %s: invalid data. %w", s.name, rec.ID, err)
+		}
+	}
+
+	var stepErr error
+	for rec.Status == SagaRunning && rec.Step < len(s.steps) {
+		i := rec.Step
+		err := s.h.inTx(func(ht *Hub) error {
+			ctx := &SagaContext{Hub: ht, ID: rec.ID, Data: data}
+			if err := s.steps[i].do(ctx); err != nil {
+				return err
+			}
+			next := *rec
+			next.Step = i + 1
+			if next.Step == len(s.steps) {
+				next.Status = SagaCompleted
+			}
+			if err := s.save(ht, &next, ctx.Data); err != nil {
+				return err
+			}
+			*rec = next
+			return nil
+		})
+		if err != nil {
+			stepErr = fmt.Errorf("fail saga %s %s: step %d. %w", s.name, rec.ID, i+1, err)
+			rec.Status, rec.Error = SagaCompensating, err.Error()
+			if err = s.save(s.h, rec, data); err != nil {
+				return fmt.Errorf("%w. unable to save state. %s", stepErr, err.Error())
+			}
+		}
+	}
+	if rec.Status == SagaRunning {
+		rec.Status = SagaCompleted
+		return s.save(s.h, rec, data)
+	}
+
+	for rec.Status == SagaCompensating {
+		if rec.Step == 0 {
+			rec.Status = SagaCompensated
+			if err := s.save(s.h, rec, data); err != nil {
+				return err
+			}
+			break
+		}
+		i := rec.Step - 1
+		err := s.h.inTx(func(ht *Hub) error {
+			ctx := &SagaContext{Hub: ht, ID: rec.ID, Data: data}
+			if fn := s.steps[i].compensate; fn != nil {
+				if err := fn(ctx); err != nil {
+					return err
+				}
+			}
+			next := *rec
+			next.Step = i
+			if err := s.save(ht, &next, ctx.Data); err != nil {
+				return err
+			}
+			*rec = next
+			return nil
+		})
+		if err != nil {
+			// saga is kept compensating so compensation is retried by Resume
+			return fmt.Errorf("fail saga %s %s: compensate step %d. %w", s.name, rec.ID, i+1, err)
+		}
+	}
+	return stepErr
+}
+
+func (s *Saga) save(h *Hub, rec *SagaRecord, data toolkit.M) error {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	rec.Data = string(bs)
+	rec.Updated = time.Now()
+	return h.SaveAny(h.SagaTableName(), rec)
+}
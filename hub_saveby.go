@@ -0,0 +1,96 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// SaveBy save data using keyFields, ie: email or external_id, to find existing record instead of key of the model.
+// keyFields could be struct field names or database field names. When a record is matched, key of the model is taken
+// from the record and the record is updated, otherwise data is inserted. Without keyFields it is the same with Save.
+// Matching and writing are separate statements, use unique index on keyFields or run it inside transaction
+// to avoid duplicate on concurrent call
+func (h *Hub) SaveBy(data orm.DataModel, keyFields ...string) error {
+	if len(keyFields) == 0 {
+		return h.Save(data)
+	}
+
+	data.SetThis(data)
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	doc := modelDoc(conn, data)
+	tag := conn.FieldNameTag()
+	if ct, ok := data.(interface{ columnTag() string }); ok {
+		tag = ct.columnTag()
+	}
+	meta := MetaOf(data)
+	names := make([]string, len(keyFields))
+	for i, name := range keyFields {
+		if _, ok := doc[name]; !ok && meta != nil {
+			if f := meta.Field(name); f != nil {
+				name = f.DbName(tag)
+			}
+		}
+		if _, ok := doc[name]; !ok {
+			return fmt.Errorf("fail SaveBy: field %s is not found", keyFields[i])
+		}
+		names[i] = name
+	}
+
+	idFields, _ := data.GetID(conn)
+	if len(idFields) == 0 {
+		return errors.New("fail SaveBy: model has no key field")
+	}
+	cmd := dbflex.From(h.tableOf(data)).Select(idFields...).Where(keyFilter(doc, names)).Take(1)
+	cur := conn.Cursor(cmd, nil)
+	if err = cur.Error(); err != nil {
+		return fmt.Errorf("fail SaveBy: %w", err)
+	}
+	found := []toolkit.M{}
+	if err = cur.Fetchs(&found, 0).Close(); err != nil {
+		return fmt.Errorf("fail SaveBy: %w", err)
+	}
+
+	if len(found) == 0 {
+		if err = h.applyIDGenerator(conn, data); err != nil {
+			return fmt.Errorf("unable to generate id. %w", err)
+		}
+		if err = h.applyDefaults(data); err != nil {
+			return fmt.Errorf("unable to apply default value. %w", err)
+		}
+		if err = h.validate(data); err != nil {
+			return err
+		}
+		if err = ormInsert(conn, h.mapped(conn, data)); err != nil {
+			return err
+		}
+		if err = h.emit(conn, EventSave, data.TableName(), data, nil); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	ids := make([]interface{}, len(idFields))
+	for i, f := range idFields {
+		ids[i] = found[0].Get(f)
+	}
+	data.SetID(ids...)
+	if err = h.validate(data); err != nil {
+		return err
+	}
+	if err = ormUpdate(conn, h.mapped(conn, data)); err != nil {
+		return err
+	}
+	if err = h.emit(conn, EventSave, data.TableName(), data, nil); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package datahub
+
+import (
+	"fmt"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// ScopeFunc returns filter fragment of a named scope, args are arguments written on the scope name, ie: visibleTo(u01)
+type ScopeFunc func(args ...string) (*dbflex.Filter, error)
+
+// RegisterScope register named scope, so common filter fragment is defined once and applied by WithScopes.
+// Scopes are shared with hubs created from this hub, register them before the hub is used
+func (h *Hub) RegisterScope(name string, fn ScopeFunc) *Hub {
+	if h.scopes == nil {
+		h.scopes = map[string]ScopeFunc{}
+	}
+	h.scopes[strings.ToLower(name)] = fn
+	return h
+}
+
+// WithScopes returns copy of parm which filter is combined using and with filters of given scopes.
+// Scope is written as its name, or name followed by comma separated arguments in parentheses, ie: "active", "visibleTo(u01)"
+func (h *Hub) WithScopes(parm *dbflex.QueryParam, scopes ...string) (*dbflex.QueryParam, error) {
+	if parm == nil {
+		parm = dbflex.NewQueryParam()
+	}
+	filters := []*dbflex.Filter{parm.Where}
+	for _, s := range scopes {
+		name, args, err := parseScope(s)
+		if err != nil {
+			return nil, fmt.Errorf("fail WithScopes: %w", err)
+		}
+		fn, ok := h.scopes[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("fail WithScopes: scope %s is not registered", name)
+		}
+		f, err := fn(args...)
+		if err != nil {
+			return nil, fmt.Errorf("fail WithScopes: scope %s. %w", name, err)
+		}
+		filters = append(filters, f)
+	}
+
+	p := *parm
+	p.Where = combineFilter(filters...)
+	return &p, nil
+}
+
+func parseScope(s string) (string, []string, error) {
+	s = strings.TrimSpace(s)
+	open := strings.Index(s, "(")
+	if open < 0 {
+		if s == "" {
+			return "", nil, fmt.Errorf("scope name is mandatory")
+		}
+		return s, nil, nil
+	}
+	if !strings.HasSuffix(s, ")") {
+		return "", nil, fmt.Errorf("invalid scope %s", s)
+	}
+
+	name := strings.TrimSpace(s[:open])
+	inner := strings.TrimSpace(s[open+1 : len(s)-1])
+	if inner == "" {
+		return name, nil, nil
+	}
+	args := strings.Split(inner, ",")
+	for i, a := range args {
+		args[i] = strings.Trim(strings.TrimSpace(a), `'"`)
+	}
+	return name, args, nil
+}
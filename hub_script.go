@@ -0,0 +1,222 @@
+package datahub
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// ScriptOptions control how ExecScript run the statements
+type ScriptOptions struct {
+	// InTransaction run all statements in single transaction, rollback when any of them is failed
+	InTransaction bool
+
+	// ContinueOnError keep running next statements when a statement is failed. Ignored when InTransaction is true
+	ContinueOnError bool
+}
+
+// ScriptError is error of a statement on the script
+type ScriptError struct {
+	Index     int
+	Statement string
+	Err       error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("statement %d: %s", e.Index+1, e.Err.Error())
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// ExecScript split script into statements and execute them sequentially using connection of the hub.
+// It returns number of successfully executed statements. Context is checked before each statement
+func (h *Hub) ExecScript(ctx context.Context, script string, opts ScriptOptions) (int, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	statements := SplitStatements(script)
+	if len(statements) == 0 {
+		return 0, nil
+	}
+
+	target := h
+	if opts.InTransaction && !h.IsTx() {
+		ht, err := h.BeginTx()
+		if err != nil {
+			return 0, fmt.Errorf("fail ExecScript: %w", err)
+		}
+		target = ht
+	}
+
+	idx, conn, err := target.getConn()
+	if err != nil {
+		if target != h {
+			target.Rollback()
+		}
+		return 0, &ConnectionError{Err: err}
+	}
+	// connection of the transaction is closed by Commit or Rollback
+	if target == h {
+		defer h.closeConn(idx, conn)
+	}
+
+	executed := 0
+	errs := []string{}
+	for i, stmt := range statements {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+
+		if _, e := conn.Execute(dbflex.SQL(stmt), nil); e != nil {
+			err = &ScriptError{Index: i, Statement: stmt, Err: e}
+			if opts.ContinueOnError && !opts.InTransaction {
+				errs = append(errs, err.Error())
+				err = nil
+				continue
+			}
+			break
+		}
+		executed++
+	}
+
+	if target != h {
+		if err != nil {
+			target.Rollback()
+			return 0, fmt.Errorf("fail ExecScript: %w", err)
+		}
+		if err = target.Commit(); err != nil {
+			return 0, fmt.Errorf("fail ExecScript: %w", err)
+		}
+	}
+
+	if err != nil {
+		return executed, fmt.Errorf("fail ExecScript: %w", err)
+	}
+	if len(errs) > 0 {
+		return executed, fmt.Errorf("fail ExecScript: %s", strings.Join(errs, "; "))
+	}
+	return executed, nil
+}
+
+// SplitStatements split script into statements separated by semicolon. Semicolon inside quoted string,
+// quoted identifier, comment and postgres dollar quoted block is not treated as separator. Statements that are
+// empty or only contain comments are removed
+func SplitStatements(script string) []string {
+	statements := []string{}
+	current := strings.Builder{}
+	hasCode := false
+	flush := func() {
+		if s := strings.TrimSpace(current.String()); s != "" && hasCode {
+			statements = append(statements, s)
+		}
+		current.Reset()
+		hasCode = false
+	}
+
+	runes := []rune(script)
+	n := len(runes)
+	for i := 0; i < n; i++ {
+		c := runes[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// quoted string or identifier, doubled quote is escaped quote
+			end := i + 1
+			for ; end < n; end++ {
+				if runes[end] == c {
+					if end+1 < n && runes[end+1] == c {
+						end++
+						continue
+					}
+					break
+				}
+			}
+			end = minInt(end+1, n)
+			current.WriteString(string(runes[i:end]))
+			hasCode = true
+			i = end - 1
+
+		case c == '-' && i+1 < n && runes[i+1] == '-':
+			end := i
+			for end < n && runes[end] != '\n' {
+				end++
+			}
+			current.WriteString(string(runes[i:end]))
+			i = end - 1
+
+		case c == '/' && i+1 < n && runes[i+1] == '*':
+			end := indexRunes(runes, i+2, []rune("*/"))
+			end = minInt(end+2, n)
+			if end < i+2 {
+				end = n
+			}
+			current.WriteString(string(runes[i:end]))
+			i = end - 1
+
+		case c == '$':
+			// postgres dollar quote, ie: $$ ... $$ or $tag$ ... $tag$
+			j := i + 1
+			for j < n && (runes[j] == '_' || isAlnum(runes[j])) {
+				j++
+			}
+			if j >= n || runes[j] != '$' {
+				current.WriteRune(c)
+				hasCode = true
+				continue
+			}
+			tag := runes[i : j+1]
+			end := indexRunes(runes, j+1, tag)
+			if end < 0 {
+				end = n
+			} else {
+				end = minInt(end+len(tag), n)
+			}
+			current.WriteString(string(runes[i:end]))
+			hasCode = true
+			i = end - 1
+
+		case c == ';':
+			flush()
+
+		default:
+			current.WriteRune(c)
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				hasCode = true
+			}
+		}
+	}
+	flush()
+	return statements
+}
+
+// indexRunes returns index of sub on runes starting from given index, -1 if not found
+func indexRunes(runes []rune, from int, sub []rune) int {
+	for i := from; i+len(sub) <= len(runes); i++ {
+		match := true
+		for j := range sub {
+			if runes[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func isAlnum(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
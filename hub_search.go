@@ -0,0 +1,223 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// GetsSearch return all data based on model and filter which contains given text on one of the fields.
+// Search is translated based on driver: $text on mongo (fields are defined by text index of the collection),
+// tsvector on postgres and case insensitive LIKE on other SQL drivers
+func (h *Hub) GetsSearch(data orm.DataModel, parm *dbflex.QueryParam, text string, fields []string, dest interface{}) error {
+	data.SetThis(data)
+	if parm == nil {
+		parm = dbflex.NewQueryParam()
+	}
+	if strings.TrimSpace(text) == "" {
+		return h.Gets(data, parm, dest)
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	if !isSQLDriver(conn) {
+		match := toolkit.M{"$text": toolkit.M{"$search": text}}
+		if parm.Where != nil {
+			where, err := mongoFilter(parm.Where)
+			if err != nil {
+				return fmt.Errorf("fail GetsSearch: %w", err)
+			}
+			match = toolkit.M{"$and": []toolkit.M{match, where}}
+		}
+		p := NewPipeline().Stage(toolkit.M{"$match": match}).Sort(parm.Sort...).Project(parm.Select...)
+		if parm.Skip > 0 {
+			p.Skip(parm.Skip)
+		}
+		if parm.Take > 0 {
+			p.Limit(parm.Take)
+		}
+		stages, _ := p.Build()
+		cur := conn.Cursor(dbflex.From(h.tableOf(data)).Command("pipe", stages), nil)
+		if err = cur.Error(); err != nil {
+			return fmt.Errorf("fail GetsSearch: %w", err)
+		}
+		defer cur.Close()
+		if err = cur.Fetchs(dest, 0).Error(); err != nil {
+			return err
+		}
+		return h.afterFetch(dest)
+	}
+
+	if len(fields) == 0 {
+		return errors.New("fail GetsSearch: search fields are mandatory for SQL driver")
+	}
+
+	sql, err := sqlSelectExtra(driverName(conn), h.tableOf(data), parm, sqlSearch(driverName(conn), text, fields))
+	if err != nil {
+		return fmt.Errorf("fail GetsSearch: %w", err)
+	}
+	cur := conn.Cursor(dbflex.SQL(sql), nil)
+	if err = cur.Error(); err != nil {
+		return fmt.Errorf("fail GetsSearch: %w", err)
+	}
+	defer cur.Close()
+	if err = cur.Fetchs(dest, 0).Error(); err != nil {
+		return err
+	}
+	return h.afterFetch(dest)
+}
+
+// sqlSearch build full text search condition based on driver
+func sqlSearch(driver, text string, fields []string) string {
+	if strings.Contains(driver, "pg") || strings.Contains(driver, "postgres") {
+		docs := make([]string, len(fields))
+		for i, f := range fields {
+			docs[i] = "coalesce(" + f + "::text, '')"
+		}
+		return "to_tsvector(" + strings.Join(docs, " || ' ' || ") + ") @@ plainto_tsquery(" + sqlLiteral(driver, text) + ")"
+	}
+
+	like := sqlLiteral(driver, "%"+strings.ToLower(text)+"%")
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = "LOWER(" + f + ") LIKE " + like
+	}
+	return strings.Join(parts, " OR ")
+}
+
+// DefaultSearchPageSize is page size used by Search when request has no page size
+var DefaultSearchPageSize = 20
+
+// SearchRequest is standard request of list endpoints
+type SearchRequest struct {
+	// Filters is mongo like filter document, see FilterFromM
+	Filters toolkit.M `json:"filters,omitempty"`
+	// Keyword is text searched on keyword fields given to Search, case insensitive
+	Keyword string `json:"keyword,omitempty"`
+	// Sort fields, prefix field with - for descending sort
+	Sort []string `json:"sort,omitempty"`
+	// Page number starting from 1
+	Page int `json:"page,omitempty"`
+	// PageSize is number of records per page, default is DefaultSearchPageSize
+	PageSize int `json:"pageSize,omitempty"`
+}
+
+// SearchResponse is standard response of list endpoints
+type SearchResponse struct {
+	Data       interface{} `json:"data"`
+	Total      int         `json:"total"`
+	Page       int         `json:"page"`
+	PageSize   int         `json:"pageSize"`
+	TotalPages int         `json:"totalPages"`
+	HasNext    bool        `json:"hasNext"`
+}
+
+// Search fetch a page of the model records matched with the request into dest, which should be pointer to slice,
+// and returns it with paging metadata. Keyword is matched using contains on keywordFields, keyword is ignored when
+// keywordFields is empty, so fields being searched are decided by the service instead of the caller. Fields of
+// filters and sort should be fields of the model, request using other field is rejected
+func (h *Hub) Search(data orm.DataModel, req SearchRequest, dest interface{}, keywordFields ...string) (SearchResponse, error) {
+	res := SearchResponse{Page: req.Page, PageSize: req.PageSize}
+	if res.Page < 1 {
+		res.Page = 1
+	}
+	if res.PageSize <= 0 {
+		res.PageSize = DefaultSearchPageSize
+	}
+	if h.maxTake > 0 && res.PageSize > h.maxTake {
+		res.PageSize = h.maxTake
+	}
+
+	var where *dbflex.Filter
+	if len(req.Filters) > 0 {
+		f, err := FilterFromM(req.Filters)
+		if err != nil {
+			return res, fmt.Errorf("fail Search: invalid filters. %w", err)
+		}
+		where = f
+	}
+	if err := checkSearchFields(data, where, req.Sort); err != nil {
+		return res, fmt.Errorf("fail Search: %w", err)
+	}
+	if keyword := strings.TrimSpace(req.Keyword); keyword != "" && len(keywordFields) > 0 {
+		items := make([]*dbflex.Filter, len(keywordFields))
+		for i, f := range keywordFields {
+			items[i] = dbflex.Contains(f, keyword)
+		}
+		where = combineFilter(where, dbflex.Or(items...))
+	}
+
+	parm := dbflex.NewQueryParam().SetSkip((res.Page - 1) * res.PageSize).SetTake(res.PageSize)
+	if where != nil {
+		parm.SetWhere(where)
+	}
+	if len(req.Sort) > 0 {
+		parm.SetSort(req.Sort...)
+	}
+
+	total, err := h.Count(data, dbflex.NewQueryParam().SetWhere(where))
+	if err != nil {
+		return res, fmt.Errorf("fail Search: %w", err)
+	}
+	if err = h.Gets(data, parm, dest); err != nil {
+		return res, fmt.Errorf("fail Search: %w", err)
+	}
+
+	res.Total = total
+	res.TotalPages = (total + res.PageSize - 1) / res.PageSize
+	res.HasNext = res.Page < res.TotalPages
+	res.Data = reflect.ValueOf(dest).Elem().Interface()
+	return res, nil
+}
+
+// checkSearchFields validate fields of filter and sort of search request against metadata of the model, nested
+// field (a.b) is validated by its first part
+func checkSearchFields(data orm.DataModel, where *dbflex.Filter, sort []string) error {
+	var model interface{} = data
+	if tm, ok := data.(tagMapped); ok {
+		model = tm.record()
+	}
+	meta := MetaOf(model)
+	if meta == nil {
+		return nil
+	}
+
+	check := func(field string) error {
+		if meta.Field(strings.Split(field, ".")[0]) == nil {
+			return fmt.Errorf("field %s is not found on %s", field, meta.Type.Name())
+		}
+		return nil
+	}
+	for _, s := range sort {
+		if err := check(strings.TrimPrefix(s, "-")); err != nil {
+			return err
+		}
+	}
+
+	var walk func(f *dbflex.Filter) error
+	walk = func(f *dbflex.Filter) error {
+		if f == nil {
+			return nil
+		}
+		switch f.Op {
+		case dbflex.OpAnd, dbflex.OpOr, dbflex.OpNot:
+			for _, item := range f.Items {
+				if err := walk(item); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		return check(f.Field)
+	}
+	return walk(where)
+}
@@ -0,0 +1,232 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// DefaultSequenceTableName is name of table used to keep sequence counters when no name is set via SetSequenceTableName
+const DefaultSequenceTableName = "DatahubSequences"
+
+// SequenceRecord is the record persisted on sequence table for each sequence
+type SequenceRecord struct {
+	ID    string `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	Value int64  `bson:"value" json:"value" sqlname:"value"`
+	Stamp string `bson:"stamp" json:"stamp" sqlname:"stamp"`
+}
+
+// Sequence define behaviour of a sequence.
+// BlockSize is number of values reserved from database at once, values of a block is given from memory, higher
+// block size means less roundtrip to database with possibility of gap on the number when process is restarted.
+// Format is used by NextNumber to format the value, it support following placeholders:
+// {yyyy} {yy} {mm} {dd} for current date and {n} or {n:6} for value with optional zero padding, ie: INV-{yyyy}-{n:6}
+type Sequence struct {
+	Name      string
+	BlockSize int
+	Format    string
+}
+
+type sequenceState struct {
+	Sequence
+	next int64
+	max  int64
+
+	// mtx guard next and max, it is held while a block is allocated so hub mutex is not held during the roundtrip
+	mtx sync.Mutex
+}
+
+var sequenceNumberRx = regexp.MustCompile(`\{n(:(\d+))?\}`)
+
+// SetSequenceTableName set name of table used to store sequences
+func (h *Hub) SetSequenceTableName(name string) *Hub {
+	h.sequenceTableName = name
+	return h
+}
+
+// SequenceTableName returns name of table used to store sequences
+func (h *Hub) SequenceTableName() string {
+	if h.sequenceTableName == "" {
+		return DefaultSequenceTableName
+	}
+	return h.sequenceTableName
+}
+
+// RegisterSequence register sequence setting. Sequence that is not registered will use block size 1 and format {n}
+func (h *Hub) RegisterSequence(seq Sequence) *Hub {
+	if seq.BlockSize <= 0 {
+		seq.BlockSize = 1
+	}
+	h.seqMtx().Lock()
+	defer h.seqMtx().Unlock()
+	if h.sequences == nil {
+		h.sequences = map[string]*sequenceState{}
+	}
+	if st, ok := h.sequences[seq.Name]; ok {
+		st.mtx.Lock()
+		st.Sequence = seq
+		st.mtx.Unlock()
+	} else {
+		h.sequences[seq.Name] = &sequenceState{Sequence: seq}
+	}
+	return h
+}
+
+// NextVal returns next value of given sequence. Sequence will be created automatically if it is not exist yet.
+// New block is allocated outside of transaction of the hub, so value is never given twice even when the
+// transaction is rolled back
+func (h *Hub) NextVal(name string) (int64, error) {
+	if name == "" {
+		return 0, errors.New("fail NextVal: sequence name is mandatory")
+	}
+
+	h.seqMtx().Lock()
+	if h.sequences == nil {
+		h.sequences = map[string]*sequenceState{}
+	}
+	st, ok := h.sequences[name]
+	if !ok {
+		st = &sequenceState{Sequence: Sequence{Name: name, BlockSize: 1}}
+		h.sequences[name] = st
+	}
+	h.seqMtx().Unlock()
+
+	st.mtx.Lock()
+	defer st.mtx.Unlock()
+	if st.next == 0 || st.next > st.max {
+		last, err := h.allocateSequence(name, int64(st.BlockSize))
+		if err != nil {
+			return 0, fmt.Errorf("fail NextVal: %w", err)
+		}
+		st.next = last - int64(st.BlockSize) + 1
+		st.max = last
+	}
+
+	v := st.next
+	st.next++
+	return v, nil
+}
+
+// NextNumber returns next value of given sequence formatted using format of the sequence
+func (h *Hub) NextNumber(name string) (string, error) {
+	v, err := h.NextVal(name)
+	if err != nil {
+		return "", err
+	}
+
+	format := "{n}"
+	h.seqMtx().Lock()
+	st := h.sequences[name]
+	h.seqMtx().Unlock()
+	if st != nil {
+		st.mtx.Lock()
+		if st.Format != "" {
+			format = st.Format
+		}
+		st.mtx.Unlock()
+	}
+
+	return FormatSequence(format, v, time.Now()), nil
+}
+
+// FormatSequence format sequence value using format, see Sequence for supported placeholders
+func FormatSequence(format string, v int64, dt time.Time) string {
+	res := strings.NewReplacer(
+		"{yyyy}", dt.Format("2006"),
+		"{yy}", dt.Format("06"),
+		"{mm}", dt.Format("01"),
+		"{dd}", dt.Format("02"),
+	).Replace(format)
+
+	return sequenceNumberRx.ReplaceAllStringFunc(res, func(s string) string {
+		m := sequenceNumberRx.FindStringSubmatch(s)
+		width, _ := strconv.Atoi(m[2])
+		return fmt.Sprintf("%0*d", width, v)
+	})
+}
+
+func (h *Hub) seqMtx() *sync.Mutex {
+	if h.sequenceMtx == nil {
+		h.sequenceMtx = new(sync.Mutex)
+	}
+	return h.sequenceMtx
+}
+
+// allocateSequence reserve count number of values and returns last value of the reserved block.
+// It is using compare and swap on current value, so it is safe to be called by multiple processes at the same time.
+// Connection is opened directly instead of taken from the hub, so the block is not part of transaction of the hub
+// and caller holding the last connection of the pool, ie: while applying defaults, does not wait for another one
+func (h *Hub) allocateSequence(name string, count int64) (int64, error) {
+	conn, err := h.connect()
+	if err != nil {
+		return 0, &ConnectionError{Err: err}
+	}
+	defer conn.Close()
+
+	tableName := h.table(h.SequenceTableName())
+	if !conn.HasTable(tableName) {
+		if err = conn.EnsureTable(tableName, []string{"_id"}, new(SequenceRecord)); err != nil {
+			return 0, fmt.Errorf("unable to prepare sequence table. %w", err)
+		}
+	}
+
+	for attempt := 0; attempt < 100; attempt++ {
+		current, err := getSequenceRecord(conn, tableName, name)
+		if err != nil {
+			return 0, err
+		}
+
+		rec := &SequenceRecord{ID: name, Value: count, Stamp: toolkit.RandomString(32)}
+		if current == nil {
+			if _, err = conn.Execute(dbflex.From(tableName).Insert(), toolkit.M{}.Set("data", rec)); err != nil {
+				// other process might create the same sequence at the same time, read it again
+				if err = duplicateKey(err); errors.Is(err, ErrDuplicateKey) {
+					continue
+				}
+				return 0, err
+			}
+			return rec.Value, nil
+		}
+
+		rec.Value = current.Value + count
+		cmd := dbflex.From(tableName).Update("value", "stamp").
+			Where(dbflex.And(dbflex.Eq("_id", name), dbflex.Eq("value", current.Value)))
+		if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", rec)); err != nil {
+			return 0, err
+		}
+
+		saved, err := getSequenceRecord(conn, tableName, name)
+		if err != nil {
+			return 0, err
+		}
+		if saved != nil && saved.Stamp == rec.Stamp {
+			return rec.Value, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unable to allocate sequence %s, too many concurrent update", name)
+}
+
+func getSequenceRecord(conn dbflex.IConnection, tableName, name string) (*SequenceRecord, error) {
+	cur := conn.Cursor(dbflex.From(tableName).Select().Where(dbflex.Eq("_id", name)), nil)
+	if err := cur.Error(); err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+
+	recs := []*SequenceRecord{}
+	if err := cur.Fetchs(&recs, 1).Error(); err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, nil
+	}
+	return recs[0], nil
+}
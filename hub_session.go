@@ -0,0 +1,92 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// ErrSessionClosed is returned by operations of session hub after the session is closed
+var ErrSessionClosed = errors.New("session is closed")
+
+// hubSession is connection pinned by Session, it is shared by hubs created from the session hub
+type hubSession struct {
+	mtx    sync.Mutex
+	owner  *Hub
+	idx    int
+	conn   dbflex.IConnection
+	closed bool
+}
+
+// Session returns hub which operations use the same connection until Close is called, ie: to use temporary tables,
+// session variables or read own writes on Mongo. The connection is taken from the pool and counted by concurrency
+// limit for the whole session, so session should be kept short and always closed. BeginTx of session hub starts the
+// transaction on the pinned connection. Session hub should not be used by multiple goroutines at the same time
+func (h *Hub) Session() (*Hub, error) {
+	if h.txconn != nil {
+		return nil, errors.New("fail Session: hub already has dedicated connection")
+	}
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return nil, fmt.Errorf("fail Session: %w", &ConnectionError{Err: err})
+	}
+	// deadline is applied per operation, not to the whole session
+	if dc, ok := conn.(*deadlineConn); ok {
+		conn = dc.IConnection
+	}
+
+	nh := h.scope()
+	nh.session = &hubSession{owner: h, idx: idx, conn: conn}
+	nh.txconn = conn
+	nh.txEvents = nil
+	return nh, nil
+}
+
+func (h *Hub) beginSessionTx() (*Hub, error) {
+	conn := h.session.conn
+	if h.session.isClosed() {
+		return nil, fmt.Errorf("fail BeginTransaction: %w", ErrSessionClosed)
+	}
+	if conn.IsTx() {
+		return nil, errors.New("fail BeginTransaction: session is already in transaction")
+	}
+	if !connCapability(conn, CapTransaction) {
+		return nil, fmt.Errorf("fail BeginTransaction: %w", errTxNotSupported)
+	}
+	if err := conn.BeginTx(); err != nil {
+		return nil, fmt.Errorf("fail BeginTransaction: %w", err)
+	}
+
+	ht := h.scope()
+	ht.txEvents = new(txEventQueue)
+	return ht, nil
+}
+
+// IsSession returns true when the hub uses connection pinned by Session
+func (h *Hub) IsSession() bool {
+	return h.session != nil
+}
+
+func (s *hubSession) isClosed() bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.closed
+}
+
+// close return pinned connection to the pool, pending transaction is rolled back
+func (s *hubSession) close() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.conn.IsTx() {
+		if err := s.conn.RollBack(); err != nil {
+			s.owner.Logger().Warn("unable to rollback transaction of closed session", "error", err.Error())
+		}
+	}
+	s.owner.closeConn(s.idx, s.conn)
+}
@@ -0,0 +1,229 @@
+package datahub
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// SnapshotVersion is version of snapshot format written by Snapshot
+const SnapshotVersion = 1
+
+// Snapshot line types. Snapshot is NDJSON where each line is a SnapshotLine
+const (
+	SnapshotHeader = "header"
+	SnapshotTable  = "table"
+	SnapshotRow    = "row"
+)
+
+// SnapshotLine is a line of snapshot
+type SnapshotLine struct {
+	Type    string            `json:"type"`
+	Version int               `json:"version,omitempty"`
+	Created *time.Time        `json:"created,omitempty"`
+	Table   string            `json:"table,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Data    toolkit.M         `json:"data,omitempty"`
+}
+
+// RestoreMode define how rows of snapshot are written into existing table
+type RestoreMode int
+
+const (
+	// RestoreUpsert insert new rows and replace existing rows having the same key
+	RestoreUpsert RestoreMode = iota
+	// RestoreTruncate delete all rows of the table before loading the snapshot
+	RestoreTruncate
+	// RestoreInsertOnly only insert new rows, rows which key is already exist are skipped
+	RestoreInsertOnly
+)
+
+// RestoreOptions control how Restore write the snapshot into database
+type RestoreOptions struct {
+	// Mode of restore, default is RestoreUpsert
+	Mode RestoreMode
+
+	// Include only restore these tables, name could contains wildcard ie: master_*. Empty means all tables
+	Include []string
+
+	// Exclude skip these tables, name could contains wildcard. Exclude is checked after Include
+	Exclude []string
+
+	// ContinueOnError keep restoring next rows when a row is failed to be written
+	ContinueOnError bool
+}
+
+// RestoreReport is result of Restore, number of restored, skipped and failed rows per table
+type RestoreReport struct {
+	Restored map[string]int
+	Skipped  map[string]int
+	Failed   map[string]int
+}
+
+func (o RestoreOptions) restoreTable(table string) bool {
+	if len(o.Include) > 0 && !matchTableName(o.Include, table) {
+		return false
+	}
+	return !matchTableName(o.Exclude, table)
+}
+
+func matchTableName(patterns []string, table string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, table); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshot write rows of given tables into w as portable dump. First line is header, each table is started by table
+// line with type hint of its fields (string, number, bool, time, object) followed by one line for each row
+func (h *Hub) Snapshot(w io.Writer, tables ...string) error {
+	if len(tables) == 0 {
+		return errors.New("fail Snapshot: tables are mandatory")
+	}
+
+	enc := json.NewEncoder(w)
+	now := time.Now()
+	if err := enc.Encode(SnapshotLine{Type: SnapshotHeader, Version: SnapshotVersion, Created: &now}); err != nil {
+		return fmt.Errorf("fail Snapshot: %w", err)
+	}
+
+	for _, table := range tables {
+		rows := []toolkit.M{}
+		if err := h.internal().PopulateByParm(table, dbflex.NewQueryParam(), &rows); err != nil {
+			return fmt.Errorf("fail Snapshot: table %s. %w", table, err)
+		}
+
+		if err := enc.Encode(SnapshotLine{Type: SnapshotTable, Table: table, Fields: snapshotFields(rows)}); err != nil {
+			return fmt.Errorf("fail Snapshot: %w", err)
+		}
+		for _, row := range rows {
+			if err := enc.Encode(SnapshotLine{Type: SnapshotRow, Table: table, Data: row}); err != nil {
+				return fmt.Errorf("fail Snapshot: table %s. %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Restore read snapshot written by Snapshot and save the rows into database
+func (h *Hub) Restore(r io.Reader, opts RestoreOptions) (*RestoreReport, error) {
+	report := &RestoreReport{Restored: map[string]int{}, Skipped: map[string]int{}, Failed: map[string]int{}}
+	fields := map[string]string{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := SnapshotLine{}
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+		if err := dec.Decode(&line); err != nil {
+			return report, fmt.Errorf("fail Restore: line %d. %w", lineNo, err)
+		}
+
+		switch line.Type {
+		case SnapshotHeader:
+			if line.Version > SnapshotVersion {
+				return report, fmt.Errorf("fail Restore: snapshot version %d is not supported", line.Version)
+			}
+
+		case SnapshotTable:
+			fields = line.Fields
+			if opts.Mode == RestoreTruncate && opts.restoreTable(line.Table) {
+				if _, err := h.Execute(dbflex.From(h.table(line.Table)).Delete(), nil); err != nil {
+					return report, fmt.Errorf("fail Restore: truncate %s. %w", line.Table, err)
+				}
+			}
+
+		case SnapshotRow:
+			if !opts.restoreTable(line.Table) {
+				continue
+			}
+			restoreTypes(line.Data, fields)
+
+			var err error
+			if opts.Mode == RestoreInsertOnly {
+				_, err = h.Execute(dbflex.From(h.table(line.Table)).Insert(), line.Data)
+				if err != nil && errors.Is(duplicateKey(err), ErrDuplicateKey) {
+					report.Skipped[line.Table]++
+					continue
+				}
+			} else {
+				err = h.SaveAny(line.Table, line.Data)
+			}
+			if err != nil {
+				report.Failed[line.Table]++
+				if !opts.ContinueOnError {
+					return report, fmt.Errorf("fail Restore: line %d. %w", lineNo, err)
+				}
+				continue
+			}
+			report.Restored[line.Table]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("fail Restore: %w", err)
+	}
+	return report, nil
+}
+
+func snapshotFields(rows []toolkit.M) map[string]string {
+	fields := map[string]string{}
+	for _, row := range rows {
+		for k, v := range row {
+			if _, ok := fields[k]; ok || v == nil {
+				continue
+			}
+			fields[k] = typeHint(v)
+		}
+	}
+	return fields
+}
+
+func typeHint(v interface{}) string {
+	switch indirectValue(v).(type) {
+	case time.Time:
+		return "time"
+	case bool:
+		return "bool"
+	case string:
+		return "string"
+	}
+	if _, ok := toFloat(indirectValue(v)); ok {
+		return "number"
+	}
+	return "object"
+}
+
+// restoreTypes convert json decoded value back into its type based on type hint
+func restoreTypes(data toolkit.M, fields map[string]string) {
+	for k, v := range data {
+		switch o := v.(type) {
+		case string:
+			if fields[k] != "time" {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339Nano, o); err == nil {
+				data[k] = t
+			}
+
+		case json.Number:
+			if i, err := o.Int64(); err == nil {
+				data[k] = i
+			} else if f, err := o.Float64(); err == nil {
+				data[k] = f
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package datahub
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// SQLDB returns *sql.DB of the hub for drivers backed by database/sql, so libraries like sqlx, squirrel or migration tools
+// could share connections of the hub. When hub is using pool, the *sql.DB of a pooled connection is returned, otherwise
+// a connection is opened once and held by the hub until Close is called. The *sql.DB should not be closed by the caller.
+// ErrNotSupported is returned for other drivers
+func (h *Hub) SQLDB() (*sql.DB, error) {
+	if h.usePool {
+		var db *sql.DB
+		err := h.Native(func(conn dbflex.IConnection) error {
+			if db = sqlDBOf(conn); db == nil {
+				return fmt.Errorf("fail SQLDB: driver %s is not backed by database/sql. %w", driverName(conn), ErrNotSupported)
+			}
+			return nil
+		})
+		return db, err
+	}
+
+	if h.mtx == nil {
+		h.mtx = new(sync.Mutex)
+	}
+	if h.pools == nil {
+		h.pools = new(hubPool)
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.pools.sqlDB != nil {
+		return h.pools.sqlDB, nil
+	}
+
+	conn, err := h.connect()
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+	db := sqlDBOf(conn)
+	if db == nil {
+		conn.Close()
+		return nil, fmt.Errorf("fail SQLDB: driver %s is not backed by database/sql. %w", driverName(conn), ErrNotSupported)
+	}
+	h.pools.sqlConn, h.pools.sqlDB = conn, db
+	return db, nil
+}
+
+// sqlDBOf returns *sql.DB returned by DB() method of the connection or held by one of its fields
+func sqlDBOf(conn dbflex.IConnection) *sql.DB {
+	if p, ok := conn.(interface{ DB() *sql.DB }); ok {
+		return p.DB()
+	}
+	if v := findNative(reflect.ValueOf(conn), "*sql.DB", 0); v.IsValid() {
+		return v.Interface().(*sql.DB)
+	}
+	return nil
+}
+
+func (h *Hub) closeSQLDB() {
+	if h.mtx == nil || h.pools == nil {
+		return
+	}
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	if h.pools.sqlConn != nil {
+		h.pools.sqlConn.Close()
+		h.pools.sqlConn, h.pools.sqlDB = nil, nil
+	}
+}
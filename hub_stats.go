@@ -0,0 +1,186 @@
+package datahub
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// StatsSampleSize is number of latest latencies kept for each table and operation to calculate percentiles
+var StatsSampleSize = 1024
+
+// OpStats is statistic of an operation on a table
+type OpStats struct {
+	Table  string
+	Op     string
+	Count  int64
+	Errors int64
+	Min    time.Duration
+	Max    time.Duration
+	Mean   time.Duration
+	P50    time.Duration
+	P90    time.Duration
+	P99    time.Duration
+	// Since is time the statistic is started, either on first call or after last reset
+	Since time.Time
+}
+
+type statKey struct {
+	table, op string
+}
+
+type opCounter struct {
+	count, errors int64
+	total         time.Duration
+	min, max      time.Duration
+	samples       []time.Duration
+	next          int
+	since         time.Time
+}
+
+// hubStats is shared by hubs created from the same hub
+type hubStats struct {
+	mtx      sync.Mutex
+	counters map[statKey]*opCounter
+	recent   recentOps
+	slowOps  recentOps
+	slow     time.Duration
+}
+
+func (h *Hub) statsOf() *hubStats {
+	if h.stats == nil {
+		h.stats = &hubStats{counters: map[statKey]*opCounter{}}
+	}
+	return h.stats
+}
+
+// observe record call of an operation on a table, it is deferred by the operation with pointer to its returned error
+// and start time returned by startOp. The error is also wrapped into its category, see classifyError
+func (h *Hub) observe(op, table string, started time.Time, err *error) {
+	h.observeQuery(op, table, nil, started, err)
+}
+
+// observeQuery is observe of operation with filter, the filter is kept on signature of the operation, see TopQueries
+func (h *Hub) observeQuery(op, table string, where *dbflex.Filter, started time.Time, err *error) {
+	elapsed := time.Since(started)
+	h.endOp()
+	if err != nil {
+		*err = classifyError(op, table, *err)
+	}
+	s := h.statsOf()
+	s.mtx.Lock()
+	slow := s.slow
+	failed := err != nil && *err != nil
+	s.record(statKey{table, op}, started, elapsed, failed)
+	rop := recentOp{signature: querySignature(op, table, where), op: op, table: table, started: started,
+		elapsed: elapsed, failed: failed}
+	s.recent.add(rop, RecentOpsSize)
+	if slow > 0 && elapsed >= slow {
+		s.slowOps.add(rop, SlowOpsSize)
+	}
+	s.mtx.Unlock()
+
+	if slow > 0 && elapsed >= slow {
+		h.Logger().Warn("slow operation", "op", op, "table", table, "duration", elapsed.String())
+	}
+}
+
+// record add a call into counter of the key, the caller should hold the lock
+func (s *hubStats) record(key statKey, started time.Time, elapsed time.Duration, failed bool) {
+	c, ok := s.counters[key]
+	if !ok {
+		c = &opCounter{since: started, min: elapsed}
+		s.counters[key] = c
+	}
+	c.count++
+	if failed {
+		c.errors++
+	}
+	c.total += elapsed
+	if elapsed < c.min {
+		c.min = elapsed
+	}
+	if elapsed > c.max {
+		c.max = elapsed
+	}
+	if len(c.samples) < StatsSampleSize {
+		c.samples = append(c.samples, elapsed)
+	} else if len(c.samples) > 0 {
+		c.samples[c.next] = elapsed
+		c.next = (c.next + 1) % len(c.samples)
+	}
+}
+
+// SetSlowQueryThreshold log operations taking at least d as warning, 0 disable it. It is shared with hubs created
+// from this hub
+func (h *Hub) SetSlowQueryThreshold(d time.Duration) *Hub {
+	s := h.statsOf()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.slow = d
+	return h
+}
+
+// SlowQueryThreshold returns minimum duration of operations logged as slow, 0 means disabled
+func (h *Hub) SlowQueryThreshold() time.Duration {
+	s := h.statsOf()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.slow
+}
+
+// Stats returns snapshot of statistics of each table and operation tracked by the hub, sorted by table then operation.
+// Statistics are shared with hubs created from this hub. Percentiles are calculated from latest StatsSampleSize calls
+func (h *Hub) Stats() []OpStats {
+	s := h.statsOf()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.snapshot()
+}
+
+// ResetStats clear statistics and latest operations of the hub and returns the last snapshot, so it could be used to report per interval
+func (h *Hub) ResetStats() []OpStats {
+	s := h.statsOf()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	res := s.snapshot()
+	s.counters = map[statKey]*opCounter{}
+	s.recent = recentOps{}
+	s.slowOps = recentOps{}
+	return res
+}
+
+func (s *hubStats) snapshot() []OpStats {
+	res := make([]OpStats, 0, len(s.counters))
+	for k, c := range s.counters {
+		st := OpStats{Table: k.table, Op: k.op, Count: c.count, Errors: c.errors, Min: c.min, Max: c.max, Since: c.since}
+		if c.count > 0 {
+			st.Mean = c.total / time.Duration(c.count)
+		}
+		samples := append([]time.Duration{}, c.samples...)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		st.P50, st.P90, st.P99 = percentile(samples, 50), percentile(samples, 90), percentile(samples, 99)
+		res = append(res, st)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Table != res[j].Table {
+			return res[i].Table < res[j].Table
+		}
+		return res[i].Op < res[j].Op
+	})
+	return res
+}
+
+// percentile returns p-th percentile of sorted durations using nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
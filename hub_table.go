@@ -0,0 +1,192 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// ErrNotSupported returned when an operation is not supported by the driver of the connection
+var ErrNotSupported = errors.New("operation is not supported by the driver")
+
+// ErrNotFound returned when query expecting a record does not return any record
+var ErrNotFound = errors.New("record is not found")
+
+// TableQuery is chainable query on a table, created by Hub.Table
+type TableQuery struct {
+	h         *Hub
+	tableName string
+	joins     []tableJoin
+	parm      *dbflex.QueryParam
+}
+
+type tableJoin struct {
+	kind  string
+	table string
+	on    string
+}
+
+// Table create chainable query for given table name
+func (h *Hub) Table(name string) *TableQuery {
+	return &TableQuery{h: h, tableName: name, parm: dbflex.NewQueryParam()}
+}
+
+// Join add inner join with other table, on is join condition, ie: orders.cust_id = customers._id.
+// Join is only supported by SQL drivers
+func (q *TableQuery) Join(table, on string) *TableQuery {
+	q.joins = append(q.joins, tableJoin{"INNER JOIN", table, on})
+	return q
+}
+
+// LeftJoin add left join with other table
+func (q *TableQuery) LeftJoin(table, on string) *TableQuery {
+	q.joins = append(q.joins, tableJoin{"LEFT JOIN", table, on})
+	return q
+}
+
+// Select set fields to be returned, on joined query fields could be prefixed by table name, ie: customers.name
+func (q *TableQuery) Select(fields ...string) *TableQuery {
+	q.parm.SetSelect(fields...)
+	return q
+}
+
+// Where set filter of the query
+func (q *TableQuery) Where(f *dbflex.Filter) *TableQuery {
+	q.parm.SetWhere(f)
+	return q
+}
+
+// Sort set sort of the query, prefix field with - for descending sort
+func (q *TableQuery) Sort(fields ...string) *TableQuery {
+	q.parm.SetSort(fields...)
+	return q
+}
+
+// Skip set number of records to be skipped
+func (q *TableQuery) Skip(n int) *TableQuery {
+	q.parm.SetSkip(n)
+	return q
+}
+
+// Take set maximum number of records to be returned
+func (q *TableQuery) Take(n int) *TableQuery {
+	q.parm.SetTake(n)
+	return q
+}
+
+// Page set skip and take based on page number (starting from 1) and page size
+func (q *TableQuery) Page(page, size int) *TableQuery {
+	if page < 1 {
+		page = 1
+	}
+	return q.Skip((page - 1) * size).Take(size)
+}
+
+// Find run the query and fetch all result into dest
+func (q *TableQuery) Find(dest interface{}) error {
+	if len(q.joins) == 0 {
+		return q.h.PopulateByParm(q.tableName, q.parm, dest)
+	}
+
+	idx, conn, err := q.h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer q.h.closeConn(idx, conn)
+
+	if !isSQLDriver(conn) {
+		return fmt.Errorf("fail Find: join on %s. %w", driverName(conn), ErrNotSupported)
+	}
+
+	sql, err := q.joinSQL(driverName(conn))
+	if err != nil {
+		return fmt.Errorf("fail Find: %w", err)
+	}
+
+	cur := conn.Cursor(dbflex.SQL(sql), nil)
+	if err = cur.Error(); err != nil {
+		return fmt.Errorf("error when running cursor for Find. %w", err)
+	}
+	defer cur.Close()
+
+	return cur.Fetchs(dest, 0).Error()
+}
+
+// First run the query and fetch the first record into dest, which should be pointer to struct or toolkit.M.
+// ErrNotFound is returned when query has no result
+func (q *TableQuery) First(dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("fail First: dest should be a pointer")
+	}
+
+	parm := *q.parm
+	parm.Take = 1
+	first := *q
+	first.parm = &parm
+	rows := reflect.New(reflect.SliceOf(rv.Elem().Type()))
+	if err := first.Find(rows.Interface()); err != nil {
+		return err
+	}
+	if rows.Elem().Len() == 0 {
+		return fmt.Errorf("fail First: %s. %w", q.tableName, ErrNotFound)
+	}
+	rv.Elem().Set(rows.Elem().Index(0))
+	return nil
+}
+
+// Count returns number of records matched with the query, skip and take are ignored
+func (q *TableQuery) Count() (int, error) {
+	idx, conn, err := q.h.getConn()
+	if err != nil {
+		return 0, &ConnectionError{Err: err}
+	}
+	defer q.h.closeConn(idx, conn)
+
+	if len(q.joins) == 0 {
+		cmd := dbflex.From(q.h.table(q.tableName))
+		if q.parm.Where != nil {
+			cmd.Where(q.parm.Where)
+		}
+		cur := conn.Cursor(cmd, nil)
+		if err = cur.Error(); err != nil {
+			return 0, fmt.Errorf("fail Count: %w", err)
+		}
+		defer cur.Close()
+		return cur.Count(), nil
+	}
+
+	if !isSQLDriver(conn) {
+		return 0, fmt.Errorf("fail Count: join on %s. %w", driverName(conn), ErrNotSupported)
+	}
+	parm := dbflex.NewQueryParam().SetSelect("COUNT(*) AS n")
+	parm.Where = q.parm.Where
+	sql, err := sqlSelectFrom(driverName(conn), q.from(), parm)
+	if err != nil {
+		return 0, fmt.Errorf("fail Count: %w", err)
+	}
+	docs, err := fetchDocs(conn, dbflex.SQL(sql))
+	if err != nil {
+		return 0, fmt.Errorf("fail Count: %w", err)
+	}
+	if len(docs) == 0 {
+		return 0, nil
+	}
+	return docs[0].GetInt("n"), nil
+}
+
+func (q *TableQuery) joinSQL(driver string) (string, error) {
+	return sqlSelectFrom(driver, q.from(), q.parm)
+}
+
+// from returns table name with its joins
+func (q *TableQuery) from() string {
+	from := []string{q.h.tableRef(q.tableName)}
+	for _, j := range q.joins {
+		from = append(from, j.kind+" "+q.h.tableRef(j.table)+" ON "+j.on)
+	}
+	return strings.Join(from, " ")
+}
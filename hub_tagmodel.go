@@ -0,0 +1,366 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// TaggedModel let struct annotated with gorm or db (sqlx) tags to be used as orm.DataModel without re-tagging,
+// by embedding it instead of orm.DataModelBase:
+//
+//	type UserProfile struct {
+//		datahub.TaggedModel
+//		ID   int    `gorm:"primaryKey"`
+//		Name string `gorm:"column:full_name"`
+//	}
+//
+// Table name is snake case plural of the type name (user_profiles) unless the struct define its own TableName.
+// Primary key is field tagged with gorm primaryKey, key:"1" or field named ID. Column is taken from gorm column,
+// db tag or snake case of field name for gorm and lower case of field name for db, following each library convention
+type TaggedModel struct {
+	orm.DataModelBase `json:"-" bson:"-" sqlname:"-" db:"-" gorm:"-"`
+}
+
+// tagMapped is implemented by models which columns are mapped by the hub instead of the driver
+type tagMapped interface {
+	// encodeDoc returns record of the model as document
+	encodeDoc() toolkit.M
+	// decodeDoc fill target, which has the same type with the record of the model, from document
+	decodeDoc(doc toolkit.M, target interface{}) error
+	// record returns object being filled by Get
+	record() interface{}
+}
+
+func (m *TaggedModel) columnTag() string {
+	meta := MetaOf(m.This())
+	if meta == nil {
+		return "db"
+	}
+	for _, f := range meta.Fields {
+		if _, ok := f.Tag.Lookup("gorm"); ok {
+			return "gorm"
+		}
+	}
+	return "db"
+}
+
+func (m *TaggedModel) encodeDoc() toolkit.M {
+	return taggedToM(m.This(), m.columnTag())
+}
+
+func (m *TaggedModel) decodeDoc(doc toolkit.M, target interface{}) error {
+	return taggedFromM(doc, target, m.columnTag())
+}
+
+func (m *TaggedModel) record() interface{} {
+	return m.This()
+}
+
+// TableName returns snake case plural of the type name
+func (m *TaggedModel) TableName() string {
+	t := reflect.Indirect(reflect.ValueOf(m.This())).Type()
+	name := snakeCase(t.Name())
+	switch {
+	case strings.HasSuffix(name, "s"), strings.HasSuffix(name, "x"), strings.HasSuffix(name, "ch"), strings.HasSuffix(name, "sh"):
+		return name + "es"
+	case strings.HasSuffix(name, "y") && len(name) > 1 && !strings.ContainsRune("aeiou", rune(name[len(name)-2])):
+		return name[:len(name)-1] + "ies"
+	}
+	return name + "s"
+}
+
+// GetID returns column names and values of primary key
+func (m *TaggedModel) GetID(conn dbflex.IConnection) ([]string, []interface{}) {
+	rv := reflect.Indirect(reflect.ValueOf(m.This()))
+	tag := m.columnTag()
+	names, values := []string{}, []interface{}{}
+	for _, f := range primaryKeys(MetaOf(rv.Type())) {
+		names = append(names, f.DbName(tag))
+		values = append(values, f.Value(rv).Interface())
+	}
+	return names, values
+}
+
+// SetID set value of primary key
+func (m *TaggedModel) SetID(keys ...interface{}) {
+	rv := reflect.Indirect(reflect.ValueOf(m.This()))
+	for i, f := range primaryKeys(MetaOf(rv.Type())) {
+		if i >= len(keys) {
+			return
+		}
+		fv := f.Value(rv)
+		kv := reflect.ValueOf(keys[i])
+		switch {
+		case kv.Type().AssignableTo(fv.Type()):
+			fv.Set(kv)
+		case kv.Type().ConvertibleTo(fv.Type()):
+			fv.Set(kv.Convert(fv.Type()))
+		}
+	}
+}
+
+func primaryKeys(meta *ModelMeta) []*FieldMeta {
+	keys := []*FieldMeta{}
+	var id *FieldMeta
+	for _, f := range meta.Fields {
+		gorm := strings.ToLower(f.Tag.Get("gorm"))
+		if f.Tag.Get("key") != "" || strings.Contains(gorm, "primarykey") || strings.Contains(gorm, "primary_key") {
+			keys = append(keys, f)
+		}
+		if f.Name == "ID" {
+			id = f
+		}
+	}
+	if len(keys) == 0 && id != nil {
+		keys = append(keys, id)
+	}
+	return keys
+}
+
+// tagColumn returns column name of a field based on gorm or db tag, empty if field is ignored
+func tagColumn(sf reflect.StructTag, name, tag string) string {
+	switch tag {
+	case "gorm":
+		v, ok := sf.Lookup("gorm")
+		if ok && strings.TrimSpace(v) == "-" {
+			return ""
+		}
+		for _, part := range strings.Split(v, ";") {
+			if kv := strings.SplitN(strings.TrimSpace(part), ":", 2); len(kv) == 2 && strings.EqualFold(kv[0], "column") {
+				return strings.TrimSpace(kv[1])
+			}
+		}
+		return snakeCase(name)
+
+	case "db":
+		v := strings.Split(sf.Get("db"), ",")[0]
+		if v == "-" {
+			return ""
+		}
+		if v == "" {
+			return strings.ToLower(name)
+		}
+		return v
+	}
+	return name
+}
+
+func snakeCase(s string) string {
+	rs := []rune(s)
+	out := []rune{}
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(rs[i-1]) || (i+1 < len(rs) && unicode.IsLower(rs[i+1]))) {
+				out = append(out, '_')
+			}
+			r = unicode.ToLower(r)
+		}
+		out = append(out, r)
+	}
+	return string(out)
+}
+
+// taggedToM convert tagged model into document using its column names
+func taggedToM(data interface{}, tag string) toolkit.M {
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	m := toolkit.M{}
+	for _, f := range MetaOf(rv.Type()).Fields {
+		if col, ok := f.dbNames[tag]; ok && col != "" {
+			m[col] = f.Value(rv).Interface()
+		}
+	}
+	return m
+}
+
+// taggedFromM set fields of tagged model from document
+func taggedFromM(m toolkit.M, data interface{}, tag string) error {
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	for _, f := range MetaOf(rv.Type()).Fields {
+		col, ok := f.dbNames[tag]
+		if !ok || col == "" {
+			continue
+		}
+		v, ok := m[col]
+		if !ok || v == nil {
+			continue
+		}
+		fv := f.Value(rv)
+		vv := reflect.ValueOf(v)
+		switch {
+		case vv.Type().AssignableTo(fv.Type()):
+			fv.Set(vv)
+		case vv.Type().ConvertibleTo(fv.Type()) && (vv.Kind() == reflect.String) == (fv.Kind() == reflect.String):
+			fv.Set(vv.Convert(fv.Type()))
+		default:
+			if err := toolkit.Serde(v, fv.Addr().Interface(), ""); err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// the orm functions below are used by the hub in place of orm package, so tagged models are written and read
+// as documents mapped by the hub
+
+func ormSave(conn dbflex.IConnection, data orm.DataModel) error {
+	return ormWrite(conn, data, dbflex.From(data.TableName()).Save(), orm.Save)
+}
+
+func ormInsert(conn dbflex.IConnection, data orm.DataModel) error {
+	return ormWrite(conn, data, dbflex.From(data.TableName()).Insert(), orm.Insert)
+}
+
+func ormWrite(conn dbflex.IConnection, data orm.DataModel, cmd dbflex.ICommand, fn func(dbflex.IConnection, orm.DataModel) error) error {
+	tm, ok := data.(tagMapped)
+	if !ok {
+		return fn(conn, data)
+	}
+	if err := data.PreSave(conn); err != nil {
+		return err
+	}
+	if _, err := conn.Execute(cmd, toolkit.M{}.Set("data", tm.encodeDoc())); err != nil {
+		return err
+	}
+	return data.PostSave(conn)
+}
+
+func ormUpdate(conn dbflex.IConnection, data orm.DataModel) error {
+	tm, ok := data.(tagMapped)
+	if !ok {
+		return orm.Update(conn, data)
+	}
+	where, err := keyFilterOf(nil, data)
+	if err != nil {
+		return err
+	}
+	if err = data.PreSave(conn); err != nil {
+		return err
+	}
+	doc := tm.encodeDoc()
+	fields := make([]string, 0, len(doc))
+	for k := range doc {
+		fields = append(fields, k)
+	}
+	cmd := dbflex.From(data.TableName()).Update(fields...).Where(where)
+	if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", doc)); err != nil {
+		return err
+	}
+	return data.PostSave(conn)
+}
+
+func ormDelete(conn dbflex.IConnection, data orm.DataModel) error {
+	if _, ok := data.(tagMapped); !ok {
+		return orm.Delete(conn, data)
+	}
+	where, err := keyFilterOf(nil, data)
+	if err != nil {
+		return err
+	}
+	_, err = conn.Execute(dbflex.From(data.TableName()).Delete().Where(where), nil)
+	return err
+}
+
+func ormGet(conn dbflex.IConnection, data orm.DataModel) error {
+	tm, ok := data.(tagMapped)
+	if !ok {
+		return orm.Get(conn, data)
+	}
+	where, err := keyFilterOf(nil, data)
+	if err != nil {
+		return err
+	}
+	cur := conn.Cursor(dbflex.From(data.TableName()).Select().Where(where).Take(1), nil)
+	if err = cur.Error(); err != nil {
+		return err
+	}
+	defer cur.Close()
+	m := toolkit.M{}
+	if err = cur.Fetch(&m).Error(); err != nil {
+		return err
+	}
+	if err = tm.decodeDoc(m, tm.record()); err != nil {
+		return &DecodeError{DecodeReport: DecodeReport{Table: data.TableName()}, Err: err}
+	}
+	return nil
+}
+
+func ormGets(conn dbflex.IConnection, data orm.DataModel, dest interface{}, parm *dbflex.QueryParam) error {
+	tm, ok := data.(tagMapped)
+	if !ok {
+		return orm.Gets(conn, data, dest, parm)
+	}
+
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("dest should be pointer to slice")
+	}
+
+	cmd := dbflex.From(data.TableName())
+	if len(parm.Select) == 0 {
+		cmd.Select()
+	} else {
+		cmd.Select(parm.Select...)
+	}
+	if parm.Where != nil {
+		cmd.Where(parm.Where)
+	}
+	if len(parm.Sort) > 0 {
+		cmd.OrderBy(parm.Sort...)
+	}
+	if parm.Skip > 0 {
+		cmd.Skip(parm.Skip)
+	}
+	if parm.Take > 0 {
+		cmd.Take(parm.Take)
+	}
+
+	cur := conn.Cursor(cmd, nil)
+	if err := cur.Error(); err != nil {
+		return err
+	}
+	defer cur.Close()
+	docs := []toolkit.M{}
+	if err := cur.Fetchs(&docs, 0).Error(); err != nil {
+		return err
+	}
+
+	return decodeDocs(tm, docs, dest)
+}
+
+// decodeDocs fill dest, pointer to slice, with documents decoded by tag mapped model
+func decodeDocs(tm tagMapped, docs []toolkit.M, dest interface{}) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("dest should be pointer to slice")
+	}
+	elemType := rv.Elem().Type().Elem()
+
+	res := reflect.MakeSlice(rv.Elem().Type(), 0, len(docs))
+	for _, doc := range docs {
+		item := reflect.New(elemType)
+		if elemType.Kind() == reflect.Ptr {
+			item = reflect.New(elemType.Elem())
+		}
+		if err := tm.decodeDoc(doc, item.Interface()); err != nil {
+			return &DecodeError{DecodeReport: DecodeReport{Table: data.TableName()}, Err: err}
+		}
+		if dm, ok := item.Interface().(orm.DataModel); ok {
+			dm.SetThis(dm)
+		}
+		if elemType.Kind() == reflect.Ptr {
+			res = reflect.Append(res, item)
+		} else {
+			res = reflect.Append(res, item.Elem())
+		}
+	}
+	rv.Elem().Set(res)
+	return nil
+}
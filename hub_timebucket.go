@@ -0,0 +1,138 @@
+package datahub
+
+import (
+	"fmt"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// BucketInterval is size of time bucket
+type BucketInterval string
+
+const (
+	BucketMinute BucketInterval = "minute"
+	BucketHour   BucketInterval = "hour"
+	BucketDay    BucketInterval = "day"
+	BucketMonth  BucketInterval = "month"
+)
+
+// TimeBucketField is name of field holding start time of the bucket on result of TimeBucket
+const TimeBucketField = "bucket"
+
+var mysqlBucketFormats = map[BucketInterval]string{
+	BucketMinute: "%Y-%m-%d %H:%i:00",
+	BucketHour:   "%Y-%m-%d %H:00:00",
+	BucketDay:    "%Y-%m-%d 00:00:00",
+	BucketMonth:  "%Y-%m-01 00:00:00",
+}
+
+// TimeBucket group records of the model into fixed time interval based on timeField and calculate aggregates for each
+// bucket. Result is sorted by bucket, each item has bucket field (see TimeBucketField) and aggregate alias, aggregate
+// without alias is named by its field
+func (h *Hub) TimeBucket(data orm.DataModel, timeField string, interval BucketInterval, aggrs []*dbflex.AggrItem,
+	where *dbflex.Filter, dest interface{}) error {
+	data.SetThis(data)
+	if _, ok := mysqlBucketFormats[interval]; !ok {
+		return fmt.Errorf("fail TimeBucket: invalid interval %s", interval)
+	}
+	aggrs, err := bucketAggrs(aggrs)
+	if err != nil {
+		return fmt.Errorf("fail TimeBucket: %w", err)
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	var cmd dbflex.ICommand
+	if isSQLDriver(conn) {
+		cmd, err = sqlTimeBucket(driverName(conn), h.tableOf(data), timeField, interval, aggrs, where)
+	} else {
+		cmd, err = mongoTimeBucket(h.tableOf(data), timeField, interval, aggrs, where)
+	}
+	if err != nil {
+		return fmt.Errorf("fail TimeBucket: %w", err)
+	}
+
+	cur := conn.Cursor(cmd, nil)
+	if err = cur.Error(); err != nil {
+		return fmt.Errorf("fail TimeBucket: %w", err)
+	}
+	defer cur.Close()
+	return cur.Fetchs(dest, 0).Error()
+}
+
+// bucketAggrs returns copy of aggregates which empty alias is replaced by the field name
+func bucketAggrs(aggrs []*dbflex.AggrItem) ([]*dbflex.AggrItem, error) {
+	res := make([]*dbflex.AggrItem, len(aggrs))
+	for i, a := range aggrs {
+		if a == nil {
+			return nil, fmt.Errorf("aggregate %d is nil", i)
+		}
+		item := *a
+		if item.Alias == "" {
+			item.Alias = item.Field
+		}
+		if item.Alias == "" || item.Alias == TimeBucketField {
+			return nil, fmt.Errorf("aggregate %d has invalid alias %q", i, item.Alias)
+		}
+		res[i] = &item
+	}
+	return res, nil
+}
+
+func sqlTimeBucket(driver, tableName, timeField string, interval BucketInterval, aggrs []*dbflex.AggrItem,
+	where *dbflex.Filter) (dbflex.ICommand, error) {
+	var bucket string
+	switch {
+	case strings.Contains(driver, "pg") || strings.Contains(driver, "postgres"):
+		bucket = "date_trunc('" + string(interval) + "', " + timeField + ")"
+	case strings.Contains(driver, "mysql"):
+		bucket = "DATE_FORMAT(" + timeField + ", '" + mysqlBucketFormats[interval] + "')"
+	default:
+		return nil, fmt.Errorf("time bucket on %s. %w", driver, ErrNotSupported)
+	}
+
+	fields := []string{bucket + " AS " + TimeBucketField}
+	for _, a := range aggrs {
+		fields = append(fields, sqlAggrExpr(a)+" AS "+a.Alias)
+	}
+	sql := "SELECT " + strings.Join(fields, ", ") + " FROM " + tableName
+	w, err := sqlWhere(driver, where)
+	if err != nil {
+		return nil, err
+	}
+	if w != "" {
+		sql += " WHERE " + w
+	}
+	sql += " GROUP BY " + bucket + " ORDER BY " + bucket
+	return dbflex.SQL(sql), nil
+}
+
+func mongoTimeBucket(tableName, timeField string, interval BucketInterval, aggrs []*dbflex.AggrItem,
+	where *dbflex.Filter) (dbflex.ICommand, error) {
+	group := toolkit.M{"_id": toolkit.M{"$dateTrunc": toolkit.M{"date": "$" + timeField, "unit": string(interval)}}}
+	for _, a := range aggrs {
+		if a.Op == dbflex.AggrCount {
+			group[a.Alias] = toolkit.M{"$sum": 1}
+		} else {
+			group[a.Alias] = toolkit.M{string(a.Op): "$" + a.Field}
+		}
+	}
+
+	stages, err := NewPipeline().
+		Match(where).
+		Stage(toolkit.M{"$group": group}).
+		Stage(toolkit.M{"$addFields": toolkit.M{TimeBucketField: "$_id"}}).
+		Sort(TimeBucketField).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+	return dbflex.From(tableName).Command("pipe", stages), nil
+}
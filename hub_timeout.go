@@ -0,0 +1,193 @@
+package datahub
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// ErrTimeout is returned when an operation is not completed within its timeout
+var ErrTimeout = errors.New("operation timeout")
+
+// WithOpTimeout returns hub which operations need to be completed within d, ie: hub.WithOpTimeout(5*time.Second).Gets(...).
+// Timeout is enforced by the hub, not by the driver. When it is exceeded the call returns ErrTimeout immediately,
+// the connection is abandoned and is reopened once the driver call returns, so state of the call is not seen by other
+// operation. Result of timed out call is not written into destination of the caller. Timeout is not applied to
+// transactional hub
+func (h *Hub) WithOpTimeout(d time.Duration) *Hub {
+	nh := h.scope()
+	nh.opTimeout = d
+	return nh
+}
+
+// SetDefaultTimeout set timeout applied to every operation that has no timeout set by WithOpTimeout,
+// so no query can run unbounded. 0 means no default timeout
+func (h *Hub) SetDefaultTimeout(d time.Duration) *Hub {
+	h.defaultTimeout = d
+	return h
+}
+
+// DefaultTimeout returns default timeout of the hub
+func (h *Hub) DefaultTimeout() time.Duration {
+	return h.defaultTimeout
+}
+
+// OpTimeout returns timeout of each operation, timeout set by WithOpTimeout take precedence over default timeout.
+// 0 means no timeout
+func (h *Hub) OpTimeout() time.Duration {
+	if h.opTimeout > 0 {
+		return h.opTimeout
+	}
+	return h.defaultTimeout
+}
+
+func (h *Hub) withDeadline(conn dbflex.IConnection) dbflex.IConnection {
+	d := h.OpTimeout()
+	if d <= 0 {
+		return conn
+	}
+	return &deadlineConn{IConnection: conn, deadline: time.Now().Add(d)}
+}
+
+// deadlineConn wraps connection and run its calls on separate goroutine, so caller can leave when deadline is exceeded
+type deadlineConn struct {
+	dbflex.IConnection
+	deadline  time.Time
+	inflight  sync.WaitGroup
+	abandoned int32
+}
+
+// Unwrap returns the underlying connection
+func (c *deadlineConn) Unwrap() dbflex.IConnection {
+	return c.IConnection
+}
+
+func (c *deadlineConn) isAbandoned() bool {
+	return atomic.LoadInt32(&c.abandoned) == 1
+}
+
+func (c *deadlineConn) call(fn func()) error {
+	if c.isAbandoned() {
+		return ErrTimeout
+	}
+	remaining := time.Until(c.deadline)
+	if remaining <= 0 {
+		atomic.StoreInt32(&c.abandoned, 1)
+		return ErrTimeout
+	}
+
+	done := make(chan bool)
+	c.inflight.Add(1)
+	go func() {
+		defer c.inflight.Done()
+		defer close(done)
+		fn()
+	}()
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		atomic.StoreInt32(&c.abandoned, 1)
+		return ErrTimeout
+	}
+}
+
+// Execute run the command within deadline of the connection
+func (c *deadlineConn) Execute(cmd dbflex.ICommand, m toolkit.M) (interface{}, error) {
+	var (
+		res interface{}
+		err error
+	)
+	if e := c.call(func() { res, err = c.IConnection.Execute(cmd, m) }); e != nil {
+		return nil, e
+	}
+	return res, err
+}
+
+// Cursor open cursor within deadline of the connection
+func (c *deadlineConn) Cursor(cmd dbflex.ICommand, m toolkit.M) dbflex.ICursor {
+	var cur dbflex.ICursor
+	if e := c.call(func() { cur = c.IConnection.Cursor(cmd, m) }); e != nil {
+		return &timeoutCursor{err: e}
+	}
+	return &deadlineCursor{ICursor: cur, conn: c}
+}
+
+type deadlineCursor struct {
+	dbflex.ICursor
+	conn *deadlineConn
+}
+
+// Fetch decode into a private value which is copied into obj only when the call completes within the deadline, so
+// the abandoned call does not write into obj after the caller has left
+func (c *deadlineCursor) Fetch(obj interface{}) dbflex.ICursor {
+	var res dbflex.ICursor
+	tmp, commit := privateDest(obj, true)
+	if e := c.conn.call(func() { res = c.ICursor.Fetch(tmp) }); e != nil {
+		return &timeoutCursor{err: e}
+	}
+	commit()
+	return res
+}
+
+func (c *deadlineCursor) Fetchs(obj interface{}, n int) dbflex.ICursor {
+	var res dbflex.ICursor
+	tmp, commit := privateDest(obj, false)
+	if e := c.conn.call(func() { res = c.ICursor.Fetchs(tmp, n) }); e != nil {
+		return &timeoutCursor{err: e}
+	}
+	commit()
+	return res
+}
+
+// privateDest returns new value of the type obj points to and function copying it into obj. Struct is initialized
+// with value of obj when keep is true, so fields not returned by the driver are kept. obj which is not a pointer is
+// returned as is
+func privateDest(obj interface{}, keep bool) (interface{}, func()) {
+	rv := reflect.ValueOf(obj)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return obj, func() {}
+	}
+	tmp := reflect.New(rv.Elem().Type())
+	if keep && rv.Elem().Kind() == reflect.Struct {
+		tmp.Elem().Set(rv.Elem())
+	}
+	return tmp.Interface(), func() { rv.Elem().Set(tmp.Elem()) }
+}
+
+func (c *deadlineCursor) Count() int {
+	n := 0
+	if e := c.conn.call(func() { n = c.ICursor.Count() }); e != nil {
+		return 0
+	}
+	return n
+}
+
+func (c *deadlineCursor) Close() error {
+	if c.conn.isAbandoned() {
+		// cursor is released together with the connection
+		return nil
+	}
+	return c.ICursor.Close()
+}
+
+// timeoutCursor is returned in place of cursor when deadline is exceeded
+type timeoutCursor struct {
+	dbflex.ICursor
+	err error
+}
+
+func (c *timeoutCursor) Reset() error                           { return c.err }
+func (c *timeoutCursor) Fetch(interface{}) dbflex.ICursor       { return c }
+func (c *timeoutCursor) Fetchs(interface{}, int) dbflex.ICursor { return c }
+func (c *timeoutCursor) Count() int                             { return 0 }
+func (c *timeoutCursor) Error() error                           { return c.err }
+func (c *timeoutCursor) Close() error                           { return nil }
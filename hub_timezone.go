@@ -0,0 +1,170 @@
+package datahub
+
+import (
+	"reflect"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// SetTimeLocation enable time normalization: time values of the model are converted into UTC before being written
+// by Save, Insert, Update, UpdateField and Patch, time values of filters are converted into UTC, and time values of
+// fetched records are converted into loc, so every driver store and return the same instant the same way. Model being
+// written gets its original time values back once the write is done, fetched records are converted in place, both
+// including nested structs, slices and maps. nil disables normalization
+func (h *Hub) SetTimeLocation(loc *time.Location) *Hub {
+	h.timeLocation = loc
+	return h
+}
+
+// TimeLocation returns location used to present fetched time values, nil if normalization is disabled
+func (h *Hub) TimeLocation() *time.Location {
+	return h.timeLocation
+}
+
+// timeToUTC convert time values of data into UTC, it returns function restoring the original values which should be
+// called once data is written, ie: defer h.timeToUTC(data)()
+func (h *Hub) timeToUTC(data interface{}) func() {
+	if h.timeLocation == nil {
+		return func() {}
+	}
+	undo := []func(){}
+	normalizeTimes(reflect.ValueOf(data), time.UTC, 0, &undo)
+	return func() {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+	}
+}
+
+// filterToUTC returns copy of filter which time values are converted into UTC
+func (h *Hub) filterToUTC(f *dbflex.Filter) *dbflex.Filter {
+	if h.timeLocation == nil || f == nil {
+		return f
+	}
+	nf := *f
+	nf.Value = timeValueToUTC(f.Value)
+	if len(f.Items) > 0 {
+		nf.Items = make([]*dbflex.Filter, len(f.Items))
+		for i, item := range f.Items {
+			nf.Items[i] = h.filterToUTC(item)
+		}
+	}
+	return &nf
+}
+
+// timeValueToUTC returns filter value with its time values converted into UTC, slice is copied
+func timeValueToUTC(v interface{}) interface{} {
+	switch tv := v.(type) {
+	case time.Time:
+		return tv.UTC()
+	case *time.Time:
+		if tv != nil {
+			t := tv.UTC()
+			return &t
+		}
+	case []time.Time:
+		res := make([]time.Time, len(tv))
+		for i, t := range tv {
+			res[i] = t.UTC()
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(tv))
+		for i, item := range tv {
+			res[i] = timeValueToUTC(item)
+		}
+		return res
+	}
+	return v
+}
+
+// timeToLocal convert time values of fetched data into the configured location
+func (h *Hub) timeToLocal(data interface{}) {
+	if h.timeLocation == nil {
+		return
+	}
+	normalizeTimes(reflect.ValueOf(data), h.timeLocation, 0, nil)
+}
+
+// normalizeTimes convert time values reachable from rv into loc, rv need to be settable or a pointer.
+// When undo is not nil, function restoring each converted value is appended into it
+func normalizeTimes(rv reflect.Value, loc *time.Location, depth int, undo *[]func()) {
+	if !rv.IsValid() || depth > 32 {
+		return
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return
+		}
+		if rv.Kind() == reflect.Interface {
+			// value inside interface is not settable, replace it with converted copy
+			if t, ok := rv.Interface().(time.Time); ok && rv.CanSet() {
+				setTime(rv, reflect.ValueOf(t.In(loc)), undo)
+				return
+			}
+		}
+		normalizeTimes(rv.Elem(), loc, depth+1, undo)
+
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			if rv.CanSet() {
+				t := rv.Interface().(time.Time)
+				if !t.IsZero() {
+					setTime(rv, reflect.ValueOf(t.In(loc)), undo)
+				}
+			}
+			return
+		}
+		for i := 0; i < rv.NumField(); i++ {
+			if rv.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			normalizeTimes(rv.Field(i), loc, depth+1, undo)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < rv.Len(); i++ {
+			normalizeTimes(rv.Index(i), loc, depth+1, undo)
+		}
+
+	case reflect.Map:
+		if rv.IsNil() {
+			return
+		}
+		iter := rv.MapRange()
+		for iter.Next() {
+			v := iter.Value()
+			if v.Kind() == reflect.Interface && !v.IsNil() {
+				v = v.Elem()
+			}
+			switch {
+			case v.Type() == timeType:
+				if t := v.Interface().(time.Time); !t.IsZero() {
+					key, old := iter.Key(), iter.Value()
+					rv.SetMapIndex(key, reflect.ValueOf(t.In(loc)))
+					if undo != nil {
+						*undo = append(*undo, func() { rv.SetMapIndex(key, old) })
+					}
+				}
+			case v.Kind() == reflect.Ptr, v.Kind() == reflect.Map, v.Kind() == reflect.Slice:
+				normalizeTimes(v, loc, depth+1, undo)
+			}
+		}
+	}
+}
+
+// setTime set rv with converted time, keeping its original value on undo when undo is not nil
+func setTime(rv, converted reflect.Value, undo *[]func()) {
+	if undo != nil {
+		old := reflect.New(rv.Type()).Elem()
+		old.Set(rv)
+		*undo = append(*undo, func() { rv.Set(old) })
+	}
+	rv.Set(converted)
+}
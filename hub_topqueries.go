@@ -0,0 +1,166 @@
+package datahub
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// RecentOpsSize is number of latest operations kept by the hub to calculate TopQueries
+var RecentOpsSize = 4096
+
+// SlowOpsSize is number of latest slow operations kept by the hub, see SlowQueries
+var SlowOpsSize = 256
+
+// QueryStats is statistic of operations sharing a signature, calculated from the latest operations of the hub
+type QueryStats struct {
+	// Signature is operation, table and filter with its values removed, ie: gets Orders where and(custid eq ?, status in ?)
+	Signature string
+	Op        string
+	Table     string
+	Count     int
+	Errors    int
+	Total     time.Duration
+	Mean      time.Duration
+	Max       time.Duration
+	// Last is time the latest operation of the signature is started
+	Last time.Time
+}
+
+type recentOp struct {
+	signature, op, table string
+	started              time.Time
+	elapsed              time.Duration
+	failed               bool
+}
+
+// recentOps is ring of latest operations, the caller should hold lock of hubStats
+type recentOps struct {
+	items []recentOp
+	next  int
+}
+
+// add put op into the ring, replacing the oldest one once the ring has size items
+func (r *recentOps) add(op recentOp, size int) {
+	if size <= 0 {
+		return
+	}
+	if len(r.items) < size {
+		r.items = append(r.items, op)
+		return
+	}
+	if r.next >= len(r.items) {
+		r.next = 0
+	}
+	r.items[r.next] = op
+	r.next = (r.next + 1) % len(r.items)
+}
+
+// TopQueries returns n signatures taking most time among the latest RecentOpsSize operations, so queries which are
+// slow or run too often come first. Signatures are grouped by normalized filter, so queries differ only on values
+// of the filter are counted together. It is shared with hubs created from this hub, n <= 0 returns all signatures
+func (h *Hub) TopQueries(n int) []QueryStats {
+	s := h.statsOf()
+	s.mtx.Lock()
+	byKey := map[string]*QueryStats{}
+	for _, op := range s.recent.items {
+		q, ok := byKey[op.signature]
+		if !ok {
+			q = &QueryStats{Signature: op.signature, Op: op.op, Table: op.table}
+			byKey[op.signature] = q
+		}
+		q.Count++
+		if op.failed {
+			q.Errors++
+		}
+		q.Total += op.elapsed
+		if op.elapsed > q.Max {
+			q.Max = op.elapsed
+		}
+		if op.started.After(q.Last) {
+			q.Last = op.started
+		}
+	}
+	s.mtx.Unlock()
+
+	res := make([]QueryStats, 0, len(byKey))
+	for _, q := range byKey {
+		q.Mean = q.Total / time.Duration(q.Count)
+		res = append(res, *q)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Total != res[j].Total {
+			return res[i].Total > res[j].Total
+		}
+		return res[i].Signature < res[j].Signature
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+// SlowQuery is an operation taking at least the slow query threshold, see SetSlowQueryThreshold
+type SlowQuery struct {
+	Signature string
+	Op        string
+	Table     string
+	Started   time.Time
+	Duration  time.Duration
+	Failed    bool
+}
+
+// SlowQueries returns n latest slow operations, newest first, among the latest SlowOpsSize slow operations. Slow
+// operations are kept only when the slow query threshold is set. n <= 0 returns all of them
+func (h *Hub) SlowQueries(n int) []SlowQuery {
+	s := h.statsOf()
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	res := make([]SlowQuery, 0, len(s.slowOps.items))
+	for _, op := range s.slowOps.items {
+		res = append(res, SlowQuery{Signature: op.signature, Op: op.op, Table: op.table, Started: op.started,
+			Duration: op.elapsed, Failed: op.failed})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Started.After(res[j].Started) })
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
+
+func whereOf(parm *dbflex.QueryParam) *dbflex.Filter {
+	if parm == nil {
+		return nil
+	}
+	return parm.Where
+}
+
+func querySignature(op, table string, where *dbflex.Filter) string {
+	if where == nil {
+		return op + " " + table
+	}
+	return op + " " + table + " where " + normalizeFilter(where)
+}
+
+// normalizeFilter write filter with its values replaced by ?, items of and / or are sorted so their order does not
+// matter, ie: and(custid eq ?, status in ?)
+func normalizeFilter(f *dbflex.Filter) string {
+	op := strings.TrimPrefix(string(f.Op), "$")
+	switch f.Op {
+	case dbflex.OpAnd, dbflex.OpOr, dbflex.OpNot:
+		items := make([]string, 0, len(f.Items))
+		for _, item := range f.Items {
+			if item != nil {
+				items = append(items, normalizeFilter(item))
+			}
+		}
+		if f.Op != dbflex.OpNot {
+			sort.Strings(items)
+		}
+		return fmt.Sprintf("%s(%s)", op, strings.Join(items, ", "))
+	}
+	return f.Field + " " + op + " ?"
+}
@@ -0,0 +1,150 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// TTLBatchSize is number of expired records deleted on each batch by TTL purger
+var TTLBatchSize = 500
+
+// EnableTTL delete records of the model which expiryField is already passed. On mongo TTL index is created on
+// expiryField and the database take care of the expiry, on other drivers a background purger run every interval
+// and delete expired records in batch. Purger is stopped by DisableTTL or Close
+func (h *Hub) EnableTTL(data orm.DataModel, expiryField string, interval time.Duration) error {
+	data.SetThis(data)
+	if expiryField == "" || interval <= 0 {
+		return errors.New("fail EnableTTL: expiry field and interval are mandatory")
+	}
+
+	tableName := data.TableName()
+	if !h.Capability(CapSQL) {
+		idxName := tableName + "_" + expiryField + "_ttl"
+		err := h.CallProc("createIndexes", []interface{}{h.table(tableName), "indexes", []toolkit.M{
+			{"key": toolkit.M{expiryField: 1}, "name": idxName, "expireAfterSeconds": 0},
+		}}, nil)
+		if err != nil {
+			return fmt.Errorf("fail EnableTTL: unable to create ttl index. %w", err)
+		}
+		return nil
+	}
+
+	h.DisableTTL(data)
+	stop := make(chan bool)
+	h.ttlLock().Lock()
+	if h.ttlWorkers == nil {
+		h.ttlWorkers = map[string]chan bool{}
+	}
+	h.ttlWorkers[tableName] = stop
+	h.ttlLock().Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+
+			case <-ticker.C:
+				n, err := h.PurgeExpired(data, expiryField)
+				if err != nil {
+					h.Logger().Error("ttl purge fail", "table", tableName, "error", err.Error())
+				} else if n > 0 {
+					h.Logger().Info("ttl purge", "table", tableName, "deleted", n)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// DisableTTL stop background purger of the model
+func (h *Hub) DisableTTL(data orm.DataModel) {
+	h.ttlLock().Lock()
+	defer h.ttlLock().Unlock()
+	if stop, ok := h.ttlWorkers[data.TableName()]; ok {
+		close(stop)
+		delete(h.ttlWorkers, data.TableName())
+	}
+}
+
+// PurgeExpired delete records of the model which expiryField is already passed in batches. It returns number of deleted records
+func (h *Hub) PurgeExpired(data orm.DataModel, expiryField string) (int, error) {
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return 0, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	data.SetThis(data)
+	keyFields, _ := data.GetID(conn)
+	if len(keyFields) != 1 {
+		return 0, errors.New("fail PurgeExpired: model should have single key field")
+	}
+	keyField := keyFields[0]
+	tableName := h.tableOf(data)
+	defer h.invalidateCache(data.TableName())
+
+	// expiry is checked against the time purge started, so records expiring while purging do not keep it running
+	expired := dbflex.Lte(expiryField, time.Now())
+	deleted := 0
+	prev := map[string]bool{}
+	for {
+		cur := conn.Cursor(dbflex.From(tableName).Select(keyField).Where(expired).Take(TTLBatchSize), nil)
+		if err = cur.Error(); err != nil {
+			return deleted, fmt.Errorf("fail PurgeExpired: %w", err)
+		}
+		ms := []toolkit.M{}
+		if err = cur.Fetchs(&ms, 0).Close(); err != nil {
+			return deleted, fmt.Errorf("fail PurgeExpired: %w", err)
+		}
+		if len(ms) == 0 {
+			return deleted, nil
+		}
+
+		keys := make([]interface{}, len(ms))
+		batch := make(map[string]bool, len(ms))
+		for i, m := range ms {
+			k := fmt.Sprintf("%v", m.Get(keyField))
+			if prev[k] {
+				return deleted, fmt.Errorf("fail PurgeExpired: record %s of previous batch is not deleted", k)
+			}
+			batch[k] = true
+			keys[i] = m.Get(keyField)
+		}
+		prev = batch
+
+		cmd := dbflex.From(tableName).Delete().Where(dbflex.And(dbflex.In(keyField, keys...), expired))
+		if _, err = conn.Execute(cmd, nil); err != nil {
+			return deleted, fmt.Errorf("fail PurgeExpired: %w", err)
+		}
+		deleted += len(ms)
+
+		if len(ms) < TTLBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+func (h *Hub) ttlLock() *sync.Mutex {
+	if h.ttlMtx == nil {
+		h.ttlMtx = new(sync.Mutex)
+	}
+	return h.ttlMtx
+}
+
+func (h *Hub) stopTTLWorkers() {
+	h.ttlLock().Lock()
+	defer h.ttlLock().Unlock()
+	for name, stop := range h.ttlWorkers {
+		close(stop)
+		delete(h.ttlWorkers, name)
+	}
+}
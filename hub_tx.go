@@ -5,39 +5,55 @@ import (
 	"fmt"
 )
 
-// BeginTx create a hub with Transaction. Commit and/or Rollback need to call later on to close the transaction
+// BeginTx create a hub with Transaction, it keeps settings of the hub. Commit and/or Rollback need to call later on to
+// close the transaction. Transaction of session hub is started on connection of the session
 func (h *Hub) BeginTx() (*Hub, error) {
+	if h.readOnly {
+		return nil, fmt.Errorf("fail BeginTransaction: %w", ErrReadOnly)
+	}
+	if h.session != nil {
+		return h.beginSessionTx()
+	}
 	conn, e := h.GetClassicConnection()
 	if e != nil {
-		return nil, fmt.Errorf("fail BeginTransaction: %s", e.Error())
+		return nil, fmt.Errorf("fail BeginTransaction: %w", e)
 	}
-	if !conn.SupportTx() {
+	if !connCapability(conn, CapTransaction) {
 		conn.Close()
-		return nil, fmt.Errorf("fail BeginTransaction: connection is not supporting transaction")
+		return nil, fmt.Errorf("fail BeginTransaction: %w", errTxNotSupported)
 	}
 	if e = conn.BeginTx(); e != nil {
-		return nil, fmt.Errorf("fail BeginTransaction: %s", e.Error())
+		return nil, fmt.Errorf("fail BeginTransaction: %w", e)
 	}
 
-	ht := new(Hub)
+	ht := h.scope()
 	ht.txconn = conn
-	ht._log = h._log
+	ht.txEvents = new(txEventQueue)
 	return ht, nil
 }
 
 // Commit commits all change into database
 func (h *Hub) Commit() error {
 	defer func() {
-		if h != nil && h.txconn != nil {
+		// connection of session is kept until the session is closed
+		if h != nil && h.txconn != nil && h.session == nil {
 			h.txconn.Close()
 			h.txconn = nil
 		}
 	}()
-	if h.txconn == nil {
+	if h.txconn == nil || (h.session != nil && !h.txconn.IsTx()) {
 		return errors.New("fail Commit: handler has no transactional connection")
 	}
 	if e := h.txconn.Commit(); e != nil {
-		return fmt.Errorf("fail Commit: %s", e.Error())
+		return fmt.Errorf("fail Commit: %w", e)
+	}
+	evs, tables := h.txEvents.take()
+	// records read by other hubs before the commit could be cached again after the write invalidated the cache
+	for _, t := range tables {
+		h.dropCache(t)
+	}
+	for _, ev := range evs {
+		h.publish(ev)
 	}
 	return nil
 }
@@ -45,16 +61,18 @@ func (h *Hub) Commit() error {
 // Rollback to reverts back all change into database
 func (h *Hub) Rollback() error {
 	defer func() {
-		if h != nil && h.txconn != nil {
+		// connection of session is kept until the session is closed
+		if h != nil && h.txconn != nil && h.session == nil {
 			h.txconn.Close()
 			h.txconn = nil
 		}
 	}()
-	if h.txconn == nil {
+	if h.txconn == nil || (h.session != nil && !h.txconn.IsTx()) {
 		return errors.New("fail Rollback: handler has no transactional connection")
 	}
+	h.txEvents.take()
 	if e := h.txconn.RollBack(); e != nil {
-		return fmt.Errorf("fail Rollback: %s", e.Error())
+		return fmt.Errorf("fail Rollback: %w", e)
 	}
 	return nil
 }
@@ -65,3 +83,28 @@ func (h *Hub) IsTx() bool {
 	}
 	return false
 }
+
+// errTxNotSupported is returned by BeginTx when connection does not support transaction
+var errTxNotSupported = errors.New("connection is not supporting transaction")
+
+// inTx run fn with transactional copy of the hub when driver support transaction, it is committed when fn returns
+// no error and rolled back otherwise. Hub that is already in transaction is passed as is. Support of transaction is
+// resolved on the connection of the transaction, so no other connection is taken from the pool while caller might
+// hold the last one
+func (h *Hub) inTx(fn func(ht *Hub) error) error {
+	if h.IsTx() {
+		return fn(h)
+	}
+	ht, err := h.BeginTx()
+	if errors.Is(err, errTxNotSupported) {
+		return fn(h)
+	}
+	if err != nil {
+		return err
+	}
+	if err = fn(ht); err != nil {
+		ht.Rollback()
+		return err
+	}
+	return ht.Commit()
+}
@@ -0,0 +1,458 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// ConflictStrategy define how UpsertMany treat row which key is already exist
+type ConflictStrategy int
+
+const (
+	// ConflictMerge update existing row with non nil fields of the model, nil fields keep existing value
+	ConflictMerge ConflictStrategy = iota
+	// ConflictReplace overwrite all non key fields of existing row with fields of the model
+	ConflictReplace
+	// ConflictSkip keep existing row as is
+	ConflictSkip
+)
+
+// Outcomes of a row written by UpsertMany
+const (
+	UpsertInserted = "inserted"
+	UpsertUpdated  = "updated"
+	UpsertSkipped  = "skipped"
+	UpsertFailed   = "failed"
+)
+
+// UpsertResult is outcome of a row of UpsertMany, Index is position of the row on models
+type UpsertResult struct {
+	Index   int
+	Outcome string
+	Err     error
+}
+
+type upsertOptions struct {
+	strategy  ConflictStrategy
+	batchSize int
+}
+
+// UpsertOption is option of UpsertMany
+type UpsertOption func(o *upsertOptions)
+
+// OnConflict set conflict strategy of UpsertMany, default is ConflictMerge
+func OnConflict(s ConflictStrategy) UpsertOption {
+	return func(o *upsertOptions) {
+		o.strategy = s
+	}
+}
+
+// UpsertBatchSize set number of rows written on each statement of UpsertMany, default is 500
+func UpsertBatchSize(n int) UpsertOption {
+	return func(o *upsertOptions) {
+		o.batchSize = n
+	}
+}
+
+// UpsertMany insert models, which should be slice of orm.DataModel, or update them when a row with the same keyFields
+// is already exist. keyFields are database field names, key of the model is used when it is empty.
+// Rows are written in batches using native upsert: ON CONFLICT on postgres and sqlite, ON DUPLICATE KEY on mysql and
+// update command with upsert on mongo, other drivers fall back to row by row write. On SQL drivers keyFields need to
+// be covered by unique index and the keys of a batch are read beforehand to tell inserted and updated rows apart.
+// On SQL drivers rows of a batch sharing the same key are written once using the last of them, the others are skipped.
+// It returns outcome for each row, error is returned when a batch could not be written at all
+func (h *Hub) UpsertMany(models interface{}, keyFields []string, opts ...UpsertOption) ([]UpsertResult, error) {
+	o := &upsertOptions{strategy: ConflictMerge, batchSize: 500}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.batchSize <= 0 {
+		o.batchSize = 500
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(models))
+	if rv.Kind() != reflect.Slice {
+		return nil, errors.New("fail UpsertMany: models should be slice of orm.DataModel")
+	}
+	if rv.Len() == 0 {
+		return []UpsertResult{}, nil
+	}
+
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return nil, &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	results := make([]UpsertResult, rv.Len())
+	rows := make([]upsertRow, 0, rv.Len())
+	tableName := ""
+	for i := 0; i < rv.Len(); i++ {
+		results[i].Index = i
+		item := rv.Index(i)
+		if item.Kind() != reflect.Ptr && item.CanAddr() {
+			item = item.Addr()
+		}
+		data, ok := item.Interface().(orm.DataModel)
+		if !ok {
+			return nil, fmt.Errorf("fail UpsertMany: item %d is not orm.DataModel", i)
+		}
+		data.SetThis(data)
+		if tableName == "" {
+			tableName = data.TableName()
+			if len(keyFields) == 0 {
+				keyFields, _ = data.GetID(conn)
+			}
+			if len(keyFields) == 0 {
+				return nil, errors.New("fail UpsertMany: key fields are mandatory for model without key")
+			}
+		}
+
+		if err = h.applyIDGenerator(conn, data); err == nil {
+			if err = h.applyDefaults(data); err == nil {
+				err = h.validate(data)
+			}
+		}
+		if err != nil {
+			results[i].Outcome, results[i].Err = UpsertFailed, err
+			continue
+		}
+		rows = append(rows, upsertRow{index: i, data: data, doc: modelDoc(conn, data)})
+	}
+
+	for start := 0; start < len(rows); start += o.batchSize {
+		end := start + o.batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch := rows[start:end]
+
+		switch {
+		case !isSQLDriver(conn):
+			err = upsertMongo(conn, h.table(tableName), keyFields, o.strategy, batch, results)
+		case upsertDialect(driverName(conn)) != "":
+			err = upsertSQL(conn, h.table(tableName), keyFields, o.strategy, batch, results)
+		default:
+			err = upsertEach(conn, h.table(tableName), keyFields, o.strategy, batch, results)
+		}
+		// failed batch could be partially written
+		h.invalidateCache(tableName)
+		if err != nil {
+			return results, fmt.Errorf("fail UpsertMany: batch %d. %w", start/o.batchSize+1, err)
+		}
+
+		for _, row := range batch {
+			if out := results[row.index].Outcome; out == UpsertInserted || out == UpsertUpdated {
+				if err = h.emit(conn, EventSave, tableName, row.data, nil); err != nil {
+					return results, fmt.Errorf("fail UpsertMany: %w", err)
+				}
+			}
+		}
+	}
+	return results, nil
+}
+
+type upsertRow struct {
+	index int
+	data  orm.DataModel
+	doc   toolkit.M
+}
+
+// modelDoc returns fields of the model as document keyed by database field name of the connection
+func modelDoc(conn dbflex.IConnection, data orm.DataModel) toolkit.M {
+	if tm, ok := data.(tagMapped); ok {
+		return tm.encodeDoc()
+	}
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	doc := toolkit.M{}
+	meta := MetaOf(rv.Type())
+	if meta == nil {
+		return doc
+	}
+	tag := conn.FieldNameTag()
+	for _, f := range meta.Fields {
+		if tag != "" && strings.Split(f.Tag.Get(tag), ",")[0] == "-" {
+			continue
+		}
+		v := roundDecimal(f, docValue(f.Value(rv).Interface()))
+		if ev, err := embedValue(conn, f, v); err == nil {
+			v = ev
+		}
+		doc[f.DbName(tag)] = v
+	}
+	return doc
+}
+
+// upsertDialect returns kind of upsert statement supported by SQL driver, empty if it has none
+func upsertDialect(driver string) string {
+	switch {
+	case strings.Contains(driver, "pg") || strings.Contains(driver, "postgres") || strings.Contains(driver, "sqlite"):
+		return "onconflict"
+	case strings.Contains(driver, "mysql"):
+		return "duplicatekey"
+	}
+	return ""
+}
+
+func keyFilter(doc toolkit.M, keyFields []string) *dbflex.Filter {
+	eqs := make([]*dbflex.Filter, len(keyFields))
+	for i, k := range keyFields {
+		eqs[i] = dbflex.Eq(k, doc.Get(k))
+	}
+	if len(eqs) == 1 {
+		return eqs[0]
+	}
+	return dbflex.And(eqs...)
+}
+
+func keyString(doc toolkit.M, keyFields []string) string {
+	parts := make([]string, len(keyFields))
+	for i, k := range keyFields {
+		parts[i] = fmt.Sprintf("%v", indirectValue(doc.Get(k)))
+	}
+	return strings.Join(parts, "|")
+}
+
+// existingKeys returns keys of the batch which are already exist on the table
+func existingKeys(conn dbflex.IConnection, tableName string, keyFields []string, batch []upsertRow) (map[string]bool, error) {
+	filters := make([]*dbflex.Filter, len(batch))
+	for i, row := range batch {
+		filters[i] = keyFilter(row.doc, keyFields)
+	}
+	cmd := dbflex.From(tableName).Select(keyFields...).Where(dbflex.Or(filters...))
+	cur := conn.Cursor(cmd, nil)
+	if err := cur.Error(); err != nil {
+		return nil, err
+	}
+	defer cur.Close()
+	found := []toolkit.M{}
+	if err := cur.Fetchs(&found, 0).Error(); err != nil {
+		return nil, err
+	}
+
+	res := map[string]bool{}
+	for _, m := range found {
+		res[keyString(m, keyFields)] = true
+	}
+	return res, nil
+}
+
+func upsertSQL(conn dbflex.IConnection, tableName string, keyFields []string, strategy ConflictStrategy, batch []upsertRow, results []UpsertResult) error {
+	exists, err := existingKeys(conn, tableName, keyFields, batch)
+	if err != nil {
+		return fmt.Errorf("read keys. %w", err)
+	}
+
+	// a statement could not write the same row twice, row having the same key with a later row of the batch is
+	// superseded by it and reported as skipped
+	batch, superseded := lastByKey(batch, keyFields)
+	for _, row := range superseded {
+		results[row.index].Outcome = UpsertSkipped
+	}
+
+	cols := []string{}
+	seen := map[string]bool{}
+	for _, row := range batch {
+		for k := range row.doc {
+			if !seen[k] {
+				seen[k] = true
+				cols = append(cols, k)
+			}
+		}
+	}
+	isKey := map[string]bool{}
+	for _, k := range keyFields {
+		isKey[k] = true
+	}
+
+	values := make([]string, len(batch))
+	for i, row := range batch {
+		literals := make([]string, len(cols))
+		for j, c := range cols {
+			literals[j] = sqlLiteral(driverName(conn), row.doc[c])
+		}
+		values[i] = "(" + strings.Join(literals, ", ") + ")"
+	}
+
+	dialect := upsertDialect(driverName(conn))
+	sets := []string{}
+	for _, c := range cols {
+		if isKey[c] {
+			continue
+		}
+		newValue := "EXCLUDED." + c
+		if dialect == "duplicatekey" {
+			newValue = "VALUES(" + c + ")"
+		}
+		if strategy == ConflictMerge {
+			if dialect == "duplicatekey" {
+				newValue = "COALESCE(" + newValue + ", " + c + ")"
+			} else {
+				newValue = "COALESCE(" + newValue + ", " + tableName + "." + c + ")"
+			}
+		}
+		sets = append(sets, c+" = "+newValue)
+	}
+
+	verb := "INSERT INTO "
+	if strategy == ConflictSkip && dialect == "duplicatekey" {
+		verb = "INSERT IGNORE INTO "
+	}
+	sql := verb + tableName + " (" + strings.Join(cols, ", ") + ") VALUES " + strings.Join(values, ", ")
+	switch {
+	case dialect == "onconflict" && (strategy == ConflictSkip || len(sets) == 0):
+		sql += " ON CONFLICT (" + strings.Join(keyFields, ", ") + ") DO NOTHING"
+	case dialect == "onconflict":
+		sql += " ON CONFLICT (" + strings.Join(keyFields, ", ") + ") DO UPDATE SET " + strings.Join(sets, ", ")
+	case strategy != ConflictSkip && len(sets) > 0:
+		sql += " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+	}
+
+	if _, err = conn.Execute(dbflex.SQL(sql), nil); err != nil {
+		return duplicateKey(err)
+	}
+
+	for _, row := range batch {
+		switch {
+		case !exists[keyString(row.doc, keyFields)]:
+			results[row.index].Outcome = UpsertInserted
+		case strategy == ConflictSkip:
+			results[row.index].Outcome = UpsertSkipped
+		default:
+			results[row.index].Outcome = UpsertUpdated
+		}
+	}
+	return nil
+}
+
+// lastByKey returns rows of the batch keeping only the last row of each key, and rows superseded by them
+func lastByKey(batch []upsertRow, keyFields []string) ([]upsertRow, []upsertRow) {
+	last := map[string]int{}
+	for i, row := range batch {
+		last[keyString(row.doc, keyFields)] = i
+	}
+	if len(last) == len(batch) {
+		return batch, nil
+	}
+	rows := make([]upsertRow, 0, len(last))
+	superseded := []upsertRow{}
+	for i, row := range batch {
+		if last[keyString(row.doc, keyFields)] == i {
+			rows = append(rows, row)
+		} else {
+			superseded = append(superseded, row)
+		}
+	}
+	return rows, superseded
+}
+
+func upsertMongo(conn dbflex.IConnection, tableName string, keyFields []string, strategy ConflictStrategy, batch []upsertRow, results []UpsertResult) error {
+	updates := make([]toolkit.M, len(batch))
+	for i, row := range batch {
+		q, err := mongoFilter(keyFilter(row.doc, keyFields))
+		if err != nil {
+			return err
+		}
+
+		var u interface{}
+		switch strategy {
+		case ConflictReplace:
+			u = row.doc
+		case ConflictSkip:
+			u = toolkit.M{"$setOnInsert": row.doc}
+		default:
+			set := toolkit.M{}
+			for k, v := range row.doc {
+				if indirectValue(v) != nil {
+					set[k] = v
+				}
+			}
+			u = toolkit.M{"$set": set}
+		}
+		updates[i] = toolkit.M{"q": q, "u": u, "upsert": true}
+	}
+
+	command := toolkit.M{}.Set("update", tableName).Set("updates", updates).Set("ordered", false)
+	res, err := conn.Execute(dbflex.From(tableName).Command("runcommand", command), nil)
+	if err != nil {
+		return err
+	}
+	reply := struct {
+		Upserted []struct {
+			Index int `json:"index" bson:"index"`
+		} `json:"upserted" bson:"upserted"`
+		WriteErrors []struct {
+			Index  int    `json:"index" bson:"index"`
+			ErrMsg string `json:"errmsg" bson:"errmsg"`
+		} `json:"writeErrors" bson:"writeErrors"`
+	}{}
+	if res != nil {
+		if err = toolkit.Serde(res, &reply, ""); err != nil {
+			return fmt.Errorf("unable to decode result. %w", err)
+		}
+	}
+
+	for _, row := range batch {
+		results[row.index].Outcome = UpsertUpdated
+		if strategy == ConflictSkip {
+			results[row.index].Outcome = UpsertSkipped
+		}
+	}
+	for _, u := range reply.Upserted {
+		if u.Index >= 0 && u.Index < len(batch) {
+			results[batch[u.Index].index].Outcome = UpsertInserted
+		}
+	}
+	for _, we := range reply.WriteErrors {
+		if we.Index >= 0 && we.Index < len(batch) {
+			results[batch[we.Index].index].Outcome = UpsertFailed
+			results[batch[we.Index].index].Err = duplicateKey(errors.New(we.ErrMsg))
+		}
+	}
+	return nil
+}
+
+// upsertEach write the rows one by one for drivers without native upsert
+func upsertEach(conn dbflex.IConnection, tableName string, keyFields []string, strategy ConflictStrategy, batch []upsertRow, results []UpsertResult) error {
+	exists, err := existingKeys(conn, tableName, keyFields, batch)
+	if err != nil {
+		return fmt.Errorf("read keys. %w", err)
+	}
+
+	for _, row := range batch {
+		res := &results[row.index]
+		if !exists[keyString(row.doc, keyFields)] {
+			if _, err = conn.Execute(dbflex.From(tableName).Insert(), toolkit.M{}.Set("data", row.doc)); err != nil {
+				res.Outcome, res.Err = UpsertFailed, duplicateKey(err)
+				continue
+			}
+			res.Outcome = UpsertInserted
+			continue
+		}
+		if strategy == ConflictSkip {
+			res.Outcome = UpsertSkipped
+			continue
+		}
+
+		fields := []string{}
+		for k, v := range row.doc {
+			if strategy == ConflictMerge && indirectValue(v) == nil {
+				continue
+			}
+			fields = append(fields, k)
+		}
+		cmd := dbflex.From(tableName).Update(fields...).Where(keyFilter(row.doc, keyFields))
+		if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", row.doc)); err != nil {
+			res.Outcome, res.Err = UpsertFailed, duplicateKey(err)
+			continue
+		}
+		res.Outcome = UpsertUpdated
+	}
+	return nil
+}
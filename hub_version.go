@@ -0,0 +1,153 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// ErrVersionConflict is returned by SaveAny and UpdateAny when the record is changed by other process after the
+// object was read
+var ErrVersionConflict = errors.New("record is changed by other process")
+
+type versionField struct {
+	field string
+	keys  []string
+}
+
+// SetVersionField enable optimistic concurrency of SaveAny and UpdateAny on the table. field holds etag of the record,
+// it is replaced by a new etag on every write and the new etag is set back into the object, so object should be a map
+// or pointer to struct carrying the etag it was read with. Write of object whose etag does not match the record
+// returns ErrVersionConflict, object with empty etag is inserted and fails when the record already exists.
+// keys are fields identifying the record, default is _id. Empty field remove the check
+func (h *Hub) SetVersionField(table, field string, keys ...string) *Hub {
+	if h.versionFields == nil {
+		h.versionFields = map[string]*versionField{}
+	}
+	if field == "" {
+		delete(h.versionFields, strings.ToLower(table))
+		return h
+	}
+	if len(keys) == 0 {
+		keys = []string{"_id"}
+	}
+	h.versionFields[strings.ToLower(table)] = &versionField{field: field, keys: keys}
+	return h
+}
+
+func (h *Hub) versionFieldOf(table string) *versionField {
+	return h.versionFields[strings.ToLower(table)]
+}
+
+// writeVersioned write object into table only when its etag matches the record, fields is fields to be updated, all
+// fields when empty
+func (h *Hub) writeVersioned(conn dbflex.IConnection, vf *versionField, table string, object interface{}, fields []string) error {
+	tag := conn.FieldNameTag()
+	current, _ := anyValue(object, tag, vf.field)
+	etag := stringOf(current)
+
+	where := make([]*dbflex.Filter, len(vf.keys))
+	for i, k := range vf.keys {
+		v, ok := anyValue(object, tag, k)
+		if !ok {
+			return fmt.Errorf("key %s is not found", k)
+		}
+		where[i] = dbflex.Eq(k, v)
+	}
+
+	next := toolkit.RandomString(32)
+	if !setAnyValue(object, tag, vf.field, next) {
+		return fmt.Errorf("version field %s could not be set, object should be a map or pointer to struct having the field", vf.field)
+	}
+
+	tableName := h.table(table)
+	if etag == "" {
+		if _, err := conn.Execute(dbflex.From(tableName).Insert(), toolkit.M{}.Set("data", object)); err != nil {
+			setAnyValue(object, tag, vf.field, current)
+			if err = duplicateKey(err); errors.Is(err, ErrDuplicateKey) {
+				return fmt.Errorf("%s already exists. %w", table, ErrVersionConflict)
+			}
+			return err
+		}
+		return nil
+	}
+
+	if len(fields) > 0 {
+		fields = append(fields, vf.field)
+	}
+	cmd := dbflex.From(tableName).Update(fields...).Where(dbflex.And(append(where, dbflex.Eq(vf.field, etag))...))
+	if _, err := conn.Execute(cmd, toolkit.M{}.Set("data", object)); err != nil {
+		setAnyValue(object, tag, vf.field, current)
+		return duplicateKey(err)
+	}
+
+	// update matching no record is not an error, read the etag back to know whether this write is the one applied
+	docs, err := fetchDocs(conn, dbflex.From(tableName).Select(vf.field).Where(dbflex.And(where...)).Take(1))
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 || stringOf(docs[0][vf.field]) != next {
+		setAnyValue(object, tag, vf.field, current)
+		return fmt.Errorf("%s. %w", table, ErrVersionConflict)
+	}
+	return nil
+}
+
+// anyValue returns value of field of map or struct by its database name
+func anyValue(object interface{}, tag, name string) (interface{}, bool) {
+	if m, ok := toM(object); ok {
+		v, ok := m[name]
+		return v, ok
+	}
+	rv := reflect.Indirect(reflect.ValueOf(object))
+	f := anyField(rv, tag, name)
+	if f == nil {
+		return nil, false
+	}
+	return f.Value(rv).Interface(), true
+}
+
+// setAnyValue set field of map or pointer to struct by its database name, returns false when it could not be set
+func setAnyValue(object interface{}, tag, name string, v interface{}) bool {
+	if m, ok := toM(object); ok {
+		m[name] = v
+		return true
+	}
+	rv := reflect.ValueOf(object)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return false
+	}
+	rv = rv.Elem()
+	f := anyField(rv, tag, name)
+	if f == nil {
+		return false
+	}
+	fv := f.Value(rv)
+	if v == nil {
+		fv.Set(reflect.Zero(fv.Type()))
+		return true
+	}
+	nv := reflect.ValueOf(v)
+	if !fv.CanSet() || !nv.Type().ConvertibleTo(fv.Type()) {
+		return false
+	}
+	fv.Set(nv.Convert(fv.Type()))
+	return true
+}
+
+func anyField(rv reflect.Value, tag, name string) *FieldMeta {
+	meta := MetaOf(rv.Type())
+	if meta == nil {
+		return nil
+	}
+	for _, f := range meta.Fields {
+		if f.DbName(tag) == name {
+			return f
+		}
+	}
+	return meta.Field(name)
+}
@@ -0,0 +1,350 @@
+package datahub
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// Default table names of webhook
+const (
+	DefaultWebhookTableName         = "DatahubWebhooks"
+	DefaultWebhookDeliveryTableName = "DatahubWebhookDeliveries"
+)
+
+// Webhook delivery status
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// WebhookSignatureHeader is header holding HMAC SHA256 signature of the payload, format is sha256=<hex>
+const WebhookSignatureHeader = "X-Datahub-Signature"
+
+// Webhook is subscription of an URL to data events of a table
+type Webhook struct {
+	ID    string `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	Table string `bson:"table" json:"table" sqlname:"table"`
+	// Ops is comma separated operations to be delivered, empty means all operations
+	Ops string `bson:"ops" json:"ops" sqlname:"ops"`
+	// Filter is JSON filter document (see FilterFromM) matched against the data of the event
+	Filter string `bson:"filter" json:"filter" sqlname:"filter"`
+	URL    string `bson:"url" json:"url" sqlname:"url"`
+	Secret string `bson:"secret" json:"secret" sqlname:"secret"`
+	Active bool   `bson:"active" json:"active" sqlname:"active"`
+}
+
+// WebhookDelivery is a payload to be delivered to a webhook
+type WebhookDelivery struct {
+	ID          string    `bson:"_id" json:"_id" sqlname:"_id" key:"1"`
+	WebhookID   string    `bson:"webhook_id" json:"webhook_id" sqlname:"webhook_id"`
+	EventID     string    `bson:"event_id" json:"event_id" sqlname:"event_id"`
+	URL         string    `bson:"url" json:"url" sqlname:"url"`
+	Payload     string    `bson:"payload" json:"payload" sqlname:"payload"`
+	Signature   string    `bson:"signature" json:"signature" sqlname:"signature"`
+	Status      string    `bson:"status" json:"status" sqlname:"status"`
+	Attempts    int       `bson:"attempts" json:"attempts" sqlname:"attempts"`
+	NextAttempt time.Time `bson:"next_attempt" json:"next_attempt" sqlname:"next_attempt"`
+	LastError   string    `bson:"last_error" json:"last_error" sqlname:"last_error"`
+	Created     time.Time `bson:"created" json:"created" sqlname:"created"`
+}
+
+// WebhookQueueSize is number of events waiting to be stored as deliveries by a WebhookDispatcher
+var WebhookQueueSize = 1024
+
+// WebhookDispatcher deliver data events to webhooks stored on the hub. It is an EventPublisher, events are
+// stored as deliveries and sent by Deliver with retries, delivery failing MaxAttempts times is marked as dead.
+// Publish only queue the event, deliveries are stored by background goroutine so the write publishing the event
+// does not wait for another connection of the hub. Call Close to store queued events before the process exits
+//
+//	d := h.NewWebhookDispatcher()
+//	h.AddPublisher(d)
+//	stop := d.Start(time.Second)
+type WebhookDispatcher struct {
+	Client      *http.Client
+	MaxAttempts int
+	// Backoff is delay before first retry, it is doubled on each attempt
+	Backoff time.Duration
+
+	h             *Hub
+	webhookTable  string
+	deliveryTable string
+
+	mtx    sync.Mutex
+	queue  chan *DataEvent
+	done   chan bool
+	closed bool
+}
+
+// NewWebhookDispatcher create webhook dispatcher using default table names
+func (h *Hub) NewWebhookDispatcher() *WebhookDispatcher {
+	return &WebhookDispatcher{
+		Client:        &http.Client{Timeout: 30 * time.Second},
+		MaxAttempts:   8,
+		Backoff:       30 * time.Second,
+		h:             h,
+		webhookTable:  DefaultWebhookTableName,
+		deliveryTable: DefaultWebhookDeliveryTableName,
+	}
+}
+
+// SetTableNames set name of webhook and delivery table
+func (d *WebhookDispatcher) SetTableNames(webhookTable, deliveryTable string) *WebhookDispatcher {
+	d.webhookTable = webhookTable
+	d.deliveryTable = deliveryTable
+	return d
+}
+
+// AddWebhook save webhook subscription, ID is generated when it is empty
+func (d *WebhookDispatcher) AddWebhook(w *Webhook) error {
+	if w.ID == "" {
+		w.ID = NewUUIDv7().(string)
+	}
+	if w.Filter != "" {
+		if _, err := parseWebhookFilter(w.Filter); err != nil {
+			return fmt.Errorf("fail AddWebhook: invalid filter. %w", err)
+		}
+	}
+	if err := d.ensureTables(); err != nil {
+		return fmt.Errorf("fail AddWebhook: %w", err)
+	}
+	return d.h.SaveAny(d.webhookTable, w)
+}
+
+// RemoveWebhook delete webhook subscription
+func (d *WebhookDispatcher) RemoveWebhook(id string) error {
+	_, err := d.h.Execute(dbflex.From(d.h.table(d.webhookTable)).Delete().Where(dbflex.Eq("_id", id)), nil)
+	return err
+}
+
+func (d *WebhookDispatcher) ensureTables() error {
+	return d.h.Native(func(conn dbflex.IConnection) error {
+		if !conn.HasTable(d.h.table(d.webhookTable)) {
+			if err := conn.EnsureTable(d.h.table(d.webhookTable), []string{"_id"}, new(Webhook)); err != nil {
+				return err
+			}
+		}
+		if !conn.HasTable(d.h.table(d.deliveryTable)) {
+			if err := conn.EnsureTable(d.h.table(d.deliveryTable), []string{"_id"}, new(WebhookDelivery)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func parseWebhookFilter(s string) (*dbflex.Filter, error) {
+	m := toolkit.M{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		return nil, err
+	}
+	return FilterFromM(m)
+}
+
+// Publish queue the event, deliveries of the event for every matching webhook are stored in background.
+// Error is returned when the dispatcher is closed or its queue is full
+func (d *WebhookDispatcher) Publish(ev *DataEvent) error {
+	if ev.Table == d.webhookTable || ev.Table == d.deliveryTable {
+		return nil
+	}
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.closed {
+		return fmt.Errorf("webhook dispatcher is closed, event %s is dropped", ev.ID)
+	}
+	if d.queue == nil {
+		d.queue = make(chan *DataEvent, WebhookQueueSize)
+		d.done = make(chan bool)
+		go d.storeQueued()
+	}
+	select {
+	case d.queue <- ev:
+		return nil
+	default:
+		return fmt.Errorf("webhook queue is full, event %s is dropped", ev.ID)
+	}
+}
+
+func (d *WebhookDispatcher) storeQueued() {
+	defer close(d.done)
+	for ev := range d.queue {
+		if err := d.store(ev); err != nil {
+			d.h.Logger().Error("unable to store webhook deliveries", "table", ev.Table, "op", ev.Op, "event", ev.ID,
+				"error", err.Error())
+		}
+	}
+}
+
+// Close stop accepting new events and wait until queued events are stored as deliveries
+func (d *WebhookDispatcher) Close() {
+	d.mtx.Lock()
+	if d.closed {
+		d.mtx.Unlock()
+		return
+	}
+	d.closed = true
+	queue, done := d.queue, d.done
+	d.mtx.Unlock()
+
+	if queue != nil {
+		close(queue)
+		<-done
+	}
+}
+
+// store save deliveries of the event for every matching webhook
+func (d *WebhookDispatcher) store(ev *DataEvent) error {
+	hooks := []*Webhook{}
+	parm := dbflex.NewQueryParam().SetWhere(dbflex.And(dbflex.Eq("table", ev.Table), dbflex.Eq("active", true)))
+	if err := d.h.internal().PopulateByParm(d.webhookTable, parm, &hooks); err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	rec := toolkit.M{}
+	if ev.Data != nil {
+		if bs, err := json.Marshal(ev.Data); err == nil {
+			json.Unmarshal(bs, &rec)
+		}
+	}
+
+	for _, w := range hooks {
+		if w.Ops != "" && !containsFold(strings.Split(w.Ops, ","), ev.Op) {
+			continue
+		}
+		if w.Filter != "" {
+			f, err := parseWebhookFilter(w.Filter)
+			if err != nil || !MatchFilter(f, rec) {
+				continue
+			}
+		}
+		del := &WebhookDelivery{
+			ID:          NewUUIDv7().(string),
+			WebhookID:   w.ID,
+			EventID:     ev.ID,
+			URL:         w.URL,
+			Payload:     string(payload),
+			Signature:   SignWebhook(w.Secret, payload),
+			Status:      DeliveryPending,
+			NextAttempt: time.Now(),
+			Created:     time.Now(),
+		}
+		if err = d.h.SaveAny(d.deliveryTable, del); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SignWebhook returns signature of a payload, receiver should compare it with WebhookSignatureHeader
+func SignWebhook(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Deliver send pending deliveries which are due, returns number of processed deliveries
+func (d *WebhookDispatcher) Deliver(batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	dels := []*WebhookDelivery{}
+	parm := dbflex.NewQueryParam().
+		SetWhere(dbflex.And(dbflex.Eq("status", DeliveryPending), dbflex.Lte("next_attempt", time.Now()))).
+		SetSort("next_attempt").SetTake(batchSize)
+	if err := d.h.internal().PopulateByParm(d.deliveryTable, parm, &dels); err != nil {
+		return 0, fmt.Errorf("fail Deliver: %w", err)
+	}
+
+	for _, del := range dels {
+		del.Attempts++
+		if err := d.send(del); err != nil {
+			del.LastError = err.Error()
+			if del.Attempts >= d.MaxAttempts {
+				del.Status = DeliveryDead
+				d.h.Logger().Warn("webhook delivery is dead", "delivery", del.ID, "url", del.URL, "error", err.Error())
+			} else {
+				del.NextAttempt = time.Now().Add(d.Backoff * time.Duration(1<<uint(del.Attempts-1)))
+			}
+		} else {
+			del.Status = DeliveryDelivered
+			del.LastError = ""
+		}
+		if err := d.h.SaveAny(d.deliveryTable, del); err != nil {
+			return 0, fmt.Errorf("fail Deliver: %w", err)
+		}
+	}
+	return len(dels), nil
+}
+
+func (d *WebhookDispatcher) send(del *WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, del.URL, bytes.NewBufferString(del.Payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, del.Signature)
+	req.Header.Set("X-Datahub-Event", del.EventID)
+	req.Header.Set("X-Datahub-Delivery", del.ID)
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("receiver returns %s", resp.Status)
+	}
+	return nil
+}
+
+// Start run Deliver every interval until returned stop function is called, stop function is safe to be called more
+// than once
+func (d *WebhookDispatcher) Start(every time.Duration) func() {
+	stop := make(chan bool)
+	var once sync.Once
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := d.Deliver(100); err != nil {
+					d.h.Logger().Error("webhook deliver fail", "error", err.Error())
+				}
+			}
+		}
+	}()
+	return func() { once.Do(func() { close(stop) }) }
+}
+
+var _ EventPublisher = new(WebhookDispatcher)
@@ -0,0 +1,370 @@
+package datahub
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// ErrWriteBehindClosed is returned when writing to closed WriteBehind
+var ErrWriteBehindClosed = errors.New("write behind queue is closed")
+
+// WriteBehindEntry is a write stored on the queue file
+type WriteBehindEntry struct {
+	Op    string          `json:"op"`
+	Table string          `json:"table"`
+	Data  json.RawMessage `json:"data"`
+	Time  time.Time       `json:"time"`
+}
+
+// WriteBehind is durable write behind queue. Writes are appended to a local file and drained to the database in
+// the order they are written, so writes are not lost when the database is not reachable for a while. A write is
+// removed from the file once it is written to the database, write which is interrupted by crash is replayed hence
+// delivery is at least once, replayed insert failing with ErrDuplicateKey is treated as written. Write which could
+// never succeed, ie: invalid data or model which is not registered, is moved to dead letter file, see DeadLetterPath.
+// Models are encoded as JSON, so their JSON tags should cover fields being stored
+type WriteBehind struct {
+	h    *Hub
+	path string
+
+	mtx      sync.Mutex
+	drainMtx sync.Mutex
+	file     *os.File
+	entries  []WriteBehindEntry
+	types    map[string]reflect.Type
+	closed   bool
+	stop     chan bool
+	done     chan bool
+}
+
+// NewWriteBehind open write behind queue stored on path, writes left by previous process are loaded and will be
+// drained. drainInterval is how often the queue is drained in background, 0 means it is only drained by Drain
+func (h *Hub) NewWriteBehind(path string, drainInterval time.Duration) (*WriteBehind, error) {
+	q := &WriteBehind{h: h, path: path, types: map[string]reflect.Type{}, stop: make(chan bool), done: make(chan bool)}
+	if err := q.load(); err != nil {
+		return nil, fmt.Errorf("fail NewWriteBehind: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("fail NewWriteBehind: %w", err)
+	}
+	q.file = f
+
+	if drainInterval <= 0 {
+		close(q.done)
+		return q, nil
+	}
+	go func() {
+		defer close(q.done)
+		ticker := time.NewTicker(drainInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-q.stop:
+				return
+			case <-ticker.C:
+				if n, err := q.Drain(); err != nil {
+					q.h.Logger().Warn("write behind drain is paused", "drained", n, "pending", q.Pending(), "error", err.Error())
+				}
+			}
+		}
+	}()
+	return q, nil
+}
+
+func (q *WriteBehind) load() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := WriteBehindEntry{}
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// last line could be partially written when process crashed
+			q.h.Logger().Warn("write behind entry is skipped", "path", q.path, "error", err.Error())
+			continue
+		}
+		q.entries = append(q.entries, e)
+	}
+	return scanner.Err()
+}
+
+// Register register models which writes are on the queue, models written using the queue are registered automatically.
+// Writes left by previous process can only be drained once their models are registered, so models should be
+// registered before the first drain, otherwise their writes are moved to dead letter file
+func (q *WriteBehind) Register(models ...orm.DataModel) *WriteBehind {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	for _, m := range models {
+		m.SetThis(m)
+		q.types[m.TableName()] = reflect.Indirect(reflect.ValueOf(m)).Type()
+	}
+	return q
+}
+
+// Save queue save of the model
+func (q *WriteBehind) Save(data orm.DataModel) error {
+	return q.append("save", data)
+}
+
+// Insert queue insert of the model
+func (q *WriteBehind) Insert(data orm.DataModel) error {
+	return q.append("insert", data)
+}
+
+// Update queue update of the model
+func (q *WriteBehind) Update(data orm.DataModel) error {
+	return q.append("update", data)
+}
+
+// Delete queue delete of the model
+func (q *WriteBehind) Delete(data orm.DataModel) error {
+	return q.append("delete", data)
+}
+
+func (q *WriteBehind) append(op string, data orm.DataModel) error {
+	data.SetThis(data)
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("fail WriteBehind.%s: %w", op, err)
+	}
+	e := WriteBehindEntry{Op: op, Table: data.TableName(), Data: bs, Time: time.Now()}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("fail WriteBehind.%s: %w", op, err)
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if q.closed {
+		return ErrWriteBehindClosed
+	}
+	q.types[e.Table] = reflect.Indirect(reflect.ValueOf(data)).Type()
+	if _, err = q.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("fail WriteBehind.%s: %w", op, err)
+	}
+	if err = q.file.Sync(); err != nil {
+		return fmt.Errorf("fail WriteBehind.%s: %w", op, err)
+	}
+	q.entries = append(q.entries, e)
+	return nil
+}
+
+// Pending returns number of writes waiting to be drained
+func (q *WriteBehind) Pending() int {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return len(q.entries)
+}
+
+// Drain write queued writes to the database in order. Write failing permanently is moved to dead letter file, on other
+// error it stops so order is kept and the write is retried on next drain. Returns number of drained writes, dead
+// letters included
+func (q *WriteBehind) Drain() (int, error) {
+	q.drainMtx.Lock()
+	defer q.drainMtx.Unlock()
+	q.mtx.Lock()
+	closed := q.closed
+	q.mtx.Unlock()
+	if closed {
+		return 0, ErrWriteBehindClosed
+	}
+
+	drained := 0
+	var err error
+	for {
+		q.mtx.Lock()
+		if len(q.entries) == 0 {
+			q.mtx.Unlock()
+			break
+		}
+		e := q.entries[0]
+		t, ok := q.types[e.Table]
+		q.mtx.Unlock()
+
+		if !ok {
+			err = &permanentError{fmt.Errorf("model of %s is not registered", e.Table)}
+		} else {
+			err = q.apply(e, t)
+		}
+		if err != nil {
+			if !isPermanent(err) {
+				break
+			}
+			if derr := q.deadLetter(e, err); derr != nil {
+				err = fmt.Errorf("unable to write dead letter. %w", derr)
+				break
+			}
+			q.h.Logger().Warn("write behind entry is moved to dead letter", "table", e.Table, "op", e.Op,
+				"error", err.Error())
+			err = nil
+		}
+		q.mtx.Lock()
+		q.entries = q.entries[1:]
+		q.mtx.Unlock()
+		drained++
+	}
+
+	if drained > 0 {
+		if cerr := q.compact(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return drained, fmt.Errorf("fail WriteBehind.Drain: %w", err)
+	}
+	return drained, nil
+}
+
+func (q *WriteBehind) apply(e WriteBehindEntry, t reflect.Type) error {
+	data, ok := reflect.New(t).Interface().(orm.DataModel)
+	if !ok {
+		return &permanentError{fmt.Errorf("model of %s is not orm.DataModel", e.Table)}
+	}
+	if err := json.Unmarshal(e.Data, data); err != nil {
+		return &permanentError{fmt.Errorf("decode %s. %w", e.Table, err)}
+	}
+	data.SetThis(data)
+
+	switch e.Op {
+	case "insert":
+		// insert interrupted after it was written is replayed
+		if err := q.h.Insert(data); err != nil && !errors.Is(err, ErrDuplicateKey) {
+			return err
+		}
+		return nil
+	case "update":
+		return q.h.Update(data)
+	case "delete":
+		return q.h.Delete(data)
+	default:
+		return q.h.Save(data)
+	}
+}
+
+// DeadLetterPath returns path of file keeping writes which could not be drained, one JSON encoded DeadLetter per line
+func (q *WriteBehind) DeadLetterPath() string {
+	return q.path + ".dead"
+}
+
+// DeadLetter is write moved out of the queue as it failed permanently
+type DeadLetter struct {
+	Entry  WriteBehindEntry `json:"entry"`
+	Error  string           `json:"error"`
+	Failed time.Time        `json:"failed"`
+}
+
+func (q *WriteBehind) deadLetter(e WriteBehindEntry, cause error) error {
+	line, err := json.Marshal(DeadLetter{Entry: e, Error: cause.Error(), Failed: time.Now()})
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(q.DeadLetterPath(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// permanentError is write which would fail on every retry
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// isPermanent returns true when retrying the write would not succeed: invalid data, rejected by guard or constraint
+func isPermanent(err error) bool {
+	var (
+		perr *permanentError
+		verr *ValidationError
+		gerr *GuardError
+		cerr *ConstraintError
+		derr *DecodeError
+	)
+	return errors.As(err, &perr) || errors.As(err, &verr) || errors.As(err, &gerr) || errors.As(err, &cerr) ||
+		errors.As(err, &derr) || errors.Is(err, ErrReadOnly)
+}
+
+// compact rewrite the queue file with pending writes only
+func (q *WriteBehind) compact() error {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+
+	tmp := q.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, e := range q.entries {
+		line, _ := json.Marshal(e)
+		w.Write(append(line, '\n'))
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, q.path); err != nil {
+		return err
+	}
+
+	nf, err := os.OpenFile(q.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	q.file.Close()
+	q.file = nf
+	return nil
+}
+
+// Close stop background drain and close the queue file, pending writes stay on the file and are drained by next
+// WriteBehind opened on the same path. Call Drain before Close to write them now
+func (q *WriteBehind) Close() error {
+	q.mtx.Lock()
+	if q.closed {
+		q.mtx.Unlock()
+		return nil
+	}
+	q.closed = true
+	q.mtx.Unlock()
+
+	select {
+	case <-q.done:
+	default:
+		close(q.stop)
+		<-q.done
+	}
+
+	q.drainMtx.Lock()
+	defer q.drainMtx.Unlock()
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	return q.file.Close()
+}
@@ -0,0 +1,300 @@
+package datahub
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// IDGenerator generate new ID for a model which key field is empty
+type IDGenerator interface {
+	NewID() interface{}
+}
+
+// IDGeneratorE is IDGenerator which could fail, hub calls GenerateID instead of NewID when it is implemented so the
+// error fails the write instead of panics
+type IDGeneratorE interface {
+	IDGenerator
+	GenerateID() (interface{}, error)
+}
+
+// IDGeneratorFunc is function that implements IDGenerator
+type IDGeneratorFunc func() interface{}
+
+// NewID call the function
+func (fn IDGeneratorFunc) NewID() interface{} {
+	return fn()
+}
+
+// IDGenTag is struct tag used to define which IDGenerator to be used for a field, ie: `idgen:"ulid"`
+const IDGenTag = "idgen"
+
+var (
+	idGenerators = map[string]IDGenerator{
+		"uuidv7":    IDGeneratorFunc(NewUUIDv7),
+		"ulid":      IDGeneratorFunc(NewULID),
+		"snowflake": defaultSnowflakeGen{},
+	}
+	idGeneratorMtx = new(sync.RWMutex)
+)
+
+// RegisterIDGenerator register an IDGenerator to be used by idgen tag. uuidv7, ulid and snowflake are registered by default
+func RegisterIDGenerator(name string, gen IDGenerator) {
+	idGeneratorMtx.Lock()
+	defer idGeneratorMtx.Unlock()
+	idGenerators[strings.ToLower(name)] = gen
+}
+
+// GetIDGenerator returns registered IDGenerator
+func GetIDGenerator(name string) (IDGenerator, bool) {
+	idGeneratorMtx.RLock()
+	defer idGeneratorMtx.RUnlock()
+	gen, ok := idGenerators[strings.ToLower(name)]
+	return gen, ok
+}
+
+// SetIDGenerator set default IDGenerator for key fields that do not have idgen tag.
+// Set it to nil to only generate ID for fields with idgen tag
+func (h *Hub) SetIDGenerator(gen IDGenerator) *Hub {
+	h.idGenerator = gen
+	return h
+}
+
+// applyIDGenerator fill empty fields tagged with idgen, and empty key fields when hub has default IDGenerator
+func (h *Hub) applyIDGenerator(conn dbflex.IConnection, data orm.DataModel) error {
+	return h.generateIDs(conn.KeyNameTag(), data)
+}
+
+// generateIDs is applyIDGenerator using given key tag, key is used when it is empty
+func (h *Hub) generateIDs(keyTag string, data orm.DataModel) error {
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	meta := MetaOf(rv.Type())
+	if meta == nil {
+		return nil
+	}
+
+	if keyTag == "" {
+		keyTag = "key"
+	}
+
+	for _, f := range meta.Fields {
+		if f.IDGen == "-" || (f.IDGen == "" && (h.idGenerator == nil || !f.IsKey(keyTag))) {
+			continue
+		}
+		fv := f.Value(rv)
+		if !fv.CanSet() || !fv.IsZero() {
+			continue
+		}
+
+		gen := h.idGenerator
+		if f.IDGen != "" {
+			g, ok := GetIDGenerator(f.IDGen)
+			if !ok {
+				return fmt.Errorf("id generator %s for field %s is not registered", f.IDGen, f.Name)
+			}
+			gen = g
+		}
+
+		var v interface{}
+		if ge, ok := gen.(IDGeneratorE); ok {
+			var err error
+			if v, err = ge.GenerateID(); err != nil {
+				return fmt.Errorf("unable to generate id of field %s. %w", f.Name, err)
+			}
+		} else {
+			v = gen.NewID()
+		}
+
+		id := reflect.ValueOf(v)
+		switch {
+		case id.Type().AssignableTo(fv.Type()):
+			fv.Set(id)
+		case id.Type().ConvertibleTo(fv.Type()) && id.Kind() != reflect.String && fv.Kind() != reflect.String:
+			fv.Set(id.Convert(fv.Type()))
+		case fv.Kind() == reflect.String:
+			fv.SetString(fmt.Sprintf("%v", id.Interface()))
+		default:
+			return fmt.Errorf("id generator returns %s which can't be assigned to field %s", id.Type().String(), f.Name)
+		}
+	}
+	return nil
+}
+
+// NewUUIDv7 generate time ordered UUID version 7 as defined on RFC 9562
+func NewUUIDv7() interface{} {
+	var b [16]byte
+	rand.Read(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = (b[6] & 0x0f) | 0x70
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	h := hex.EncodeToString(b[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID generate Universally Unique Lexicographically Sortable Identifier
+func NewULID() interface{} {
+	var b [16]byte
+	rand.Read(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+
+	// 128 bits encoded as 26 characters of 5 bits, first character only hold 3 bits
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordBase32[lo&0x1f]
+		lo = (lo >> 5) | (hi << 59)
+		hi >>= 5
+	}
+	return string(out)
+}
+
+// Snowflake generate 64 bit time ordered ID composed by 41 bit milliseconds since epoch, 10 bit node and 12 bit sequence
+type Snowflake struct {
+	node  int64
+	epoch int64
+	last  int64
+	seq   int64
+	mtx   sync.Mutex
+}
+
+// SnowflakeEpoch is default epoch of snowflake ID, 2020-01-01 UTC
+var SnowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeNodeEnv is environment variable holding node number (0 - 1023) of the snowflake generator registered by
+// default. When it is not set, node is derived from host name and process id, set it to a unique value for each
+// process when more than one process generate snowflake IDs for the same tables
+const SnowflakeNodeEnv = "DATAHUB_NODE_ID"
+
+var (
+	snowflakeNodes   = map[int64]bool{}
+	snowflakeNodeMtx = new(sync.Mutex)
+
+	defaultSnowflake     *Snowflake
+	defaultSnowflakeErr  error
+	defaultSnowflakeOnce sync.Once
+)
+
+// NewSnowflakeNode create snowflake generator for given node number (0 - 1023). It returns error when node is out of
+// range or is already used by other generator of this process, two generators with the same node produce the same IDs
+func NewSnowflakeNode(node int64) (*Snowflake, error) {
+	if node < 0 || node > 0x3ff {
+		return nil, fmt.Errorf("snowflake node %d is out of range 0 - 1023", node)
+	}
+
+	snowflakeNodeMtx.Lock()
+	defer snowflakeNodeMtx.Unlock()
+	if snowflakeNodes[node] {
+		return nil, fmt.Errorf("snowflake node %d is already used", node)
+	}
+	snowflakeNodes[node] = true
+	return &Snowflake{node: node, epoch: SnowflakeEpoch.UnixMilli()}, nil
+}
+
+// NewSnowflake is NewSnowflakeNode that panics on error
+func NewSnowflake(node int64) *Snowflake {
+	s, err := NewSnowflakeNode(node)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// defaultSnowflakeGen is snowflake generator registered by default, the generator is created on first use so node
+// could be set by SnowflakeNodeEnv or taken by NewSnowflakeNode beforehand. Error creating it is kept and returned
+// by every GenerateID
+type defaultSnowflakeGen struct{}
+
+// NewID panics when the generator could not be created
+func (g defaultSnowflakeGen) NewID() interface{} {
+	id, err := g.GenerateID()
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+// GenerateID returns error when the generator could not be created, ie: invalid SnowflakeNodeEnv
+func (defaultSnowflakeGen) GenerateID() (interface{}, error) {
+	defaultSnowflakeOnce.Do(func() {
+		defaultSnowflake, defaultSnowflakeErr = defaultSnowflakeNode()
+	})
+	if defaultSnowflakeErr != nil {
+		return nil, defaultSnowflakeErr
+	}
+	return defaultSnowflake.NewID(), nil
+}
+
+// defaultSnowflakeNode create snowflake generator using node from SnowflakeNodeEnv, or derived from host name and
+// process id. Derived node is moved to the next free node when it is already used by this process
+func defaultSnowflakeNode() (*Snowflake, error) {
+	if v := strings.TrimSpace(os.Getenv(SnowflakeNodeEnv)); v != "" {
+		node, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", SnowflakeNodeEnv, v, err)
+		}
+		return NewSnowflakeNode(node)
+	}
+
+	host, _ := os.Hostname()
+	hs := fnv.New32a()
+	hs.Write([]byte(host + ":" + strconv.Itoa(os.Getpid())))
+	node := int64(hs.Sum32() & 0x3ff)
+	for i := int64(0); i <= 0x3ff; i++ {
+		if s, err := NewSnowflakeNode((node + i) & 0x3ff); err == nil {
+			return s, nil
+		}
+	}
+	return nil, errors.New("no free snowflake node")
+}
+
+// NewID generate new snowflake ID as int64
+func (s *Snowflake) NewID() interface{} {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := time.Now().UnixMilli()
+	if now < s.last {
+		now = s.last
+	}
+	if now == s.last {
+		s.seq = (s.seq + 1) & 0xfff
+		if s.seq == 0 {
+			for now <= s.last {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Now().UnixMilli()
+			}
+		}
+	} else {
+		s.seq = 0
+	}
+	s.last = now
+	return ((now - s.epoch) << 22) | (s.node << 12) | s.seq
+}
@@ -0,0 +1,135 @@
+// Package kafkapub publish data events of datahub.Hub to Kafka
+//
+//	w := &kafka.Writer{Addr: kafka.TCP("localhost:9092"), RequiredAcks: kafka.RequireAll}
+//	h.AddPublisher(kafkapub.New(w, kafkapub.Options{})).EnableOutbox("")
+//	stop := h.StartOutboxRelay(time.Second, 100)
+//
+// Using outbox, events are delivered at least once, consumer should deduplicate using event id
+package kafkapub
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ariefdarmawan/datahub"
+	"github.com/segmentio/kafka-go"
+)
+
+// Serializer encode key and value of the message of an event
+type Serializer interface {
+	Key(ev *datahub.DataEvent) ([]byte, error)
+	Value(ev *datahub.DataEvent) ([]byte, error)
+}
+
+// JSONSerializer encode event as JSON, key is keys of the record or event id when record has no key
+type JSONSerializer struct{}
+
+// Key returns message key
+func (JSONSerializer) Key(ev *datahub.DataEvent) ([]byte, error) {
+	if len(ev.Keys) == 0 {
+		return []byte(ev.ID), nil
+	}
+	return json.Marshal(ev.Keys)
+}
+
+// Value returns message value
+func (JSONSerializer) Value(ev *datahub.DataEvent) ([]byte, error) {
+	return json.Marshal(ev)
+}
+
+// Envelope wrap event with schema information, so payload can be switched to Avro or other schema based format
+// without changing consumers contract
+type Envelope struct {
+	Schema  string             `json:"schema"`
+	Version int                `json:"version"`
+	Payload *datahub.DataEvent `json:"payload"`
+}
+
+// EnvelopeSerializer encode event as JSON Envelope
+type EnvelopeSerializer struct {
+	Schema  string
+	Version int
+}
+
+// Key returns message key
+func (s EnvelopeSerializer) Key(ev *datahub.DataEvent) ([]byte, error) {
+	return JSONSerializer{}.Key(ev)
+}
+
+// Value returns message value
+func (s EnvelopeSerializer) Value(ev *datahub.DataEvent) ([]byte, error) {
+	schema := s.Schema
+	if schema == "" {
+		schema = "datahub.DataEvent"
+	}
+	version := s.Version
+	if version == 0 {
+		version = 1
+	}
+	return json.Marshal(Envelope{Schema: schema, Version: version, Payload: ev})
+}
+
+// Options of the publisher
+type Options struct {
+	// Topic returns topic of an event, default is datahub.<table>
+	Topic func(ev *datahub.DataEvent) string
+	// Serializer of the messages, default is JSONSerializer
+	Serializer Serializer
+	// Timeout of each publish, default is 10s
+	Timeout time.Duration
+}
+
+// Publisher implements datahub.EventPublisher writing events to Kafka
+type Publisher struct {
+	w    *kafka.Writer
+	opts Options
+}
+
+// New create publisher using given writer. Writer should not have topic set, topic is defined per message
+func New(w *kafka.Writer, opts Options) *Publisher {
+	if opts.Topic == nil {
+		opts.Topic = func(ev *datahub.DataEvent) string {
+			return "datahub." + ev.Table
+		}
+	}
+	if opts.Serializer == nil {
+		opts.Serializer = JSONSerializer{}
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Publisher{w: w, opts: opts}
+}
+
+// Publish write event to its topic
+func (p *Publisher) Publish(ev *datahub.DataEvent) error {
+	key, err := p.opts.Serializer.Key(ev)
+	if err != nil {
+		return err
+	}
+	value, err := p.opts.Serializer.Value(ev)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+	defer cancel()
+	return p.w.WriteMessages(ctx, kafka.Message{
+		Topic: p.opts.Topic(ev),
+		Key:   key,
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(ev.ID)},
+			{Key: "op", Value: []byte(ev.Op)},
+		},
+		Time: ev.Time,
+	})
+}
+
+// Close close the writer
+func (p *Publisher) Close() error {
+	return p.w.Close()
+}
+
+var _ datahub.EventPublisher = new(Publisher)
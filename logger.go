@@ -0,0 +1,104 @@
+package datahub
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/eaciit/toolkit"
+)
+
+// Logger is logger used by the hub. kv is list of key and value pairs of structured fields
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+// SetLogger set logger used by the hub, it take precedence over LogEngine set by SetLog
+func (h *Hub) SetLogger(l Logger) *Hub {
+	h.logger = l
+	return h
+}
+
+// Logger returns logger of the hub. When it is not set, it returns Logger that write to LogEngine of the hub.
+// Metadata of the hub, see WithMeta, is added to every log
+func (h *Hub) Logger() Logger {
+	l := h.logger
+	if l == nil {
+		l = NewLogEngineLogger(h.Log())
+	}
+	if fields := h.metaFields(); len(fields) > 0 {
+		return &metaLogger{Logger: l, fields: fields}
+	}
+	return l
+}
+
+// NewLogEngineLogger create Logger that write to toolkit.LogEngine, fields are written as key=value after the message
+func NewLogEngineLogger(l *toolkit.LogEngine) Logger {
+	return &logEngineLogger{l}
+}
+
+type logEngineLogger struct {
+	l *toolkit.LogEngine
+}
+
+func (l *logEngineLogger) Debug(msg string, kv ...interface{}) {
+	l.l.Debug(formatFields(msg, kv))
+}
+
+func (l *logEngineLogger) Info(msg string, kv ...interface{}) {
+	l.l.Info(formatFields(msg, kv))
+}
+
+func (l *logEngineLogger) Warn(msg string, kv ...interface{}) {
+	l.l.Warning(formatFields(msg, kv))
+}
+
+func (l *logEngineLogger) Error(msg string, kv ...interface{}) {
+	l.l.Error(formatFields(msg, kv))
+}
+
+func formatFields(msg string, kv []interface{}) string {
+	if len(kv) == 0 {
+		return msg
+	}
+	parts := []string{msg}
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			parts = append(parts, fmt.Sprintf("%v=%v", kv[i], kv[i+1]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%v", kv[i]))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// NewSlogLogger create Logger that write to slog.Logger, nil means slog.Default()
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return &slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (l *slogLogger) Debug(msg string, kv ...interface{}) {
+	l.l.Debug(msg, kv...)
+}
+
+func (l *slogLogger) Info(msg string, kv ...interface{}) {
+	l.l.Info(msg, kv...)
+}
+
+func (l *slogLogger) Warn(msg string, kv ...interface{}) {
+	l.l.Warn(msg, kv...)
+}
+
+func (l *slogLogger) Error(msg string, kv ...interface{}) {
+	l.l.Error(msg, kv...)
+}
@@ -0,0 +1,214 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// IndexTag is struct tag defining index of a field, format is name[,unique]. Fields having the same index name
+// are composed into one index following their order on the struct
+const IndexTag = "index"
+
+// FieldMeta is metadata of a struct field
+type FieldMeta struct {
+	Name  string
+	Index []int
+	Type  reflect.Type
+	Tag   reflect.StructTag
+
+	IDGen      string
+	Default    string
+	HasDefault bool
+	Validate   string
+	Rel        string
+
+	dbNames map[string]string
+}
+
+// DbName returns name of the field on database based on given field name tag, field name is returned when tag is not set
+func (f *FieldMeta) DbName(tag string) string {
+	if n, ok := f.dbNames[tag]; ok {
+		return n
+	}
+	return f.Name
+}
+
+// IsKey returns true if field is tagged using given key tag
+func (f *FieldMeta) IsKey(keyTag string) bool {
+	return f.Tag.Get(keyTag) != ""
+}
+
+// IndexMeta is index definition of a model
+type IndexMeta struct {
+	Name   string
+	Fields []string
+	Unique bool
+}
+
+// ModelMeta is metadata of a model type. It is computed once for each type and reused by hub operations
+type ModelMeta struct {
+	Type    reflect.Type
+	Fields  []*FieldMeta
+	Indexes []*IndexMeta
+
+	byName map[string]*FieldMeta
+}
+
+var metaCache = new(sync.Map)
+
+// MetaOf returns metadata of type of given object, object could be a struct, pointer to struct or reflect.Type
+func MetaOf(obj interface{}) *ModelMeta {
+	t, ok := obj.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(obj)
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if m, ok := metaCache.Load(t); ok {
+		return m.(*ModelMeta)
+	}
+	m := buildMeta(t)
+	actual, _ := metaCache.LoadOrStore(t, m)
+	return actual.(*ModelMeta)
+}
+
+// Field returns field by its struct field name or database name (sqlname, json or bson tag), case insensitive on struct field name
+func (m *ModelMeta) Field(name string) *FieldMeta {
+	if f, ok := m.byName[name]; ok {
+		return f
+	}
+	return m.byName[strings.ToLower(name)]
+}
+
+// KeyFields returns fields tagged with given key tag
+func (m *ModelMeta) KeyFields(keyTag string) []*FieldMeta {
+	res := []*FieldMeta{}
+	for _, f := range m.Fields {
+		if f.IsKey(keyTag) {
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// Value returns value of the field on given struct value
+func (f *FieldMeta) Value(rv reflect.Value) reflect.Value {
+	return rv.FieldByIndex(f.Index)
+}
+
+func buildMeta(t reflect.Type) *ModelMeta {
+	m := &ModelMeta{Type: t, byName: map[string]*FieldMeta{}}
+	collectFields(m, t, nil)
+
+	indexes := map[string]*IndexMeta{}
+	for _, f := range m.Fields {
+		for _, tag := range []string{"bson", "json", "sqlname"} {
+			if n := strings.Split(f.Tag.Get(tag), ",")[0]; n != "" && n != "-" {
+				f.dbNames[tag] = n
+				if _, exist := m.byName[n]; !exist {
+					m.byName[n] = f
+				}
+			}
+		}
+		for _, tag := range []string{"db", "gorm"} {
+			col := tagColumn(f.Tag, f.Name, tag)
+			if col == "" {
+				continue
+			}
+			f.dbNames[tag] = col
+			if _, tagged := f.Tag.Lookup(tag); tagged {
+				if _, exist := m.byName[col]; !exist {
+					m.byName[col] = f
+				}
+			}
+		}
+		m.byName[f.Name] = f
+		if _, exist := m.byName[strings.ToLower(f.Name)]; !exist {
+			m.byName[strings.ToLower(f.Name)] = f
+		}
+
+		if idx := f.Tag.Get(IndexTag); idx != "" {
+			parts := strings.Split(idx, ",")
+			im, ok := indexes[parts[0]]
+			if !ok {
+				im = &IndexMeta{Name: parts[0]}
+				indexes[parts[0]] = im
+				m.Indexes = append(m.Indexes, im)
+			}
+			im.Fields = append(im.Fields, f.Name)
+			for _, opt := range parts[1:] {
+				if strings.TrimSpace(opt) == "unique" {
+					im.Unique = true
+				}
+			}
+		}
+	}
+	return m
+}
+
+func collectFields(m *ModelMeta, t reflect.Type, parent []int) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			collectFields(m, sf.Type, index)
+			continue
+		}
+		if sf.PkgPath != "" || sf.Anonymous {
+			continue
+		}
+
+		def, hasDef := sf.Tag.Lookup(DefaultTag)
+		m.Fields = append(m.Fields, &FieldMeta{
+			Name:       sf.Name,
+			Index:      index,
+			Type:       sf.Type,
+			Tag:        sf.Tag,
+			IDGen:      sf.Tag.Get(IDGenTag),
+			Default:    def,
+			HasDefault: hasDef,
+			Validate:   sf.Tag.Get(ValidateTag),
+			Rel:        sf.Tag.Get(RelTag),
+			dbNames:    map[string]string{},
+		})
+	}
+}
+
+// ParseKey convert string into value of key field (tagged with key:"1") of the model, so ID received as text,
+// ie from url, can be passed to GetByID. String is returned as is if the model has no key field
+func ParseKey(model interface{}, s string) (interface{}, error) {
+	meta := MetaOf(model)
+	if meta == nil {
+		return s, nil
+	}
+	keys := meta.KeyFields("key")
+	if len(keys) == 0 {
+		return s, nil
+	}
+	v := reflect.New(keys[0].Type).Elem()
+	if err := setFromString(v, s); err != nil {
+		return nil, fmt.Errorf("invalid key %s. %w", s, err)
+	}
+	return v.Interface(), nil
+}
+
+// keyValues returns values of key fields (tagged with key:"1") of a struct
+func keyValues(data interface{}) []interface{} {
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	meta := MetaOf(rv.Type())
+	if meta == nil {
+		return nil
+	}
+	ids := []interface{}{}
+	for _, f := range meta.KeyFields("key") {
+		ids = append(ids, f.Value(rv).Interface())
+	}
+	return ids
+}
@@ -0,0 +1,92 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// mongoFilter translate dbflex filter into mongo query document
+func mongoFilter(f *dbflex.Filter) (toolkit.M, error) {
+	if f == nil {
+		return toolkit.M{}, nil
+	}
+
+	switch f.Op {
+	case dbflex.OpAnd, dbflex.OpOr, dbflex.OpNot:
+		items := []toolkit.M{}
+		for _, item := range f.Items {
+			m, e := mongoFilter(item)
+			if e != nil {
+				return nil, e
+			}
+			items = append(items, m)
+		}
+		switch f.Op {
+		case dbflex.OpAnd:
+			return toolkit.M{"$and": items}, nil
+		case dbflex.OpOr:
+			return toolkit.M{"$or": items}, nil
+		default:
+			return toolkit.M{"$nor": items}, nil
+		}
+
+	case dbflex.OpEq, dbflex.OpNe, dbflex.OpGt, dbflex.OpGte, dbflex.OpLt, dbflex.OpLte:
+		return toolkit.M{f.Field: toolkit.M{string(f.Op): f.Value}}, nil
+
+	case opJSONPathEq:
+		return toolkit.M{f.Field: toolkit.M{"$eq": f.Value}}, nil
+
+	case opArrayHas:
+		return toolkit.M{f.Field: f.Value}, nil
+
+	case opArrayAll:
+		return toolkit.M{f.Field: toolkit.M{"$all": mongoValues(f.Value)}}, nil
+
+	case opArraySize:
+		return toolkit.M{f.Field: toolkit.M{"$size": f.Value}}, nil
+
+	case dbflex.OpIn, dbflex.OpNin:
+		return toolkit.M{f.Field: toolkit.M{string(f.Op): mongoValues(f.Value)}}, nil
+
+	case dbflex.OpRange:
+		values := mongoValues(f.Value)
+		if len(values) != 2 {
+			return nil, fmt.Errorf("range filter on %s need 2 values", f.Field)
+		}
+		return toolkit.M{f.Field: toolkit.M{"$gte": values[0], "$lte": values[1]}}, nil
+
+	case dbflex.OpContains:
+		items := []toolkit.M{}
+		for _, v := range mongoValues(f.Value) {
+			items = append(items, toolkit.M{f.Field: toolkit.M{
+				"$regex": regexp.QuoteMeta(fmt.Sprintf("%v", v)), "$options": "i"}})
+		}
+		return toolkit.M{"$or": items}, nil
+
+	case dbflex.OpStartWith:
+		return toolkit.M{f.Field: toolkit.M{
+			"$regex": "^" + regexp.QuoteMeta(fmt.Sprintf("%v", f.Value)), "$options": "i"}}, nil
+
+	case dbflex.OpEndWith:
+		return toolkit.M{f.Field: toolkit.M{
+			"$regex": regexp.QuoteMeta(fmt.Sprintf("%v", f.Value)) + "$", "$options": "i"}}, nil
+	}
+
+	return nil, fmt.Errorf("filter operator %s is not supported", f.Op)
+}
+
+func mongoValues(v interface{}) []interface{} {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []interface{}{v}
+	}
+	res := make([]interface{}, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		res[i] = rv.Index(i).Interface()
+	}
+	return res
+}
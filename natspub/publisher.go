@@ -0,0 +1,67 @@
+// Package natspub publish data events of datahub.Hub to NATS JetStream
+//
+//	js, _ := nc.JetStream()
+//	h.AddPublisher(natspub.New(js, natspub.Options{Subject: "data.{table}.{op}"})).EnableOutbox("")
+//	stop := h.StartOutboxRelay(time.Second, 100)
+//
+// Each message is acknowledged by JetStream and carries event id as Nats-Msg-Id, so event relayed more than once
+// by the outbox is deduplicated by the stream within its duplicate window
+package natspub
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ariefdarmawan/datahub"
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultSubject is default subject template
+const DefaultSubject = "datahub.{table}.{op}"
+
+// Options of the publisher
+type Options struct {
+	// Subject is subject template, {table} and {op} are replaced by table name and operation of the event
+	Subject string
+	// Encode encode the event, default is JSON
+	Encode func(ev *datahub.DataEvent) ([]byte, error)
+}
+
+// Publisher implements datahub.EventPublisher publishing events to JetStream
+type Publisher struct {
+	js   nats.JetStreamContext
+	opts Options
+}
+
+// New create publisher
+func New(js nats.JetStreamContext, opts Options) *Publisher {
+	if opts.Subject == "" {
+		opts.Subject = DefaultSubject
+	}
+	if opts.Encode == nil {
+		opts.Encode = func(ev *datahub.DataEvent) ([]byte, error) {
+			return json.Marshal(ev)
+		}
+	}
+	return &Publisher{js: js, opts: opts}
+}
+
+// Subject returns subject of an event
+func (p *Publisher) Subject(ev *datahub.DataEvent) string {
+	return strings.NewReplacer("{table}", ev.Table, "{op}", ev.Op).Replace(p.opts.Subject)
+}
+
+// Publish publish event and wait for acknowledgement of the stream
+func (p *Publisher) Publish(ev *datahub.DataEvent) error {
+	data, err := p.opts.Encode(ev)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(p.Subject(ev))
+	msg.Data = data
+	msg.Header.Set("Datahub-Op", ev.Op)
+	_, err = p.js.PublishMsg(msg, nats.MsgId(ev.ID))
+	return err
+}
+
+var _ datahub.EventPublisher = new(Publisher)
@@ -0,0 +1,242 @@
+package datahub
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Null is optional value which tells null apart from zero value, following sql.Null. Zero Null is null.
+// Models having Null field are encoded and decoded by the hub, so null is written and read as null on every driver,
+// and Null is marshaled to and from JSON, BSON and database/sql as the value or null
+type Null[T any] struct {
+	V     T
+	Valid bool
+}
+
+// NullOf returns non null value
+func NullOf[T any](v T) Null[T] {
+	return Null[T]{V: v, Valid: true}
+}
+
+// Get returns the value and whether it is not null
+func (n Null[T]) Get() (T, bool) {
+	return n.V, n.Valid
+}
+
+// OrElse returns the value, or d when it is null
+func (n Null[T]) OrElse(d T) T {
+	if !n.Valid {
+		return d
+	}
+	return n.V
+}
+
+func (n Null[T]) nullValue() (interface{}, bool) {
+	return n.V, n.Valid
+}
+
+// MarshalJSON implements json.Marshaler
+func (n Null[T]) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.V)
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (n *Null[T]) UnmarshalJSON(b []byte) error {
+	var zero T
+	n.V, n.Valid = zero, false
+	if strings.TrimSpace(string(b)) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(b, &n.V); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// MarshalBSONValue implements bson.ValueMarshaler
+func (n Null[T]) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	if !n.Valid {
+		return bsontype.Null, nil, nil
+	}
+	return bson.MarshalValue(n.V)
+}
+
+// UnmarshalBSONValue implements bson.ValueUnmarshaler
+func (n *Null[T]) UnmarshalBSONValue(t bsontype.Type, b []byte) error {
+	var zero T
+	n.V, n.Valid = zero, false
+	if t == bsontype.Null || t == bsontype.Undefined {
+		return nil
+	}
+	if err := (bson.RawValue{Type: t, Value: b}).Unmarshal(&n.V); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// Value implements driver.Valuer
+func (n Null[T]) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(n.V)
+}
+
+// Scan implements sql.Scanner
+func (n *Null[T]) Scan(src interface{}) error {
+	var zero T
+	n.V, n.Valid = zero, false
+	if src == nil {
+		return nil
+	}
+	if b, ok := src.([]byte); ok {
+		src = string(b)
+	}
+	fv := reflect.ValueOf(&n.V).Elem()
+	sv := reflect.ValueOf(src)
+	switch {
+	case sv.Type().AssignableTo(fv.Type()):
+		fv.Set(sv)
+	case sv.Kind() == reflect.String:
+		if err := setFromString(fv, sv.String()); err != nil {
+			return err
+		}
+	case sv.Type().ConvertibleTo(fv.Type()):
+		fv.Set(sv.Convert(fv.Type()))
+	default:
+		if err := toolkit.Serde(src, &n.V, ""); err != nil {
+			return fmt.Errorf("can't scan %T into %T", src, n.V)
+		}
+	}
+	n.Valid = true
+	return nil
+}
+
+// nullable is implemented by Null
+type nullable interface {
+	nullValue() (interface{}, bool)
+}
+
+var nullableType = reflect.TypeOf((*nullable)(nil)).Elem()
+
+// docValue returns value of a field to be written, null is written as nil
+func docValue(v interface{}) interface{} {
+	if n, ok := v.(nullable); ok && reflect.ValueOf(v).Kind() == reflect.Struct {
+		if nv, valid := n.nullValue(); valid {
+			return nv
+		}
+		return nil
+	}
+	return v
+}
+
+// hasNullField returns true if model has Null field
+func hasNullField(meta *ModelMeta) bool {
+	for _, f := range meta.Fields {
+		if f.Type.Kind() == reflect.Struct && f.Type.Implements(nullableType) {
+			return true
+		}
+	}
+	return false
+}
+
+// EqNull returns filter of field equals to v, or field is null when v is null
+func EqNull[T any](field string, v Null[T]) *dbflex.Filter {
+	if !v.Valid {
+		return dbflex.Eq(field, nil)
+	}
+	return dbflex.Eq(field, v.V)
+}
+
+// Patch update fields of the model which are not null, a field is not null if it is non nil pointer or valid Null,
+// so partial update could be expressed by model having optional fields only. Record is identified by key fields of
+// the model, key fields and fields of other types are never updated. Returns error when there is nothing to update
+func (h *Hub) Patch(data orm.DataModel) error {
+	data.SetThis(data)
+	idx, conn, err := h.getConn()
+	if err != nil {
+		return &ConnectionError{Err: err}
+	}
+	defer h.closeConn(idx, conn)
+
+	where, err := keyFilterOf(conn, data)
+	if err != nil {
+		return fmt.Errorf("fail Patch: %w", err)
+	}
+	if err = h.guardWrite("update", data.TableName(), where); err != nil {
+		return err
+	}
+	where = h.filterToUTC(where)
+
+	meta := MetaOf(data)
+	if meta == nil {
+		return fmt.Errorf("fail Patch: %T is not a struct", data)
+	}
+	rv := reflect.Indirect(reflect.ValueOf(data))
+	tag := conn.FieldNameTag()
+	keys, _ := data.GetID(conn)
+	isKey := map[string]bool{}
+	for _, k := range keys {
+		isKey[k] = true
+	}
+
+	defer h.timeToUTC(data)()
+	doc := toolkit.M{}
+	fields := []string{}
+	for _, f := range meta.Fields {
+		name := f.DbName(tag)
+		if isKey[name] || isIgnoredField(f) {
+			continue
+		}
+		fv := f.Value(rv)
+		var v interface{}
+		switch {
+		case fv.Kind() == reflect.Struct && f.Type.Implements(nullableType):
+			nv, valid := fv.Interface().(nullable).nullValue()
+			if !valid {
+				continue
+			}
+			v = nv
+		case fv.Kind() == reflect.Ptr:
+			if fv.IsNil() {
+				continue
+			}
+			if v = docValue(fv.Elem().Interface()); v == nil {
+				continue
+			}
+		default:
+			continue
+		}
+		doc[name] = roundDecimal(f, v)
+		fields = append(fields, name)
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("fail Patch: no field to update")
+	}
+	if err = h.encodeValues(conn, doc); err != nil {
+		return fmt.Errorf("fail Patch: %w", err)
+	}
+
+	cmd := dbflex.From(h.tableOf(data)).Update(fields...).Where(where)
+	if _, err = conn.Execute(cmd, toolkit.M{}.Set("data", doc)); err != nil {
+		return fmt.Errorf("fail Patch: %w", duplicateKey(err))
+	}
+	if err = h.emit(conn, EventUpdate, data.TableName(), data, fields); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Pipeline is composable aggregation pipeline builder. Error found while building the stages is kept and returned by Build
+type Pipeline struct {
+	stages []toolkit.M
+	err    error
+}
+
+// NewPipeline create new empty pipeline
+func NewPipeline() *Pipeline {
+	return new(Pipeline)
+}
+
+// Match add stage to filter the documents
+func (p *Pipeline) Match(f *dbflex.Filter) *Pipeline {
+	if f == nil {
+		return p
+	}
+	m, e := mongoFilter(f)
+	if e != nil {
+		p.setErr(fmt.Errorf("match: %s", e.Error()))
+		return p
+	}
+	return p.Stage(toolkit.M{"$match": m})
+}
+
+// Group add stage to group the documents by given fields and calculate aggregates.
+// Group fields are available as top level fields on the result beside the aggregate alias
+func (p *Pipeline) Group(by []string, aggrs ...*dbflex.AggrItem) *Pipeline {
+	var id interface{}
+	if len(by) > 0 {
+		ids := toolkit.M{}
+		for _, f := range by {
+			ids[groupKey(f)] = "$" + f
+		}
+		id = ids
+	}
+
+	group := toolkit.M{"_id": id}
+	for _, a := range aggrs {
+		if a == nil {
+			continue
+		}
+		alias := a.Alias
+		if alias == "" {
+			alias = a.Field
+		}
+		if alias == "" {
+			p.setErr(errors.New("group: aggregate need alias or field"))
+			return p
+		}
+		if a.Op == dbflex.AggrCount {
+			group[alias] = toolkit.M{"$sum": 1}
+		} else {
+			group[alias] = toolkit.M{string(a.Op): "$" + a.Field}
+		}
+	}
+	p.Stage(toolkit.M{"$group": group})
+
+	if len(by) > 0 {
+		fields := toolkit.M{}
+		for _, f := range by {
+			fields[groupKey(f)] = "$_id." + groupKey(f)
+		}
+		p.Stage(toolkit.M{"$addFields": fields})
+	}
+	return p
+}
+
+// Project add stage to only return given fields. Field prefixed by - will be excluded instead
+func (p *Pipeline) Project(fields ...string) *Pipeline {
+	if len(fields) == 0 {
+		return p
+	}
+	proj := toolkit.M{}
+	for _, f := range fields {
+		if strings.HasPrefix(f, "-") {
+			proj[f[1:]] = 0
+		} else {
+			proj[f] = 1
+		}
+	}
+	return p.Stage(toolkit.M{"$project": proj})
+}
+
+// Sort add stage to sort the documents, prefix field with - for descending sort
+func (p *Pipeline) Sort(fields ...string) *Pipeline {
+	if len(fields) == 0 {
+		return p
+	}
+	sort := bson.D{}
+	for _, f := range fields {
+		if strings.HasPrefix(f, "-") {
+			sort = append(sort, bson.E{Key: f[1:], Value: -1})
+		} else {
+			sort = append(sort, bson.E{Key: f, Value: 1})
+		}
+	}
+	return p.Stage(toolkit.M{"$sort": sort})
+}
+
+// Skip add stage to skip n documents
+func (p *Pipeline) Skip(n int) *Pipeline {
+	return p.Stage(toolkit.M{"$skip": n})
+}
+
+// Limit add stage to limit number of documents
+func (p *Pipeline) Limit(n int) *Pipeline {
+	return p.Stage(toolkit.M{"$limit": n})
+}
+
+// Lookup add stages to join other collection
+func (p *Pipeline) Lookup(l Lookup) *Pipeline {
+	for _, s := range l.Stages() {
+		p.Stage(s)
+	}
+	return p
+}
+
+// Stage add raw stage into pipeline
+func (p *Pipeline) Stage(stage toolkit.M) *Pipeline {
+	p.stages = append(p.stages, stage)
+	return p
+}
+
+// Build returns stages of the pipeline
+func (p *Pipeline) Build() ([]toolkit.M, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return p.stages, nil
+}
+
+func (p *Pipeline) setErr(e error) {
+	if p.err == nil {
+		p.err = e
+	}
+}
+
+func groupKey(field string) string {
+	return strings.ReplaceAll(field, ".", "_")
+}
+
+// AggregatePipeline run pipeline against table of the model and fetch the result into dest
+func (h *Hub) AggregatePipeline(data orm.DataModel, pipeline *Pipeline, dest interface{}) error {
+	data.SetThis(data)
+	stages, err := pipeline.Build()
+	if err != nil {
+		return fmt.Errorf("fail AggregatePipeline: %w", err)
+	}
+	return h.Aggregate(data.TableName(), stages, dest)
+}
@@ -0,0 +1,191 @@
+package datahub
+
+import (
+	"fmt"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// QueryBuilder is chainable builder of dbflex.QueryParam. Conditions are combined using and.
+//
+//	parm, err := datahub.Q().Eq("status", "open").Gte("amount", 100).SortDesc("created").Page(2, 50).Build()
+//
+// When model is set using For, field names are checked against metadata of the model and Build returns error on
+// unknown field
+type QueryBuilder struct {
+	meta    *ModelMeta
+	filters []*dbflex.Filter
+	fields  []string
+	sort    []string
+	skip    int
+	take    int
+	err     error
+}
+
+// Q create new query builder
+func Q() *QueryBuilder {
+	return new(QueryBuilder)
+}
+
+// For validate field names against given model, model could be a struct, pointer to struct or reflect.Type
+func (b *QueryBuilder) For(model interface{}) *QueryBuilder {
+	b.meta = MetaOf(model)
+	return b
+}
+
+// Where add raw filter
+func (b *QueryBuilder) Where(f *dbflex.Filter) *QueryBuilder {
+	if f != nil {
+		b.filters = append(b.filters, f)
+	}
+	return b
+}
+
+// Eq add field = value condition
+func (b *QueryBuilder) Eq(field string, v interface{}) *QueryBuilder {
+	return b.add(field, dbflex.Eq(field, v))
+}
+
+// Ne add field <> value condition
+func (b *QueryBuilder) Ne(field string, v interface{}) *QueryBuilder {
+	return b.add(field, dbflex.Ne(field, v))
+}
+
+// Gt add field > value condition
+func (b *QueryBuilder) Gt(field string, v interface{}) *QueryBuilder {
+	return b.add(field, dbflex.Gt(field, v))
+}
+
+// Gte add field >= value condition
+func (b *QueryBuilder) Gte(field string, v interface{}) *QueryBuilder {
+	return b.add(field, dbflex.Gte(field, v))
+}
+
+// Lt add field < value condition
+func (b *QueryBuilder) Lt(field string, v interface{}) *QueryBuilder {
+	return b.add(field, dbflex.Lt(field, v))
+}
+
+// Lte add field <= value condition
+func (b *QueryBuilder) Lte(field string, v interface{}) *QueryBuilder {
+	return b.add(field, dbflex.Lte(field, v))
+}
+
+// In add condition of field equals to one of values
+func (b *QueryBuilder) In(field string, values ...interface{}) *QueryBuilder {
+	return b.add(field, dbflex.In(field, values...))
+}
+
+// Nin add condition of field not equals to any of values
+func (b *QueryBuilder) Nin(field string, values ...interface{}) *QueryBuilder {
+	return b.add(field, dbflex.Nin(field, values...))
+}
+
+// Between add condition of field within from and to (inclusive)
+func (b *QueryBuilder) Between(field string, from, to interface{}) *QueryBuilder {
+	return b.add(field, dbflex.And(dbflex.Gte(field, from), dbflex.Lte(field, to)))
+}
+
+// Contains add condition of field contains one of the texts
+func (b *QueryBuilder) Contains(field string, texts ...string) *QueryBuilder {
+	return b.add(field, dbflex.Contains(field, texts...))
+}
+
+// StartWith add condition of field starts with text
+func (b *QueryBuilder) StartWith(field, text string) *QueryBuilder {
+	return b.add(field, dbflex.StartWith(field, text))
+}
+
+// EndWith add condition of field ends with text
+func (b *QueryBuilder) EndWith(field, text string) *QueryBuilder {
+	return b.add(field, dbflex.EndWith(field, text))
+}
+
+// Select set fields to be returned
+func (b *QueryBuilder) Select(fields ...string) *QueryBuilder {
+	for _, f := range fields {
+		b.check(f)
+	}
+	b.fields = append(b.fields, fields...)
+	return b
+}
+
+// Sort add sort fields, prefix field with - for descending sort
+func (b *QueryBuilder) Sort(fields ...string) *QueryBuilder {
+	for _, f := range fields {
+		b.check(strings.TrimPrefix(f, "-"))
+	}
+	b.sort = append(b.sort, fields...)
+	return b
+}
+
+// SortAsc add ascending sort fields
+func (b *QueryBuilder) SortAsc(fields ...string) *QueryBuilder {
+	return b.Sort(fields...)
+}
+
+// SortDesc add descending sort fields
+func (b *QueryBuilder) SortDesc(fields ...string) *QueryBuilder {
+	for _, f := range fields {
+		b.Sort("-" + f)
+	}
+	return b
+}
+
+// Skip set number of records to be skipped
+func (b *QueryBuilder) Skip(n int) *QueryBuilder {
+	b.skip = n
+	return b
+}
+
+// Take set maximum number of records to be returned
+func (b *QueryBuilder) Take(n int) *QueryBuilder {
+	b.take = n
+	return b
+}
+
+// Page set skip and take based on page number (starting from 1) and page size
+func (b *QueryBuilder) Page(page, size int) *QueryBuilder {
+	if page < 1 {
+		page = 1
+	}
+	return b.Skip((page - 1) * size).Take(size)
+}
+
+// Build returns the QueryParam, or first error found while building it
+func (b *QueryBuilder) Build() (*dbflex.QueryParam, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	parm := dbflex.NewQueryParam()
+	if where := combineFilter(b.filters...); where != nil {
+		parm.SetWhere(where)
+	}
+	if len(b.fields) > 0 {
+		parm.SetSelect(b.fields...)
+	}
+	if len(b.sort) > 0 {
+		parm.SetSort(b.sort...)
+	}
+	parm.Skip = b.skip
+	parm.Take = b.take
+	return parm, nil
+}
+
+func (b *QueryBuilder) add(field string, f *dbflex.Filter) *QueryBuilder {
+	b.check(field)
+	b.filters = append(b.filters, f)
+	return b
+}
+
+// check validate field against model, nested field (a.b) is validated by its first part
+func (b *QueryBuilder) check(field string) {
+	if b.meta == nil || b.err != nil {
+		return
+	}
+	name := strings.Split(field, ".")[0]
+	if b.meta.Field(name) == nil {
+		b.err = fmt.Errorf("field %s is not found on %s", field, b.meta.Type.Name())
+	}
+}
@@ -0,0 +1,249 @@
+package datahub
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+)
+
+// FilterFromM build filter from mongo like document, so filter can be received from other services as plain JSON.
+//
+//	{"status": "open", "age": {"$gte": 17, "$lt": 60}, "$or": [{"city": "Jakarta"}, {"city": {"$in": ["Bandung", "Bogor"]}}]}
+//
+// Supported operators are $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $contains, $startwith, $endwith, $and, $or and $not.
+// Conditions of a document are combined using and. Field names should be identifiers, optionally dot separated
+func FilterFromM(m toolkit.M) (*dbflex.Filter, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	items := []*dbflex.Filter{}
+	for _, k := range keys {
+		v := m[k]
+		switch k {
+		case "$and", "$or":
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s should be an array", k)
+			}
+			subs := make([]*dbflex.Filter, 0, len(list))
+			for _, item := range list {
+				sm, ok := toM(item)
+				if !ok {
+					return nil, fmt.Errorf("item of %s should be an object", k)
+				}
+				f, err := FilterFromM(sm)
+				if err != nil {
+					return nil, err
+				}
+				subs = append(subs, f)
+			}
+			if k == "$and" {
+				items = append(items, dbflex.And(subs...))
+			} else {
+				items = append(items, dbflex.Or(subs...))
+			}
+
+		case "$not":
+			sm, ok := toM(v)
+			if !ok {
+				return nil, fmt.Errorf("$not should be an object")
+			}
+			f, err := FilterFromM(sm)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, dbflex.Not(f))
+
+		default:
+			if strings.HasPrefix(k, "$") {
+				return nil, fmt.Errorf("unknown operator %s", k)
+			}
+			if err := checkFieldName(k); err != nil {
+				return nil, err
+			}
+			ops, ok := toM(v)
+			if !ok {
+				items = append(items, dbflex.Eq(k, v))
+				continue
+			}
+			f, err := fieldFilterFromM(k, ops)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, f)
+		}
+	}
+
+	switch len(items) {
+	case 0:
+		return nil, nil
+	case 1:
+		return items[0], nil
+	}
+	return dbflex.And(items...), nil
+}
+
+func fieldFilterFromM(field string, ops toolkit.M) (*dbflex.Filter, error) {
+	keys := make([]string, 0, len(ops))
+	for k := range ops {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	items := []*dbflex.Filter{}
+	for _, op := range keys {
+		v := ops[op]
+		switch strings.ToLower(op) {
+		case "$eq":
+			items = append(items, dbflex.Eq(field, v))
+		case "$ne":
+			items = append(items, dbflex.Ne(field, v))
+		case "$gt":
+			items = append(items, dbflex.Gt(field, v))
+		case "$gte":
+			items = append(items, dbflex.Gte(field, v))
+		case "$lt":
+			items = append(items, dbflex.Lt(field, v))
+		case "$lte":
+			items = append(items, dbflex.Lte(field, v))
+		case "$in", "$nin":
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s of %s should be an array", op, field)
+			}
+			if op == "$in" {
+				items = append(items, dbflex.In(field, list...))
+			} else {
+				items = append(items, dbflex.Nin(field, list...))
+			}
+		case "$contains":
+			strs := []string{}
+			if list, ok := v.([]interface{}); ok {
+				for _, s := range list {
+					strs = append(strs, fmt.Sprintf("%v", s))
+				}
+			} else {
+				strs = append(strs, fmt.Sprintf("%v", v))
+			}
+			items = append(items, dbflex.Contains(field, strs...))
+		case "$startwith":
+			items = append(items, dbflex.StartWith(field, fmt.Sprintf("%v", v)))
+		case "$endwith":
+			items = append(items, dbflex.EndWith(field, fmt.Sprintf("%v", v)))
+		default:
+			return nil, fmt.Errorf("unknown operator %s of %s", op, field)
+		}
+	}
+
+	if len(items) == 1 {
+		return items[0], nil
+	}
+	return dbflex.And(items...), nil
+}
+
+// QueryParamFromM build QueryParam from plain document with optional attributes:
+// where (see FilterFromM), select, sort, skip, take, groupby and aggregates (array of {op, field, alias},
+// op is one of sum, avg, min, max and count)
+func QueryParamFromM(m toolkit.M) (*dbflex.QueryParam, error) {
+	parm := dbflex.NewQueryParam()
+	if w, ok := toM(m["where"]); ok {
+		f, err := FilterFromM(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid where. %w", err)
+		}
+		if f != nil {
+			parm = parm.SetWhere(f)
+		}
+	}
+	parm.Select = toStrings(m["select"])
+	parm.Sort = toStrings(m["sort"])
+	parm.GroupBy = toStrings(m["groupby"])
+	for _, fields := range [][]string{parm.Select, parm.Sort, parm.GroupBy} {
+		for _, f := range fields {
+			if err := checkFieldName(strings.TrimPrefix(f, "-")); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if n, ok := toFloat(m["skip"]); ok {
+		parm.Skip = int(n)
+	}
+	if n, ok := toFloat(m["take"]); ok {
+		parm.Take = int(n)
+	}
+
+	if list, ok := m["aggregates"].([]interface{}); ok {
+		for _, item := range list {
+			am, ok := toM(item)
+			if !ok {
+				return nil, fmt.Errorf("aggregate should be an object")
+			}
+			op := dbflex.AggrOp("$" + strings.TrimPrefix(strings.ToLower(stringOf(am["op"])), "$"))
+			switch op {
+			case dbflex.AggrSum, dbflex.AggrAvr, dbflex.AggrMin, dbflex.AggrMax, dbflex.AggrCount:
+			default:
+				return nil, fmt.Errorf("invalid aggregate op %s", stringOf(am["op"]))
+			}
+			for _, name := range []string{stringOf(am["field"]), stringOf(am["alias"])} {
+				if err := checkFieldName(name); name != "" && err != nil {
+					return nil, err
+				}
+			}
+			parm.Aggregates = append(parm.Aggregates, dbflex.NewAggrItem(stringOf(am["alias"]), op, stringOf(am["field"])))
+		}
+	}
+	return parm, nil
+}
+
+var fieldNameRx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z0-9_]+)*$`)
+
+// checkFieldName reject field name that is not an identifier, as field names are written into SQL as is
+func checkFieldName(name string) error {
+	if !fieldNameRx.MatchString(name) {
+		return fmt.Errorf("invalid field name %q", name)
+	}
+	return nil
+}
+
+func toM(v interface{}) (toolkit.M, bool) {
+	switch m := v.(type) {
+	case toolkit.M:
+		return m, true
+	case map[string]interface{}:
+		return toolkit.M(m), true
+	}
+	return nil, false
+}
+
+func stringOf(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func toStrings(v interface{}) []string {
+	switch s := v.(type) {
+	case []string:
+		return s
+	case string:
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, ",")
+	case []interface{}:
+		res := make([]string, len(s))
+		for i, item := range s {
+			res[i] = fmt.Sprintf("%v", item)
+		}
+		return res
+	}
+	return nil
+}
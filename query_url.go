@@ -0,0 +1,195 @@
+package datahub
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// ParseQueryMaxTake is maximum take accepted by ParseQuery, larger take is capped. 0 means no limit
+var ParseQueryMaxTake = 1000
+
+// ParseQuery build QueryParam from URL query string, ie: ?status=open&amount[gte]=100&sort=-created&page=2&pagesize=50
+//
+// Condition is written as field=value (equal) or field[op]=value where op is one of eq, ne, gt, gte, lt, lte,
+// in and nin (comma separated values), like (contains), startwith and endwith. Conditions are combined using and.
+// Unquoted value is converted into number, bool, time (RFC3339) or nil (null), value quoted by ' or " is kept as text.
+// Reserved params are sort (comma separated, prefix with - for descending), select (comma separated),
+// skip, take, page (starting from 1) and pagesize.
+// Only fields on allowedFields can be filtered, sorted or selected, other fields are rejected with error
+func ParseQuery(values url.Values, allowedFields []string) (*dbflex.QueryParam, error) {
+	allowed := map[string]bool{}
+	for _, f := range allowedFields {
+		allowed[strings.ToLower(f)] = true
+	}
+	check := func(field string) error {
+		if !allowed[strings.ToLower(field)] {
+			return fmt.Errorf("field %s is not allowed", field)
+		}
+		return nil
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parm := dbflex.NewQueryParam()
+	filters := []*dbflex.Filter{}
+	page, pageSize := 0, 0
+	for _, k := range keys {
+		vs := values[k]
+		if len(vs) == 0 {
+			continue
+		}
+		v := vs[0]
+
+		switch strings.ToLower(k) {
+		case "sort":
+			for _, s := range splitList(v) {
+				if err := check(strings.TrimPrefix(s, "-")); err != nil {
+					return nil, fmt.Errorf("invalid sort. %w", err)
+				}
+				parm.Sort = append(parm.Sort, s)
+			}
+
+		case "select":
+			for _, s := range splitList(v) {
+				if err := check(s); err != nil {
+					return nil, fmt.Errorf("invalid select. %w", err)
+				}
+				parm.Select = append(parm.Select, s)
+			}
+
+		case "skip", "take", "page", "pagesize":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s", k)
+			}
+			switch strings.ToLower(k) {
+			case "skip":
+				parm.Skip = n
+			case "take":
+				parm.Take = n
+			case "page":
+				page = n
+			default:
+				pageSize = n
+			}
+
+		default:
+			field, op := k, "eq"
+			if i := strings.Index(k, "["); i > 0 && strings.HasSuffix(k, "]") {
+				field, op = k[:i], strings.ToLower(k[i+1:len(k)-1])
+			}
+			if err := check(field); err != nil {
+				return nil, err
+			}
+			for _, item := range vs {
+				f, err := urlFilter(field, op, item)
+				if err != nil {
+					return nil, err
+				}
+				filters = append(filters, f)
+			}
+		}
+	}
+
+	if page > 0 || pageSize > 0 {
+		if pageSize == 0 {
+			pageSize = parm.Take
+		}
+		if page < 1 {
+			page = 1
+		}
+		parm.Take = pageSize
+		parm.Skip = (page - 1) * pageSize
+	}
+	if ParseQueryMaxTake > 0 && parm.Take > ParseQueryMaxTake {
+		parm.Take = ParseQueryMaxTake
+	}
+	parm.Where = combineFilter(filters...)
+	return parm, nil
+}
+
+func urlFilter(field, op, v string) (*dbflex.Filter, error) {
+	switch op {
+	case "eq":
+		return dbflex.Eq(field, urlValue(v)), nil
+	case "ne":
+		return dbflex.Ne(field, urlValue(v)), nil
+	case "gt":
+		return dbflex.Gt(field, urlValue(v)), nil
+	case "gte":
+		return dbflex.Gte(field, urlValue(v)), nil
+	case "lt":
+		return dbflex.Lt(field, urlValue(v)), nil
+	case "lte":
+		return dbflex.Lte(field, urlValue(v)), nil
+	case "in", "nin":
+		items := splitList(v)
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = urlValue(item)
+		}
+		if op == "in" {
+			return dbflex.In(field, list...), nil
+		}
+		return dbflex.Nin(field, list...), nil
+	case "like":
+		return dbflex.Contains(field, unquote(v)), nil
+	case "startwith":
+		return dbflex.StartWith(field, unquote(v)), nil
+	case "endwith":
+		return dbflex.EndWith(field, unquote(v)), nil
+	}
+	return nil, fmt.Errorf("unknown operator %s of %s", op, field)
+}
+
+// urlValue convert unquoted text into number, bool, time or nil
+func urlValue(v string) interface{} {
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	switch strings.ToLower(v) {
+	case "null":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return n
+	}
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		return n
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t
+	}
+	return v
+}
+
+func unquote(v string) string {
+	if s, ok := urlValue(v).(string); ok {
+		return s
+	}
+	return v
+}
+
+func splitList(v string) []string {
+	res := []string{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			res = append(res, s)
+		}
+	}
+	return res
+}
@@ -0,0 +1,197 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+	"github.com/eaciit/toolkit"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Record is dynamic record of a table, for tools querying tables which struct is not known at compile time.
+// Getters accept nested path separated by dot, ie: address.city, and returns zero value when the field is not
+// exist or can't be converted, use Lookup to tell them apart
+type Record toolkit.M
+
+// GetsMap returns records of a table as documents, see PopulateByParm
+func (h *Hub) GetsMap(tableName string, parm *dbflex.QueryParam) ([]toolkit.M, error) {
+	res := []toolkit.M{}
+	if err := h.PopulateByParm(tableName, parm, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// GetsRecord returns records of a table as Record
+func (h *Hub) GetsRecord(tableName string, parm *dbflex.QueryParam) ([]Record, error) {
+	ms, err := h.GetsMap(tableName, parm)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Record, len(ms))
+	for i, m := range ms {
+		res[i] = Record(m)
+	}
+	return res, nil
+}
+
+// Lookup returns value of the field and whether it is exist
+func (r Record) Lookup(path string) (interface{}, bool) {
+	var cur interface{} = map[string]interface{}(r)
+	for _, part := range strings.Split(path, ".") {
+		var m map[string]interface{}
+		switch o := cur.(type) {
+		case map[string]interface{}:
+			m = o
+		case toolkit.M:
+			m = o
+		case Record:
+			m = o
+		case primitive.M:
+			m = o
+		case primitive.D:
+			m = o.Map()
+		default:
+			return nil, false
+		}
+		v, ok := m[part]
+		if !ok {
+			return nil, false
+		}
+		cur = v
+	}
+	return cur, true
+}
+
+// Has returns true if the field is exist
+func (r Record) Has(path string) bool {
+	_, ok := r.Lookup(path)
+	return ok
+}
+
+// Value returns value of the field as is
+func (r Record) Value(path string) interface{} {
+	v, _ := r.Lookup(path)
+	return v
+}
+
+// GetString returns value of the field as text, non text value is formatted using fmt
+func (r Record) GetString(path string) string {
+	v, ok := r.Lookup(path)
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprintf("%v", indirectValue(v))
+}
+
+// GetInt returns value of the field as int
+func (r Record) GetInt(path string) int {
+	return int(r.GetInt64(path))
+}
+
+// GetInt64 returns value of the field as int64, text is parsed and float is truncated
+func (r Record) GetInt64(path string) int64 {
+	v, ok := r.Lookup(path)
+	if !ok {
+		return 0
+	}
+	switch o := indirectValue(v).(type) {
+	case string:
+		n, _ := strconv.ParseInt(strings.TrimSpace(o), 10, 64)
+		return n
+	case json.Number:
+		n, _ := o.Int64()
+		return n
+	}
+	f, _ := toFloat(indirectValue(v))
+	return int64(f)
+}
+
+// GetFloat64 returns value of the field as float64, text is parsed
+func (r Record) GetFloat64(path string) float64 {
+	v, ok := r.Lookup(path)
+	if !ok {
+		return 0
+	}
+	switch o := indirectValue(v).(type) {
+	case string:
+		f, _ := strconv.ParseFloat(strings.TrimSpace(o), 64)
+		return f
+	case json.Number:
+		f, _ := o.Float64()
+		return f
+	case primitive.Decimal128:
+		f, _ := strconv.ParseFloat(o.String(), 64)
+		return f
+	}
+	f, _ := toFloat(indirectValue(v))
+	return f
+}
+
+// GetBool returns value of the field as bool, text is parsed and number other than 0 is true
+func (r Record) GetBool(path string) bool {
+	v, ok := r.Lookup(path)
+	if !ok {
+		return false
+	}
+	switch o := indirectValue(v).(type) {
+	case bool:
+		return o
+	case string:
+		b, _ := strconv.ParseBool(strings.TrimSpace(o))
+		return b
+	}
+	f, _ := toFloat(indirectValue(v))
+	return f != 0
+}
+
+// GetTime returns value of the field as time, text is parsed using RFC3339
+func (r Record) GetTime(path string) time.Time {
+	v, ok := r.Lookup(path)
+	if !ok {
+		return time.Time{}
+	}
+	switch o := indirectValue(v).(type) {
+	case time.Time:
+		return o
+	case primitive.DateTime:
+		return o.Time()
+	case string:
+		t, _ := time.Parse(time.RFC3339Nano, strings.TrimSpace(o))
+		return t
+	}
+	return time.Time{}
+}
+
+// GetRecord returns nested document of the field as Record
+func (r Record) GetRecord(path string) Record {
+	v, ok := r.Lookup(path)
+	if !ok {
+		return nil
+	}
+	switch o := v.(type) {
+	case map[string]interface{}:
+		return o
+	case toolkit.M:
+		return Record(o)
+	case Record:
+		return o
+	case primitive.M:
+		return Record(o)
+	case primitive.D:
+		return Record(o.Map())
+	}
+	return nil
+}
+
+// M returns the record as toolkit.M
+func (r Record) M() toolkit.M {
+	return toolkit.M(r)
+}
@@ -0,0 +1,491 @@
+// Package rest generate http.Handler implementing CRUD of a model on top of datahub.Hub
+//
+//	http.Handle("/api/customers/", http.StripPrefix("/api/customers", rest.NewHandler(h, new(Customer), rest.Options{})))
+//
+// Routes, relative to the mount point:
+//
+//	GET    /      list, query params: where (JSON filter, see datahub.FilterFromM), sort (comma separated,
+//	              prefix with - for descending), skip, take. Other query params are used as equal filter,
+//	              value of field having enum registered on the hub should be one of the enum. Only fields of
+//	              the model could be filtered or sorted
+//	GET    /{id}  get by id
+//	POST   /      create
+//	PUT    /{id}  update
+//	DELETE /{id}  delete
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/ariefdarmawan/datahub"
+	"github.com/eaciit/toolkit"
+)
+
+// Actions of the handler
+const (
+	ActionList   = "list"
+	ActionGet    = "get"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Options of the handler
+type Options struct {
+	// Authorize is called before each action, returning error reject the request with 403
+	Authorize func(r *http.Request, action string) error
+	// Scope returns additional filter applied to list, get, update and delete, ie: to limit records to current
+	// tenant. Record outside the scope is reported as not found. On update, fields having equal filter on the scope
+	// are set to the scope value so the record could not be moved to other scope
+	Scope func(r *http.Request) *dbflex.Filter
+	// BeforeWrite is called before create and update, it could modify or reject the data
+	BeforeWrite func(r *http.Request, action string, data orm.DataModel) error
+	// Fields returns fields to be returned for the action, nil means all fields
+	Fields func(r *http.Request, action string) []string
+	// MaxTake limit number of records returned by list, default is 100. It is further limited by max take of the hub
+	MaxTake int
+}
+
+type handler struct {
+	h         *datahub.Hub
+	modelType reflect.Type
+	meta      *datahub.ModelMeta
+	opts      Options
+}
+
+// NewHandler create http.Handler for model, model should be a pointer to struct implementing orm.DataModel
+func NewHandler(h *datahub.Hub, model orm.DataModel, opts Options) http.Handler {
+	if opts.MaxTake == 0 {
+		opts.MaxTake = 100
+	}
+	return &handler{h: h, modelType: reflect.TypeOf(model).Elem(), meta: datahub.MetaOf(model), opts: opts}
+}
+
+// hub returns hub bound to context of the request, so cancelled request stop its queries
+func (hd *handler) hub(r *http.Request) *datahub.Hub {
+	return hd.h.WithContext(r.Context())
+}
+
+// checkField returns error when name is not a field of the model
+func (hd *handler) checkField(name string) error {
+	if hd.meta == nil || hd.meta.Field(name) == nil {
+		return fmt.Errorf("field %s is not found", name)
+	}
+	return nil
+}
+
+// checkFilter returns error when filter refers to field which is not a field of the model
+func (hd *handler) checkFilter(f *dbflex.Filter) error {
+	if f == nil {
+		return nil
+	}
+	if f.Field != "" {
+		if err := hd.checkField(f.Field); err != nil {
+			return err
+		}
+	}
+	for _, item := range f.Items {
+		if err := hd.checkFilter(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (hd *handler) newModel() orm.DataModel {
+	m := reflect.New(hd.modelType).Interface().(orm.DataModel)
+	m.SetThis(m)
+	return m
+}
+
+func (hd *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(r.URL.Path, "/")
+	var action string
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		action = ActionList
+	case r.Method == http.MethodGet:
+		action = ActionGet
+	case r.Method == http.MethodPost && id == "":
+		action = ActionCreate
+	case r.Method == http.MethodPut && id != "":
+		action = ActionUpdate
+	case r.Method == http.MethodDelete && id != "":
+		action = ActionDelete
+	default:
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method is not allowed"))
+		return
+	}
+
+	if hd.opts.Authorize != nil {
+		if err := hd.opts.Authorize(r, action); err != nil {
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+	}
+
+	switch action {
+	case ActionList:
+		hd.list(w, r)
+	case ActionGet:
+		hd.get(w, r, id)
+	case ActionCreate:
+		hd.write(w, r, action, "")
+	case ActionUpdate:
+		hd.write(w, r, action, id)
+	case ActionDelete:
+		hd.delete(w, r, id)
+	}
+}
+
+func (hd *handler) list(w http.ResponseWriter, r *http.Request) {
+	parm, err := hd.queryParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	dest := reflect.New(reflect.SliceOf(reflect.PtrTo(hd.modelType)))
+	if err = hd.hub(r).Gets(hd.newModel(), parm, dest.Interface()); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	hd.writeData(w, r, ActionList, http.StatusOK, dest.Elem().Interface())
+}
+
+func (hd *handler) queryParam(r *http.Request) (*dbflex.QueryParam, error) {
+	q := r.URL.Query()
+	parm := dbflex.NewQueryParam()
+	filters := []*dbflex.Filter{}
+
+	for k, vs := range q {
+		if len(vs) == 0 {
+			continue
+		}
+		switch k {
+		case "where":
+			m := toolkit.M{}
+			if err := json.Unmarshal([]byte(vs[0]), &m); err != nil {
+				return nil, fmt.Errorf("invalid where. %w", err)
+			}
+			f, err := datahub.FilterFromM(m)
+			if err != nil {
+				return nil, fmt.Errorf("invalid where. %w", err)
+			}
+			if err = hd.checkFilter(f); err != nil {
+				return nil, fmt.Errorf("invalid where. %w", err)
+			}
+			if f != nil {
+				filters = append(filters, f)
+			}
+		case "sort":
+			for _, s := range strings.Split(vs[0], ",") {
+				if err := hd.checkField(strings.TrimPrefix(s, "-")); err != nil {
+					return nil, fmt.Errorf("invalid sort. %w", err)
+				}
+				parm.Sort = append(parm.Sort, s)
+			}
+		case "skip", "take":
+			n, err := strconv.Atoi(vs[0])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s", k)
+			}
+			if k == "skip" {
+				parm.Skip = n
+			} else {
+				parm.Take = n
+			}
+		default:
+			if err := hd.checkField(k); err != nil {
+				return nil, err
+			}
+			if err := hd.h.CheckEnum(hd.modelType, k, vs[0]); err != nil {
+				return nil, fmt.Errorf("invalid %s. %w", k, err)
+			}
+			filters = append(filters, dbflex.Eq(k, vs[0]))
+		}
+	}
+
+	if hd.opts.Scope != nil {
+		if f := hd.opts.Scope(r); f != nil {
+			filters = append(filters, f)
+		}
+	}
+	switch len(filters) {
+	case 0:
+	case 1:
+		parm.Where = filters[0]
+	default:
+		parm.Where = dbflex.And(filters...)
+	}
+
+	if parm.Take == 0 || parm.Take > hd.opts.MaxTake {
+		parm.Take = hd.opts.MaxTake
+	}
+	if max := hd.h.MaxTake(); max > 0 && parm.Take > max {
+		parm.Take = max
+	}
+	return parm, nil
+}
+
+func (hd *handler) get(w http.ResponseWriter, r *http.Request, id string) {
+	data := hd.newModel()
+	key, err := datahub.ParseKey(data, id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	data.SetID(key)
+	where, err := hd.scopedKey(r, data)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	if where == nil {
+		err = hd.hub(r).Get(data)
+	} else {
+		err = hd.hub(r).GetByParm(data, dbflex.NewQueryParam().SetWhere(where))
+	}
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	hd.writeData(w, r, ActionGet, http.StatusOK, data)
+}
+
+func (hd *handler) write(w http.ResponseWriter, r *http.Request, action, id string) {
+	data := hd.newModel()
+	if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body. %w", err))
+		return
+	}
+	data.SetThis(data)
+
+	if id != "" {
+		key, err := datahub.ParseKey(data, id)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		data.SetID(key)
+	}
+
+	if hd.opts.BeforeWrite != nil {
+		if err := hd.opts.BeforeWrite(r, action, data); err != nil {
+			writeError(w, http.StatusForbidden, err)
+			return
+		}
+	}
+
+	var err error
+	status := http.StatusOK
+	if action == ActionCreate {
+		err = hd.hub(r).Insert(data)
+		status = http.StatusCreated
+	} else {
+		err = hd.update(r, data)
+	}
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	hd.writeData(w, r, action, status, data)
+}
+
+func (hd *handler) delete(w http.ResponseWriter, r *http.Request, id string) {
+	data := hd.newModel()
+	key, err := datahub.ParseKey(data, id)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	data.SetID(key)
+	where, err := hd.scopedKey(r, data)
+	if err == nil && where != nil {
+		err = hd.mustExist(r, data, where)
+	}
+	if err == nil {
+		if where == nil {
+			err = hd.hub(r).Delete(data)
+		} else {
+			err = hd.hub(r).DeleteQuery(data, where)
+		}
+	}
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// update update data, within scope of the request when Options.Scope is set
+func (hd *handler) update(r *http.Request, data orm.DataModel) error {
+	where, err := hd.scopedKey(r, data)
+	if err != nil {
+		return err
+	}
+	if where == nil {
+		return hd.hub(r).Update(data)
+	}
+	if err = hd.mustExist(r, data, where); err != nil {
+		return err
+	}
+	if err = hd.applyScope(data, hd.opts.Scope(r)); err != nil {
+		return err
+	}
+	return hd.hub(r).UpdateField(data, where)
+}
+
+// applyScope set fields of data having equal filter on scope to value of the filter
+func (hd *handler) applyScope(data orm.DataModel, scope *dbflex.Filter) error {
+	if scope == nil || hd.meta == nil {
+		return nil
+	}
+	switch scope.Op {
+	case dbflex.OpAnd:
+		for _, item := range scope.Items {
+			if err := hd.applyScope(data, item); err != nil {
+				return err
+			}
+		}
+	case dbflex.OpEq:
+		f := hd.meta.Field(scope.Field)
+		if f == nil {
+			return nil
+		}
+		fv := f.Value(reflect.ValueOf(data).Elem())
+		v := reflect.ValueOf(scope.Value)
+		if !v.IsValid() || !v.Type().ConvertibleTo(fv.Type()) {
+			return fmt.Errorf("invalid scope of field %s", scope.Field)
+		}
+		fv.Set(v.Convert(fv.Type()))
+	}
+	return nil
+}
+
+// scopedKey returns filter of key of data combined with scope of the request, nil when Options.Scope is not set, so
+// record of other scope, ie: other tenant, could not be read or written by its id
+func (hd *handler) scopedKey(r *http.Request, data orm.DataModel) (*dbflex.Filter, error) {
+	if hd.opts.Scope == nil {
+		return nil, nil
+	}
+	scope := hd.opts.Scope(r)
+	if scope == nil {
+		return nil, nil
+	}
+	key, err := hd.hub(r).KeyFilter(data)
+	if err != nil {
+		return nil, err
+	}
+	return dbflex.And(key, scope), nil
+}
+
+// mustExist returns datahub.ErrNotFound when no record of data matches where
+func (hd *handler) mustExist(r *http.Request, data orm.DataModel, where *dbflex.Filter) error {
+	n, err := hd.hub(r).Count(hd.newModel(), dbflex.NewQueryParam().SetWhere(where))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("fail %s: %w", data.TableName(), datahub.ErrNotFound)
+	}
+	return nil
+}
+
+func (hd *handler) writeData(w http.ResponseWriter, r *http.Request, action string, status int, data interface{}) {
+	var fields []string
+	if hd.opts.Fields != nil {
+		fields = hd.opts.Fields(r, action)
+	}
+	if len(fields) > 0 {
+		filtered, err := filterFields(data, fields)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		data = filtered
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// filterFields keep only given fields of a record or list of records
+func filterFields(data interface{}, fields []string) (interface{}, error) {
+	bs, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	pick := func(m toolkit.M) toolkit.M {
+		res := toolkit.M{}
+		for _, f := range fields {
+			if v, ok := m[f]; ok {
+				res[f] = v
+			}
+		}
+		return res
+	}
+
+	if reflect.Indirect(reflect.ValueOf(data)).Kind() == reflect.Slice {
+		list := []toolkit.M{}
+		if err = json.Unmarshal(bs, &list); err != nil {
+			return nil, err
+		}
+		for i, m := range list {
+			list[i] = pick(m)
+		}
+		return list, nil
+	}
+	m := toolkit.M{}
+	if err = json.Unmarshal(bs, &m); err != nil {
+		return nil, err
+	}
+	return pick(m), nil
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(toolkit.M{"error": err.Error()})
+}
+
+func statusOf(err error) int {
+	var (
+		gerr *datahub.GuardError
+		verr *datahub.ValidationError
+		cerr *datahub.ConstraintError
+		nerr *datahub.ConnectionError
+	)
+	switch {
+	case errors.As(err, &verr), errors.As(err, &gerr):
+		return http.StatusBadRequest
+	case errors.Is(err, datahub.ErrNotFound), errors.Is(err, io.EOF):
+		return http.StatusNotFound
+	case errors.Is(err, datahub.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, datahub.ErrNotSupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, datahub.ErrReadOnly):
+		return http.StatusForbidden
+	case errors.Is(err, datahub.ErrDuplicateKey), errors.As(err, &cerr):
+		return http.StatusConflict
+	case errors.As(err, &nerr):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, datahub.ErrRateLimited), errors.Is(err, datahub.ErrShed):
+		return http.StatusTooManyRequests
+	}
+	msg := strings.ToLower(err.Error())
+	if strings.Contains(msg, "not found") || strings.Contains(msg, "eof") || strings.Contains(msg, "no rows") {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,231 @@
+package datahub
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"sync"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// IHub is common data operations of Hub, it is implemented by Hub and Router so application code does not need
+// to know which physical database a model lives in
+type IHub interface {
+	Save(data orm.DataModel) error
+	Insert(data orm.DataModel) error
+	Update(data orm.DataModel) error
+	UpdateField(data orm.DataModel, where *dbflex.Filter, fields ...string) error
+	Delete(data orm.DataModel) error
+	DeleteQuery(model orm.DataModel, where *dbflex.Filter) error
+	Get(data orm.DataModel) error
+	GetByID(data orm.DataModel, ids ...interface{}) error
+	GetByParm(data orm.DataModel, parm *dbflex.QueryParam) error
+	Gets(data orm.DataModel, parm *dbflex.QueryParam, dest interface{}) error
+	Count(data orm.DataModel, qp *dbflex.QueryParam) (int, error)
+	PopulateByParm(tableName string, parm *dbflex.QueryParam, dest interface{}) error
+	SaveAny(name string, object interface{}) error
+	Close()
+}
+
+// ErrNoRoute is returned by Router when no hub is mapped to a table and router has no default hub
+var ErrNoRoute = errors.New("no hub is mapped to the table")
+
+type route struct {
+	pattern string
+	hub     *Hub
+}
+
+// Router route data operations to different hubs based on table name of the model, ie:
+//
+//	router := datahub.NewRouter().Map("logs*", coldHub).Default(hotHub)
+//	router.Save(&LogRecord{})
+//
+// Patterns are matched in the order they are mapped, using path.Match syntax, and are case insensitive
+type Router struct {
+	routes []route
+	def    *Hub
+	mtx    sync.RWMutex
+}
+
+// NewRouter create new router
+func NewRouter() *Router {
+	return new(Router)
+}
+
+// Map route tables matching pattern to h
+func (r *Router) Map(pattern string, h *Hub) *Router {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.routes = append(r.routes, route{strings.ToLower(pattern), h})
+	return r
+}
+
+// Default set hub for tables not matching any pattern
+func (r *Router) Default(h *Hub) *Router {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.def = h
+	return r
+}
+
+// HubFor returns hub of given table name
+func (r *Router) HubFor(tableName string) (*Hub, error) {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	name := strings.ToLower(tableName)
+	for _, rt := range r.routes {
+		if ok, _ := path.Match(rt.pattern, name); ok {
+			return rt.hub, nil
+		}
+	}
+	if r.def == nil {
+		return nil, ErrNoRoute
+	}
+	return r.def, nil
+}
+
+// HubOf returns hub of given model
+func (r *Router) HubOf(data orm.DataModel) (*Hub, error) {
+	return r.HubFor(data.TableName())
+}
+
+// Save save data using hub of the model
+func (r *Router) Save(data orm.DataModel) error {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return err
+	}
+	return h.Save(data)
+}
+
+// Insert insert data using hub of the model
+func (r *Router) Insert(data orm.DataModel) error {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return err
+	}
+	return h.Insert(data)
+}
+
+// Update update data using hub of the model
+func (r *Router) Update(data orm.DataModel) error {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return err
+	}
+	return h.Update(data)
+}
+
+// UpdateField update fields of data using hub of the model
+func (r *Router) UpdateField(data orm.DataModel, where *dbflex.Filter, fields ...string) error {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return err
+	}
+	return h.UpdateField(data, where, fields...)
+}
+
+// Delete delete data using hub of the model
+func (r *Router) Delete(data orm.DataModel) error {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return err
+	}
+	return h.Delete(data)
+}
+
+// DeleteQuery delete data based on filter using hub of the model
+func (r *Router) DeleteQuery(model orm.DataModel, where *dbflex.Filter) error {
+	h, err := r.HubOf(model)
+	if err != nil {
+		return err
+	}
+	return h.DeleteQuery(model, where)
+}
+
+// Get get data using hub of the model
+func (r *Router) Get(data orm.DataModel) error {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return err
+	}
+	return h.Get(data)
+}
+
+// GetByID get data by its ID using hub of the model
+func (r *Router) GetByID(data orm.DataModel, ids ...interface{}) error {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return err
+	}
+	return h.GetByID(data, ids...)
+}
+
+// GetByParm get single data using hub of the model
+func (r *Router) GetByParm(data orm.DataModel, parm *dbflex.QueryParam) error {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return err
+	}
+	return h.GetByParm(data, parm)
+}
+
+// Gets get data using hub of the model
+func (r *Router) Gets(data orm.DataModel, parm *dbflex.QueryParam, dest interface{}) error {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return err
+	}
+	return h.Gets(data, parm, dest)
+}
+
+// Count count data using hub of the model
+func (r *Router) Count(data orm.DataModel, qp *dbflex.QueryParam) (int, error) {
+	h, err := r.HubOf(data)
+	if err != nil {
+		return 0, err
+	}
+	return h.Count(data, qp)
+}
+
+// PopulateByParm populate data of the table using its hub
+func (r *Router) PopulateByParm(tableName string, parm *dbflex.QueryParam, dest interface{}) error {
+	h, err := r.HubFor(tableName)
+	if err != nil {
+		return err
+	}
+	return h.PopulateByParm(tableName, parm, dest)
+}
+
+// SaveAny save object into the table using its hub
+func (r *Router) SaveAny(name string, object interface{}) error {
+	h, err := r.HubFor(name)
+	if err != nil {
+		return err
+	}
+	return h.SaveAny(name, object)
+}
+
+// Close close all hubs of the router
+func (r *Router) Close() {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	hubs := []*Hub{r.def}
+	for _, rt := range r.routes {
+		hubs = append(hubs, rt.hub)
+	}
+	closed := map[*Hub]bool{}
+	for _, h := range hubs {
+		if h != nil && !closed[h] {
+			closed[h] = true
+			h.Close()
+		}
+	}
+}
+
+var (
+	_ IHub = new(Hub)
+	_ IHub = new(Router)
+)
@@ -0,0 +1,328 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+)
+
+// ShardReplicas is number of points of each shard on the hash ring
+var ShardReplicas = 128
+
+// ShardedHub spread records of a model over several hubs. Writes and key based reads are routed to a shard using
+// consistent hashing of the shard key, other queries are run on all shards and the results are merged
+type ShardedHub struct {
+	shards []*Hub
+	keyFn  func(data orm.DataModel) string
+	ring   []uint32
+	owners map[uint32]int
+	merge  MergeStrategy
+}
+
+// NewShardedHub create sharded hub. keyFn returns shard key of a model, when it is nil value of fields tagged
+// with key:"1" is used. Empty key of new record is generated using ID generator of the first shard before routing
+func NewShardedHub(shards []*Hub, keyFn func(data orm.DataModel) string) *ShardedHub {
+	s := &ShardedHub{shards: shards, keyFn: keyFn, owners: map[uint32]int{}}
+	for i := range shards {
+		for r := 0; r < ShardReplicas; r++ {
+			p := hashKey(strconv.Itoa(i) + "#" + strconv.Itoa(r))
+			if _, ok := s.owners[p]; ok {
+				continue
+			}
+			s.owners[p] = i
+			s.ring = append(s.ring, p)
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i] < s.ring[j] })
+	return s
+}
+
+func hashKey(key string) uint32 {
+	f := fnv.New32a()
+	f.Write([]byte(key))
+	return f.Sum32()
+}
+
+// Shards returns hubs of the sharded hub
+func (s *ShardedHub) Shards() []*Hub {
+	return s.shards
+}
+
+// ShardFor returns hub for given shard key
+func (s *ShardedHub) ShardFor(key string) *Hub {
+	if len(s.ring) == 0 {
+		return nil
+	}
+	p := hashKey(key)
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i] >= p })
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.shards[s.owners[s.ring[i]]]
+}
+
+// ShardOf returns hub of given model. Error is returned when the shard key is empty, ie: key field is not set or the
+// model has no key field, rather than routing all of such records to the same shard
+func (s *ShardedHub) ShardOf(data orm.DataModel) (*Hub, error) {
+	if len(s.shards) == 0 {
+		return nil, errors.New("sharded hub has no shard")
+	}
+	if s.keyFn != nil {
+		key := s.keyFn(data)
+		if key == "" {
+			return nil, errors.New("shard key is empty")
+		}
+		return s.ShardFor(key), nil
+	}
+
+	ids := keyValues(data)
+	if len(ids) == 0 {
+		return nil, errors.New("shard key is empty: model has no key field")
+	}
+	for _, id := range ids {
+		if v := reflect.ValueOf(id); !v.IsValid() || v.IsZero() {
+			return nil, errors.New("shard key is empty: key field is not set")
+		}
+	}
+	return s.ShardFor(fmt.Sprintf("%v", ids)), nil
+}
+
+// shardOfNew returns hub of new record, generating its id first using ID generators of the shards, so record having
+// generated id is routed by that id
+func (s *ShardedHub) shardOfNew(data orm.DataModel) (*Hub, error) {
+	if len(s.shards) == 0 {
+		return nil, errors.New("sharded hub has no shard")
+	}
+	data.SetThis(data)
+	if err := s.shards[0].generateIDs("", data); err != nil {
+		return nil, fmt.Errorf("unable to generate id. %w", err)
+	}
+	return s.ShardOf(data)
+}
+
+// fanOut run fn for every shard concurrently and returns first error
+func (s *ShardedHub) fanOut(fn func(i int, h *Hub) error) error {
+	errs := make([]error, len(s.shards))
+	wg := new(sync.WaitGroup)
+	for i, h := range s.shards {
+		wg.Add(1)
+		go func(i int, h *Hub) {
+			defer wg.Done()
+			errs[i] = fn(i, h)
+		}(i, h)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("shard %d. %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Save save data into its shard
+func (s *ShardedHub) Save(data orm.DataModel) error {
+	h, err := s.shardOfNew(data)
+	if err != nil {
+		return err
+	}
+	return h.Save(data)
+}
+
+// Insert insert data into its shard
+func (s *ShardedHub) Insert(data orm.DataModel) error {
+	h, err := s.shardOfNew(data)
+	if err != nil {
+		return err
+	}
+	return h.Insert(data)
+}
+
+// Update update data on its shard
+func (s *ShardedHub) Update(data orm.DataModel) error {
+	h, err := s.ShardOf(data)
+	if err != nil {
+		return err
+	}
+	return h.Update(data)
+}
+
+// UpdateField update fields of records matching the filter on all shards
+func (s *ShardedHub) UpdateField(data orm.DataModel, where *dbflex.Filter, fields ...string) error {
+	return s.fanOut(func(_ int, h *Hub) error {
+		return h.UpdateField(data, where, fields...)
+	})
+}
+
+// Delete delete data from its shard
+func (s *ShardedHub) Delete(data orm.DataModel) error {
+	h, err := s.ShardOf(data)
+	if err != nil {
+		return err
+	}
+	return h.Delete(data)
+}
+
+// DeleteQuery delete records matching the filter on all shards
+func (s *ShardedHub) DeleteQuery(model orm.DataModel, where *dbflex.Filter) error {
+	return s.fanOut(func(_ int, h *Hub) error {
+		return h.DeleteQuery(model, where)
+	})
+}
+
+// Get get data from its shard, shard key need to be derivable from ID of the data
+func (s *ShardedHub) Get(data orm.DataModel) error {
+	h, err := s.ShardOf(data)
+	if err != nil {
+		return err
+	}
+	return h.Get(data)
+}
+
+// GetByID get data by its ID from its shard
+func (s *ShardedHub) GetByID(data orm.DataModel, ids ...interface{}) error {
+	data.SetThis(data)
+	data.SetID(ids...)
+	return s.Get(data)
+}
+
+// GetByParm query all shards and returns first record following sort of the parm
+func (s *ShardedHub) GetByParm(data orm.DataModel, parm *dbflex.QueryParam) error {
+	if parm == nil {
+		parm = dbflex.NewQueryParam()
+	}
+	p := *parm
+	p.Take = 1
+	res := reflect.New(reflect.SliceOf(reflect.TypeOf(data)))
+	if err := s.Gets(data, &p, res.Interface()); err != nil {
+		return err
+	}
+	if res.Elem().Len() == 0 {
+		return io.EOF
+	}
+	reflect.ValueOf(data).Elem().Set(res.Elem().Index(0).Elem())
+	return nil
+}
+
+// Gets query all shards and merge the results following merge strategy of the hub, then skip and take are applied
+func (s *ShardedHub) Gets(data orm.DataModel, parm *dbflex.QueryParam, dest interface{}) error {
+	return s.gather(data.TableName(), parm, dest, func(h *Hub, p *dbflex.QueryParam, res interface{}) error {
+		return h.Gets(data, p, res)
+	})
+}
+
+// PopulateByParm query the table on all shards and merge the results, see Gets. When parm has aggregates, partial
+// aggregates of each shard are recombined per group, dest could be pointer to []toolkit.M or slice of struct
+func (s *ShardedHub) PopulateByParm(tableName string, parm *dbflex.QueryParam, dest interface{}) error {
+	return s.gather(tableName, parm, dest, func(h *Hub, p *dbflex.QueryParam, res interface{}) error {
+		return h.PopulateByParm(tableName, p, res)
+	})
+}
+
+// gather run fn on every shard and merge the results. Query guards of the first shard are applied to the whole query,
+// fn is called with hub of the shard which does not apply them again, as each shard need to return skip+take records
+func (s *ShardedHub) gather(tableName string, parm *dbflex.QueryParam, dest interface{},
+	fn func(h *Hub, p *dbflex.QueryParam, res interface{}) error) error {
+	rv := reflect.ValueOf(dest)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("dest should be pointer to slice")
+	}
+	sliceType := rv.Elem().Type()
+	if len(s.shards) == 0 {
+		return errors.New("sharded hub has no shard")
+	}
+	parm, err := s.shards[0].guardQuery("gets", tableName, parm)
+	if err != nil {
+		return err
+	}
+	run := fn
+	fn = func(h *Hub, p *dbflex.QueryParam, res interface{}) error {
+		return run(h.internal(), p, res)
+	}
+	if len(parm.Aggregates) > 0 {
+		return s.gatherAggregate(parm, dest, fn)
+	}
+
+	// every shard need to return skip+take records to get correct page after merging
+	p := *parm
+	p.Skip = 0
+	if parm.Take > 0 {
+		p.Take = parm.Skip + parm.Take
+	}
+
+	results := make([]reflect.Value, len(s.shards))
+	err = s.fanOut(func(i int, h *Hub) error {
+		res := reflect.New(sliceType)
+		if err := fn(h, &p, res.Interface()); err != nil {
+			return err
+		}
+		results[i] = res.Elem()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	merged := reflect.MakeSlice(sliceType, 0, 0)
+	for _, res := range results {
+		merged = reflect.AppendSlice(merged, res)
+	}
+	if s.merge == MergeSort {
+		sortRecords(merged, parm.Sort)
+	}
+
+	from, to := parm.Skip, merged.Len()
+	if from > to {
+		from = to
+	}
+	if parm.Take > 0 && from+parm.Take < to {
+		to = from + parm.Take
+	}
+	rv.Elem().Set(merged.Slice(from, to))
+	return nil
+}
+
+// Count returns sum of count of all shards
+func (s *ShardedHub) Count(data orm.DataModel, qp *dbflex.QueryParam) (int, error) {
+	counts := make([]int, len(s.shards))
+	err := s.fanOut(func(i int, h *Hub) error {
+		n, err := h.Count(data, qp)
+		counts[i] = n
+		return err
+	})
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total, err
+}
+
+// SaveAny save object into its shard, object need to be orm.DataModel so its shard key can be resolved
+func (s *ShardedHub) SaveAny(name string, object interface{}) error {
+	data, ok := object.(orm.DataModel)
+	if !ok {
+		return fmt.Errorf("fail SaveAny: object should be orm.DataModel. %w", ErrNotSupported)
+	}
+	h, err := s.ShardOf(data)
+	if err != nil {
+		return err
+	}
+	return h.SaveAny(name, object)
+}
+
+// Close close all shards
+func (s *ShardedHub) Close() {
+	for _, h := range s.shards {
+		h.Close()
+	}
+}
+
+var _ IHub = new(ShardedHub)
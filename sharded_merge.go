@@ -0,0 +1,172 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"git.kanosolution.net/kano/dbflex"
+	"git.kanosolution.net/kano/dbflex/orm"
+	"github.com/eaciit/toolkit"
+)
+
+// MergeStrategy define how results of shards are merged by ShardedHub
+type MergeStrategy int
+
+const (
+	// MergeSort sort merged records by sort of the parm. Each shard is asked for skip+take records only
+	// so paging return correct result without reading whole table. This is the default
+	MergeSort MergeStrategy = iota
+	// MergeConcat append records following order of the shards without sorting, each shard is still limited to skip+take
+	MergeConcat
+)
+
+// SetMergeStrategy set how results of shards are merged. Query with aggregates is always recombined per group,
+// see PopulateByParm
+func (s *ShardedHub) SetMergeStrategy(m MergeStrategy) *ShardedHub {
+	s.merge = m
+	return s
+}
+
+// Sum returns sum of field of records matching the filter on all shards
+func (s *ShardedHub) Sum(data orm.DataModel, field string, where *dbflex.Filter) (float64, error) {
+	parm := dbflex.NewQueryParam().SetAggr(dbflex.NewAggrItem("total", dbflex.AggrSum, field))
+	if where != nil {
+		parm = parm.SetWhere(where)
+	}
+	res := []toolkit.M{}
+	if err := s.PopulateByParm(data.TableName(), parm, &res); err != nil {
+		return 0, err
+	}
+	if len(res) == 0 {
+		return 0, nil
+	}
+	total, _ := toFloat(res[0]["total"])
+	return total, nil
+}
+
+// gatherAggregate run aggregate query on all shards and recombine partial aggregates of each group.
+// Sum and count are added, min and max are compared, avg is recomputed from sum and count of each shard
+func (s *ShardedHub) gatherAggregate(parm *dbflex.QueryParam, dest interface{},
+	fn func(h *Hub, p *dbflex.QueryParam, res interface{}) error) error {
+	p := *parm
+	p.Skip, p.Take, p.Sort = 0, 0, nil
+	p.Aggregates = []*dbflex.AggrItem{}
+	for _, a := range parm.Aggregates {
+		alias := aggrAlias(a)
+		if a.Op == dbflex.AggrAvr {
+			p.Aggregates = append(p.Aggregates,
+				dbflex.NewAggrItem(alias+"_datahubsum", dbflex.AggrSum, a.Field),
+				dbflex.NewAggrItem(alias+"_datahubcount", dbflex.AggrCount, a.Field))
+			continue
+		}
+		p.Aggregates = append(p.Aggregates, a)
+	}
+
+	results := make([][]toolkit.M, len(s.shards))
+	err := s.fanOut(func(i int, h *Hub) error {
+		return fn(h, &p, &results[i])
+	})
+	if err != nil {
+		return err
+	}
+
+	groups := map[string]toolkit.M{}
+	keys := []string{}
+	for _, rows := range results {
+		for _, row := range rows {
+			values := groupValues(row, parm.GroupBy)
+			k := groupKeyOf(values, parm.GroupBy)
+			acc, ok := groups[k]
+			if !ok {
+				acc = toolkit.M{}
+				for _, g := range parm.GroupBy {
+					acc[g] = values[g]
+				}
+				groups[k] = acc
+				keys = append(keys, k)
+			}
+			for _, a := range p.Aggregates {
+				alias := aggrAlias(a)
+				acc[alias] = mergeAggr(a.Op, acc[alias], row[alias])
+			}
+		}
+	}
+
+	merged := make([]toolkit.M, 0, len(keys))
+	for _, k := range keys {
+		acc := groups[k]
+		for _, a := range parm.Aggregates {
+			if a.Op != dbflex.AggrAvr {
+				continue
+			}
+			alias := aggrAlias(a)
+			sum, _ := toFloat(acc[alias+"_datahubsum"])
+			count, _ := toFloat(acc[alias+"_datahubcount"])
+			if count > 0 {
+				acc[alias] = sum / count
+			} else {
+				acc[alias] = nil
+			}
+			delete(acc, alias+"_datahubsum")
+			delete(acc, alias+"_datahubcount")
+		}
+		merged = append(merged, acc)
+	}
+
+	mv := reflect.ValueOf(merged)
+	sortRecords(mv, parm.Sort)
+	from, to := parm.Skip, len(merged)
+	if from > to {
+		from = to
+	}
+	if parm.Take > 0 && from+parm.Take < to {
+		to = from + parm.Take
+	}
+	merged = merged[from:to]
+
+	if ms, ok := dest.(*[]toolkit.M); ok {
+		*ms = merged
+		return nil
+	}
+	return toolkit.Serde(merged, dest, "")
+}
+
+func aggrAlias(a *dbflex.AggrItem) string {
+	if a.Alias != "" {
+		return a.Alias
+	}
+	return a.Field
+}
+
+func groupKeyOf(row toolkit.M, fields []string) string {
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = fmt.Sprintf("%v", row[f])
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func mergeAggr(op dbflex.AggrOp, acc, v interface{}) interface{} {
+	if acc == nil {
+		return v
+	}
+	if v == nil {
+		return acc
+	}
+	switch op {
+	case dbflex.AggrSum, dbflex.AggrCount:
+		a, _ := toFloat(acc)
+		b, _ := toFloat(v)
+		return a + b
+	case dbflex.AggrMin:
+		if compareValues(v, acc) < 0 {
+			return v
+		}
+	case dbflex.AggrMax:
+		if compareValues(v, acc) > 0 {
+			return v
+		}
+	}
+	return acc
+}
@@ -0,0 +1,376 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"git.kanosolution.net/kano/dbflex"
+)
+
+// driverName returns last part of package path of the connection type, ie: flexpg, flexmgo, flexmysql
+func driverName(conn dbflex.IConnection) string {
+	if conn == nil {
+		return ""
+	}
+	for {
+		w, ok := conn.(interface{ Unwrap() dbflex.IConnection })
+		if !ok {
+			break
+		}
+		conn = w.Unwrap()
+	}
+	t := reflect.TypeOf(conn)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	paths := strings.Split(t.PkgPath(), "/")
+	return strings.ToLower(paths[len(paths)-1])
+}
+
+// isSQLDriver returns true if connection is backed by SQL database
+func isSQLDriver(conn dbflex.IConnection) bool {
+	name := driverName(conn)
+	return name != "" && !strings.Contains(name, "mgo") && !strings.Contains(name, "mongo")
+}
+
+// sqlLiteral convert a value into sql literal of the driver. String is quoted based on the driver: mysql treats
+// backslash as escape character so it is escaped, NUL is written using char(0) on sqlite as the statement would be
+// cut on it, other drivers reject NUL inside the statement
+func sqlLiteral(driver string, v interface{}) string {
+	switch o := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return sqlString(driver, o)
+	case bool:
+		if o {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		return "'" + o.Format("2006-01-02 15:04:05.999999-07:00") + "'"
+	case *time.Time:
+		if o == nil {
+			return "NULL"
+		}
+		return sqlLiteral(driver, *o)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("%v", o)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "NULL"
+		}
+		return sqlLiteral(driver, rv.Elem().Interface())
+	}
+	return sqlLiteral(driver, fmt.Sprintf("%v", v))
+}
+
+func sqlString(driver, s string) string {
+	switch {
+	case strings.Contains(driver, "mysql"):
+		s = strings.NewReplacer("\\", "\\\\", "'", "''", "\x00", "\\0").Replace(s)
+	case strings.Contains(driver, "sqlite"):
+		s = strings.ReplaceAll(s, "'", "''")
+		if strings.Contains(s, "\x00") {
+			return "('" + strings.ReplaceAll(s, "\x00", "' || char(0) || '") + "')"
+		}
+	default:
+		s = strings.ReplaceAll(s, "'", "''")
+	}
+	return "'" + s + "'"
+}
+
+func sqlLiterals(driver string, v interface{}) []string {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return []string{sqlLiteral(driver, v)}
+	}
+	res := make([]string, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		res[i] = sqlLiteral(driver, rv.Index(i).Interface())
+	}
+	return res
+}
+
+// sqlWhere translate dbflex filter into sql where clause (without WHERE keyword)
+func sqlWhere(driver string, f *dbflex.Filter) (string, error) {
+	return sqlWhereFn(driver, f, nil)
+}
+
+// sqlWhereFn translate dbflex filter into sql where clause, fieldFn is used to translate field name into
+// sql expression, ie: aggregate alias on having clause. Field names are written as is, so they are rejected when
+// they are not identifier
+func sqlWhereFn(driver string, f *dbflex.Filter, fieldFn func(string) string) (string, error) {
+	if f == nil {
+		return "", nil
+	}
+	if f.Field != "" {
+		if err := checkFieldName(f.Field); err != nil {
+			return "", err
+		}
+	}
+	if fieldFn != nil && f.Field != "" {
+		mapped := *f
+		mapped.Field = fieldFn(f.Field)
+		f = &mapped
+	}
+
+	switch f.Op {
+	case dbflex.OpAnd, dbflex.OpOr:
+		parts := []string{}
+		for _, item := range f.Items {
+			s, e := sqlWhereFn(driver, item, fieldFn)
+			if e != nil {
+				return "", e
+			}
+			if s != "" {
+				parts = append(parts, "("+s+")")
+			}
+		}
+		if f.Op == dbflex.OpAnd {
+			return strings.Join(parts, " AND "), nil
+		}
+		return strings.Join(parts, " OR "), nil
+
+	case dbflex.OpNot:
+		if len(f.Items) == 0 {
+			return "", nil
+		}
+		s, e := sqlWhereFn(driver, f.Items[0], fieldFn)
+		if e != nil {
+			return "", e
+		}
+		return "NOT (" + s + ")", nil
+
+	case dbflex.OpEq:
+		if f.Value == nil {
+			return f.Field + " IS NULL", nil
+		}
+		return f.Field + " = " + sqlLiteral(driver, f.Value), nil
+
+	case dbflex.OpNe:
+		if f.Value == nil {
+			return f.Field + " IS NOT NULL", nil
+		}
+		return f.Field + " <> " + sqlLiteral(driver, f.Value), nil
+
+	case dbflex.OpGt:
+		return f.Field + " > " + sqlLiteral(driver, f.Value), nil
+
+	case dbflex.OpGte:
+		return f.Field + " >= " + sqlLiteral(driver, f.Value), nil
+
+	case dbflex.OpLt:
+		return f.Field + " < " + sqlLiteral(driver, f.Value), nil
+
+	case dbflex.OpLte:
+		return f.Field + " <= " + sqlLiteral(driver, f.Value), nil
+
+	case dbflex.OpIn, dbflex.OpNin:
+		values := sqlLiterals(driver, f.Value)
+		if len(values) == 0 {
+			if f.Op == dbflex.OpIn {
+				return "1 = 0", nil
+			}
+			return "1 = 1", nil
+		}
+		if f.Op == dbflex.OpIn {
+			return f.Field + " IN (" + strings.Join(values, ", ") + ")", nil
+		}
+		return f.Field + " NOT IN (" + strings.Join(values, ", ") + ")", nil
+
+	case dbflex.OpRange:
+		values := sqlLiterals(driver, f.Value)
+		if len(values) != 2 {
+			return "", fmt.Errorf("range filter on %s need 2 values", f.Field)
+		}
+		return f.Field + " BETWEEN " + values[0] + " AND " + values[1], nil
+
+	case dbflex.OpContains:
+		parts := []string{}
+		for _, v := range mongoValues(f.Value) {
+			parts = append(parts, sqlLike(driver, f.Field, "%", v, "%"))
+		}
+		return strings.Join(parts, " OR "), nil
+
+	case dbflex.OpStartWith:
+		return sqlLike(driver, f.Field, "", f.Value, "%"), nil
+
+	case dbflex.OpEndWith:
+		return sqlLike(driver, f.Field, "%", f.Value, ""), nil
+	}
+
+	return "", fmt.Errorf("filter operator %s is not supported", f.Op)
+}
+
+var sqlLikeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// sqlLike returns LIKE condition of field matching prefix + v + suffix. % and _ of v are matched as is, and the
+// match is case insensitive, same with regex filter of mongo
+func sqlLike(driver, field, prefix string, v interface{}, suffix string) string {
+	pattern := prefix + sqlLikeEscaper.Replace(fmt.Sprintf("%v", indirectValue(v))) + suffix
+	return "LOWER(" + field + ") LIKE LOWER(" + sqlString(driver, pattern) + ") ESCAPE '!'"
+}
+
+// sqlOrderBy translate dbflex sort fields (prefixed by - for descending) into sql order by clause
+func sqlOrderBy(sorts []string) (string, error) {
+	parts := make([]string, len(sorts))
+	for i, s := range sorts {
+		field, dir := s, ""
+		if strings.HasPrefix(s, "-") {
+			field, dir = s[1:], " DESC"
+		}
+		if err := checkFieldName(field); err != nil {
+			return "", err
+		}
+		parts[i] = field + dir
+	}
+	return strings.Join(parts, ", "), nil
+}
+
+// sqlSelect build select statement based on table name and query parameter
+func sqlSelect(driver, tableName string, parm *dbflex.QueryParam) (string, error) {
+	return sqlSelectFrom(driver, tableName, parm)
+}
+
+// sqlSelectFrom build select statement based on from clause (table name with its joins) and query parameter
+func sqlSelectFrom(driver, from string, parm *dbflex.QueryParam) (string, error) {
+	return sqlSelectExtra(driver, from, parm, "")
+}
+
+// sqlSelectExtra build select statement with additional sql condition combined with filter of query parameter
+func sqlSelectExtra(driver, from string, parm *dbflex.QueryParam, extra string) (string, error) {
+	if parm == nil {
+		parm = dbflex.NewQueryParam()
+	}
+
+	fields := "*"
+	if len(parm.Select) > 0 {
+		for _, f := range parm.Select {
+			if err := checkFieldName(f); err != nil {
+				return "", err
+			}
+		}
+		fields = strings.Join(parm.Select, ", ")
+	}
+	sql := "SELECT " + fields + " FROM " + from
+
+	where, e := sqlWhere(driver, parm.Where)
+	if e != nil {
+		return "", e
+	}
+	switch {
+	case where != "" && extra != "":
+		sql += " WHERE (" + where + ") AND (" + extra + ")"
+	case where != "":
+		sql += " WHERE " + where
+	case extra != "":
+		sql += " WHERE " + extra
+	}
+	if len(parm.Sort) > 0 {
+		orderBy, e := sqlOrderBy(parm.Sort)
+		if e != nil {
+			return "", e
+		}
+		sql += " ORDER BY " + orderBy
+	}
+	if parm.Take > 0 {
+		sql += fmt.Sprintf(" LIMIT %d", parm.Take)
+	}
+	if parm.Skip > 0 {
+		sql += fmt.Sprintf(" OFFSET %d", parm.Skip)
+	}
+	return sql, nil
+}
+
+// sqlAggrExpr translate aggregate item into sql expression (without alias)
+func sqlAggrExpr(a *dbflex.AggrItem) string {
+	switch a.Op {
+	case dbflex.AggrSum:
+		return "SUM(" + a.Field + ")"
+	case dbflex.AggrAvr:
+		return "AVG(" + a.Field + ")"
+	case dbflex.AggrMin:
+		return "MIN(" + a.Field + ")"
+	case dbflex.AggrMax:
+		return "MAX(" + a.Field + ")"
+	case dbflex.AggrCount:
+		return "COUNT(*)"
+	}
+	return strings.ToUpper(strings.TrimPrefix(string(a.Op), "$")) + "(" + a.Field + ")"
+}
+
+// sqlAggregate build select statement with group by and aggregate, having filter could refer to aggregate alias
+func sqlAggregate(driver, tableName string, parm *dbflex.QueryParam, having *dbflex.Filter) (string, error) {
+	exprs := map[string]string{}
+	for _, g := range parm.GroupBy {
+		if err := checkFieldName(g); err != nil {
+			return "", err
+		}
+	}
+	fields := append([]string{}, parm.GroupBy...)
+	for _, a := range parm.Aggregates {
+		if a.Op != dbflex.AggrCount || (a.Field != "" && a.Field != "*") {
+			if err := checkFieldName(a.Field); err != nil {
+				return "", err
+			}
+		}
+		alias := a.Alias
+		if alias == "" {
+			alias = a.Field
+		}
+		if err := checkFieldName(alias); err != nil {
+			return "", fmt.Errorf("invalid alias of %s. %w", a.Field, err)
+		}
+		exprs[alias] = sqlAggrExpr(a)
+		fields = append(fields, exprs[alias]+" AS "+alias)
+	}
+	if len(fields) == 0 {
+		fields = []string{"*"}
+	}
+
+	sql := "SELECT " + strings.Join(fields, ", ") + " FROM " + tableName
+	where, e := sqlWhere(driver, parm.Where)
+	if e != nil {
+		return "", e
+	}
+	if where != "" {
+		sql += " WHERE " + where
+	}
+	if len(parm.GroupBy) > 0 {
+		sql += " GROUP BY " + strings.Join(parm.GroupBy, ", ")
+	}
+
+	havingSQL, e := sqlWhereFn(driver, having, func(field string) string {
+		if expr, ok := exprs[field]; ok {
+			return expr
+		}
+		return field
+	})
+	if e != nil {
+		return "", e
+	}
+	if havingSQL != "" {
+		sql += " HAVING " + havingSQL
+	}
+
+	if len(parm.Sort) > 0 {
+		orderBy, e := sqlOrderBy(parm.Sort)
+		if e != nil {
+			return "", e
+		}
+		sql += " ORDER BY " + orderBy
+	}
+	if parm.Take > 0 {
+		sql += fmt.Sprintf(" LIMIT %d", parm.Take)
+	}
+	if parm.Skip > 0 {
+		sql += fmt.Sprintf(" OFFSET %d", parm.Skip)
+	}
+	return sql, nil
+}
@@ -0,0 +1,201 @@
+package datahub
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ValidateTag is struct tag holding validation rules separated by comma, supported rules are:
+// required, min=n, max=n, len=n (length for string, slice and map, value for number), email and oneof=a b c.
+// Unknown rules are ignored
+const ValidateTag = "validate"
+
+// Validator is implemented by model that need custom validation before being written
+type Validator interface {
+	Validate() error
+}
+
+// FieldError is validation error of a field
+type FieldError struct {
+	Field   string
+	Rule    string
+	Message string
+}
+
+// ValidationError is returned by Insert, Update and Save when model is not valid. It holds error of every invalid field
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		if fe.Field == "" {
+			msgs[i] = fe.Message
+		} else {
+			msgs[i] = fe.Field + ": " + fe.Message
+		}
+	}
+	return "validation error. " + strings.Join(msgs, "; ")
+}
+
+var emailRx = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
+
+// SetValidation enable or disable validation before Insert, Update and Save. Validation is enabled by default
+func (h *Hub) SetValidation(enable bool) *Hub {
+	h.skipValidation = !enable
+	return h
+}
+
+func (h *Hub) validate(data interface{}) error {
+	if h.skipValidation {
+		return nil
+	}
+	err := ValidateModel(data)
+	if len(h.enums) == 0 {
+		return err
+	}
+
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		verr = &ValidationError{}
+		if err != nil {
+			verr.Errors = append(verr.Errors, FieldError{Rule: "custom", Message: err.Error()})
+		}
+	}
+	h.validateEnums(data, verr)
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// ValidateModel validate data based on validate tag of its fields and its Validate method if it implements Validator
+func ValidateModel(data interface{}) error {
+	verr := &ValidationError{}
+	validateStruct(reflect.ValueOf(data), verr)
+
+	if v, ok := data.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			if ve, ok := err.(*ValidationError); ok {
+				verr.Errors = append(verr.Errors, ve.Errors...)
+			} else {
+				verr.Errors = append(verr.Errors, FieldError{Rule: "custom", Message: err.Error()})
+			}
+		}
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+func validateStruct(rv reflect.Value, verr *ValidationError) {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+
+	for _, f := range MetaOf(rv.Type()).Fields {
+		if f.Validate == "" || f.Validate == "-" {
+			continue
+		}
+		fv := f.Value(rv)
+		for _, rule := range strings.Split(f.Validate, ",") {
+			name, arg := rule, ""
+			if pos := strings.Index(rule, "="); pos >= 0 {
+				name, arg = rule[:pos], rule[pos+1:]
+			}
+			if msg := validateRule(fv, strings.TrimSpace(name), strings.TrimSpace(arg)); msg != "" {
+				verr.Errors = append(verr.Errors, FieldError{Field: f.Name, Rule: name, Message: msg})
+			}
+		}
+	}
+	validateEmbedded(rv, verr)
+}
+
+// validateEmbedded validate embedded pointer structs which are set, they are not part of metadata of the model
+func validateEmbedded(rv reflect.Value, verr *ValidationError) {
+	for i := 0; i < rv.NumField(); i++ {
+		sf := rv.Type().Field(i)
+		if !sf.Anonymous {
+			continue
+		}
+		fv := rv.Field(i)
+		switch {
+		case sf.Type.Kind() == reflect.Struct:
+			validateEmbedded(fv, verr)
+		case sf.Type.Kind() == reflect.Ptr && sf.Type.Elem().Kind() == reflect.Struct && sf.PkgPath == "" && !fv.IsNil():
+			validateStruct(fv, verr)
+		}
+	}
+}
+
+// validateRule returns error message, or empty string when value is valid
+func validateRule(fv reflect.Value, rule, arg string) string {
+	v := reflect.Indirect(fv)
+	switch rule {
+	case "required":
+		if !v.IsValid() || v.IsZero() {
+			return "is required"
+		}
+
+	case "min", "max", "len":
+		if !v.IsValid() {
+			return ""
+		}
+		limit, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return ""
+		}
+		var size float64
+		unit := ""
+		switch v.Kind() {
+		case reflect.String:
+			size, unit = float64(len([]rune(v.String()))), " characters"
+		case reflect.Slice, reflect.Map, reflect.Array:
+			size, unit = float64(v.Len()), " items"
+		default:
+			f, ok := toFloat(v.Interface())
+			if !ok {
+				return ""
+			}
+			size = f
+		}
+		switch {
+		case rule == "min" && size < limit:
+			return fmt.Sprintf("should be at least %s%s", arg, unit)
+		case rule == "max" && size > limit:
+			return fmt.Sprintf("should be at most %s%s", arg, unit)
+		case rule == "len" && size != limit:
+			return fmt.Sprintf("should be exactly %s%s", arg, unit)
+		}
+
+	case "email":
+		if v.IsValid() && v.Kind() == reflect.String && v.String() != "" && !emailRx.MatchString(v.String()) {
+			return "is not a valid email"
+		}
+
+	case "oneof":
+		if !v.IsValid() || v.IsZero() {
+			return ""
+		}
+		s := fmt.Sprintf("%v", v.Interface())
+		for _, opt := range strings.Fields(arg) {
+			if s == opt {
+				return ""
+			}
+		}
+		return "should be one of " + strings.Join(strings.Fields(arg), ", ")
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+// Package vaultsecret provide connection string of datahub.Hub from HashiCorp Vault
+//
+//	p := vaultsecret.New(client, vaultsecret.Options{
+//		Path:     "database/creds/app",
+//		Template: "postgres://{username}:{password}@db:5432/app?sslmode=disable",
+//	})
+//	err := h.UseConnStringProvider(p, datahub.ConnProviderOptions{})
+//
+// Credentials of dynamic secrets engines, such as database engine, expire with their lease, so the hub refreshes them
+// before lease duration is over. Secrets of KV engine (v1 and v2) are read every RefreshInterval
+package vaultsecret
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ariefdarmawan/datahub"
+	"github.com/hashicorp/vault/api"
+)
+
+// Options of the provider
+type Options struct {
+	// Path is path of the secret, ie: database/creds/app or secret/data/app
+	Path string
+	// Template is connection string having {field} placeholders replaced by fields of the secret. When it is empty
+	// the secret should have connection string on field named by Field
+	Template string
+	// Field is field holding connection string when Template is empty, default is connection_string
+	Field string
+	// RefreshInterval is how often secret without lease is read again, 0 means it is read once
+	RefreshInterval time.Duration
+}
+
+// Provider implements datahub.ConnStringProvider reading secret from Vault
+type Provider struct {
+	client *api.Client
+	opts   Options
+}
+
+// New create provider
+func New(client *api.Client, opts Options) *Provider {
+	if opts.Field == "" {
+		opts.Field = "connection_string"
+	}
+	return &Provider{client: client, opts: opts}
+}
+
+// ConnString read the secret and returns connection string and expiry of its lease
+func (p *Provider) ConnString() (string, time.Time, error) {
+	secret, err := p.client.Logical().Read(p.opts.Path)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to read %s. %w", p.opts.Path, err)
+	}
+	if secret == nil || secret.Data == nil {
+		return "", time.Time{}, fmt.Errorf("secret %s is not found", p.opts.Path)
+	}
+
+	data := secret.Data
+	// KV v2 wraps values of the secret in data field
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		data = inner
+	}
+
+	var connString string
+	if p.opts.Template != "" {
+		connString = datahub.ExpandConnString(p.opts.Template, data)
+	} else {
+		s, ok := data[p.opts.Field].(string)
+		if !ok || s == "" {
+			return "", time.Time{}, errors.New("secret has no " + p.opts.Field)
+		}
+		connString = s
+	}
+
+	var expiry time.Time
+	switch {
+	case secret.LeaseDuration > 0:
+		expiry = time.Now().Add(time.Duration(secret.LeaseDuration) * time.Second)
+	case p.opts.RefreshInterval > 0:
+		expiry = time.Now().Add(p.opts.RefreshInterval)
+	}
+	return connString, expiry, nil
+}
@@ -0,0 +1,47 @@
+// Package zerologger provides datahub.Logger backed by zerolog
+//
+//	h.SetLogger(zerologger.New(log.Logger))
+package zerologger
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog"
+)
+
+// Logger write datahub logs to zerolog.Logger
+type Logger struct {
+	l zerolog.Logger
+}
+
+// New create Logger
+func New(l zerolog.Logger) *Logger {
+	return &Logger{l: l}
+}
+
+// Debug write debug log
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	write(l.l.Debug(), msg, kv)
+}
+
+// Info write info log
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	write(l.l.Info(), msg, kv)
+}
+
+// Warn write warning log
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	write(l.l.Warn(), msg, kv)
+}
+
+// Error write error log
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	write(l.l.Error(), msg, kv)
+}
+
+func write(ev *zerolog.Event, msg string, kv []interface{}) {
+	for i := 0; i+1 < len(kv); i += 2 {
+		ev = ev.Interface(fmt.Sprintf("%v", kv[i]), kv[i+1])
+	}
+	ev.Msg(msg)
+}